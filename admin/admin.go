@@ -0,0 +1,246 @@
+// Package admin serves a read-only dashboard and JSON API over the request
+// log that the chat proxy writes.
+package admin
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"gopenbridge/config"
+	"gopenbridge/keys"
+	"gopenbridge/logstore"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const (
+	defaultLimit = 100
+	maxLimit     = 1000
+)
+
+// Handler serves the admin dashboard under /admin and its JSON API under
+// /admin/api.
+type Handler struct {
+	live   atomic.Pointer[config.Config] // swapped by Reload
+	logs   logstore.Store
+	keys   *keys.Store
+	models ModelSource
+	mux    *http.ServeMux
+}
+
+// New returns the dashboard handler over logs, opening the database at
+// cfg.DBPath for virtual keys. models serves the upstream model lists.
+func New(cfg *config.Config, logs logstore.Store, models ModelSource) (*Handler, error) {
+	db, err := sql.Open("sqlite3", cfg.DBPath)
+	if err != nil {
+		return nil, err
+	}
+	store, err := keys.NewStore(db)
+	if err != nil {
+		return nil, err
+	}
+	h := &Handler{logs: logs, keys: store, models: models, mux: http.NewServeMux()}
+	h.live.Store(cfg)
+	h.mux.HandleFunc("GET /admin", h.list)
+	h.mux.HandleFunc("GET /admin/logs/{id}", h.detail)
+	h.mux.HandleFunc("GET /admin/api/logs", h.apiLogs)
+	h.mux.HandleFunc("GET /admin/api/logs/{id}", h.apiLog)
+	h.mux.HandleFunc("GET /admin/api/usage", h.apiUsage)
+	h.mux.HandleFunc("GET /admin/api/export", h.apiExport)
+	h.mux.HandleFunc("GET /admin/api/keys", h.apiKeys)
+	h.mux.HandleFunc("POST /admin/api/keys", h.apiCreateKey)
+	h.mux.HandleFunc("DELETE /admin/api/keys/{name}", h.apiRevokeKey)
+	h.mux.HandleFunc("GET /admin/api/models", h.apiModels)
+	h.mux.HandleFunc("POST /admin/api/models/refresh", h.apiRefreshModels)
+	return h, nil
+}
+
+// cfg returns the current configuration.
+func (h *Handler) cfg() *config.Config {
+	return h.live.Load()
+}
+
+// Reload applies cfg, such as new prices and admin keys, to subsequent
+// requests.
+func (h *Handler) Reload(cfg *config.Config) error {
+	h.live.Store(cfg)
+	return nil
+}
+
+// ServeHTTP satisfies http.Handler. Every page and API call needs a key
+// from auth_keys once the proxy has any keys, since the log holds prompts
+// and responses.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if status, msg := h.authorize(r); status != 0 {
+		// Browsers prompt for Basic credentials, the key being the password
+		w.Header().Set("WWW-Authenticate", `Basic realm="gopenbridge admin"`)
+		writeJSONError(w, status, msg)
+		return
+	}
+	h.mux.ServeHTTP(w, r)
+}
+
+// authorize checks r for a key from auth_keys, in x-api-key, as a bearer
+// token or as the Basic auth password. It returns 0 when r may proceed, or
+// the status and message to refuse it with. The dashboard is open while no
+// keys are configured and closed when only virtual keys are, since those
+// are not admin keys.
+func (h *Handler) authorize(r *http.Request) (int, string) {
+	static := h.cfg().AuthKeys
+	if len(static) == 0 {
+		active, err := h.keys.Active(r.Context())
+		if err != nil {
+			slog.Error("Failed to load virtual keys", "error", err)
+			return http.StatusInternalServerError, "failed to load keys"
+		}
+		if active {
+			return http.StatusForbidden, "configure auth_keys to use the admin dashboard"
+		}
+		return 0, ""
+	}
+	key := keys.FromRequest(r)
+	if _, password, ok := r.BasicAuth(); ok && key == "" {
+		key = password
+	}
+	if !keys.MatchStatic(key, static) {
+		return http.StatusUnauthorized, "a key from auth_keys is required"
+	}
+	return 0, ""
+}
+
+// parseFilter reads list filters from query parameters. Times accept
+// RFC 3339 or the browser's datetime-local format, interpreted as UTC.
+func parseFilter(q url.Values) (logstore.Filter, error) {
+	f := logstore.Filter{Model: q.Get("model"), Key: q.Get("key"), UpstreamKey: q.Get("upstream_key"), UserID: q.Get("user_id"), Limit: defaultLimit}
+	if v := q.Get("status"); v != "" {
+		s, err := strconv.Atoi(v)
+		if err != nil {
+			return f, errors.New("status must be an integer")
+		}
+		f.Status = s
+	}
+	for _, p := range []struct {
+		key string
+		dst *time.Time
+	}{{"since", &f.Since}, {"until", &f.Until}} {
+		if v := q.Get(p.key); v != "" {
+			t, err := parseTime(v)
+			if err != nil {
+				return f, errors.New(p.key + " must be an RFC 3339 time")
+			}
+			*p.dst = t
+		}
+	}
+	if v := q.Get("limit"); v != "" {
+		l, err := strconv.Atoi(v)
+		if err != nil || l < 1 {
+			return f, errors.New("limit must be a positive integer")
+		}
+		f.Limit = min(l, maxLimit)
+	}
+	if v := q.Get("offset"); v != "" {
+		o, err := strconv.Atoi(v)
+		if err != nil || o < 0 {
+			return f, errors.New("offset must be a non-negative integer")
+		}
+		f.Offset = o
+	}
+	return f, nil
+}
+
+// parseTime accepts RFC 3339 or datetime-local values.
+func parseTime(v string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02T15:04", v)
+}
+
+// list renders recent log rows matching the filter.
+func (h *Handler) list(w http.ResponseWriter, r *http.Request) {
+	f, err := parseFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	rows, err := h.logs.QueryLogs(r.Context(), f)
+	if err != nil {
+		slog.Error("Failed to query api_logs", "error", err)
+		http.Error(w, "failed to query logs", http.StatusInternalServerError)
+		return
+	}
+	q := r.URL.Query()
+	next := ""
+	if len(rows) == f.Limit {
+		q.Set("offset", strconv.Itoa(f.Offset+f.Limit))
+		next = "/admin?" + q.Encode()
+	}
+	h.render(w, listTemplate, map[string]interface{}{
+		"Rows":   rows,
+		"Model":  f.Model,
+		"Key":    f.Key,
+		"Status": r.URL.Query().Get("status"),
+		"Since":  r.URL.Query().Get("since"),
+		"Until":  r.URL.Query().Get("until"),
+		"Next":   next,
+	})
+}
+
+// detail renders one log row with pretty-printed bodies.
+func (h *Handler) detail(w http.ResponseWriter, r *http.Request) {
+	row, err := h.logs.GetLog(r.Context(), r.PathValue("id"))
+	if errors.Is(err, logstore.ErrNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to load api_log", "id", r.PathValue("id"), "error", err)
+		http.Error(w, "failed to load log", http.StatusInternalServerError)
+		return
+	}
+	h.render(w, detailTemplate, map[string]interface{}{
+		"Row":           row,
+		"ClientRequest": prettyJSON(row.ClientRequest),
+		"Request":       prettyJSON(row.Request),
+		"Response":      prettyJSON(row.Response),
+	})
+}
+
+// render executes tmpl, reporting template errors as 500s.
+func (h *Handler) render(w http.ResponseWriter, tmpl *template.Template, data interface{}) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		slog.Error("Failed to render admin page", "error", err)
+		http.Error(w, "failed to render page", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(buf.Bytes())
+}
+
+// prettyJSON indents s if it is JSON. Streamed responses hold one JSON
+// chunk per line, so each line is indented separately.
+func prettyJSON(s string) string {
+	var buf bytes.Buffer
+	if json.Indent(&buf, []byte(s), "", "  ") == nil {
+		return buf.String()
+	}
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	for i, line := range lines {
+		buf.Reset()
+		if json.Indent(&buf, []byte(line), "", "  ") == nil {
+			lines[i] = buf.String()
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,94 @@
+package admin
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gopenbridge/config"
+	"gopenbridge/logbody"
+	"gopenbridge/logstore"
+)
+
+// newTestHandler returns a dashboard over a fresh database holding one
+// logged request, "log-1", with authKeys as the static keys.
+func newTestHandler(t *testing.T, authKeys ...string) *Handler {
+	t.Helper()
+	cfg := &config.Config{DBPath: filepath.Join(t.TempDir(), "test.db"), AuthKeys: authKeys}
+	db, err := sql.Open("sqlite3", cfg.DBPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	logs, err := logstore.NewSQLite(db, func() logbody.Options { return logbody.Options{Storage: logbody.Inline} })
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := logstore.Record{Log: logstore.Log{ID: "log-1", Timestamp: time.Now().UTC(), Model: "gpt-4o", StatusCode: 200, Request: `{"messages":[{"role":"user","content":"secret prompt"}]}`}, Persist: true}
+	if err := logs.LogRequests(context.Background(), []logstore.Record{rec}); err != nil {
+		t.Fatal(err)
+	}
+	h, err := New(cfg, logs, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+// adminPaths are the read endpoints that expose logged requests.
+var adminPaths = []string{"/admin", "/admin/logs/log-1", "/admin/api/logs", "/admin/api/logs/log-1", "/admin/api/usage", "/admin/api/export"}
+
+func TestAdminRequiresAuthKey(t *testing.T) {
+	tests := []struct {
+		name     string
+		authKeys []string
+		setup    func(r *http.Request)
+		want     int
+	}{
+		{name: "no keys configured", want: http.StatusOK},
+		{name: "missing key", authKeys: []string{"sk-secret"}, want: http.StatusUnauthorized},
+		{name: "wrong key", authKeys: []string{"sk-secret"}, setup: func(r *http.Request) { r.Header.Set("X-Api-Key", "sk-wrong") }, want: http.StatusUnauthorized},
+		{name: "x-api-key", authKeys: []string{"sk-secret"}, setup: func(r *http.Request) { r.Header.Set("X-Api-Key", "sk-secret") }, want: http.StatusOK},
+		{name: "bearer token", authKeys: []string{"sk-secret"}, setup: func(r *http.Request) { r.Header.Set("Authorization", "Bearer sk-secret") }, want: http.StatusOK},
+		{name: "basic auth password", authKeys: []string{"sk-secret"}, setup: func(r *http.Request) { r.SetBasicAuth("admin", "sk-secret") }, want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		h := newTestHandler(t, tt.authKeys...)
+		for _, path := range adminPaths {
+			r := httptest.NewRequest(http.MethodGet, path, nil)
+			if tt.setup != nil {
+				tt.setup(r)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("%s: GET %s = %d, want %d", tt.name, path, w.Code, tt.want)
+			}
+			if w.Code == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+				t.Errorf("%s: GET %s: 401 without WWW-Authenticate", tt.name, path)
+			}
+			if w.Code != http.StatusOK && strings.Contains(w.Body.String(), "secret prompt") {
+				t.Errorf("%s: GET %s: refused response contains the logged prompt", tt.name, path)
+			}
+		}
+	}
+}
+
+func TestAdminClosedWithOnlyVirtualKeys(t *testing.T) {
+	h := newTestHandler(t)
+	if _, _, err := h.keys.Create(context.Background(), "alice", 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range adminPaths {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != http.StatusForbidden {
+			t.Errorf("GET %s = %d, want %d", path, w.Code, http.StatusForbidden)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"gopenbridge/logstore"
+)
+
+// logsPage is the response body of GET /admin/api/logs.
+type logsPage struct {
+	Data       []logstore.Log `json:"data"`
+	Limit      int            `json:"limit"`
+	Offset     int            `json:"offset"`
+	NextOffset *int           `json:"next_offset"` // nil on the last page
+}
+
+// apiLogs lists log rows matching the query filters, newest first. Bodies
+// are omitted; fetch a single row for the full request and response.
+func (h *Handler) apiLogs(w http.ResponseWriter, r *http.Request) {
+	f, err := parseFilter(r.URL.Query())
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	// Fetch one extra row to tell whether another page exists
+	rows, err := h.logs.QueryLogs(r.Context(), logstore.Filter{
+		Model: f.Model, Key: f.Key, Status: f.Status, Since: f.Since, Until: f.Until,
+		Limit: f.Limit + 1, Offset: f.Offset,
+	})
+	if err != nil {
+		slog.Error("Failed to query api_logs", "error", err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to query logs")
+		return
+	}
+	page := logsPage{Data: rows, Limit: f.Limit, Offset: f.Offset}
+	if len(rows) > f.Limit {
+		page.Data = rows[:f.Limit]
+		next := f.Offset + f.Limit
+		page.NextOffset = &next
+	}
+	if page.Data == nil {
+		page.Data = []logstore.Log{}
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+// apiLog returns one log row including the stored request and response.
+func (h *Handler) apiLog(w http.ResponseWriter, r *http.Request) {
+	row, err := h.logs.GetLog(r.Context(), r.PathValue("id"))
+	if errors.Is(err, logstore.ErrNotFound) {
+		writeJSONError(w, http.StatusNotFound, "log not found")
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to load api_log", "id", r.PathValue("id"), "error", err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to load log")
+		return
+	}
+	writeJSON(w, http.StatusOK, row)
+}
+
+// usageTotals sums the rows of a usage report.
+type usageTotals struct {
+	Requests         int     `json:"requests"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	CostUSD          float64 `json:"cost_usd"`          // Priced requests only
+	UnpricedRequests int     `json:"unpriced_requests"` // Requests to models without a price
+}
+
+// apiUsage reports token usage and estimated cost grouped by UTC day,
+// upstream model, provider and upstream API key. Costs stored at request
+// time are used as is; older rows are priced with the current table. It
+// accepts the same model, key, upstream_key, user_id, status, since and
+// until filters as apiLogs, but since and until select whole UTC days.
+func (h *Handler) apiUsage(w http.ResponseWriter, r *http.Request) {
+	f, err := parseFilter(r.URL.Query())
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	rows, err := h.logs.Usage(r.Context(), f)
+	if err != nil {
+		slog.Error("Failed to aggregate usage", "error", err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to aggregate usage")
+		return
+	}
+	if rows == nil {
+		rows = []logstore.UsageRow{}
+	}
+	var total usageTotals
+	for i := range rows {
+		row := &rows[i]
+		total.Requests += row.Requests
+		total.PromptTokens += row.PromptTokens
+		total.CompletionTokens += row.CompletionTokens
+		if row.UnpricedRequests > 0 {
+			if price, ok := h.cfg().PriceFor(row.Model); ok {
+				cost := price.Cost(row.UnpricedPromptTokens, row.UnpricedCompletionTokens)
+				if row.CostUSD != nil {
+					cost += *row.CostUSD
+				}
+				row.CostUSD = &cost
+			} else {
+				total.UnpricedRequests += row.UnpricedRequests
+			}
+		}
+		if row.CostUSD != nil {
+			total.CostUSD += *row.CostUSD
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"data": rows, "total": total})
+}
+
+// apiExport streams the log rows matching the apiLogs filters, oldest first,
+// as a jsonl (default) or csv download. bodies=false leaves out the request
+// and response bodies; limit and offset are ignored.
+func (h *Handler) apiExport(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	f, err := parseFilter(q)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	format := q.Get("format")
+	if format == "" {
+		format = logstore.JSONL
+	}
+	contentType, ok := logstore.ContentType(format)
+	if !ok {
+		writeJSONError(w, http.StatusBadRequest, "format must be jsonl or csv")
+		return
+	}
+	bodies := true
+	if v := q.Get("bodies"); v != "" {
+		if bodies, err = strconv.ParseBool(v); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "bodies must be true or false")
+			return
+		}
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="api_logs.`+format+`"`)
+	// The status is sent with the first row, so later failures can only be logged
+	if n, err := logstore.Export(r.Context(), h.logs, w, format, f, bodies); err != nil && r.Context().Err() == nil {
+		slog.Error("Failed to export api_logs", "exported", n, "error", err)
+	}
+}
+
+// writeJSON writes v as a JSON response with the given status.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeJSONError writes an {"error": {"message": ...}} body.
+func writeJSONError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]interface{}{
+		"error": map[string]interface{}{"message": msg},
+	})
+}
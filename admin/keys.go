@@ -0,0 +1,98 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"gopenbridge/keys"
+)
+
+// requireAdminKey reports whether the request carries one of the static
+// auth_keys, writing an error if not. Key management is refused entirely
+// when no static keys are configured, since anyone could then mint keys.
+func (h *Handler) requireAdminKey(w http.ResponseWriter, r *http.Request) bool {
+	if len(h.cfg().AuthKeys) == 0 {
+		writeJSONError(w, http.StatusForbidden, "configure auth_keys to manage virtual keys")
+		return false
+	}
+	if !keys.MatchStatic(keys.FromRequest(r), h.cfg().AuthKeys) {
+		writeJSONError(w, http.StatusUnauthorized, "a key from auth_keys is required")
+		return false
+	}
+	return true
+}
+
+// apiKeys lists active virtual keys without their secrets.
+func (h *Handler) apiKeys(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdminKey(w, r) {
+		return
+	}
+	list, err := h.keys.List(r.Context())
+	if err != nil {
+		slog.Error("Failed to list virtual keys", "error", err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to list keys")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"data": list})
+}
+
+// apiCreateKey issues a virtual key. The response is the only time the
+// secret is shown.
+func (h *Handler) apiCreateKey(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdminKey(w, r) {
+		return
+	}
+	var body struct {
+		Name        string `json:"name"`
+		RateLimit   int    `json:"rate_limit"`
+		DailyTokens int    `json:"daily_tokens"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+		return
+	}
+	body.Name = strings.TrimSpace(body.Name)
+	if body.Name == "" {
+		writeJSONError(w, http.StatusBadRequest, "name is required")
+		return
+	}
+	if body.RateLimit < 0 || body.DailyTokens < 0 {
+		writeJSONError(w, http.StatusBadRequest, "rate_limit and daily_tokens must not be negative")
+		return
+	}
+	key, secret, err := h.keys.Create(r.Context(), body.Name, body.RateLimit, body.DailyTokens)
+	if errors.Is(err, keys.ErrExists) {
+		writeJSONError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to create virtual key", "name", body.Name, "error", err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to create key")
+		return
+	}
+	slog.Info("Virtual key created", "name", key.Name)
+	writeJSON(w, http.StatusCreated, map[string]interface{}{"key": key, "secret": secret})
+}
+
+// apiRevokeKey revokes the virtual key named in the path.
+func (h *Handler) apiRevokeKey(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdminKey(w, r) {
+		return
+	}
+	name := r.PathValue("name")
+	err := h.keys.Revoke(r.Context(), name)
+	if errors.Is(err, keys.ErrNotFound) {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to revoke virtual key", "name", name, "error", err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to revoke key")
+		return
+	}
+	slog.Info("Virtual key revoked", "name", name)
+	w.WriteHeader(http.StatusNoContent)
+}
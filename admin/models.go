@@ -0,0 +1,50 @@
+package admin
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"gopenbridge/catalog"
+)
+
+// ModelSource lists and refreshes the upstreams' model lists, see
+// proxy.ChatProxy.
+type ModelSource interface {
+	CachedModels(ctx context.Context) ([]catalog.Entry, error)
+	RefreshModels(ctx context.Context) ([]catalog.Entry, error)
+}
+
+// apiModels lists the cached upstream model lists.
+func (h *Handler) apiModels(w http.ResponseWriter, r *http.Request) {
+	list, err := h.models.CachedModels(r.Context())
+	if err != nil {
+		slog.Error("Failed to list cached models", "error", err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to list models")
+		return
+	}
+	if list == nil {
+		list = []catalog.Entry{}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"data": list})
+}
+
+// apiRefreshModels queries the upstreams' model lists and returns them.
+// Upstreams that could not be queried are reported in errors. It requires
+// an admin key when auth_keys are configured, since it calls the upstreams
+// with their API keys.
+func (h *Handler) apiRefreshModels(w http.ResponseWriter, r *http.Request) {
+	if len(h.cfg().AuthKeys) > 0 && !h.requireAdminKey(w, r) {
+		return
+	}
+	list, err := h.models.RefreshModels(r.Context())
+	if list == nil {
+		list = []catalog.Entry{}
+	}
+	res := map[string]interface{}{"data": list}
+	if err != nil {
+		slog.Warn("Failed to list models of some upstreams", "error", err)
+		res["errors"] = err.Error()
+	}
+	writeJSON(w, http.StatusOK, res)
+}
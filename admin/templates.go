@@ -0,0 +1,76 @@
+package admin
+
+import "html/template"
+
+const pageStyle = `<style>
+body { font-family: Arial; max-width: 1200px; margin: 40px auto; padding: 0 20px; }
+table { border-collapse: collapse; width: 100%; font-size: 14px; }
+th, td { text-align: left; padding: 6px 8px; border-bottom: 1px solid #ddd; }
+tr:hover { background: #f5f5f5; }
+form { background: #e3f2fd; padding: 12px; border-radius: 8px; margin-bottom: 16px; }
+pre { background: #f5f5f5; padding: 12px; border-radius: 8px; overflow-x: auto; white-space: pre-wrap; }
+.err { color: #c62828; }
+</style>`
+
+var listTemplate = template.Must(template.New("list").Parse(`<!DOCTYPE html>
+<html>
+<head><title>gopenbridge admin</title>` + pageStyle + `</head>
+<body>
+<h1>🌉 gopenbridge requests</h1>
+<form method="get" action="/admin">
+  Model <input name="model" value="{{.Model}}">
+  Key <input name="key" value="{{.Key}}" size="10">
+  Status <input name="status" value="{{.Status}}" size="4">
+  Since <input type="datetime-local" name="since" value="{{.Since}}">
+  Until <input type="datetime-local" name="until" value="{{.Until}}">
+  <button type="submit">Filter</button> <a href="/admin">Reset</a>
+</form>
+<table>
+<tr><th>Time (UTC)</th><th>ID</th><th>Model</th><th>Provider</th><th>Key</th><th>Status</th><th>Stop reason</th><th>Input tokens</th><th>Output tokens</th><th>Cost (USD)</th></tr>
+{{range .Rows}}<tr>
+  <td>{{.Timestamp.Format "2006-01-02 15:04:05"}}</td>
+  <td><a href="/admin/logs/{{.ID}}">{{.ID}}</a></td>
+  <td>{{.Model}}</td>
+  <td>{{.Provider}}</td>
+  <td>{{.KeyName}}</td>
+  <td{{if .ErrorMessage}} class="err" title="{{.ErrorMessage}}"{{end}}>{{.StatusCode}}</td>
+  <td>{{.StopReason}}</td>
+  <td>{{.PromptTokens}}</td>
+  <td>{{.CompletionTokens}}</td>
+  <td>{{with .CostUSD}}{{printf "%.6f" .}}{{end}}</td>
+</tr>{{else}}<tr><td colspan="10">No requests found.</td></tr>{{end}}
+</table>
+{{if .Next}}<p><a href="{{.Next}}">Older →</a></p>{{end}}
+</body>
+</html>`))
+
+var detailTemplate = template.Must(template.New("detail").Parse(`<!DOCTYPE html>
+<html>
+<head><title>gopenbridge request {{.Row.ID}}</title>` + pageStyle + `</head>
+<body>
+<p><a href="/admin">← All requests</a></p>
+<h1>Request {{.Row.ID}}</h1>
+<table>
+<tr><th>Time (UTC)</th><td>{{.Row.Timestamp.Format "2006-01-02 15:04:05"}}</td></tr>
+<tr><th>Model</th><td>{{.Row.Model}}</td></tr>
+<tr><th>Provider</th><td>{{.Row.Provider}}</td></tr>
+{{if .Row.KeyName}}<tr><th>Key</th><td>{{.Row.KeyName}}</td></tr>{{end}}
+{{if .Row.UpstreamKey}}<tr><th>Upstream key</th><td>{{.Row.UpstreamKey}}</td></tr>{{end}}
+{{if .Row.UserID}}<tr><th>User</th><td>{{.Row.UserID}}</td></tr>{{end}}
+<tr><th>Endpoint</th><td>{{.Row.Endpoint}}</td></tr>
+<tr><th>Status</th><td>{{.Row.StatusCode}}</td></tr>
+<tr><th>Stop reason</th><td>{{.Row.StopReason}}</td></tr>
+<tr><th>Tokens</th><td>{{.Row.PromptTokens}} in / {{.Row.CompletionTokens}} out</td></tr>
+{{with .Row.CostUSD}}<tr><th>Cost (USD)</th><td>{{printf "%.6f" .}}</td></tr>{{end}}
+<tr><th>Retries</th><td>{{.Row.Retries}}</td></tr>
+{{if .Row.LatencyMs}}<tr><th>Latency</th><td>{{.Row.LatencyMs}} ms</td></tr>{{end}}
+{{if .Row.ErrorMessage}}<tr><th>Error</th><td class="err">{{.Row.ErrorMessage}}</td></tr>{{end}}
+</table>
+{{with .ClientRequest}}<h2>Client request</h2>
+<pre>{{.}}</pre>
+{{end}}<h2>Upstream request</h2>
+<pre>{{.Request}}</pre>
+<h2>Response</h2>
+<pre>{{.Response}}</pre>
+</body>
+</html>`))
@@ -0,0 +1,225 @@
+// Package awsauth loads AWS credentials and signs requests with Signature
+// Version 4, without pulling in the AWS SDK.
+package awsauth
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Credentials are static AWS access credentials.
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string // Optional, for temporary credentials
+}
+
+// LoadCredentials resolves credentials from the standard environment
+// variables, falling back to profile in the shared credentials file. An empty
+// profile means AWS_PROFILE or "default".
+func LoadCredentials(profile string) (Credentials, error) {
+	if id, secret := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY"); id != "" && secret != "" {
+		return Credentials{AccessKeyID: id, SecretAccessKey: secret, SessionToken: os.Getenv("AWS_SESSION_TOKEN")}, nil
+	}
+	profile = profileName(profile)
+	path := os.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+	if path == "" {
+		home, _ := os.UserHomeDir()
+		path = filepath.Join(home, ".aws", "credentials")
+	}
+	sections, err := parseINI(path)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("no AWS credentials in environment and %s unreadable: %w", path, err)
+	}
+	sec, ok := sections[profile]
+	if !ok || sec["aws_access_key_id"] == "" || sec["aws_secret_access_key"] == "" {
+		return Credentials{}, fmt.Errorf("AWS profile %q has no credentials in %s", profile, path)
+	}
+	return Credentials{
+		AccessKeyID:     sec["aws_access_key_id"],
+		SecretAccessKey: sec["aws_secret_access_key"],
+		SessionToken:    sec["aws_session_token"],
+	}, nil
+}
+
+// DefaultRegion returns the region from AWS_REGION, AWS_DEFAULT_REGION or the
+// profile in the shared config file, or "" if none is set.
+func DefaultRegion(profile string) string {
+	if v := os.Getenv("AWS_REGION"); v != "" {
+		return v
+	}
+	if v := os.Getenv("AWS_DEFAULT_REGION"); v != "" {
+		return v
+	}
+	path := os.Getenv("AWS_CONFIG_FILE")
+	if path == "" {
+		home, _ := os.UserHomeDir()
+		path = filepath.Join(home, ".aws", "config")
+	}
+	sections, err := parseINI(path)
+	if err != nil {
+		return ""
+	}
+	profile = profileName(profile)
+	if sec, ok := sections["profile "+profile]; ok {
+		return sec["region"]
+	}
+	return sections[profile]["region"]
+}
+
+// profileName applies the AWS_PROFILE and "default" fallbacks.
+func profileName(profile string) string {
+	if profile != "" {
+		return profile
+	}
+	if v := os.Getenv("AWS_PROFILE"); v != "" {
+		return v
+	}
+	return "default"
+}
+
+// parseINI reads the [section] key = value format used by AWS config files.
+func parseINI(path string) (map[string]map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	res := make(map[string]map[string]string)
+	section := ""
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			if res[section] == nil {
+				res[section] = make(map[string]string)
+			}
+			continue
+		}
+		if k, v, ok := strings.Cut(line, "="); ok && section != "" {
+			res[section][strings.TrimSpace(k)] = strings.TrimSpace(v)
+		}
+	}
+	return res, scanner.Err()
+}
+
+// Sign adds Signature Version 4 headers to req for service in region. body
+// must be the exact request payload.
+func Sign(req *http.Request, body []byte, creds Credentials, region, service string, now time.Time) error {
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return errors.New("missing AWS credentials")
+	}
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+
+	// Canonical headers: host plus every content-type and x-amz-* header
+	headers := map[string]string{"host": host}
+	for k, vs := range req.Header {
+		lk := strings.ToLower(k)
+		if lk == "content-type" || strings.HasPrefix(lk, "x-amz-") {
+			headers[lk] = strings.TrimSpace(strings.Join(vs, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonHeaders strings.Builder
+	for _, k := range names {
+		canonHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	payloadHash := sha256.Sum256(body)
+	canonRequest := strings.Join([]string{
+		req.Method,
+		canonicalURI(req.URL.EscapedPath()),
+		canonicalQuery(req.URL.Query()),
+		canonHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+	canonHash := sha256.Sum256([]byte(canonRequest))
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(canonHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+creds.AccessKeyID+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+	return nil
+}
+
+// canonicalURI encodes each segment of an already escaped path once more, as
+// SigV4 requires for every service except S3.
+func canonicalURI(escapedPath string) string {
+	if escapedPath == "" {
+		return "/"
+	}
+	segments := strings.Split(escapedPath, "/")
+	for i, s := range segments {
+		segments[i] = uriEncode(s)
+	}
+	return strings.Join(segments, "/")
+}
+
+// canonicalQuery sorts and encodes query parameters.
+func canonicalQuery(q map[string][]string) string {
+	var pairs []string
+	for k, vs := range q {
+		for _, v := range vs {
+			pairs = append(pairs, uriEncode(k)+"="+uriEncode(v))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// uriEncode percent-encodes everything except unreserved characters.
+func uriEncode(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// hmacSHA256 returns HMAC-SHA256(key, data).
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,331 @@
+// Package batches stores Message Batches: a row per batch and a row per
+// batched request, which the proxy's batch workers claim and complete.
+package batches
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"gopenbridge/migrate"
+)
+
+// Request states. Pending requests wait for a worker; the others are
+// final except processing.
+const (
+	StatusPending    = "pending"
+	StatusProcessing = "processing"
+	StatusSucceeded  = "succeeded"
+	StatusErrored    = "errored"
+	StatusCanceled   = "canceled"
+	StatusExpired    = "expired"
+)
+
+var (
+	// ErrNotFound is returned for an unknown batch ID.
+	ErrNotFound = errors.New("batch not found")
+	// ErrNotEnded is returned when deleting a batch that is still processing.
+	ErrNotEnded = errors.New("batch is still processing")
+)
+
+// Counts tallies a batch's requests by state, as in Anthropic's
+// request_counts; processing includes pending requests.
+type Counts struct {
+	Processing int `json:"processing"`
+	Succeeded  int `json:"succeeded"`
+	Errored    int `json:"errored"`
+	Canceled   int `json:"canceled"`
+	Expired    int `json:"expired"`
+}
+
+// Batch is a stored batch.
+type Batch struct {
+	ID                string
+	KeyName           string // Virtual key that created the batch, if any
+	CreatedAt         time.Time
+	EndedAt           *time.Time
+	CancelInitiatedAt *time.Time
+	Counts            Counts
+}
+
+// Item is a request submitted in a batch.
+type Item struct {
+	CustomID string          `json:"custom_id"`
+	Params   json.RawMessage `json:"params"`
+}
+
+// Request is a batched request claimed by a worker.
+type Request struct {
+	BatchID  string
+	CustomID string
+	Params   json.RawMessage
+	KeyName  string
+}
+
+// Result is the outcome of one batched request. Result holds the JSON
+// result object, nil for canceled and expired requests.
+type Result struct {
+	CustomID string
+	Status   string
+	Result   json.RawMessage
+}
+
+// Store persists batches in the message_batches and batch_requests tables.
+type Store struct {
+	db *sql.DB
+	mu sync.Mutex // serializes Claim
+}
+
+// NewStore returns a store backed by db, migrating its tables if needed.
+// Requests left processing by a previous run are queued again.
+func NewStore(db *sql.DB) (*Store, error) {
+	if err := migrate.Apply(context.Background(), db, "batches", migrations); err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(`UPDATE batch_requests SET status = 'pending' WHERE status = 'processing'`); err != nil {
+		return nil, err
+	}
+	return &Store{db: db}, nil
+}
+
+// migrations are the schema changes of the batch tables, in order.
+var migrations = []migrate.Migration{
+	migrate.Exec("create message_batches and batch_requests",
+		`CREATE TABLE IF NOT EXISTS message_batches (
+			id TEXT PRIMARY KEY,
+			key_name TEXT,
+			created_at DATETIME,
+			ended_at DATETIME,
+			cancel_initiated_at DATETIME
+		)`,
+		`CREATE TABLE IF NOT EXISTS batch_requests (
+			batch_id TEXT,
+			seq INTEGER,
+			custom_id TEXT,
+			params TEXT,
+			status TEXT,
+			result TEXT,
+			PRIMARY KEY (batch_id, custom_id)
+		)`),
+}
+
+// Create stores a batch of items for keyName and returns it.
+func (s *Store) Create(ctx context.Context, keyName string, items []Item) (*Batch, error) {
+	b := &Batch{
+		ID:        "msgbatch_" + strings.ReplaceAll(uuid.New().String(), "-", ""),
+		KeyName:   keyName,
+		CreatedAt: time.Now().UTC(),
+		Counts:    Counts{Processing: len(items)},
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, "INSERT INTO message_batches(id, key_name, created_at) VALUES (?, ?, ?)", b.ID, keyName, b.CreatedAt); err != nil {
+		return nil, err
+	}
+	for i, it := range items {
+		_, err := tx.ExecContext(ctx,
+			"INSERT INTO batch_requests(batch_id, seq, custom_id, params, status) VALUES (?, ?, ?, ?, ?)",
+			b.ID, i, it.CustomID, string(it.Params), StatusPending)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return b, tx.Commit()
+}
+
+// Get returns the batch with the given ID, or ErrNotFound.
+func (s *Store) Get(ctx context.Context, id string) (*Batch, error) {
+	var b Batch
+	var ended, canceled sql.NullTime
+	err := s.db.QueryRowContext(ctx,
+		"SELECT id, COALESCE(key_name, ''), created_at, ended_at, cancel_initiated_at FROM message_batches WHERE id = ?", id).
+		Scan(&b.ID, &b.KeyName, &b.CreatedAt, &ended, &canceled)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if ended.Valid {
+		b.EndedAt = &ended.Time
+	}
+	if canceled.Valid {
+		b.CancelInitiatedAt = &canceled.Time
+	}
+	rows, err := s.db.QueryContext(ctx, "SELECT status, COUNT(*) FROM batch_requests WHERE batch_id = ? GROUP BY status", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var status string
+		var n int
+		if err := rows.Scan(&status, &n); err != nil {
+			return nil, err
+		}
+		switch status {
+		case StatusPending, StatusProcessing:
+			b.Counts.Processing += n
+		case StatusSucceeded:
+			b.Counts.Succeeded = n
+		case StatusErrored:
+			b.Counts.Errored = n
+		case StatusCanceled:
+			b.Counts.Canceled = n
+		case StatusExpired:
+			b.Counts.Expired = n
+		}
+	}
+	return &b, rows.Err()
+}
+
+// List returns the IDs of all batches, newest first.
+func (s *Store) List(ctx context.Context) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT id FROM message_batches ORDER BY created_at DESC, id DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// Claim marks the oldest pending request as processing and returns it, or
+// nil when none is pending.
+func (s *Store) Claim(ctx context.Context) (*Request, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var r Request
+	var params string
+	err := s.db.QueryRowContext(ctx, `SELECT r.batch_id, r.custom_id, r.params, COALESCE(b.key_name, '')
+		FROM batch_requests r JOIN message_batches b ON b.id = r.batch_id
+		WHERE r.status = 'pending' ORDER BY b.created_at, r.seq LIMIT 1`).
+		Scan(&r.BatchID, &r.CustomID, &params, &r.KeyName)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	r.Params = json.RawMessage(params)
+	_, err = s.db.ExecContext(ctx, "UPDATE batch_requests SET status = ? WHERE batch_id = ? AND custom_id = ?", StatusProcessing, r.BatchID, r.CustomID)
+	return &r, err
+}
+
+// Finish records a claimed request's outcome and ends its batch when no
+// request is left.
+func (s *Store) Finish(ctx context.Context, batchID, customID, status string, result json.RawMessage) error {
+	_, err := s.db.ExecContext(ctx, "UPDATE batch_requests SET status = ?, result = ? WHERE batch_id = ? AND custom_id = ?",
+		status, string(result), batchID, customID)
+	if err != nil {
+		return err
+	}
+	return s.endIfDone(ctx, batchID)
+}
+
+// endIfDone sets ended_at once none of the batch's requests is pending or
+// processing.
+func (s *Store) endIfDone(ctx context.Context, batchID string) error {
+	_, err := s.db.ExecContext(ctx, `UPDATE message_batches SET ended_at = ? WHERE id = ? AND ended_at IS NULL
+		AND NOT EXISTS (SELECT 1 FROM batch_requests WHERE batch_id = ? AND status IN ('pending', 'processing'))`,
+		time.Now().UTC(), batchID, batchID)
+	return err
+}
+
+// Cancel cancels the batch's pending requests. Requests already being
+// processed finish normally.
+func (s *Store) Cancel(ctx context.Context, id string) error {
+	res, err := s.db.ExecContext(ctx, "UPDATE message_batches SET cancel_initiated_at = COALESCE(cancel_initiated_at, ?) WHERE id = ?", time.Now().UTC(), id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	if _, err := s.db.ExecContext(ctx, "UPDATE batch_requests SET status = ? WHERE batch_id = ? AND status = 'pending'", StatusCanceled, id); err != nil {
+		return err
+	}
+	return s.endIfDone(ctx, id)
+}
+
+// Expire marks the pending requests of batches created before cutoff as
+// expired.
+func (s *Store) Expire(ctx context.Context, cutoff time.Time) error {
+	rows, err := s.db.QueryContext(ctx, "SELECT id FROM message_batches WHERE ended_at IS NULL AND created_at < ?", cutoff.UTC())
+	if err != nil {
+		return err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	for _, id := range ids {
+		if _, err := s.db.ExecContext(ctx, "UPDATE batch_requests SET status = ? WHERE batch_id = ? AND status = 'pending'", StatusExpired, id); err != nil {
+			return err
+		}
+		if err := s.endIfDone(ctx, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Results returns the outcomes of a batch's requests in submission order.
+func (s *Store) Results(ctx context.Context, id string) ([]Result, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT custom_id, status, COALESCE(result, '') FROM batch_requests WHERE batch_id = ? ORDER BY seq", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var res []Result
+	for rows.Next() {
+		var r Result
+		var result string
+		if err := rows.Scan(&r.CustomID, &r.Status, &result); err != nil {
+			return nil, err
+		}
+		if result != "" {
+			r.Result = json.RawMessage(result)
+		}
+		res = append(res, r)
+	}
+	return res, rows.Err()
+}
+
+// Delete removes an ended batch and its requests.
+func (s *Store) Delete(ctx context.Context, id string) error {
+	b, err := s.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if b.EndedAt == nil {
+		return ErrNotEnded
+	}
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM batch_requests WHERE batch_id = ?", id); err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, "DELETE FROM message_batches WHERE id = ?", id)
+	return err
+}
@@ -0,0 +1,143 @@
+// Package cache stores upstream responses by request hash: recent entries
+// in an in-memory LRU, all of them in SQLite so they survive restarts.
+package cache
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"time"
+
+	"gopenbridge/migrate"
+)
+
+// pruneInterval is how often expired rows are deleted from SQLite.
+const pruneInterval = time.Minute
+
+// entry is a cached value.
+type entry struct {
+	key     string
+	value   []byte
+	created time.Time
+}
+
+// Cache maps request keys to response bodies for a TTL.
+type Cache struct {
+	db         *sql.DB // nil keeps entries in memory only
+	maxEntries int
+	ttl        time.Duration
+
+	mu        sync.Mutex
+	ll        *list.List // most recently used first
+	items     map[string]*list.Element
+	lastPrune time.Time
+}
+
+// New returns a cache holding up to maxEntries in memory and expiring
+// entries after ttl. If db is not nil entries are also persisted in its
+// response_cache table, which is migrated if needed.
+func New(db *sql.DB, maxEntries int, ttl time.Duration) (*Cache, error) {
+	if db != nil {
+		if err := migrate.Apply(context.Background(), db, "cache", migrations); err != nil {
+			return nil, err
+		}
+	}
+	return &Cache{db: db, maxEntries: maxEntries, ttl: ttl, ll: list.New(), items: make(map[string]*list.Element)}, nil
+}
+
+// migrations are the schema changes of response_cache, in order.
+var migrations = []migrate.Migration{
+	migrate.Exec("create response_cache", `CREATE TABLE IF NOT EXISTS response_cache (
+		key TEXT PRIMARY KEY,
+		value BLOB,
+		created_at DATETIME
+	)`),
+}
+
+// Key hashes parts, marshaled as JSON, into a cache key. Struct fields keep
+// their declaration order and map keys are sorted, so equal requests hash
+// equally.
+func Key(parts ...interface{}) string {
+	h := sha256.New()
+	enc := json.NewEncoder(h)
+	for _, p := range parts {
+		enc.Encode(p)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Get returns the value stored under key, if present and not expired.
+func (c *Cache) Get(ctx context.Context, key string) ([]byte, bool) {
+	c.mu.Lock()
+	if el, ok := c.items[key]; ok {
+		e := el.Value.(*entry)
+		if time.Since(e.created) < c.ttl {
+			c.ll.MoveToFront(el)
+			c.mu.Unlock()
+			return e.value, true
+		}
+		c.ll.Remove(el)
+		delete(c.items, key)
+	}
+	c.mu.Unlock()
+	if c.db == nil {
+		return nil, false
+	}
+	var e entry
+	err := c.db.QueryRowContext(ctx, "SELECT value, created_at FROM response_cache WHERE key = ? AND created_at >= ?",
+		key, time.Now().UTC().Add(-c.ttl)).Scan(&e.value, &e.created)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			slog.Warn("Failed to read response cache", "error", err)
+		}
+		return nil, false
+	}
+	e.key = key
+	c.mu.Lock()
+	c.add(&e)
+	c.mu.Unlock()
+	return e.value, true
+}
+
+// Put stores value under key.
+func (c *Cache) Put(ctx context.Context, key string, value []byte) {
+	e := &entry{key: key, value: value, created: time.Now().UTC()}
+	c.mu.Lock()
+	if el, ok := c.items[key]; ok {
+		c.ll.Remove(el)
+	}
+	c.add(e)
+	prune := c.db != nil && time.Since(c.lastPrune) >= pruneInterval
+	if prune {
+		c.lastPrune = time.Now()
+	}
+	c.mu.Unlock()
+	if c.db == nil {
+		return
+	}
+	if _, err := c.db.ExecContext(ctx, "INSERT OR REPLACE INTO response_cache(key, value, created_at) VALUES (?, ?, ?)",
+		key, value, e.created); err != nil {
+		slog.Warn("Failed to write response cache", "error", err)
+	}
+	if prune {
+		if _, err := c.db.ExecContext(ctx, "DELETE FROM response_cache WHERE created_at < ?", e.created.Add(-c.ttl)); err != nil {
+			slog.Warn("Failed to prune response cache", "error", err)
+		}
+	}
+}
+
+// add inserts e at the front, evicting the least recently used entries
+// beyond maxEntries. c.mu must be held.
+func (c *Cache) add(e *entry) {
+	c.items[e.key] = c.ll.PushFront(e)
+	for c.ll.Len() > c.maxEntries {
+		oldest := c.ll.Back()
+		c.ll.Remove(oldest)
+		delete(c.items, oldest.Value.(*entry).key)
+	}
+}
@@ -0,0 +1,267 @@
+// Package cassette records upstream HTTP exchanges to a JSON file and plays
+// them back without network access, so the translation layer can be tested
+// deterministically and demoed offline.
+package cassette
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"unicode/utf8"
+)
+
+// secretParams are query parameters carrying API keys, as Gemini's key=.
+// They are left out of recorded URLs and ignored when matching.
+var secretParams = []string{"key", "api_key", "api-key"}
+
+// Interaction is one recorded exchange.
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+// Request is the recorded part of an upstream request. Headers are not
+// recorded, since they carry credentials.
+type Request struct {
+	Method string `json:"method"`
+	URL    string `json:"url"`
+	Body   Body   `json:"body"`
+}
+
+// Response is a recorded upstream response.
+type Response struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header,omitempty"`
+	Body   Body        `json:"body"`
+}
+
+// Body is a request or response body, stored as text when it is valid
+// UTF-8 and base64 encoded otherwise, e.g. Bedrock event streams.
+type Body []byte
+
+// MarshalJSON satisfies json.Marshaler.
+func (b Body) MarshalJSON() ([]byte, error) {
+	if utf8.Valid(b) {
+		return json.Marshal(string(b))
+	}
+	return json.Marshal(map[string]string{"base64": base64.StdEncoding.EncodeToString(b)})
+}
+
+// UnmarshalJSON satisfies json.Unmarshaler.
+func (b *Body) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*b = Body(s)
+		return nil
+	}
+	var enc struct {
+		Base64 string `json:"base64"`
+	}
+	if err := json.Unmarshal(data, &enc); err != nil {
+		return err
+	}
+	raw, err := base64.StdEncoding.DecodeString(enc.Base64)
+	*b = raw
+	return err
+}
+
+// file is the cassette file format.
+type file struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Cassette records to or replays from one file.
+type Cassette struct {
+	path   string
+	replay bool
+
+	mu           sync.Mutex
+	interactions []Interaction
+	responses    map[string][]Response // recorded responses by request key, when replaying
+	played       map[string]int        // responses served, by request key
+}
+
+// Record returns a cassette that saves every completed upstream exchange
+// to path, replacing its previous contents.
+func Record(path string) (*Cassette, error) {
+	c := &Cassette{path: path, interactions: []Interaction{}}
+	return c, c.save()
+}
+
+// Replay returns a cassette answering requests from the exchanges recorded
+// in path.
+func Replay(path string) (*Cassette, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f file
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("parse cassette %s: %w", path, err)
+	}
+	c := &Cassette{path: path, replay: true, interactions: f.Interactions, responses: make(map[string][]Response), played: make(map[string]int)}
+	for _, in := range f.Interactions {
+		key := matchKey(in.Request)
+		c.responses[key] = append(c.responses[key], in.Response)
+	}
+	return c, nil
+}
+
+// Len returns the number of recorded exchanges.
+func (c *Cassette) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.interactions)
+}
+
+// Transport returns a RoundTripper that records the exchanges of base, or
+// when replaying answers from the cassette without calling base.
+func (c *Cassette) Transport(base http.RoundTripper) http.RoundTripper {
+	return &transport{c: c, base: base}
+}
+
+type transport struct {
+	c    *Cassette
+	base http.RoundTripper
+}
+
+// RoundTrip satisfies http.RoundTripper.
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	recorded := Request{Method: req.Method, URL: redactURL(req.URL), Body: body}
+	if t.c.replay {
+		return t.c.play(req, recorded)
+	}
+	out := req.Clone(req.Context())
+	out.Body = io.NopCloser(bytes.NewReader(body))
+	// Let the transport decompress, so bodies are recorded readable
+	out.Header.Del("Accept-Encoding")
+	res, err := t.base.RoundTrip(out)
+	if err != nil {
+		return nil, err
+	}
+	res.Body = &recorder{ReadCloser: res.Body, c: t.c, req: recorded, res: res}
+	return res, nil
+}
+
+// play answers req with the next recorded response to an equal request.
+// Once those are used up the last one is repeated.
+func (c *Cassette) play(req *http.Request, recorded Request) (*http.Response, error) {
+	key := matchKey(recorded)
+	c.mu.Lock()
+	matches := c.responses[key]
+	n := c.played[key]
+	c.played[key]++
+	c.mu.Unlock()
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("cassette %s has no response recorded for %s %s", c.path, recorded.Method, recorded.URL)
+	}
+	r := matches[min(n, len(matches)-1)]
+	header := r.Header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", r.Status, http.StatusText(r.Status)),
+		StatusCode:    r.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(r.Body)),
+		ContentLength: int64(len(r.Body)),
+		Request:       req,
+	}, nil
+}
+
+// add appends in and saves the cassette.
+func (c *Cassette) add(in Interaction) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.interactions = append(c.interactions, in)
+	return c.saveLocked()
+}
+
+func (c *Cassette) save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.saveLocked()
+}
+
+// saveLocked writes the cassette through a temporary file, so an
+// interrupted recording leaves the last complete version.
+func (c *Cassette) saveLocked() error {
+	data, err := json.MarshalIndent(file{Interactions: c.interactions}, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.path)
+}
+
+// recorder buffers a response body as it is read and records the exchange
+// once it has been read to the end. Bodies abandoned early, such as
+// cancelled streams, are not recorded.
+type recorder struct {
+	io.ReadCloser
+	c    *Cassette
+	req  Request
+	res  *http.Response
+	buf  bytes.Buffer
+	done bool
+}
+
+func (r *recorder) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.buf.Write(p[:n])
+	if errors.Is(err, io.EOF) && !r.done {
+		r.done = true
+		header := r.res.Header.Clone()
+		header.Del("Set-Cookie")
+		in := Interaction{Request: r.req, Response: Response{Status: r.res.StatusCode, Header: header, Body: r.buf.Bytes()}}
+		if err := r.c.add(in); err != nil {
+			return n, fmt.Errorf("record to cassette %s: %w", r.c.path, err)
+		}
+	}
+	return n, err
+}
+
+// matchKey identifies equal requests. JSON bodies are compared by value, so
+// key order and whitespace do not matter.
+func matchKey(r Request) string {
+	body := []byte(r.Body)
+	var v interface{}
+	if json.Unmarshal(body, &v) == nil {
+		body, _ = json.Marshal(v)
+	}
+	return r.Method + " " + r.URL + "\n" + string(body)
+}
+
+// redactURL returns u without secretParams.
+func redactURL(u *url.URL) string {
+	c := *u
+	q := c.Query()
+	for _, p := range secretParams {
+		q.Del(p)
+	}
+	c.RawQuery = q.Encode()
+	return c.String()
+}
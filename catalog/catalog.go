@@ -0,0 +1,102 @@
+// Package catalog caches the model lists upstreams report, so configured
+// model names can be checked without querying every upstream each time.
+package catalog
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"gopenbridge/migrate"
+)
+
+// Entry is the model list of one upstream.
+type Entry struct {
+	Upstream  string    `json:"upstream"` // Base URL
+	Provider  string    `json:"provider"`
+	Models    []string  `json:"models"`
+	FetchedAt time.Time `json:"fetched_at"`
+}
+
+// Store persists model lists in the upstream_models table.
+type Store struct {
+	db *sql.DB
+}
+
+// NewStore returns a store backed by db, migrating its table if needed.
+func NewStore(db *sql.DB) (*Store, error) {
+	if err := migrate.Apply(context.Background(), db, "catalog", migrations); err != nil {
+		return nil, err
+	}
+	return &Store{db: db}, nil
+}
+
+// migrations are the schema changes of upstream_models, in order.
+var migrations = []migrate.Migration{
+	migrate.Exec("create upstream_models", `CREATE TABLE IF NOT EXISTS upstream_models (
+		upstream TEXT,
+		provider TEXT,
+		model TEXT,
+		fetched_at DATETIME,
+		PRIMARY KEY (upstream, model)
+	)`),
+}
+
+// Save replaces the stored list of e.Upstream with e.
+func (s *Store) Save(ctx context.Context, e Entry) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, "DELETE FROM upstream_models WHERE upstream = ?", e.Upstream); err != nil {
+		return err
+	}
+	for _, m := range e.Models {
+		_, err := tx.ExecContext(ctx,
+			"INSERT OR IGNORE INTO upstream_models(upstream, provider, model, fetched_at) VALUES (?, ?, ?, ?)",
+			e.Upstream, e.Provider, m, e.FetchedAt.UTC())
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// List returns every stored list, ordered by upstream, with models sorted.
+func (s *Store) List(ctx context.Context) ([]Entry, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT upstream, provider, model, fetched_at FROM upstream_models ORDER BY upstream, model")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var res []Entry
+	for rows.Next() {
+		var e Entry
+		var model string
+		if err := rows.Scan(&e.Upstream, &e.Provider, &model, &e.FetchedAt); err != nil {
+			return nil, err
+		}
+		if n := len(res); n > 0 && res[n-1].Upstream == e.Upstream {
+			res[n-1].Models = append(res[n-1].Models, model)
+			continue
+		}
+		e.Models = []string{model}
+		res = append(res, e)
+	}
+	return res, rows.Err()
+}
+
+// Get returns the stored list of upstream, or nil if there is none.
+func (s *Store) Get(ctx context.Context, upstream string) (*Entry, error) {
+	list, err := s.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range list {
+		if list[i].Upstream == upstream {
+			return &list[i], nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"gopenbridge/config"
+	"gopenbridge/models"
+	"gopenbridge/proxy"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const benchUsage = `Usage: gopenbridge bench [-url URL] [-concurrency N] [-requests M] [-stream] [-direct]
+
+Drive a running gopenbridge with synthetic Anthropic requests and report
+latency percentiles and throughput. With -direct the same requests, already
+translated, are also sent straight to the upstream, and the difference is
+reported as the bridge's overhead. Every request is a real upstream call.
+
+Flags:
+  -url URL         Bridge to drive (default: http://host:port from the config)
+  -key KEY         Client API key, if the bridge requires one (default: the
+                   first of auth_keys)
+  -concurrency N   Requests in flight at once (default 4)
+  -requests M      Requests to send (default 100)
+  -stream          Stream the responses and also report time to first byte
+  -model NAME      Client model to request (default: default_model)
+  -max-tokens N    max_tokens of each request (default 32)
+  -direct          Also benchmark the upstream directly
+`
+
+// benchResult is the outcome of one benchmarked request.
+type benchResult struct {
+	latency   time.Duration // Until the whole response was read
+	firstByte time.Duration // Until the first body byte, for streams
+	err       error
+}
+
+// runBench implements the bench subcommand and returns the exit code.
+func runBench(args []string) int {
+	fs := flag.NewFlagSet("bench", flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprint(os.Stderr, benchUsage) }
+	url := fs.String("url", "", "")
+	key := fs.String("key", "", "")
+	concurrency := fs.Int("concurrency", 4, "")
+	requests := fs.Int("requests", 100, "")
+	stream := fs.Bool("stream", false, "")
+	model := fs.String("model", "", "")
+	maxTokens := fs.Int("max-tokens", 32, "")
+	direct := fs.Bool("direct", false, "")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if fs.NArg() > 0 || *concurrency < 1 || *requests < 1 {
+		fs.Usage()
+		return 2
+	}
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "gopenbridge bench: failed to load config: %v\n", err)
+		return 1
+	}
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if *url == "" {
+		*url = "http://" + cfg.Host + ":" + strconv.Itoa(cfg.Port)
+		if cfg.Host == "0.0.0.0" || cfg.Host == "" {
+			*url = "http://127.0.0.1:" + strconv.Itoa(cfg.Port)
+		}
+	}
+	if *key == "" && len(cfg.AuthKeys) > 0 {
+		*key = cfg.AuthKeys[0]
+	}
+	if *model == "" {
+		*model = cfg.DefaultModel
+	}
+	// Each request is distinct so the response cache and in-flight
+	// deduplication cannot answer it
+	request := func(i int) []byte {
+		data, _ := json.Marshal(map[string]interface{}{
+			"model":      *model,
+			"max_tokens": *maxTokens,
+			"stream":     *stream,
+			"messages": []interface{}{map[string]interface{}{
+				"role": "user", "content": fmt.Sprintf("Benchmark request %d. Reply with the single word OK.", i),
+			}},
+		})
+		return data
+	}
+	client := &http.Client{Transport: &http.Transport{MaxIdleConnsPerHost: *concurrency}}
+	ctx := context.Background()
+
+	fmt.Printf("Sending %d requests to %s, %d at a time\n", *requests, *url, *concurrency)
+	bridge := bench(*requests, *concurrency, func(i int) benchResult {
+		req, _ := http.NewRequestWithContext(ctx, "POST", *url+"/v1/messages", bytes.NewReader(request(i)))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("anthropic-version", "2023-06-01")
+		if *key != "" {
+			req.Header.Set("x-api-key", *key)
+		}
+		start := time.Now()
+		res, err := client.Do(req)
+		return timeResponse(start, res, err)
+	})
+	bridge.print("bridge", *stream)
+	code := 0
+	if bridge.failed > 0 {
+		code = 1
+	}
+	if !*direct {
+		return code
+	}
+
+	p := proxy.NewChatProxy(cfg)
+	fmt.Printf("\nSending %d requests straight to the upstream, %d at a time\n", *requests, *concurrency)
+	upstream := bench(*requests, *concurrency, func(i int) benchResult {
+		var req models.MessagesRequest
+		json.Unmarshal(request(i), &req)
+		start := time.Now()
+		res, err := p.SendDirect(ctx, &req)
+		return timeResponse(start, res, err)
+	})
+	upstream.print("upstream", *stream)
+	if upstream.failed > 0 {
+		code = 1
+	}
+	if len(bridge.latencies) == 0 || len(upstream.latencies) == 0 {
+		return code
+	}
+	fmt.Println("\noverhead")
+	fmt.Printf("  latency     %s\n", overhead(bridge.latencies, upstream.latencies))
+	if *stream {
+		fmt.Printf("  first byte  %s\n", overhead(bridge.firstBytes, upstream.firstBytes))
+	}
+	return code
+}
+
+// timeResponse reads res to the end and times it from start. Non-2xx
+// responses are failures.
+func timeResponse(start time.Time, res *http.Response, err error) benchResult {
+	if err != nil {
+		return benchResult{err: err}
+	}
+	defer res.Body.Close()
+	var r benchResult
+	buf := make([]byte, 32<<10)
+	n, err := res.Body.Read(buf)
+	r.firstByte = time.Since(start)
+	body := bytes.NewBuffer(buf[:n])
+	if err == nil {
+		_, err = body.ReadFrom(res.Body)
+	}
+	r.latency = time.Since(start)
+	switch {
+	case res.StatusCode/100 != 2:
+		r.err = fmt.Errorf("status %d: %s", res.StatusCode, bytes.TrimSpace(body.Bytes()))
+	case err != nil && err != io.EOF:
+		r.err = err
+	}
+	return r
+}
+
+// benchRun summarizes the requests of one benchmark.
+type benchRun struct {
+	elapsed    time.Duration
+	latencies  []time.Duration // Sorted, successful requests only
+	firstBytes []time.Duration // Sorted, successful requests only
+	failed     int
+	firstErr   error
+}
+
+// bench calls send for requests 0 to n-1, concurrency at a time.
+func bench(n, concurrency int, send func(i int) benchResult) *benchRun {
+	results := make([]benchResult, n)
+	var next atomic.Int64
+	var wg sync.WaitGroup
+	start := time.Now()
+	for range min(concurrency, n) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := int(next.Add(1)) - 1; i < n; i = int(next.Add(1)) - 1 {
+				results[i] = send(i)
+			}
+		}()
+	}
+	wg.Wait()
+	run := &benchRun{elapsed: time.Since(start)}
+	for _, r := range results {
+		if r.err != nil {
+			run.failed++
+			if run.firstErr == nil {
+				run.firstErr = r.err
+			}
+			continue
+		}
+		run.latencies = append(run.latencies, r.latency)
+		run.firstBytes = append(run.firstBytes, r.firstByte)
+	}
+	slices.Sort(run.latencies)
+	slices.Sort(run.firstBytes)
+	return run
+}
+
+func (r *benchRun) print(name string, stream bool) {
+	total := len(r.latencies) + r.failed
+	fmt.Printf("%s\n  requests    %d ok, %d failed in %s, %.1f req/s\n",
+		name, len(r.latencies), r.failed, r.elapsed.Round(time.Millisecond), float64(total)/r.elapsed.Seconds())
+	if r.firstErr != nil {
+		fmt.Printf("  first error %v\n", r.firstErr)
+	}
+	if len(r.latencies) == 0 {
+		return
+	}
+	fmt.Printf("  latency     %s\n", percentiles(r.latencies))
+	if stream {
+		fmt.Printf("  first byte  %s\n", percentiles(r.firstBytes))
+	}
+}
+
+// benchQuantiles are the percentiles reported.
+var benchQuantiles = []float64{0.5, 0.9, 0.99}
+
+// percentile returns the q quantile of sorted by the nearest-rank method.
+func percentile(sorted []time.Duration, q float64) time.Duration {
+	i := int(math.Ceil(q*float64(len(sorted)))) - 1
+	return sorted[max(i, 0)]
+}
+
+func percentiles(sorted []time.Duration) string {
+	var s string
+	for _, q := range benchQuantiles {
+		s += fmt.Sprintf("p%g %s  ", q*100, percentile(sorted, q).Round(100*time.Microsecond))
+	}
+	return s + "max " + sorted[len(sorted)-1].Round(100*time.Microsecond).String()
+}
+
+// overhead formats the per-percentile difference between two runs.
+func overhead(bridge, upstream []time.Duration) string {
+	var s string
+	for _, q := range benchQuantiles {
+		d := percentile(bridge, q) - percentile(upstream, q)
+		sign := "+"
+		if d < 0 {
+			sign = "-"
+			d = -d
+		}
+		s += fmt.Sprintf("p%g %s%s  ", q*100, sign, d.Round(100*time.Microsecond))
+	}
+	return s[:len(s)-2]
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+const completionUsage = `Usage: gopenbridge completion bash|zsh|fish
+
+Print a script that completes gopenbridge commands, their arguments and
+flags in the given shell. Load it from the shell's startup file:
+
+  bash  source <(gopenbridge completion bash)         in ~/.bashrc
+  zsh   source <(gopenbridge completion zsh)          in ~/.zshrc, after compinit
+  fish  gopenbridge completion fish | source          in ~/.config/fish/config.fish
+`
+
+// completeCommand is the hidden command the scripts call with the words
+// typed so far, the last one being completed.
+const completeCommand = "__complete"
+
+// completionScripts ask gopenbridge for the candidates, falling back to
+// file names, which flags like -o and -record take.
+var completionScripts = map[string]string{
+	"bash": `_gopenbridge() {
+	local IFS=$'\n'
+	COMPREPLY=($(gopenbridge ` + completeCommand + ` "${COMP_WORDS[@]:1:COMP_CWORD}" 2>/dev/null))
+}
+complete -o default -F _gopenbridge gopenbridge
+`,
+	"zsh": `#compdef gopenbridge
+_gopenbridge() {
+	local -a candidates
+	candidates=(${(f)"$(gopenbridge ` + completeCommand + ` "${(@)words[2,CURRENT]}" 2>/dev/null)"})
+	if (( ${#candidates} )); then
+		compadd -a candidates
+	else
+		_files
+	fi
+}
+compdef _gopenbridge gopenbridge
+`,
+	"fish": `complete -c gopenbridge -a '(gopenbridge ` + completeCommand + ` (commandline -opc)[2..-1] (commandline -ct) 2>/dev/null)'
+`,
+}
+
+// runCompletion implements the completion subcommand and returns the exit
+// code.
+func runCompletion(args []string) int {
+	if len(args) > 0 && isHelp(args[0]) {
+		fmt.Fprint(os.Stderr, completionUsage)
+		return 0
+	}
+	if len(args) != 1 {
+		fmt.Fprint(os.Stderr, completionUsage)
+		return 2
+	}
+	script, ok := completionScripts[args[0]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "gopenbridge completion: unsupported shell %q\n", args[0])
+		fmt.Fprint(os.Stderr, completionUsage)
+		return 2
+	}
+	fmt.Print(script)
+	return 0
+}
+
+// runComplete prints the candidates for the last of words, one per line.
+func runComplete(words []string) int {
+	if len(words) == 0 {
+		return 0
+	}
+	prev, cur := words[:len(words)-1], words[len(words)-1]
+	var candidates []string
+	switch c, ok := lookup(first(prev)); {
+	case len(prev) == 0 && !strings.HasPrefix(cur, "-"):
+		for _, c := range commands {
+			candidates = append(candidates, c.name)
+			candidates = append(candidates, c.aliases...)
+		}
+	case strings.HasPrefix(cur, "-"):
+		if !ok {
+			// Flags without a command are for serve
+			c, _ = lookup("serve")
+		}
+		candidates = usageFlags(c.usage)
+	case ok && len(prev) == 1 && c.name == "help":
+		for _, c := range commands {
+			candidates = append(candidates, c.name)
+		}
+	case ok && len(prev) == 1:
+		candidates = c.words
+	}
+	for _, s := range candidates {
+		if strings.HasPrefix(s, cur) {
+			fmt.Println(s)
+		}
+	}
+	return 0
+}
+
+// first returns the first of words, or "".
+func first(words []string) string {
+	if len(words) == 0 {
+		return ""
+	}
+	return words[0]
+}
+
+// flagLine matches a flag at the start of a line of a usage text's flag
+// list; continuation lines are indented further.
+var flagLine = regexp.MustCompile(`(?m)^  (-[a-z][a-z0-9-]*)`)
+
+// usageFlags returns the flags a command's usage text documents, so that
+// completion follows the usage.
+func usageFlags(usage string) []string {
+	var flags []string
+	for _, m := range flagLine.FindAllStringSubmatch(usage, -1) {
+		flags = append(flags, m[1])
+	}
+	return flags
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"gopenbridge/config"
+	"gopenbridge/logging"
+	"gopenbridge/proxy"
+	"io"
+	"log/slog"
+	"os"
+)
+
+const configUsage = `Usage: gopenbridge config validate [-ping]
+
+Check the configuration: parse the config file, report unknown keys (with
+the likely intended ones), invalid values and settings the configured
+providers need but lack. Exits 1 if anything is wrong.
+
+Flags:
+  -ping  Also list each upstream's models, to check it is reachable and
+         accepts the API key
+`
+
+// runConfig implements the config subcommand and returns the exit code.
+func runConfig(args []string) int {
+	if len(args) > 0 && isHelp(args[0]) {
+		fmt.Fprint(os.Stderr, configUsage)
+		return 0
+	}
+	if len(args) == 0 || args[0] != "validate" {
+		fmt.Fprint(os.Stderr, configUsage)
+		return 2
+	}
+	fs := flag.NewFlagSet("config validate", flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprint(os.Stderr, configUsage) }
+	ping := fs.Bool("ping", false, "")
+	if code, ok := parseFlags(fs, args[1:]); !ok {
+		return code
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return 2
+	}
+	// Problems are reported below rather than logged
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if path := config.FilePath(); path != "" {
+		fmt.Printf("Config file: %s\n", path)
+	} else {
+		fmt.Println("No config file, using the environment and defaults")
+	}
+	cfg, problems, err := config.Validate()
+	if err != nil {
+		fmt.Printf("  %v\n", err)
+		return 1
+	}
+	if _, err := logging.New(io.Discard, cfg.LogLevel, cfg.LogFormat); err != nil {
+		problems = append(problems, config.Problem{Key: "log_level", Message: err.Error()})
+	}
+	for _, pr := range problems {
+		fmt.Printf("  %s\n", pr)
+	}
+	// Validation is read-only: the database is never opened, so checking
+	// a new binary's config cannot migrate a production store
+	upstream := proxy.ValidateUpstreams(cfg)
+	for _, pr := range upstream {
+		fmt.Printf("  %s\n", pr)
+	}
+	problems = append(problems, upstream...)
+	code := 0
+	switch len(problems) {
+	case 0:
+		fmt.Println("Configuration is valid")
+	case 1:
+		code = 1
+		fmt.Println("1 problem found")
+	default:
+		code = 1
+		fmt.Printf("%d problems found\n", len(problems))
+	}
+	if !*ping {
+		return code
+	}
+	fmt.Println("\nListing upstream models:")
+	list, err := proxy.ListModels(context.Background(), cfg)
+	for _, e := range list {
+		fmt.Printf("  %s (%s): reachable, %d models\n", e.Upstream, e.Provider, len(e.Models))
+	}
+	if err != nil {
+		fmt.Printf("  %v\n", err)
+		code = 1
+	}
+	fmt.Println("Upstreams that cannot list models are not pinged; gopenbridge doctor sends a real request.")
+	return code
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines shown around changes.
+const diffContext = 3
+
+// maxDiffCells caps the comparison table of lineDiff; larger changes are
+// shown as one replaced block.
+const maxDiffCells = 4 << 20
+
+// indentJSON pretty-prints s if it is JSON, so diffs are line by line.
+func indentJSON(s string) string {
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, []byte(s), "", "  "); err != nil {
+		return s
+	}
+	return buf.String()
+}
+
+// unifiedDiff returns the differences from a to b in unified diff format,
+// or "" when they are equal.
+func unifiedDiff(aName, bName, a, b string) string {
+	if a == b {
+		return ""
+	}
+	ops := lineDiff(strings.Split(a, "\n"), strings.Split(b, "\n"))
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", aName, bName)
+	for start := 0; start < len(ops); {
+		// Find the next change and the hunk around it
+		for start < len(ops) && ops[start].kind == ' ' {
+			start++
+		}
+		if start == len(ops) {
+			break
+		}
+		from := max(start-diffContext, 0)
+		end, unchanged := start, 0
+		for end < len(ops) && unchanged <= 2*diffContext {
+			if ops[end].kind == ' ' {
+				unchanged++
+			} else {
+				unchanged = 0
+			}
+			end++
+		}
+		end = min(end-max(unchanged-diffContext, 0), len(ops))
+		aLine, bLine := ops[from].aLine, ops[from].bLine
+		var aCount, bCount int
+		for _, op := range ops[from:end] {
+			if op.kind != '+' {
+				aCount++
+			}
+			if op.kind != '-' {
+				bCount++
+			}
+		}
+		fmt.Fprintf(&out, "@@ -%d,%d +%d,%d @@\n", aLine+1, aCount, bLine+1, bCount)
+		for _, op := range ops[from:end] {
+			fmt.Fprintf(&out, "%c%s\n", op.kind, op.text)
+		}
+		start = end
+	}
+	return out.String()
+}
+
+// diffOp is one line of a diff: ' ' kept, '-' removed from a, '+' added
+// in b. aLine and bLine are the 0-based positions before the line.
+type diffOp struct {
+	kind         byte
+	text         string
+	aLine, bLine int
+}
+
+// lineDiff returns the edit script from a to b, keeping a longest common
+// subsequence of lines.
+func lineDiff(a, b []string) []diffOp {
+	// Common prefix and suffix need no table
+	pre := 0
+	for pre < len(a) && pre < len(b) && a[pre] == b[pre] {
+		pre++
+	}
+	suf := 0
+	for suf < len(a)-pre && suf < len(b)-pre && a[len(a)-1-suf] == b[len(b)-1-suf] {
+		suf++
+	}
+	ma, mb := a[pre:len(a)-suf], b[pre:len(b)-suf]
+	var ops []diffOp
+	for i := 0; i < pre; i++ {
+		ops = append(ops, diffOp{' ', a[i], i, i})
+	}
+	i, j := 0, 0
+	if len(ma)*len(mb) <= maxDiffCells {
+		// lcs[i][j] is the LCS length of ma[i:] and mb[j:]
+		w := len(mb) + 1
+		lcs := make([]int32, (len(ma)+1)*w)
+		for x := len(ma) - 1; x >= 0; x-- {
+			for y := len(mb) - 1; y >= 0; y-- {
+				if ma[x] == mb[y] {
+					lcs[x*w+y] = lcs[(x+1)*w+y+1] + 1
+				} else {
+					lcs[x*w+y] = max(lcs[(x+1)*w+y], lcs[x*w+y+1])
+				}
+			}
+		}
+		for i < len(ma) && j < len(mb) {
+			switch {
+			case ma[i] == mb[j]:
+				ops = append(ops, diffOp{' ', ma[i], pre + i, pre + j})
+				i++
+				j++
+			case lcs[(i+1)*w+j] >= lcs[i*w+j+1]:
+				ops = append(ops, diffOp{'-', ma[i], pre + i, pre + j})
+				i++
+			default:
+				ops = append(ops, diffOp{'+', mb[j], pre + i, pre + j})
+				j++
+			}
+		}
+	}
+	for ; i < len(ma); i++ {
+		ops = append(ops, diffOp{'-', ma[i], pre + i, pre + j})
+	}
+	for ; j < len(mb); j++ {
+		ops = append(ops, diffOp{'+', mb[j], pre + len(ma), pre + j})
+	}
+	for k := 0; k < suf; k++ {
+		ops = append(ops, diffOp{' ', a[len(a)-suf+k], len(a) - suf + k, len(b) - suf + k})
+	}
+	return ops
+}
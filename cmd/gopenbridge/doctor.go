@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"gopenbridge/config"
+	"gopenbridge/proxy"
+	"io"
+	"log/slog"
+	"os"
+)
+
+const doctorUsage = `Usage: gopenbridge doctor [-model NAME]
+
+Check the configuration end to end: resolve the upstream, then send a tiny
+request, a streaming request and a tool call through it, and report
+whether authentication, the model, streaming and tool calls work. Exits 1
+if a check fails. "gopenbridge test" is the same command.
+
+Flags:
+  -model NAME  Client model to test, as Claude Code would send it
+               (default: default_model)
+`
+
+// runDoctor implements the doctor subcommand and returns the exit code.
+func runDoctor(args []string) int {
+	fs := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprint(os.Stderr, doctorUsage) }
+	model := fs.String("model", "", "")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return 2
+	}
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		fmt.Printf("FAIL  config     %v\n", err)
+		return 1
+	}
+	// Failures are in the report, the request log has the rest
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	fmt.Printf("PASS  config     %s\n", configSource())
+	// Write the checks' log rows before exiting
+	cfg.LogQueueSize = 0
+	code := 0
+	for _, c := range proxy.NewChatProxy(cfg).Doctor(context.Background(), *model) {
+		switch {
+		case c.Err != nil:
+			code = 1
+			fmt.Printf("FAIL  %-10s %v\n", c.Name, c.Err)
+		case c.Skipped:
+			fmt.Printf("SKIP  %-10s %s\n", c.Name, c.Detail)
+		default:
+			fmt.Printf("PASS  %-10s %s\n", c.Name, c.Detail)
+		}
+	}
+	return code
+}
+
+// configSource describes where the configuration was loaded from.
+func configSource() string {
+	if path := config.FilePath(); path != "" {
+		return "loaded from " + path
+	}
+	return "loaded from the environment"
+}
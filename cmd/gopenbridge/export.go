@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"gopenbridge/config"
+	"gopenbridge/logging"
+	"gopenbridge/logstore"
+	"gopenbridge/proxy"
+	"log/slog"
+	"os"
+	"time"
+)
+
+const exportUsage = `Usage: gopenbridge export [flags]
+
+Write the request log (api_logs) matching the flags to stdout, oldest first,
+for offline analysis.
+
+Flags:
+  -format jsonl|csv  Output format (default jsonl)
+  -since TIME        Only requests at or after TIME (RFC 3339 or YYYY-MM-DD, UTC)
+  -until TIME        Only requests before TIME
+  -model NAME        Only requests to this upstream model
+  -key NAME          Only requests made with this virtual key
+  -status CODE       Only requests that ended with this HTTP status
+  -no-bodies         Leave out the request and response bodies
+  -o FILE            Write to FILE instead of stdout
+`
+
+// runExport implements the export subcommand and returns the exit code.
+func runExport(args []string) int {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprint(os.Stderr, exportUsage) }
+	format := fs.String("format", logstore.JSONL, "")
+	since := fs.String("since", "", "")
+	until := fs.String("until", "", "")
+	model := fs.String("model", "", "")
+	key := fs.String("key", "", "")
+	status := fs.Int("status", 0, "")
+	noBodies := fs.Bool("no-bodies", false, "")
+	out := fs.String("o", "", "")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return 2
+	}
+	f := logstore.Filter{Model: *model, Key: *key, Status: *status}
+	for _, p := range []struct {
+		name, value string
+		dst         *time.Time
+	}{{"since", *since, &f.Since}, {"until", *until, &f.Until}} {
+		if p.value == "" {
+			continue
+		}
+		t, err := parseExportTime(p.value)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "gopenbridge export: -%s must be an RFC 3339 time or a YYYY-MM-DD date\n", p.name)
+			return 2
+		}
+		*p.dst = t
+	}
+	if _, ok := logstore.ContentType(*format); !ok {
+		fmt.Fprintf(os.Stderr, "gopenbridge export: -format must be %s or %s\n", logstore.JSONL, logstore.CSV)
+		return 2
+	}
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "gopenbridge export: failed to load config: %v\n", err)
+		return 1
+	}
+	if logger, err := logging.New(os.Stderr, cfg.LogLevel, cfg.LogFormat); err == nil {
+		slog.SetDefault(logger)
+	}
+	w := os.Stdout
+	if *out != "" {
+		if w, err = os.Create(*out); err != nil {
+			fmt.Fprintf(os.Stderr, "gopenbridge export: %v\n", err)
+			return 1
+		}
+		defer w.Close()
+	}
+	bw := bufio.NewWriter(w)
+	n, err := logstore.Export(context.Background(), proxy.NewChatProxy(cfg).Logs(), bw, *format, f, !*noBodies)
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "gopenbridge export: %v\n", err)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "Exported %d requests\n", n)
+	return 0
+}
+
+// parseExportTime accepts RFC 3339 times and dates, read as UTC midnight.
+func parseExportTime(v string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, v)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"gopenbridge/secrets"
+	"io"
+	"os"
+	"strings"
+)
+
+const keyUsage = `Usage: gopenbridge key <command> <name>
+
+Store upstream API keys in the OS keychain and reference them in the config
+file as api_key: keychain://<name>.
+
+Commands:
+  set <name>     Store a key, read from stdin
+  get <name>     Print a stored key
+  delete <name>  Remove a stored key
+`
+
+// runKey implements the key subcommand and returns the exit code.
+func runKey(args []string) int {
+	if len(args) > 0 && isHelp(args[0]) {
+		fmt.Fprint(os.Stderr, keyUsage)
+		return 0
+	}
+	if len(args) != 2 {
+		fmt.Fprint(os.Stderr, keyUsage)
+		return 2
+	}
+	command, name := args[0], args[1]
+	var err error
+	switch command {
+	case "set":
+		var secret string
+		if secret, err = readSecret(os.Stdin); err == nil {
+			err = secrets.KeychainSet(name, secret)
+		}
+		if err == nil {
+			fmt.Fprintf(os.Stderr, "Stored %s, use api_key: keychain://%s\n", name, name)
+		}
+	case "get":
+		var secret string
+		if secret, err = secrets.KeychainGet(name); err == nil {
+			fmt.Println(secret)
+		}
+	case "delete":
+		err = secrets.KeychainDelete(name)
+	default:
+		fmt.Fprint(os.Stderr, keyUsage)
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "gopenbridge key %s %s: %v\n", command, name, err)
+		return 1
+	}
+	return 0
+}
+
+// readSecret reads one line from r, prompting when r is a terminal.
+func readSecret(r *os.File) (string, error) {
+	if fi, err := r.Stat(); err == nil && fi.Mode()&os.ModeCharDevice != 0 {
+		fmt.Fprint(os.Stderr, "API key: ")
+	}
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	secret := strings.TrimSpace(line)
+	if secret == "" {
+		return "", errors.New("empty key")
+	}
+	return secret, nil
+}
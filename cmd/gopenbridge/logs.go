@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"gopenbridge/config"
+	"gopenbridge/logging"
+	"gopenbridge/logstore"
+	"gopenbridge/proxy"
+	"log/slog"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"time"
+)
+
+const logsUsage = `Usage: gopenbridge logs [-f] [-n N] [flags]
+
+Print the latest requests from the request log (api_logs), oldest first:
+time, ID, status, model, latency, tokens and the start of the last user
+message or the error. With -f, keep printing new requests as they are
+logged, like tail -f.
+
+Flags:
+  -f             Follow the log
+  -n N           Print the last N requests first (default 10)
+  -model NAME    Only requests to this upstream model
+  -key NAME      Only requests made with this virtual key
+  -status CODE   Only requests that ended with this HTTP status
+`
+
+// logsPollInterval is how often logs -f checks for new rows.
+const logsPollInterval = time.Second
+
+// runLogs implements the logs subcommand and returns the exit code.
+func runLogs(args []string) int {
+	fs := flag.NewFlagSet("logs", flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprint(os.Stderr, logsUsage) }
+	follow := fs.Bool("f", false, "")
+	n := fs.Int("n", 10, "")
+	model := fs.String("model", "", "")
+	key := fs.String("key", "", "")
+	status := fs.Int("status", 0, "")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if fs.NArg() > 0 || *n < 0 {
+		fs.Usage()
+		return 2
+	}
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "gopenbridge logs: failed to load config: %v\n", err)
+		return 1
+	}
+	if logger, err := logging.New(os.Stderr, cfg.LogLevel, cfg.LogFormat); err == nil {
+		slog.SetDefault(logger)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	logs := proxy.NewChatProxy(cfg).Logs()
+	f := logstore.Filter{Model: *model, Key: *key, Status: *status, Limit: *n}
+	var rows []logstore.Log
+	if *n > 0 {
+		if rows, err = logs.QueryLogs(ctx, f); err != nil {
+			fmt.Fprintf(os.Stderr, "gopenbridge logs: %v\n", err)
+			return 1
+		}
+		slices.Reverse(rows)
+	}
+	// Rows are polled from the newest timestamp printed; seen holds the IDs
+	// printed at that timestamp so they are not printed twice
+	f.Since = time.Now().UTC()
+	seen := map[string]bool{}
+	for {
+		for _, l := range rows {
+			if seen[l.ID] {
+				continue
+			}
+			if full, err := logs.GetLog(ctx, l.ID); err == nil {
+				l = *full
+			}
+			fmt.Println(formatLogLine(l))
+			if l.Timestamp.After(f.Since) {
+				f.Since = l.Timestamp
+				clear(seen)
+			}
+			seen[l.ID] = true
+		}
+		if !*follow {
+			return 0
+		}
+		select {
+		case <-ctx.Done():
+			return 0
+		case <-time.After(logsPollInterval):
+		}
+		f.Limit = 1000
+		if rows, err = logs.QueryLogs(ctx, f); err != nil {
+			if ctx.Err() != nil {
+				return 0
+			}
+			fmt.Fprintf(os.Stderr, "gopenbridge logs: %v\n", err)
+			return 1
+		}
+		slices.Reverse(rows)
+	}
+}
+
+// formatLogLine renders l as one line of the logs output.
+func formatLogLine(l logstore.Log) string {
+	latency := "-"
+	if l.LatencyMs > 0 {
+		latency = fmt.Sprintf("%dms", l.LatencyMs)
+	}
+	line := fmt.Sprintf("%s  %s  %3d  %-24s %7s  %6d in %5d out",
+		l.Timestamp.Local().Format("2006-01-02 15:04:05"), l.ID, l.StatusCode, l.Model, latency, l.PromptTokens, l.CompletionTokens)
+	if l.KeyName != "" {
+		line += "  key=" + l.KeyName
+	}
+	if l.ErrorMessage != "" {
+		return line + "  error: " + truncateLine(l.ErrorMessage, 100)
+	}
+	prompt := lastUserText(l.ClientRequest)
+	if prompt == "" {
+		prompt = lastUserText(l.Request)
+	}
+	if prompt != "" {
+		line += "  " + truncateLine(prompt, 80)
+	}
+	return line
+}
+
+// lastUserText returns the text of the last user message in a messages or
+// chat completions request body, or "" if it has none.
+func lastUserText(body string) string {
+	var req struct {
+		Messages []struct {
+			Role    string          `json:"role"`
+			Content json.RawMessage `json:"content"`
+		} `json:"messages"`
+	}
+	if json.Unmarshal([]byte(body), &req) != nil {
+		return ""
+	}
+	for i := len(req.Messages) - 1; i >= 0; i-- {
+		m := req.Messages[i]
+		if m.Role != "user" {
+			continue
+		}
+		var s string
+		if json.Unmarshal(m.Content, &s) == nil {
+			return s
+		}
+		var blocks []struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		}
+		json.Unmarshal(m.Content, &blocks)
+		var parts []string
+		for _, b := range blocks {
+			if b.Text != "" {
+				parts = append(parts, b.Text)
+			} else {
+				parts = append(parts, "["+b.Type+"]")
+			}
+		}
+		return strings.Join(parts, " ")
+	}
+	return ""
+}
+
+// truncateLine collapses whitespace in s and truncates it to n runes.
+func truncateLine(s string, n int) string {
+	r := []rune(strings.Join(strings.Fields(s), " "))
+	if len(r) > n {
+		return string(r[:n]) + "…"
+	}
+	return string(r)
+}
@@ -1,41 +1,124 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
-	"gopenbridge/config"
-	"gopenbridge/server"
-	"log"
+	"os"
+	"slices"
+	"strings"
 )
 
-func main() {
-	// Load configuration
-	cfg, err := config.LoadConfig()
-	if err != nil {
-		log.Fatalf("failed to load config: %v", err)
+// command is a gopenbridge subcommand.
+type command struct {
+	name    string
+	aliases []string
+	summary string   // One line for gopenbridge help
+	usage   string   // Printed by -h and gopenbridge help <command>
+	words   []string // Arguments completed after the command, e.g. key's set/get/delete
+	run     func(args []string) int
+}
+
+// commands lists the subcommands in the order gopenbridge help shows them.
+// It is filled in by init, since help and completion refer back to it.
+var commands []command
+
+func init() {
+	commands = []command{
+		{name: "serve", summary: "Run the proxy (the default)", usage: serveUsage, run: runServe},
+		{name: "doctor", aliases: []string{"test"}, summary: "Check the setup end to end with real requests", usage: doctorUsage, run: runDoctor},
+		{name: "config", summary: "Validate the configuration", usage: configUsage, words: []string{"validate"}, run: runConfig},
+		{name: "models", summary: "List the models each upstream offers", usage: modelsUsage, run: runModels},
+		{name: "logs", summary: "Print and follow the request log", usage: logsUsage, run: runLogs},
+		{name: "stats", summary: "Summarize usage, errors and cost per model", usage: statsUsage, run: runStats},
+		{name: "export", summary: "Export the request log as JSONL or CSV", usage: exportUsage, run: runExport},
+		{name: "replay", summary: "Send a logged request again and diff the result", usage: replayUsage, run: runReplay},
+		{name: "bench", summary: "Benchmark latency and throughput of a running bridge", usage: benchUsage, run: runBench},
+		{name: "key", summary: "Store upstream API keys in the OS keychain", usage: keyUsage, words: []string{"set", "get", "delete"}, run: runKey},
+		{name: "version", summary: "Print the version and build info", usage: versionUsage, run: runVersion},
+		{name: "completion", summary: "Print a shell completion script", usage: completionUsage, words: []string{"bash", "zsh", "fish"}, run: runCompletion},
+		{name: "help", summary: "Show help for a command", usage: helpUsage, run: runHelp},
 	}
+}
+
+const helpUsage = `Usage: gopenbridge help [command]
 
-	// Parse CLI flags
-	host := flag.String("host", cfg.Host, "Host to bind to")
-	port := flag.Int("port", cfg.Port, "Port to bind to")
-	reload := flag.Bool("reload", false, "Enable auto-reload for development (not supported)")
-	flag.Parse()
-
-	// Print configuration info
-	config.PrintConfigInfo(cfg)
-	fmt.Println()
-	if cfg.Debug {
-		fmt.Println("🔍 Debug logging enabled")
+Print the list of commands, or the usage of one command.
+`
+
+// lookup returns the command called name, directly or by an alias.
+func lookup(name string) (command, bool) {
+	for _, c := range commands {
+		if c.name == name || slices.Contains(c.aliases, name) {
+			return c, true
+		}
 	}
+	return command{}, false
+}
+
+// usage is the overview printed by gopenbridge help.
+func usage() string {
+	var b strings.Builder
+	b.WriteString("Usage: gopenbridge [command] [flags]\n\nCommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(&b, "  %-11s %s\n", c.name, c.summary)
+	}
+	b.WriteString("\nWithout a command, gopenbridge runs serve. Run gopenbridge help <command>\nor gopenbridge <command> -h for a command's flags.\n")
+	return b.String()
+}
 
-	// Start server
-	fmt.Printf("🌉 gopenbridge proxy starting on %s:%d\n", *host, *port)
-	fmt.Printf("📋 Config: ANTHROPIC_BASE_URL=http://%s:%d/\n", *host, *port)
-	// Update config host and port
-	cfg.Host = *host
-	cfg.Port = *port
-	_ = reload // reload flag not implemented
-	if err := server.StartServer(cfg); err != nil {
-		log.Fatalf("server error: %v", err)
+// runHelp implements the help subcommand and returns the exit code.
+func runHelp(args []string) int {
+	switch len(args) {
+	case 0:
+		fmt.Print(usage())
+		return 0
+	case 1:
+		if c, ok := lookup(args[0]); ok {
+			fmt.Print(c.usage)
+			return 0
+		}
+		fmt.Fprintf(os.Stderr, "gopenbridge help: unknown command %q\n", args[0])
+	}
+	fmt.Fprint(os.Stderr, helpUsage)
+	return 2
+}
+
+// parseFlags parses a subcommand's flags the same way for every command:
+// -h prints the usage and exits 0, an invalid flag prints the error and
+// the usage and exits 2. ok is false when the command should return code.
+func parseFlags(fs *flag.FlagSet, args []string) (code int, ok bool) {
+	if err := fs.Parse(args); errors.Is(err, flag.ErrHelp) {
+		return 0, false
+	} else if err != nil {
+		return 2, false
+	}
+	return 0, true
+}
+
+// isHelp reports whether arg asks for the usage, for commands that take
+// words rather than flags.
+func isHelp(arg string) bool {
+	return slices.Contains([]string{"-h", "-help", "--help"}, arg)
+}
+
+func main() {
+	args := os.Args[1:]
+	switch {
+	case len(args) > 0 && isHelp(args[0]):
+		os.Exit(runHelp(nil))
+	case len(args) > 0 && (args[0] == "-version" || args[0] == "--version"):
+		os.Exit(runVersion(nil))
+	case len(args) == 0 || strings.HasPrefix(args[0], "-"):
+		// Flags without a command are for serve, as before subcommands
+		os.Exit(runServe(args))
+	case args[0] == completeCommand:
+		os.Exit(runComplete(args[1:]))
+	}
+	c, ok := lookup(args[0])
+	if !ok {
+		fmt.Fprintf(os.Stderr, "gopenbridge: unknown command %q\n\n%s", args[0], usage())
+		os.Exit(2)
 	}
+	os.Exit(c.run(args[1:]))
 }
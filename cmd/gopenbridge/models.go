@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"gopenbridge/catalog"
+	"gopenbridge/config"
+	"gopenbridge/logging"
+	"gopenbridge/proxy"
+	"log/slog"
+	"os"
+)
+
+const modelsUsage = `Usage: gopenbridge models [-cached] [-check]
+
+List the models each configured upstream offers, as reported by its models
+endpoint, and cache the lists in the database.
+
+Flags:
+  -cached  Print the cached lists without querying the upstreams
+  -check   Also warn about configured model names the upstreams do not offer
+`
+
+// runModels implements the models subcommand and returns the exit code.
+func runModels(args []string) int {
+	fs := flag.NewFlagSet("models", flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprint(os.Stderr, modelsUsage) }
+	cached := fs.Bool("cached", false, "")
+	check := fs.Bool("check", false, "")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return 2
+	}
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "gopenbridge models: failed to load config: %v\n", err)
+		return 1
+	}
+	if logger, err := logging.New(os.Stderr, cfg.LogLevel, cfg.LogFormat); err == nil {
+		slog.SetDefault(logger)
+	}
+	ctx := context.Background()
+	p := proxy.NewChatProxy(cfg)
+	var list []catalog.Entry
+	code := 0
+	if *cached {
+		list, err = p.CachedModels(ctx)
+	} else {
+		list, err = p.RefreshModels(ctx)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "gopenbridge models: %v\n", err)
+		code = 1
+	}
+	for _, e := range list {
+		fmt.Printf("%s (%s, fetched %s)\n", e.Upstream, e.Provider, e.FetchedAt.Local().Format("2006-01-02 15:04"))
+		for _, m := range e.Models {
+			fmt.Printf("  %s\n", m)
+		}
+	}
+	if *check && p.ValidateModels(ctx) > 0 {
+		code = 1
+	}
+	return code
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"gopenbridge/config"
+	"gopenbridge/logging"
+	"gopenbridge/logstore"
+	"gopenbridge/proxy"
+	"log/slog"
+	"os"
+)
+
+const replayUsage = `Usage: gopenbridge replay <log-id> [-model NAME] [-provider NAME]
+
+Send a logged request through the current configuration again, without
+streaming, and diff the upstream request and response against the logged
+ones. Requests logged before replay support cannot be replayed.
+
+Flags:
+  -model NAME     Request this model instead of the logged one
+  -provider NAME  Send to this provider profile instead of the routed upstream
+`
+
+// runReplay implements the replay subcommand and returns the exit code.
+func runReplay(args []string) int {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprint(os.Stderr, replayUsage) }
+	model := fs.String("model", "", "")
+	provider := fs.String("provider", "", "")
+	// Flags may come before or after the log ID
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+	id := fs.Arg(0)
+	if code, ok := parseFlags(fs, fs.Args()[1:]); !ok {
+		return code
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return 2
+	}
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "gopenbridge replay: failed to load config: %v\n", err)
+		return 1
+	}
+	if logger, err := logging.New(os.Stderr, cfg.LogLevel, cfg.LogFormat); err == nil {
+		slog.SetDefault(logger)
+	}
+	// Write the replay's own log row before exiting
+	cfg.LogQueueSize = 0
+	ctx := context.Background()
+	p := proxy.NewChatProxy(cfg)
+	l, err := p.Logs().GetLog(ctx, id)
+	if errors.Is(err, logstore.ErrNotFound) {
+		fmt.Fprintf(os.Stderr, "gopenbridge replay: no log with ID %s\n", id)
+		return 1
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "gopenbridge replay: %v\n", err)
+		return 1
+	}
+	res, err := p.Replay(ctx, l, proxy.ReplayOptions{Model: *model, Provider: *provider})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "gopenbridge replay: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Replayed %s (%s, %s) as %s\n", l.ID, l.Model, l.Provider, res.ID)
+	for _, d := range []struct{ name, logged, replayed string }{
+		{"upstream request", l.Request, res.Request},
+		{"upstream response", l.Response, res.Response},
+	} {
+		diff := unifiedDiff("logged "+d.name, "replayed "+d.name, indentJSON(d.logged), indentJSON(d.replayed))
+		if diff == "" {
+			fmt.Printf("\n%s: identical\n", d.name)
+			continue
+		}
+		fmt.Printf("\n%s", diff)
+	}
+	if res.Err != nil {
+		fmt.Fprintf(os.Stderr, "\nReplay failed: %v\n", res.Err)
+		return 1
+	}
+	msg, _ := json.MarshalIndent(res.Message, "", "  ")
+	fmt.Printf("\nReplayed message:\n%s\n", msg)
+	return 0
+}
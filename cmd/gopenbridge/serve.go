@@ -0,0 +1,97 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"gopenbridge/config"
+	"gopenbridge/logging"
+	"gopenbridge/server"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+const serveUsage = `Usage: gopenbridge serve [flags]
+
+Run the proxy. This is also what gopenbridge does without a command, so
+gopenbridge -port 9000 is gopenbridge serve -port 9000. Flags override the
+config file and the environment.
+
+Flags:
+  -host HOST        Host to bind to (default: host)
+  -port PORT        Port to bind to (default: port)
+  -reload           Reload configuration when the config file changes
+  -record FILE      Record upstream exchanges to this cassette file
+  -replay FILE      Answer upstream requests from this cassette file instead
+                    of the network
+  -mock-upstream    Serve requests from a built-in mock upstream; no API key
+                    needed
+  -version          Print the version and exit
+`
+
+// runServe implements the serve subcommand and returns the exit code once
+// the server stops.
+func runServe(args []string) int {
+	// Load configuration
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		slog.Error("Failed to load config", "error", err)
+		return 1
+	}
+	logger, err := logging.New(os.Stderr, cfg.LogLevel, cfg.LogFormat)
+	if err != nil {
+		slog.Error("Invalid logging config", "error", err)
+		return 1
+	}
+	slog.SetDefault(logger)
+
+	// Parse CLI flags
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprint(os.Stderr, serveUsage) }
+	host := fs.String("host", cfg.Host, "")
+	port := fs.Int("port", cfg.Port, "")
+	reload := fs.Bool("reload", cfg.Reload, "")
+	record := fs.String("record", cfg.CassetteRecord, "")
+	replay := fs.String("replay", cfg.CassetteReplay, "")
+	mockUpstream := fs.Bool("mock-upstream", cfg.MockUpstream, "")
+	showVersion := fs.Bool("version", false, "")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return 2
+	}
+	if *showVersion {
+		return runVersion(nil)
+	}
+
+	// Print configuration info
+	config.PrintConfigInfo(cfg)
+	fmt.Println()
+	slog.Debug("Debug logging enabled")
+
+	// Start server
+	scheme := "http"
+	if cfg.TLSEnabled() {
+		scheme = "https"
+	}
+	if socket, ok := strings.CutPrefix(cfg.Listen, "unix://"); ok {
+		fmt.Printf("🌉 gopenbridge proxy starting on unix socket %s\n", socket)
+	} else {
+		fmt.Printf("🌉 gopenbridge proxy starting on %s:%d\n", *host, *port)
+		fmt.Printf("📋 Config: ANTHROPIC_BASE_URL=%s://%s:%d/\n", scheme, *host, *port)
+	}
+	// Update config host and port
+	cfg.Host = *host
+	cfg.Port = *port
+	cfg.Reload = *reload
+	cfg.CassetteRecord = *record
+	cfg.CassetteReplay = *replay
+	cfg.MockUpstream = *mockUpstream
+	if err := server.StartServer(cfg); err != nil {
+		slog.Error("Server error", "error", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"flag"
+	"fmt"
+	"gopenbridge/config"
+	"gopenbridge/logging"
+	"gopenbridge/logstore"
+	"gopenbridge/proxy"
+	"log/slog"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const statsUsage = `Usage: gopenbridge stats [flags]
+
+Print request counts, error rates, token usage and estimated cost per
+upstream model and provider, read from the database. Usage is counted by
+UTC day, so -since and -until select whole days.
+
+Flags:
+  -since WHEN   Only days from WHEN: a duration back from now such as 7d or
+                12h, an RFC 3339 time or a YYYY-MM-DD date (default 7d)
+  -until WHEN   Only days before WHEN
+  -model NAME   Only requests to this upstream model
+  -key NAME     Only requests made with this virtual key
+`
+
+// statsRow aggregates the usage of one upstream model and provider.
+type statsRow struct {
+	model, provider  string
+	requests, errors int
+	prompt, output   int
+	cost             float64
+	unpriced         int // Requests that could not be priced
+}
+
+// runStats implements the stats subcommand and returns the exit code.
+func runStats(args []string) int {
+	fs := flag.NewFlagSet("stats", flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprint(os.Stderr, statsUsage) }
+	since := fs.String("since", "7d", "")
+	until := fs.String("until", "", "")
+	model := fs.String("model", "", "")
+	key := fs.String("key", "", "")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return 2
+	}
+	f := logstore.Filter{Model: *model, Key: *key}
+	for _, p := range []struct {
+		name, value string
+		dst         *time.Time
+	}{{"since", *since, &f.Since}, {"until", *until, &f.Until}} {
+		if p.value == "" {
+			continue
+		}
+		t, err := parseStatsTime(p.value)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "gopenbridge stats: -%s must be a duration such as 7d, an RFC 3339 time or a YYYY-MM-DD date\n", p.name)
+			return 2
+		}
+		*p.dst = t
+	}
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "gopenbridge stats: failed to load config: %v\n", err)
+		return 1
+	}
+	if logger, err := logging.New(os.Stderr, cfg.LogLevel, cfg.LogFormat); err == nil {
+		slog.SetDefault(logger)
+	}
+	usage, err := proxy.NewChatProxy(cfg).Logs().Usage(context.Background(), f)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "gopenbridge stats: %v\n", err)
+		return 1
+	}
+	if len(usage) == 0 {
+		fmt.Println("No requests")
+		return 0
+	}
+	var rows []*statsRow
+	total := &statsRow{model: "total"}
+	for _, u := range usage {
+		i := slices.IndexFunc(rows, func(r *statsRow) bool { return r.model == u.Model && r.provider == u.Provider })
+		if i == -1 {
+			rows = append(rows, &statsRow{model: u.Model, provider: u.Provider})
+			i = len(rows) - 1
+		}
+		for _, r := range []*statsRow{rows[i], total} {
+			r.requests += u.Requests
+			r.errors += u.Errors
+			r.prompt += u.PromptTokens
+			r.output += u.CompletionTokens
+			if u.CostUSD != nil {
+				r.cost += *u.CostUSD
+			}
+			// Rows logged before the model had a price are priced now
+			if price, ok := cfg.PriceFor(u.Model); ok {
+				r.cost += price.Cost(u.UnpricedPromptTokens, u.UnpricedCompletionTokens)
+			} else {
+				r.unpriced += u.UnpricedRequests
+			}
+		}
+	}
+	slices.SortFunc(rows, func(a, b *statsRow) int {
+		return cmp.Or(cmp.Compare(b.requests, a.requests), strings.Compare(a.model, b.model), strings.Compare(a.provider, b.provider))
+	})
+	fmt.Printf("Usage from %s to %s (UTC)\n\n", usage[len(usage)-1].Day, usage[0].Day)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "MODEL\tPROVIDER\tREQUESTS\tERRORS\tERROR RATE\tINPUT TOKENS\tOUTPUT TOKENS\tCOST USD")
+	for _, r := range append(rows, total) {
+		cost := fmt.Sprintf("%.4f", r.cost)
+		if r.unpriced == r.requests {
+			cost = "-"
+		} else if r.unpriced > 0 {
+			cost += "*"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%.1f%%\t%d\t%d\t%s\n", r.model, r.provider, r.requests, r.errors,
+			100*float64(r.errors)/float64(r.requests), r.prompt, r.output, cost)
+	}
+	w.Flush()
+	if total.unpriced > 0 {
+		fmt.Printf("\n%d requests to models without a price are not included in the cost (- or *); see pricing\n", total.unpriced)
+	}
+	return 0
+}
+
+// parseStatsTime accepts durations back from now, in days ("7d") or as
+// time.ParseDuration reads them, and the times parseExportTime accepts.
+func parseStatsTime(v string) (time.Time, error) {
+	if days, ok := strings.CutSuffix(v, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n >= 0 {
+			return time.Now().AddDate(0, 0, -n), nil
+		}
+	}
+	if d, err := time.ParseDuration(v); err == nil && d >= 0 {
+		return time.Now().Add(-d), nil
+	}
+	return parseExportTime(v)
+}
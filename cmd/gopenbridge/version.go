@@ -0,0 +1,44 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"gopenbridge/version"
+	"os"
+)
+
+const versionUsage = `Usage: gopenbridge version [-json]
+
+Print the version, commit and build date of this binary, to include in bug
+reports. gopenbridge --version prints the same line.
+
+Flags:
+  -json  Print the build info as JSON
+`
+
+// runVersion implements the version subcommand and returns the exit code.
+func runVersion(args []string) int {
+	fs := flag.NewFlagSet("version", flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprint(os.Stderr, versionUsage) }
+	asJSON := fs.Bool("json", false, "")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return 2
+	}
+	build := version.Get()
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(build); err != nil {
+			fmt.Fprintf(os.Stderr, "gopenbridge version: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+	fmt.Printf("gopenbridge %s\n", build)
+	return 0
+}
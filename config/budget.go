@@ -0,0 +1,48 @@
+package config
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Budget caps spend over a calendar period (UTC).
+type Budget struct {
+	Period string  `yaml:"period"` // "daily" or "monthly"
+	Unit   string  `yaml:"unit"`   // "usd" or "tokens"
+	Hard   float64 `yaml:"hard"`   // Requests are rejected once usage reaches this; zero disables
+	Soft   float64 `yaml:"soft"`   // Requests carry a warning once usage reaches this; zero disables
+}
+
+// Name identifies the budget in messages, e.g. "daily_usd".
+func (b Budget) Name() string {
+	return b.Period + "_" + b.Unit
+}
+
+// parseBudgets parses comma-separated entries of the form
+// "<daily|monthly>_<usd|tokens>=hard;soft=N".
+func parseBudgets(s string) []Budget {
+	var res []Budget
+	for _, entry := range strings.Split(s, ",") {
+		fields := strings.Split(entry, ";")
+		name, hard, ok := strings.Cut(fields[0], "=")
+		if !ok {
+			continue
+		}
+		period, unit, _ := strings.Cut(strings.TrimSpace(name), "_")
+		if (period != "daily" && period != "monthly") || (unit != "usd" && unit != "tokens") {
+			continue
+		}
+		b := Budget{Period: period, Unit: unit}
+		b.Hard, _ = strconv.ParseFloat(strings.TrimSpace(hard), 64)
+		for _, f := range fields[1:] {
+			k, v, _ := strings.Cut(f, "=")
+			if strings.TrimSpace(k) == "soft" {
+				b.Soft, _ = strconv.ParseFloat(strings.TrimSpace(v), 64)
+			}
+		}
+		if b.Hard > 0 || b.Soft > 0 {
+			res = append(res, b)
+		}
+	}
+	return res
+}
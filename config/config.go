@@ -1,44 +1,425 @@
 package config
 
 import (
-	"bufio"
+	"encoding/json"
 	"fmt"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
+
+	"gopenbridge/secrets"
 )
 
 // Config holds application configuration.
 type Config struct {
 	APIKey    string // API key for authentication
 	BaseURL   string // Base URL for API requests
+	Provider  string // Provider adapter name; detected from BaseURL when empty
 	Model     string // Model identifier
 	MaxTokens int    // Maximum output tokens
 	Host      string // Server host
 	Port      int    // Server port
-	Debug     bool   // Enable debug logging
+	// APIKeys pools several keys for the default upstream, used round-robin
+	// together with APIKey.
+	APIKeys []string
+	// APIKeyCooldown is how long a pooled key is benched after the upstream
+	// rate limits (without a Retry-After) or rejects it.
+	APIKeyCooldown time.Duration
+	// Listen overrides Host and Port with a TCP address or a unix domain
+	// socket as "unix:///path/to.sock".
+	Listen string
+	// ListenMode is the permission set on a unix socket.
+	ListenMode os.FileMode
+	// Providers are named upstream profiles that Routes can send requests
+	// to. A profile without a provider adapter uses its name when that is
+	// a known adapter, otherwise detection from its base URL.
+	Providers map[string]UpstreamConfig
+	// Routes select a provider profile by model name; unmatched models go
+	// to the default upstream.
+	Routes []Route
+	// SecretsRefresh is how long API keys fetched from a secret manager
+	// (vault:// or aws-sm:// references) are cached before re-fetching.
+	SecretsRefresh time.Duration
+	// CassetteRecord saves every upstream exchange to this file;
+	// CassetteReplay answers upstream requests from such a file instead of
+	// the network.
+	CassetteRecord string
+	CassetteReplay string
+	// MockUpstream serves requests from the built-in mock server instead of
+	// the configured upstreams, so no API key is needed. MockReply is its
+	// canned completion, echoing the last user message when empty;
+	// MockLatency delays each response, MockChunkDelay each streamed
+	// chunk, and MockErrorRate is the fraction of requests failing with a
+	// 500.
+	MockUpstream   bool
+	MockReply      string
+	MockLatency    time.Duration
+	MockChunkDelay time.Duration
+	MockErrorRate  float64
+	// Reload watches the config file and applies changes without a
+	// restart. SIGHUP reloads regardless.
+	Reload    bool
+	Debug     bool   // Enable debug logging; shorthand for LogLevel "debug"
+	LogLevel  string // Minimum log level: debug, info, warn or error
+	LogFormat string // Log output format: text or json
 	DBPath    string // Path to SQLite database file
+	// LogBodyMaxBytes truncates request and response bodies stored in
+	// api_logs to this many bytes; zero stores them whole.
+	LogBodyMaxBytes int
+	// LogBodyStorage is how api_logs bodies are stored: inline text, gzip
+	// blobs, or file for files under LogBodyDir referenced from the row.
+	LogBodyStorage string
+	// LogBodyDir holds bodies with file storage; empty means a directory
+	// next to the database.
+	LogBodyDir string
+	// LogQueueSize bounds the api_logs rows waiting for the background
+	// writer; rows arriving when it is full are dropped. Zero writes rows
+	// synchronously on the request path. LogBatchSize caps the rows written
+	// per transaction. Both need a restart.
+	LogQueueSize int
+	LogBatchSize int
+	// LogPersist selects the requests stored in api_logs: all, errors (failed
+	// requests only), sampled (a LogSampleRate fraction of them) or none.
+	// Token usage and cost are counted in usage_daily either way.
+	LogPersist    string
+	LogSampleRate float64
+	// LogRetention deletes api_logs rows older than this, and LogMaxDBBytes
+	// the oldest rows while the database uses more space, every
+	// LogPruneInterval. Zero disables each limit.
+	LogRetention     time.Duration
+	LogMaxDBBytes    int
+	LogPruneInterval time.Duration
+	// StrictResponseParsing rejects upstream responses with no recognizable
+	// content or tool call instead of returning an empty message.
+	StrictResponseParsing bool
+	// StrictMaxTokens rejects requests without max_tokens, as Anthropic does,
+	// instead of applying MaxTokens as the default.
+	StrictMaxTokens bool
+	// ToolErrorPrefix marks tool results flagged with is_error, since OpenAI
+	// tool messages have no dedicated error field.
+	ToolErrorPrefix string
+	// ExtractDocuments sends PDF document blocks as text extracted by the
+	// proxy instead of passing the file to upstreams that accept PDFs.
+	// Upstreams without file inputs always get extracted text.
+	ExtractDocuments bool
+	// ToolSchemaProfile overrides the tool schema cleanup applied for the
+	// upstream: none, basic or gemini. Empty uses each provider's default.
+	ToolSchemaProfile string
+	// StrictTools sends tools as strict function definitions to upstreams
+	// that support them, tightening schemas to what strict mode requires.
+	StrictTools bool
+	// ToolArgRepair repairs tool call arguments that are not valid JSON or
+	// do not match the tool's input_schema: off, fix (best-effort fixing and
+	// type coercion) or reask (fix, then ask the model once more about any
+	// call still invalid). Streamed responses only get JSON fixing.
+	ToolArgRepair string
+	// EmulateTools describes tools in the system prompt and parses tool
+	// calls out of the reply text, for default upstream models without
+	// native function calling. Profiles and failovers set it per upstream.
+	EmulateTools bool
+	// ReasoningAsThinking returns the reasoning some upstreams send
+	// alongside the answer (reasoning_content, reasoning, Ollama's
+	// thinking) as thinking blocks instead of dropping it.
+	ReasoningAsThinking bool
+	// NoStream marks the default upstream as unable to stream: streamed
+	// requests are sent buffered and the message is replayed to the client
+	// as SSE events. Profiles and failovers set it per upstream.
+	NoStream bool
+	// AlwaysStream sends every request to the default upstream with
+	// stream=true, for upstreams and models that only work reliably when
+	// streaming. Buffered responses are aggregated from the stream.
+	// Profiles and failovers set it per upstream.
+	AlwaysStream bool
+	// SimulatedStreamDelay paces replayed streams, sending text word by
+	// word with this delay between words; zero sends each block at once.
+	SimulatedStreamDelay time.Duration
+	// ReasoningModels are upstream model names (exact or glob) sent with
+	// the OpenAI reasoning model payload: max_completion_tokens, no
+	// sampling parameters and a developer system prompt. Models named like
+	// o1, o3 or gpt-5 get it without being listed; this is for Azure
+	// deployments and other aliases.
+	ReasoningModels []string
+	// ValidateModels checks the configured model names against the
+	// upstreams' model lists at startup and warns about unknown ones. Lists
+	// are cached in the database for a day.
+	ValidateModels bool
+	// ExtraBody holds extra JSON fields merged into every payload sent to
+	// the default upstream, e.g. OpenRouter provider preferences or vLLM
+	// sampling options. Objects merge recursively and null removes a
+	// field. Profiles, failovers and model_map entries have their own.
+	ExtraBody map[string]interface{}
+	// RateLimitGlobal, RateLimitPerKey and RateLimitPerIP cap inbound
+	// /v1/messages requests per minute across all clients, per client API
+	// key and per client IP; zero disables each.
+	RateLimitGlobal int
+	RateLimitPerKey int
+	RateLimitPerIP  int
+	// BatchWorkers is the number of Message Batches requests run at once;
+	// zero disables the batches API. BatchRateLimit caps batched requests
+	// per minute; zero is unlimited.
+	BatchWorkers   int
+	BatchRateLimit int
+	// BreakerThreshold is the number of consecutive upstream failures that
+	// trips the circuit breaker; zero disables it.
+	BreakerThreshold int
+	// BreakerCooldown is how long the breaker stays open before a trial request.
+	BreakerCooldown time.Duration
+	// RetryMaxAttempts is the total number of tries per upstream call; 1
+	// disables retries.
+	RetryMaxAttempts int
+	// RetryBackoff is the base delay, doubled on each retry with jitter.
+	RetryBackoff time.Duration
+	// RetryOn lists the upstream status codes that are retried. Network
+	// errors are always retried.
+	RetryOn []int
+	// UpstreamConnectTimeout bounds dialing and the TLS handshake.
+	UpstreamConnectTimeout time.Duration
+	// UpstreamResponseTimeout bounds the wait for response headers, which for
+	// non-streaming calls covers the whole generation.
+	UpstreamResponseTimeout time.Duration
+	// StreamIdleTimeout aborts a stream when the upstream sends nothing for
+	// this long; zero disables it.
+	StreamIdleTimeout time.Duration
+	// StreamPingInterval sends a ping event to streaming clients that have
+	// received nothing for this long, starting the stream early when the
+	// upstream is slow to answer; zero disables pings.
+	StreamPingInterval time.Duration
+	// UpstreamMaxIdleConns and UpstreamMaxIdleConnsPerHost size the pool of
+	// keep-alive connections to upstreams.
+	UpstreamMaxIdleConns        int
+	UpstreamMaxIdleConnsPerHost int
+	// UpstreamIdleConnTimeout closes pooled connections unused for this long.
+	UpstreamIdleConnTimeout time.Duration
+	// UpstreamHTTP2 negotiates HTTP/2 with upstreams that support it.
+	UpstreamHTTP2 bool
+	// UpstreamCompression asks upstreams for gzip or deflate encoded
+	// responses, which are decoded before translation.
+	UpstreamCompression bool
+	// UpstreamMaxConcurrency caps simultaneous requests to each upstream;
+	// zero is unlimited. Profiles and failovers can set their own.
+	UpstreamMaxConcurrency int
+	// UpstreamMaxQueue is how many requests may wait for a free slot per
+	// upstream before new ones are rejected as overloaded.
+	UpstreamMaxQueue int
+	// BackgroundModels are requested model names (exact or glob) queued
+	// behind interactive requests when an upstream is at its concurrency
+	// limit.
+	BackgroundModels []string
+	// ServerReadTimeout, ServerWriteTimeout and ServerIdleTimeout configure
+	// the listening server; zero disables each. The write timeout also caps
+	// streaming responses, so it is off by default.
+	ServerReadTimeout  time.Duration
+	ServerWriteTimeout time.Duration
+	ServerIdleTimeout  time.Duration
+	// GzipMinSize gzips buffered responses of at least this many bytes for
+	// clients that accept it; zero disables response compression.
+	GzipMinSize int
+	// MaxRequestBytes caps decoded request bodies on the Messages endpoints,
+	// batch creation included, and the legacy and OpenAI-style ones; larger
+	// requests get a 413. Zero disables the limit.
+	MaxRequestBytes int
+	// TracingEndpoint is the OTLP/HTTP collector URL, e.g.
+	// http://localhost:4318; empty disables tracing.
+	TracingEndpoint string
+	// TracingSampleRate is the fraction of new traces recorded, 0 to 1.
+	TracingSampleRate float64
+	// AdminEnabled serves the request log dashboard under /admin. It shows
+	// stored prompts and responses, so it is off by default and requires a
+	// key from AuthKeys once any keys are configured.
+	AdminEnabled bool
+	// AllowRawUpstream lets clients request the untranslated upstream
+	// response with the X-Include-Raw-Upstream header.
+	AllowRawUpstream bool
+	// CacheEnabled serves repeated deterministic (temperature 0) requests
+	// from a response cache holding up to CacheMaxEntries in memory for
+	// CacheTTL. CachePersist also keeps entries in the database.
+	CacheEnabled    bool
+	CacheMaxEntries int
+	CacheTTL        time.Duration
+	CachePersist    bool
+	// DedupRequests coalesces identical requests that arrive while one is
+	// already in flight into a single upstream call.
+	DedupRequests bool
+	// DefaultModel is used when a request omits model. Falls back to Model.
+	DefaultModel string
+	// AzureAPIVersion is the api-version query parameter for Azure OpenAI.
+	AzureAPIVersion string
+	// AzureDeployments maps model names to Azure deployment names. Models
+	// without an entry use the model name as the deployment.
+	AzureDeployments map[string]string
+	// AWSRegion and AWSProfile select the Bedrock region and shared
+	// credentials profile. Both fall back to the standard AWS defaults.
+	AWSRegion  string
+	AWSProfile string
+	// Failover lists upstreams tried in order when the primary fails with a
+	// 5xx, 429 or network error.
+	Failover []UpstreamConfig
+	// OllamaKeepAlive is how long Ollama keeps the model loaded after a
+	// request, e.g. "5m" or "-1" for forever. Empty uses Ollama's default.
+	OllamaKeepAlive string
+	// SmallModel serves haiku-class requests, which Claude Code sends for
+	// cheap background work, when no ModelMap entry matches.
+	SmallModel string
+	// ModelMap maps incoming Anthropic model names to upstream models.
+	// Unmatched models are forwarded verbatim.
+	ModelMap []ModelMapping
+	// OllamaNumCtx sets the Ollama context window; zero uses the model default.
+	OllamaNumCtx int
+	// Pricing lists upstream model prices used to estimate spend. Models
+	// without an entry have unknown cost.
+	Pricing []ModelPrice
+	// Budgets limit token usage or spend per day or month, computed from
+	// the usage the log store counts. Dollar budgets count priced requests
+	// only.
+	Budgets []Budget
+	// AuthKeys are the API keys clients must present in x-api-key or an
+	// Authorization bearer token. Empty leaves the proxy unauthenticated.
+	AuthKeys []string
+	// TLSCertFile and TLSKeyFile are a PEM certificate and key to serve
+	// HTTPS with.
+	TLSCertFile string
+	TLSKeyFile  string
+	// TLSSelfSigned serves HTTPS with a certificate generated at startup
+	// when no certificate files are configured.
+	TLSSelfSigned bool
+	// UpstreamClientCert and UpstreamClientKey are a PEM client certificate
+	// and key presented to upstreams that require mTLS.
+	UpstreamClientCert string
+	UpstreamClientKey  string
+	// UpstreamCAFile is a PEM bundle of CAs trusted for upstreams in
+	// addition to the system roots.
+	UpstreamCAFile string
+	// UpstreamInsecureSkipVerify disables upstream certificate verification.
+	UpstreamInsecureSkipVerify bool
+}
+
+// TLSEnabled reports whether the server listens with HTTPS.
+func (c *Config) TLSEnabled() bool {
+	return c.TLSCertFile != "" || c.TLSKeyFile != "" || c.TLSSelfSigned
+}
+
+// UpstreamConfig is one fallback upstream in the failover chain.
+type UpstreamConfig struct {
+	Provider       string   `yaml:"provider"` // Provider adapter name; detected from BaseURL when empty
+	BaseURL        string   `yaml:"base_url"`
+	APIKey         string   `yaml:"api_key"`
+	APIKeys        []string `yaml:"api_keys"`        // Pooled with APIKey
+	Model          string   `yaml:"model"`           // Replaces the request model when set
+	MaxConcurrency int      `yaml:"max_concurrency"` // Overrides Config.UpstreamMaxConcurrency when set
+	EmulateTools   bool     `yaml:"emulate_tools"`   // Emulate tool calling through the prompt
+	NoStream       bool     `yaml:"no_stream"`       // Upstream cannot stream; streams are simulated
+	AlwaysStream   bool     `yaml:"always_stream"`   // Upstream must stream; buffered responses are aggregated
+	// ExtraBody is merged into every payload sent to this upstream
+	ExtraBody map[string]interface{} `yaml:"extra_body"`
+}
+
+// Keys returns the upstream's API keys: APIKey followed by APIKeys.
+func (u UpstreamConfig) Keys() []string {
+	return mergeKeys(u.APIKey, u.APIKeys)
+}
+
+// UpstreamKeys returns the default upstream's API keys: APIKey followed by
+// APIKeys.
+func (c *Config) UpstreamKeys() []string {
+	return mergeKeys(c.APIKey, c.APIKeys)
+}
+
+// mergeKeys returns key and keys without blanks or duplicates.
+func mergeKeys(key string, keys []string) []string {
+	var res []string
+	for _, k := range append([]string{key}, keys...) {
+		if k != "" && !slices.Contains(res, k) {
+			res = append(res, k)
+		}
+	}
+	return res
 }
 
 // LoadConfig loads configuration from file, environment, or defaults.
+// Problems in the config file are logged and the settings concerned
+// ignored; Validate reports them instead. A config file that cannot be
+// read or parsed is an error.
 func LoadConfig() (*Config, error) {
+	cfg, problems, err := load()
+	for _, p := range problems {
+		slog.Warn("Ignoring config problem", "key", p.Key, "problem", p.Message)
+	}
+	return cfg, err
+}
+
+// load reads the configuration like LoadConfig, returning the problems
+// found in the config file.
+func load() (*Config, []Problem, error) {
+	var problems []Problem
 	// Set defaults
 	cfg := &Config{
-		APIKey:    "",
-		BaseURL:   "https://router.huggingface.co/v1",
-		Model:     "moonshotai/Kimi-K2-Instruct-0905:groq",
-		MaxTokens: 16384,
-		Host:      "0.0.0.0",
-		Port:      8323,
+		APIKey:           "",
+		BaseURL:          "https://router.huggingface.co/v1",
+		Model:            "moonshotai/Kimi-K2-Instruct-0905:groq",
+		MaxTokens:        16384,
+		Host:             "0.0.0.0",
+		Port:             8323,
+		ListenMode:       0o660,
+		LogLevel:         "info",
+		LogFormat:        "text",
+		LogBodyStorage:   "inline",
+		LogQueueSize:     1000,
+		LogBatchSize:     100,
+		LogPersist:       "all",
+		LogSampleRate:    0.1,
+		LogPruneInterval: time.Hour,
+
+		ToolErrorPrefix:  "ERROR: ",
+		BreakerThreshold: 5,
+		BatchWorkers:     2,
+		BreakerCooldown:  30 * time.Second,
+		RetryMaxAttempts: 3,
+		RetryBackoff:     500 * time.Millisecond,
+		RetryOn:          []int{429, 500, 502, 503, 504, 529},
+
+		UpstreamConnectTimeout:  10 * time.Second,
+		UpstreamResponseTimeout: 10 * time.Minute,
+		StreamIdleTimeout:       2 * time.Minute,
+		StreamPingInterval:      15 * time.Second,
+		ServerReadTimeout:       time.Minute,
+		ServerIdleTimeout:       2 * time.Minute,
+
+		UpstreamMaxIdleConns:        100,
+		UpstreamMaxIdleConnsPerHost: 16,
+		UpstreamIdleConnTimeout:     90 * time.Second,
+		UpstreamHTTP2:               true,
+		UpstreamCompression:         true,
+		MaxRequestBytes:             10 << 20,
+		UpstreamMaxQueue:            100,
+		BackgroundModels:            []string{"*haiku*"},
+
+		TracingSampleRate: 1,
+		SecretsRefresh:    5 * time.Minute,
+		MockChunkDelay:    30 * time.Millisecond,
+		APIKeyCooldown:    time.Minute,
+		AdminEnabled:      false,
+		CacheMaxEntries:   1000,
+		CacheTTL:          24 * time.Hour,
+		CachePersist:      true,
 	}
 	// Override with environment variables
 	if v := os.Getenv("OPENAI_API_KEY"); v != "" {
 		cfg.APIKey = v
 	}
+	if v := os.Getenv("OPENAI_API_KEYS"); v != "" {
+		cfg.APIKeys = parseList(v)
+	}
+	envDuration("API_KEY_COOLDOWN", &cfg.APIKeyCooldown)
 	if v := os.Getenv("OPENAI_BASE_URL"); v != "" {
 		cfg.BaseURL = v
 	}
+	if v := os.Getenv("PROVIDER"); v != "" {
+		cfg.Provider = v
+	}
 	if v := os.Getenv("OPENAI_MODEL"); v != "" {
 		cfg.Model = v
 	}
@@ -61,45 +442,295 @@ func LoadConfig() (*Config, error) {
 			cfg.Debug = b
 		}
 	}
+	if v := os.Getenv("LOG_LEVEL"); v != "" {
+		cfg.LogLevel = v
+	}
+	if v := os.Getenv("LOG_FORMAT"); v != "" {
+		cfg.LogFormat = v
+	}
+	if v := os.Getenv("STRICT_RESPONSE_PARSING"); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			cfg.StrictResponseParsing = b
+		}
+	}
+	if v := os.Getenv("STRICT_MAX_TOKENS"); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			cfg.StrictMaxTokens = b
+		}
+	}
+	if v := os.Getenv("TOOL_ERROR_PREFIX"); v != "" {
+		cfg.ToolErrorPrefix = v
+	}
+	envBool("EXTRACT_DOCUMENTS", &cfg.ExtractDocuments)
+	if v := os.Getenv("TOOL_SCHEMA_PROFILE"); v != "" {
+		cfg.ToolSchemaProfile = v
+	}
+	envBool("STRICT_TOOLS", &cfg.StrictTools)
+	if v := os.Getenv("TOOL_ARG_REPAIR"); v != "" {
+		cfg.ToolArgRepair = v
+	}
+	envBool("EMULATE_TOOLS", &cfg.EmulateTools)
+	envBool("REASONING_AS_THINKING", &cfg.ReasoningAsThinking)
+	envBool("NO_STREAM", &cfg.NoStream)
+	envBool("ALWAYS_STREAM", &cfg.AlwaysStream)
+	envDuration("SIMULATED_STREAM_DELAY", &cfg.SimulatedStreamDelay)
+	if v := os.Getenv("REASONING_MODELS"); v != "" {
+		cfg.ReasoningModels = parseList(v)
+	}
+	envBool("VALIDATE_MODELS", &cfg.ValidateModels)
+	if v := os.Getenv("EXTRA_BODY"); v != "" {
+		if err := json.Unmarshal([]byte(v), &cfg.ExtraBody); err != nil {
+			slog.Warn("Invalid EXTRA_BODY, expected a JSON object", "error", err)
+		}
+	}
+	envInt("RATE_LIMIT_GLOBAL", &cfg.RateLimitGlobal)
+	envInt("RATE_LIMIT_PER_KEY", &cfg.RateLimitPerKey)
+	envInt("RATE_LIMIT_PER_IP", &cfg.RateLimitPerIP)
+	envInt("BATCH_WORKERS", &cfg.BatchWorkers)
+	envInt("BATCH_RATE_LIMIT", &cfg.BatchRateLimit)
+	if v := os.Getenv("BREAKER_THRESHOLD"); v != "" {
+		if iv, err := strconv.Atoi(v); err == nil {
+			cfg.BreakerThreshold = iv
+		}
+	}
+	if v := os.Getenv("BREAKER_COOLDOWN"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.BreakerCooldown = d
+		}
+	}
+	if v := os.Getenv("RETRY_MAX_ATTEMPTS"); v != "" {
+		if iv, err := strconv.Atoi(v); err == nil {
+			cfg.RetryMaxAttempts = iv
+		}
+	}
+	if v := os.Getenv("RETRY_BACKOFF"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.RetryBackoff = d
+		}
+	}
+	if v := os.Getenv("RETRY_ON"); v != "" {
+		cfg.RetryOn = parseIntList(v)
+	}
+	envDuration("UPSTREAM_CONNECT_TIMEOUT", &cfg.UpstreamConnectTimeout)
+	envDuration("UPSTREAM_RESPONSE_TIMEOUT", &cfg.UpstreamResponseTimeout)
+	envDuration("STREAM_IDLE_TIMEOUT", &cfg.StreamIdleTimeout)
+	envDuration("STREAM_PING_INTERVAL", &cfg.StreamPingInterval)
+	if v := os.Getenv("UPSTREAM_MAX_IDLE_CONNS"); v != "" {
+		if iv, err := strconv.Atoi(v); err == nil {
+			cfg.UpstreamMaxIdleConns = iv
+		}
+	}
+	if v := os.Getenv("UPSTREAM_MAX_IDLE_CONNS_PER_HOST"); v != "" {
+		if iv, err := strconv.Atoi(v); err == nil {
+			cfg.UpstreamMaxIdleConnsPerHost = iv
+		}
+	}
+	envDuration("UPSTREAM_IDLE_CONN_TIMEOUT", &cfg.UpstreamIdleConnTimeout)
+	envInt("UPSTREAM_MAX_CONCURRENCY", &cfg.UpstreamMaxConcurrency)
+	envInt("UPSTREAM_MAX_QUEUE", &cfg.UpstreamMaxQueue)
+	if v := os.Getenv("BACKGROUND_MODELS"); v != "" {
+		cfg.BackgroundModels = parseList(v)
+	}
+	if v := os.Getenv("UPSTREAM_HTTP2"); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			cfg.UpstreamHTTP2 = b
+		}
+	}
+	envBool("UPSTREAM_COMPRESSION", &cfg.UpstreamCompression)
+	envDuration("SERVER_READ_TIMEOUT", &cfg.ServerReadTimeout)
+	envDuration("SERVER_WRITE_TIMEOUT", &cfg.ServerWriteTimeout)
+	envDuration("SERVER_IDLE_TIMEOUT", &cfg.ServerIdleTimeout)
+	envInt("GZIP_MIN_SIZE", &cfg.GzipMinSize)
+	envInt("MAX_REQUEST_BYTES", &cfg.MaxRequestBytes)
+	if v := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); v != "" {
+		cfg.TracingEndpoint = v
+	}
+	if v := os.Getenv("TRACING_ENDPOINT"); v != "" {
+		cfg.TracingEndpoint = v
+	}
+	if v := os.Getenv("TRACING_SAMPLE_RATE"); v != "" {
+		if fv, err := strconv.ParseFloat(v, 64); err == nil {
+			cfg.TracingSampleRate = fv
+		}
+	}
+	if v := os.Getenv("ADMIN_ENABLED"); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			cfg.AdminEnabled = b
+		}
+	}
+	envBool("CACHE_ENABLED", &cfg.CacheEnabled)
+	envInt("CACHE_MAX_ENTRIES", &cfg.CacheMaxEntries)
+	envDuration("CACHE_TTL", &cfg.CacheTTL)
+	envBool("CACHE_PERSIST", &cfg.CachePersist)
+	envBool("DEDUP_REQUESTS", &cfg.DedupRequests)
+	if v := os.Getenv("ALLOW_RAW_UPSTREAM"); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			cfg.AllowRawUpstream = b
+		}
+	}
+	if v := os.Getenv("DEFAULT_MODEL"); v != "" {
+		cfg.DefaultModel = v
+	}
+	if v := os.Getenv("AZURE_API_VERSION"); v != "" {
+		cfg.AzureAPIVersion = v
+	}
+	if v := os.Getenv("AZURE_DEPLOYMENTS"); v != "" {
+		cfg.AzureDeployments = parseMapping(v)
+	}
+	if v := os.Getenv("AWS_REGION"); v != "" {
+		cfg.AWSRegion = v
+	}
+	if v := os.Getenv("AWS_PROFILE"); v != "" {
+		cfg.AWSProfile = v
+	}
+	if v := os.Getenv("SMALL_MODEL"); v != "" {
+		cfg.SmallModel = v
+	}
+	if v := os.Getenv("MODEL_MAP"); v != "" {
+		cfg.ModelMap = parseModelMap(v)
+	}
+	if v := os.Getenv("PRICING"); v != "" {
+		cfg.Pricing = parsePricing(v)
+	}
+	envDuration("SECRETS_REFRESH", &cfg.SecretsRefresh)
+	if v := os.Getenv("RELOAD"); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			cfg.Reload = b
+		}
+	}
+	if v := os.Getenv("CASSETTE_RECORD"); v != "" {
+		cfg.CassetteRecord = v
+	}
+	if v := os.Getenv("CASSETTE_REPLAY"); v != "" {
+		cfg.CassetteReplay = v
+	}
+	envBool("MOCK_UPSTREAM", &cfg.MockUpstream)
+	if v := os.Getenv("MOCK_REPLY"); v != "" {
+		cfg.MockReply = v
+	}
+	envDuration("MOCK_LATENCY", &cfg.MockLatency)
+	envDuration("MOCK_CHUNK_DELAY", &cfg.MockChunkDelay)
+	if v := os.Getenv("MOCK_ERROR_RATE"); v != "" {
+		if fv, err := strconv.ParseFloat(v, 64); err == nil {
+			cfg.MockErrorRate = fv
+		}
+	}
+	if v := os.Getenv("LISTEN"); v != "" {
+		cfg.Listen = v
+	}
+	if v := os.Getenv("LISTEN_MODE"); v != "" {
+		parseFileMode(v, &cfg.ListenMode)
+	}
+	if v := os.Getenv("TLS_CERT_FILE"); v != "" {
+		cfg.TLSCertFile = v
+	}
+	if v := os.Getenv("TLS_KEY_FILE"); v != "" {
+		cfg.TLSKeyFile = v
+	}
+	if v := os.Getenv("TLS_SELF_SIGNED"); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			cfg.TLSSelfSigned = b
+		}
+	}
+	if v := os.Getenv("UPSTREAM_CLIENT_CERT"); v != "" {
+		cfg.UpstreamClientCert = v
+	}
+	if v := os.Getenv("UPSTREAM_CLIENT_KEY"); v != "" {
+		cfg.UpstreamClientKey = v
+	}
+	if v := os.Getenv("UPSTREAM_CA_FILE"); v != "" {
+		cfg.UpstreamCAFile = v
+	}
+	if v := os.Getenv("UPSTREAM_INSECURE_SKIP_VERIFY"); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			cfg.UpstreamInsecureSkipVerify = b
+		}
+	}
+	if v := os.Getenv("AUTH_KEYS"); v != "" {
+		cfg.AuthKeys = parseList(v)
+	}
+	if v := os.Getenv("BUDGETS"); v != "" {
+		cfg.Budgets = parseBudgets(v)
+	}
+	if v := os.Getenv("ROUTES"); v != "" {
+		cfg.Routes = parseRoutes(v)
+	}
+	if v := os.Getenv("FAILOVER"); v != "" {
+		cfg.Failover = parseFailover(v)
+	}
+	if v := os.Getenv("OLLAMA_KEEP_ALIVE"); v != "" {
+		cfg.OllamaKeepAlive = v
+	}
+	if v := os.Getenv("OLLAMA_NUM_CTX"); v != "" {
+		if iv, err := strconv.Atoi(v); err == nil {
+			cfg.OllamaNumCtx = iv
+		}
+	}
 	// Database path from environment or default
 	if v := os.Getenv("DB_PATH"); v != "" {
 		cfg.DBPath = v
 	} else {
 		cfg.DBPath = "gopenbridge.db"
 	}
-	// Load from config file if available
+	envInt("LOG_BODY_MAX_BYTES", &cfg.LogBodyMaxBytes)
+	envInt("LOG_QUEUE_SIZE", &cfg.LogQueueSize)
+	envInt("LOG_BATCH_SIZE", &cfg.LogBatchSize)
+	if v := os.Getenv("LOG_PERSIST"); v != "" {
+		cfg.LogPersist = v
+	}
+	if v := os.Getenv("LOG_SAMPLE_RATE"); v != "" {
+		if fv, err := strconv.ParseFloat(v, 64); err == nil {
+			cfg.LogSampleRate = fv
+		}
+	}
+	envDuration("LOG_RETENTION", &cfg.LogRetention)
+	envInt("LOG_MAX_DB_BYTES", &cfg.LogMaxDBBytes)
+	envDuration("LOG_PRUNE_INTERVAL", &cfg.LogPruneInterval)
+	if v := os.Getenv("LOG_BODY_STORAGE"); v != "" {
+		cfg.LogBodyStorage = v
+	}
+	if v := os.Getenv("LOG_BODY_DIR"); v != "" {
+		cfg.LogBodyDir = v
+	}
+	// Load from config file if available. A file that cannot be read or
+	// parsed is an error rather than a problem: running on the defaults
+	// instead would drop its auth keys and upstream.
 	if path := findConfigFile(); path != "" {
-		if fileCfg, err := parseYAMLFile(path); err != nil {
-			fmt.Fprintf(os.Stderr, "⚠️  Warning: Could not load config file %s: %v\n", path, err)
-		} else {
-			for k, v := range fileCfg {
-				switch k {
-				case "api_key":
-					cfg.APIKey = v
-				case "base_url":
-					cfg.BaseURL = v
-				case "model":
-					cfg.Model = v
-				case "max_tokens":
-					if iv, err := strconv.Atoi(v); err == nil {
-						cfg.MaxTokens = iv
-					}
-				case "host":
-					cfg.Host = v
-				case "port":
-					if iv, err := strconv.Atoi(v); err == nil {
-						cfg.Port = iv
-					}
-				case "debug":
-					if b, err := strconv.ParseBool(v); err == nil {
-						cfg.Debug = b
-					}
-				case "db_path":
-					cfg.DBPath = v
-				}
+		fileCfg, sections, err := parseYAMLFile(path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not load the config file: %w", err)
+		}
+		for k, v := range fileCfg {
+			if known, ok := applyKey(cfg, k, v); !known {
+				problems = append(problems, unknownKey(k))
+			} else if !ok {
+				problems = append(problems, Problem{Key: k, Message: fmt.Sprintf("invalid value %q, ignored", v)})
+			}
+		}
+		for k, n := range sections {
+			if err := applySection(cfg, k, n); err != nil {
+				problems = append(problems, Problem{Key: k, Message: "invalid section, ignored: " + err.Error()})
 			}
+			problems = append(problems, unknownFields(k, n)...)
+		}
+	}
+	if cfg.DefaultModel == "" {
+		cfg.DefaultModel = cfg.Model
+	}
+	for _, r := range cfg.Routes {
+		if _, ok := cfg.Providers[r.Provider]; !ok {
+			problems = append(problems, Problem{Key: "routes", Message: fmt.Sprintf("route %s refers to unknown provider profile %q", r.Pattern, r.Provider)})
 		}
 	}
+	if cfg.Debug {
+		cfg.LogLevel = "debug"
+	}
+	if err := resolveKeychain(cfg); err != nil {
+		return nil, nil, err
+	}
+	if cfg.APIKey == "" && len(cfg.APIKeys) > 0 {
+		cfg.APIKey = cfg.APIKeys[0]
+	}
 	// Fallback to Hugging Face token if APIKey not set
 	if cfg.APIKey == "" {
 		if home, err := os.UserHomeDir(); err == nil {
@@ -111,7 +742,282 @@ func LoadConfig() (*Config, error) {
 			}
 		}
 	}
-	return cfg, nil
+	return cfg, problems, nil
+}
+
+// applyKey sets the flat config file setting k to v. It reports whether k
+// is a known setting and whether v was valid for it; invalid values are
+// ignored.
+func applyKey(cfg *Config, k, v string) (known, ok bool) {
+	ok = true
+	switch k {
+	case "api_key":
+		cfg.APIKey = v
+	case "api_keys":
+		cfg.APIKeys = parseList(v)
+	case "api_key_cooldown":
+		ok = parseDuration(v, &cfg.APIKeyCooldown)
+	case "base_url":
+		cfg.BaseURL = v
+	case "provider":
+		cfg.Provider = v
+	case "model":
+		cfg.Model = v
+	case "max_tokens":
+		ok = parseInt(v, &cfg.MaxTokens)
+	case "host":
+		cfg.Host = v
+	case "port":
+		ok = parseInt(v, &cfg.Port)
+	case "debug":
+		ok = parseBool(v, &cfg.Debug)
+	case "log_level":
+		cfg.LogLevel = v
+	case "log_format":
+		cfg.LogFormat = v
+	case "db_path":
+		cfg.DBPath = v
+	case "log_body_max_bytes":
+		ok = parseInt(v, &cfg.LogBodyMaxBytes)
+	case "log_body_storage":
+		cfg.LogBodyStorage = v
+	case "log_body_dir":
+		cfg.LogBodyDir = v
+	case "log_queue_size":
+		ok = parseInt(v, &cfg.LogQueueSize)
+	case "log_batch_size":
+		ok = parseInt(v, &cfg.LogBatchSize)
+	case "log_persist":
+		cfg.LogPersist = v
+	case "log_sample_rate":
+		ok = parseFloat(v, &cfg.LogSampleRate)
+	case "log_retention":
+		ok = parseDuration(v, &cfg.LogRetention)
+	case "log_max_db_bytes":
+		ok = parseInt(v, &cfg.LogMaxDBBytes)
+	case "log_prune_interval":
+		ok = parseDuration(v, &cfg.LogPruneInterval)
+	case "strict_response_parsing":
+		ok = parseBool(v, &cfg.StrictResponseParsing)
+	case "tool_error_prefix":
+		cfg.ToolErrorPrefix = v
+	case "extract_documents":
+		ok = parseBool(v, &cfg.ExtractDocuments)
+	case "tool_schema_profile":
+		cfg.ToolSchemaProfile = v
+	case "strict_tools":
+		ok = parseBool(v, &cfg.StrictTools)
+	case "tool_arg_repair":
+		cfg.ToolArgRepair = v
+	case "emulate_tools":
+		ok = parseBool(v, &cfg.EmulateTools)
+	case "reasoning_as_thinking":
+		ok = parseBool(v, &cfg.ReasoningAsThinking)
+	case "no_stream":
+		ok = parseBool(v, &cfg.NoStream)
+	case "always_stream":
+		ok = parseBool(v, &cfg.AlwaysStream)
+	case "simulated_stream_delay":
+		ok = parseDuration(v, &cfg.SimulatedStreamDelay)
+	case "reasoning_models":
+		cfg.ReasoningModels = parseList(v)
+	case "validate_models":
+		ok = parseBool(v, &cfg.ValidateModels)
+	case "extra_body":
+		if err := json.Unmarshal([]byte(v), &cfg.ExtraBody); err != nil {
+			slog.Warn("Invalid extra_body, expected a JSON object", "error", err)
+		}
+	case "rate_limit_global":
+		ok = parseInt(v, &cfg.RateLimitGlobal)
+	case "rate_limit_per_key":
+		ok = parseInt(v, &cfg.RateLimitPerKey)
+	case "rate_limit_per_ip":
+		ok = parseInt(v, &cfg.RateLimitPerIP)
+	case "batch_workers":
+		ok = parseInt(v, &cfg.BatchWorkers)
+	case "batch_rate_limit":
+		ok = parseInt(v, &cfg.BatchRateLimit)
+	case "breaker_threshold":
+		ok = parseInt(v, &cfg.BreakerThreshold)
+	case "breaker_cooldown":
+		ok = parseDuration(v, &cfg.BreakerCooldown)
+	case "retry_max_attempts":
+		ok = parseInt(v, &cfg.RetryMaxAttempts)
+	case "retry_backoff":
+		ok = parseDuration(v, &cfg.RetryBackoff)
+	case "retry_on":
+		cfg.RetryOn = parseIntList(v)
+	case "upstream_connect_timeout":
+		ok = parseDuration(v, &cfg.UpstreamConnectTimeout)
+	case "upstream_response_timeout":
+		ok = parseDuration(v, &cfg.UpstreamResponseTimeout)
+	case "stream_idle_timeout":
+		ok = parseDuration(v, &cfg.StreamIdleTimeout)
+	case "stream_ping_interval":
+		ok = parseDuration(v, &cfg.StreamPingInterval)
+	case "upstream_max_idle_conns":
+		ok = parseInt(v, &cfg.UpstreamMaxIdleConns)
+	case "upstream_max_idle_conns_per_host":
+		ok = parseInt(v, &cfg.UpstreamMaxIdleConnsPerHost)
+	case "upstream_idle_conn_timeout":
+		ok = parseDuration(v, &cfg.UpstreamIdleConnTimeout)
+	case "upstream_max_concurrency":
+		ok = parseInt(v, &cfg.UpstreamMaxConcurrency)
+	case "upstream_max_queue":
+		ok = parseInt(v, &cfg.UpstreamMaxQueue)
+	case "background_models":
+		cfg.BackgroundModels = parseList(v)
+	case "upstream_http2":
+		ok = parseBool(v, &cfg.UpstreamHTTP2)
+	case "upstream_compression":
+		ok = parseBool(v, &cfg.UpstreamCompression)
+	case "gzip_min_size":
+		ok = parseInt(v, &cfg.GzipMinSize)
+	case "max_request_bytes":
+		ok = parseInt(v, &cfg.MaxRequestBytes)
+	case "server_read_timeout":
+		ok = parseDuration(v, &cfg.ServerReadTimeout)
+	case "server_write_timeout":
+		ok = parseDuration(v, &cfg.ServerWriteTimeout)
+	case "server_idle_timeout":
+		ok = parseDuration(v, &cfg.ServerIdleTimeout)
+	case "tracing_endpoint":
+		cfg.TracingEndpoint = v
+	case "tracing_sample_rate":
+		ok = parseFloat(v, &cfg.TracingSampleRate)
+	case "admin_enabled":
+		ok = parseBool(v, &cfg.AdminEnabled)
+	case "cache_enabled":
+		ok = parseBool(v, &cfg.CacheEnabled)
+	case "cache_max_entries":
+		ok = parseInt(v, &cfg.CacheMaxEntries)
+	case "cache_ttl":
+		ok = parseDuration(v, &cfg.CacheTTL)
+	case "cache_persist":
+		ok = parseBool(v, &cfg.CachePersist)
+	case "dedup_requests":
+		ok = parseBool(v, &cfg.DedupRequests)
+	case "allow_raw_upstream":
+		ok = parseBool(v, &cfg.AllowRawUpstream)
+	case "default_model":
+		cfg.DefaultModel = v
+	case "azure_api_version":
+		cfg.AzureAPIVersion = v
+	case "azure_deployments":
+		cfg.AzureDeployments = parseMapping(v)
+	case "aws_region":
+		cfg.AWSRegion = v
+	case "aws_profile":
+		cfg.AWSProfile = v
+	case "small_model":
+		cfg.SmallModel = v
+	case "model_map":
+		cfg.ModelMap = parseModelMap(v)
+	case "failover":
+		cfg.Failover = parseFailover(v)
+	case "routes":
+		cfg.Routes = parseRoutes(v)
+	case "pricing":
+		cfg.Pricing = parsePricing(v)
+	case "secrets_refresh":
+		ok = parseDuration(v, &cfg.SecretsRefresh)
+	case "reload":
+		ok = parseBool(v, &cfg.Reload)
+	case "cassette_record":
+		cfg.CassetteRecord = v
+	case "cassette_replay":
+		cfg.CassetteReplay = v
+	case "mock_upstream":
+		ok = parseBool(v, &cfg.MockUpstream)
+	case "mock_reply":
+		cfg.MockReply = v
+	case "mock_latency":
+		ok = parseDuration(v, &cfg.MockLatency)
+	case "mock_chunk_delay":
+		ok = parseDuration(v, &cfg.MockChunkDelay)
+	case "mock_error_rate":
+		ok = parseFloat(v, &cfg.MockErrorRate)
+	case "listen":
+		cfg.Listen = v
+	case "listen_mode":
+		ok = parseFileMode(v, &cfg.ListenMode)
+	case "tls_cert_file":
+		cfg.TLSCertFile = v
+	case "tls_key_file":
+		cfg.TLSKeyFile = v
+	case "tls_self_signed":
+		ok = parseBool(v, &cfg.TLSSelfSigned)
+	case "upstream_client_cert":
+		cfg.UpstreamClientCert = v
+	case "upstream_client_key":
+		cfg.UpstreamClientKey = v
+	case "upstream_ca_file":
+		cfg.UpstreamCAFile = v
+	case "upstream_insecure_skip_verify":
+		ok = parseBool(v, &cfg.UpstreamInsecureSkipVerify)
+	case "auth_keys":
+		cfg.AuthKeys = parseList(v)
+	case "budgets":
+		cfg.Budgets = parseBudgets(v)
+	case "ollama_keep_alive":
+		cfg.OllamaKeepAlive = v
+	case "ollama_num_ctx":
+		ok = parseInt(v, &cfg.OllamaNumCtx)
+	case "strict_max_tokens":
+		ok = parseBool(v, &cfg.StrictMaxTokens)
+	default:
+		return false, true
+	}
+	return true, ok
+}
+
+// resolveKeychain replaces keychain:// API keys with the secret stored in
+// the OS keyring, so a missing entry fails at startup rather than on the
+// first request.
+func resolveKeychain(cfg *Config) error {
+	resolve := func(key *string) error {
+		ref, ok := secrets.Parse(*key)
+		if !ok || ref.Scheme != "keychain" {
+			return nil
+		}
+		v, err := secrets.KeychainGet(ref.Path)
+		if err != nil {
+			return fmt.Errorf("read %s from keychain: %w", ref.Path, err)
+		}
+		*key = v
+		return nil
+	}
+	resolveAll := func(key *string, keys []string) error {
+		if err := resolve(key); err != nil {
+			return err
+		}
+		for i := range keys {
+			if err := resolve(&keys[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := resolveAll(&cfg.APIKey, cfg.APIKeys); err != nil {
+		return err
+	}
+	for name, u := range cfg.Providers {
+		if err := resolveAll(&u.APIKey, u.APIKeys); err != nil {
+			return err
+		}
+		cfg.Providers[name] = u
+	}
+	for i := range cfg.Failover {
+		if err := resolveAll(&cfg.Failover[i].APIKey, cfg.Failover[i].APIKeys); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FilePath returns the config file LoadConfig reads, or "" if there is none.
+func FilePath() string {
+	return findConfigFile()
 }
 
 // findConfigFile searches for a YAML config file in standard locations.
@@ -134,31 +1040,157 @@ func findConfigFile() string {
 	return ""
 }
 
-// parseYAMLFile loads simple key:value pairs from a YAML file.
-func parseYAMLFile(path string) (map[string]string, error) {
-	f, err := os.Open(path)
-	if err != nil {
-		return nil, err
-	}
-	defer f.Close()
+// parseMapping parses "key=value,key2=value2" into a map.
+func parseMapping(s string) map[string]string {
 	res := make(map[string]string)
-	scanner := bufio.NewScanner(f)
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
+	for _, pair := range strings.Split(s, ",") {
+		if k, v, ok := strings.Cut(pair, "="); ok {
+			res[strings.TrimSpace(k)] = strings.TrimSpace(v)
 		}
-		if idx := strings.Index(line, ":"); idx != -1 {
-			key := strings.TrimSpace(line[:idx])
-			val := strings.TrimSpace(line[idx+1:])
-			val = strings.Trim(val, `"'`)
-			res[key] = val
+	}
+	return res
+}
+
+// envDuration sets *d from the environment variable key when it holds a
+// valid duration.
+func envDuration(key string, d *time.Duration) {
+	if v := os.Getenv(key); v != "" {
+		parseDuration(v, d)
+	}
+}
+
+// parseDuration sets *d from v, leaving it unchanged and returning false if
+// v is invalid. Whole days are accepted as e.g. "30d".
+func parseDuration(v string, d *time.Duration) bool {
+	if days, ok := strings.CutSuffix(v, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err == nil {
+			*d = time.Duration(n) * 24 * time.Hour
 		}
+		return err == nil
+	}
+	pd, err := time.ParseDuration(v)
+	if err == nil {
+		*d = pd
+	}
+	return err == nil
+}
+
+// envInt sets *n from the integer environment variable key, if set and valid.
+func envInt(key string, n *int) {
+	if v := os.Getenv(key); v != "" {
+		parseInt(v, n)
+	}
+}
+
+// parseInt sets *n from v, leaving it unchanged and returning false if v is
+// invalid.
+func parseInt(v string, n *int) bool {
+	iv, err := strconv.Atoi(v)
+	if err == nil {
+		*n = iv
+	}
+	return err == nil
+}
+
+// parseFloat sets *f from v, leaving it unchanged and returning false if v
+// is invalid.
+func parseFloat(v string, f *float64) bool {
+	fv, err := strconv.ParseFloat(v, 64)
+	if err == nil {
+		*f = fv
 	}
-	if err := scanner.Err(); err != nil {
-		return res, err
+	return err == nil
+}
+
+// envBool sets *b from the boolean environment variable key, if set and valid.
+func envBool(key string, b *bool) {
+	if v := os.Getenv(key); v != "" {
+		parseBool(v, b)
+	}
+}
+
+// parseBool sets *b from v, leaving it unchanged and returning false if v
+// is invalid.
+func parseBool(v string, b *bool) bool {
+	pb, err := strconv.ParseBool(v)
+	if err == nil {
+		*b = pb
+	}
+	return err == nil
+}
+
+// parseFileMode sets *m from an octal permission string such as "0660",
+// leaving it unchanged and returning false if v is invalid.
+func parseFileMode(v string, m *os.FileMode) bool {
+	iv, err := strconv.ParseUint(v, 8, 32)
+	if err == nil {
+		*m = os.FileMode(iv)
+	}
+	return err == nil
+}
+
+// parseIntList parses "1,2,3", skipping entries that are not integers.
+func parseIntList(s string) []int {
+	var res []int
+	for _, f := range strings.Split(s, ",") {
+		if iv, err := strconv.Atoi(strings.TrimSpace(f)); err == nil {
+			res = append(res, iv)
+		}
+	}
+	return res
+}
+
+// parseList parses "a,b,c", dropping empty entries.
+func parseList(s string) []string {
+	var res []string
+	for _, f := range strings.Split(s, ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			res = append(res, f)
+		}
+	}
+	return res
+}
+
+// parseFailover parses comma-separated upstreams of the form
+// "base_url=URL;api_key=KEY;model=M;provider=P", with pooled keys given as
+// "api_keys=KEY1|KEY2", prompt-based tool calling as "emulate_tools=true" and
+// buffered-only and streaming-only upstreams as "no_stream=true" and
+// "always_stream=true".
+// Entries without a base_url are skipped.
+func parseFailover(s string) []UpstreamConfig {
+	var res []UpstreamConfig
+	for _, entry := range strings.Split(s, ",") {
+		var u UpstreamConfig
+		for _, f := range strings.Split(entry, ";") {
+			k, v, _ := strings.Cut(f, "=")
+			v = strings.TrimSpace(v)
+			switch strings.TrimSpace(k) {
+			case "base_url":
+				u.BaseURL = v
+			case "api_key":
+				u.APIKey = v
+			case "api_keys":
+				u.APIKeys = strings.Split(v, "|")
+			case "model":
+				u.Model = v
+			case "provider":
+				u.Provider = v
+			case "max_concurrency":
+				parseInt(v, &u.MaxConcurrency)
+			case "emulate_tools":
+				parseBool(v, &u.EmulateTools)
+			case "no_stream":
+				parseBool(v, &u.NoStream)
+			case "always_stream":
+				parseBool(v, &u.AlwaysStream)
+			}
+		}
+		if u.BaseURL != "" {
+			res = append(res, u)
+		}
 	}
-	return res, nil
+	return res
 }
 
 // IsUsingDefaults returns true if config model and base URL match defaults.
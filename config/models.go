@@ -0,0 +1,73 @@
+package config
+
+import (
+	"path"
+	"strconv"
+	"strings"
+)
+
+// ModelMapping routes incoming model names matching Pattern to an upstream
+// model, optionally overriding request settings.
+type ModelMapping struct {
+	Pattern     string   `yaml:"pattern"`     // Exact name or glob, e.g. "claude-3-5-sonnet*"
+	Model       string   `yaml:"model"`       // Upstream model ID
+	MaxTokens   int      `yaml:"max_tokens"`  // Replaces MaxTokens as the cap when non-zero
+	Temperature *float64 `yaml:"temperature"` // Forces the sampling temperature when set
+	// ExtraBody is merged into the upstream payload for this model, after
+	// the upstream's own ExtraBody
+	ExtraBody map[string]interface{} `yaml:"extra_body"`
+}
+
+// smallModelPattern matches the models Claude Code uses for titles and
+// other background tasks.
+const smallModelPattern = "*haiku*"
+
+// MapModel returns the first mapping whose pattern matches name. Haiku
+// models without an explicit mapping are routed to SmallModel when set.
+func (c *Config) MapModel(name string) (ModelMapping, bool) {
+	for _, m := range c.ModelMap {
+		if m.Pattern == name {
+			return m, true
+		}
+		if ok, _ := path.Match(m.Pattern, name); ok {
+			return m, true
+		}
+	}
+	if c.SmallModel != "" && strings.Contains(strings.ToLower(name), "haiku") {
+		return ModelMapping{Pattern: smallModelPattern, Model: c.SmallModel}, true
+	}
+	return ModelMapping{}, false
+}
+
+// parseModelMap parses comma-separated mappings of the form
+// "pattern=model;max_tokens=N;temperature=T". Order is preserved so the
+// first matching pattern wins.
+func parseModelMap(s string) []ModelMapping {
+	var res []ModelMapping
+	for _, entry := range strings.Split(s, ",") {
+		fields := strings.Split(entry, ";")
+		pattern, model, ok := strings.Cut(fields[0], "=")
+		if !ok {
+			continue
+		}
+		m := ModelMapping{Pattern: strings.TrimSpace(pattern), Model: strings.TrimSpace(model)}
+		for _, f := range fields[1:] {
+			k, v, _ := strings.Cut(f, "=")
+			v = strings.TrimSpace(v)
+			switch strings.TrimSpace(k) {
+			case "max_tokens":
+				if iv, err := strconv.Atoi(v); err == nil {
+					m.MaxTokens = iv
+				}
+			case "temperature":
+				if fv, err := strconv.ParseFloat(v, 64); err == nil {
+					m.Temperature = &fv
+				}
+			}
+		}
+		if m.Pattern != "" && m.Model != "" {
+			res = append(res, m)
+		}
+	}
+	return res
+}
@@ -0,0 +1,56 @@
+package config
+
+import (
+	"path"
+	"strconv"
+	"strings"
+)
+
+// ModelPrice is the cost of an upstream model in USD per million tokens.
+type ModelPrice struct {
+	Pattern string  `yaml:"pattern"` // Exact upstream model name or glob, e.g. "gpt-4o*"
+	Input   float64 `yaml:"input"`
+	Output  float64 `yaml:"output"`
+}
+
+// Cost returns the USD cost of a request with the given token counts.
+func (p ModelPrice) Cost(inputTokens, outputTokens int) float64 {
+	return (float64(inputTokens)*p.Input + float64(outputTokens)*p.Output) / 1e6
+}
+
+// PriceFor returns the first pricing entry matching the upstream model.
+func (c *Config) PriceFor(model string) (ModelPrice, bool) {
+	for _, p := range c.Pricing {
+		if p.Pattern == model {
+			return p, true
+		}
+		if ok, _ := path.Match(p.Pattern, model); ok {
+			return p, true
+		}
+	}
+	return ModelPrice{}, false
+}
+
+// parsePricing parses comma-separated entries of the form
+// "pattern=input/output", prices in USD per million tokens.
+func parsePricing(s string) []ModelPrice {
+	var res []ModelPrice
+	for _, entry := range strings.Split(s, ",") {
+		pattern, prices, ok := strings.Cut(entry, "=")
+		if !ok {
+			continue
+		}
+		in, out, ok := strings.Cut(prices, "/")
+		if !ok {
+			continue
+		}
+		inF, err1 := strconv.ParseFloat(strings.TrimSpace(in), 64)
+		outF, err2 := strconv.ParseFloat(strings.TrimSpace(out), 64)
+		pattern = strings.TrimSpace(pattern)
+		if err1 != nil || err2 != nil || pattern == "" {
+			continue
+		}
+		res = append(res, ModelPrice{Pattern: pattern, Input: inF, Output: outF})
+	}
+	return res
+}
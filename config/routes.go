@@ -0,0 +1,53 @@
+package config
+
+import (
+	"path"
+	"strings"
+)
+
+// Route sends requests for models matching Pattern to a named provider
+// profile instead of the default upstream.
+type Route struct {
+	Pattern  string `yaml:"pattern"`  // Exact model name or glob
+	Provider string `yaml:"provider"` // Key in Providers
+	Model    string `yaml:"model"`    // Replaces the request model when set
+}
+
+// RouteFor returns the first route matching any of names, typically the
+// requested model followed by its model_map target.
+func (c *Config) RouteFor(names ...string) (Route, bool) {
+	for _, r := range c.Routes {
+		for _, name := range names {
+			if r.Pattern == name {
+				return r, true
+			}
+			if ok, _ := path.Match(r.Pattern, name); ok {
+				return r, true
+			}
+		}
+	}
+	return Route{}, false
+}
+
+// parseRoutes parses comma-separated routes of the form
+// "pattern=profile;model=M". Order is preserved so the first match wins.
+func parseRoutes(s string) []Route {
+	var res []Route
+	for _, entry := range strings.Split(s, ",") {
+		fields := strings.Split(entry, ";")
+		pattern, profile, ok := strings.Cut(fields[0], "=")
+		if !ok {
+			continue
+		}
+		r := Route{Pattern: strings.TrimSpace(pattern), Provider: strings.TrimSpace(profile)}
+		for _, f := range fields[1:] {
+			if k, v, _ := strings.Cut(f, "="); strings.TrimSpace(k) == "model" {
+				r.Model = strings.TrimSpace(v)
+			}
+		}
+		if r.Pattern != "" && r.Provider != "" {
+			res = append(res, r)
+		}
+	}
+	return res
+}
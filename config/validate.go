@@ -0,0 +1,140 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Problem is a mistake in the configuration.
+type Problem struct {
+	Key     string // Setting concerned, flattened as in the config file; "" for the file itself
+	Message string // What is wrong
+}
+
+// String formats p as "key: message".
+func (p Problem) String() string {
+	if p.Key == "" {
+		return p.Message
+	}
+	return p.Key + ": " + p.Message
+}
+
+// Validate loads the configuration like LoadConfig and returns it with the
+// problems found instead of logging them: unknown keys, invalid values
+// and sections, unknown fields in provider profiles and failover entries,
+// routes to unknown profiles and incomplete settings. The error is for configurations that cannot be
+// loaded at all, such as a config file that is not valid YAML.
+func Validate() (*Config, []Problem, error) {
+	cfg, problems, err := load()
+	if err != nil {
+		return nil, nil, err
+	}
+	if cfg.DefaultModel == "" {
+		problems = append(problems, Problem{Key: "model", Message: "no model is set; set model or default_model"})
+	}
+	if (cfg.TLSCertFile == "") != (cfg.TLSKeyFile == "") {
+		problems = append(problems, Problem{Key: "tls_cert_file", Message: "tls_cert_file and tls_key_file must be set together"})
+	}
+	if cfg.Listen == "" && (cfg.Port < 1 || cfg.Port > 65535) {
+		problems = append(problems, Problem{Key: "port", Message: fmt.Sprintf("%d is not a valid port", cfg.Port)})
+	}
+	for _, f := range []struct{ key, path string }{
+		{"tls_cert_file", cfg.TLSCertFile}, {"tls_key_file", cfg.TLSKeyFile},
+		{"upstream_client_cert", cfg.UpstreamClientCert}, {"upstream_client_key", cfg.UpstreamClientKey},
+		{"upstream_ca_file", cfg.UpstreamCAFile},
+	} {
+		if f.path == "" {
+			continue
+		}
+		if _, err := os.Stat(f.path); err != nil {
+			problems = append(problems, Problem{Key: f.key, Message: err.Error()})
+		}
+	}
+	for _, k := range []struct {
+		key   string
+		value float64
+	}{{"log_sample_rate", cfg.LogSampleRate}, {"tracing_sample_rate", cfg.TracingSampleRate}, {"mock_error_rate", cfg.MockErrorRate}} {
+		if k.value < 0 || k.value > 1 {
+			problems = append(problems, Problem{Key: k.key, Message: fmt.Sprintf("%g is not between 0 and 1", k.value)})
+		}
+	}
+	return cfg, problems, nil
+}
+
+// keyAlphabet are the characters config keys are made of.
+const keyAlphabet = "abcdefghijklmnopqrstuvwxyz0123456789_"
+
+// unknownKey reports config file key k as unknown, suggesting the known
+// keys one edit away, as typos usually are.
+func unknownKey(k string) Problem {
+	var scratch Config
+	known := func(c string) bool {
+		if structuredKeys[c] {
+			return true
+		}
+		ok, _ := applyKey(&scratch, c, "")
+		return ok
+	}
+	var candidates []string
+	for i := 0; i <= len(k); i++ {
+		if i < len(k) {
+			candidates = append(candidates, k[:i]+k[i+1:])
+		}
+		if i+1 < len(k) {
+			candidates = append(candidates, k[:i]+k[i+1:i+2]+k[i:i+1]+k[i+2:])
+		}
+		for _, r := range keyAlphabet {
+			candidates = append(candidates, k[:i]+string(r)+k[i:])
+			if i < len(k) {
+				candidates = append(candidates, k[:i]+string(r)+k[i+1:])
+			}
+		}
+	}
+	var suggestions []string
+	for _, c := range candidates {
+		if c != k && !slices.Contains(suggestions, c) && known(c) {
+			suggestions = append(suggestions, c)
+		}
+	}
+	if len(suggestions) == 0 {
+		return Problem{Key: k, Message: "unknown setting, ignored"}
+	}
+	return Problem{Key: k, Message: "unknown setting, ignored; did you mean " + strings.Join(suggestions, " or ") + "?"}
+}
+
+// unknownFields reports the fields of the provider profiles and failover
+// entries in section k that UpstreamConfig does not have.
+func unknownFields(k string, n *yaml.Node) []Problem {
+	var fields []string
+	t := reflect.TypeFor[UpstreamConfig]()
+	for i := range t.NumField() {
+		fields = append(fields, strings.Split(t.Field(i).Tag.Get("yaml"), ",")[0])
+	}
+	var problems []Problem
+	check := func(name string, m *yaml.Node) {
+		if m.Kind != yaml.MappingNode {
+			return
+		}
+		for i := 0; i+1 < len(m.Content); i += 2 {
+			if f := m.Content[i].Value; !slices.Contains(fields, f) {
+				problems = append(problems, Problem{Key: name + "." + f, Message: fmt.Sprintf("unknown field on line %d, ignored; fields are %s", m.Content[i].Line, strings.Join(fields, ", "))})
+			}
+		}
+	}
+	switch {
+	case k == "providers" && n.Kind == yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			check("providers."+n.Content[i].Value, n.Content[i+1])
+		}
+	case k == "failover" && n.Kind == yaml.SequenceNode:
+		for i, item := range n.Content {
+			check(fmt.Sprintf("failover[%d]", i), item)
+		}
+	}
+	return problems
+}
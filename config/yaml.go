@@ -0,0 +1,284 @@
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// structuredKeys are settings that accept YAML lists or mappings in
+// addition to their one-line string form.
+var structuredKeys = map[string]bool{
+	"model_map":         true,
+	"failover":          true,
+	"pricing":           true,
+	"budgets":           true,
+	"azure_deployments": true,
+	"providers":         true,
+	"routes":            true,
+	"extra_body":        true,
+}
+
+// keyAliases maps flattened section keys to their flat names where the two
+// differ, e.g. "server: {host: ...}" to "host".
+var keyAliases = map[string]string{
+	"server_host":         "host",
+	"server_port":         "port",
+	"server_listen":       "listen",
+	"server_listen_mode":  "listen_mode",
+	"upstream_base_url":   "base_url",
+	"upstream_api_key":    "api_key",
+	"upstream_api_keys":   "api_keys",
+	"upstream_provider":   "provider",
+	"upstream_model":      "model",
+	"upstream_failover":   "failover",
+	"logging_persist":     "log_persist",
+	"logging_sample_rate": "log_sample_rate",
+	"logging_retention":   "log_retention",
+}
+
+// parseYAMLFile loads a YAML config file. Nested sections are flattened by
+// joining keys with "_", so "retry: {max_attempts: 3}" is equivalent to the
+// flat "retry_max_attempts: 3". Scalars and lists of scalars are returned
+// as strings, lists joined with commas; lists and mappings under
+// structuredKeys are returned as nodes for typed decoding.
+//
+// Flat values go through applyKey, the same parser as environment
+// variables, so a setting is validated and converted in one place whatever
+// its source. Nothing is lost on the way: a scalar's text is kept as
+// written, quoted or not, and list items that would not survive the comma
+// join are rejected.
+func parseYAMLFile(path string) (map[string]string, map[string]*yaml.Node, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, nil, fmt.Errorf("%s is not valid YAML: %w", path, err)
+	}
+	flat := make(map[string]string)
+	sections := make(map[string]*yaml.Node)
+	if len(doc.Content) == 0 {
+		return flat, sections, nil
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, nil, fmt.Errorf("%s: top level must be a mapping", path)
+	}
+	interpolate(root)
+	if err := flatten(root, "", flat, sections); err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return flat, sections, nil
+}
+
+// flatten walks mapping node n, recording values under prefixed keys.
+func flatten(n *yaml.Node, prefix string, flat map[string]string, sections map[string]*yaml.Node) error {
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		key := prefix + n.Content[i].Value
+		if alias, ok := keyAliases[key]; ok {
+			key = alias
+		}
+		v := n.Content[i+1]
+		if v.Kind == yaml.AliasNode {
+			v = v.Alias
+		}
+		switch {
+		case v.Kind == yaml.ScalarNode:
+			if v.Tag != "!!null" {
+				flat[key] = v.Value
+			}
+		case structuredKeys[key]:
+			sections[key] = v
+		case v.Kind == yaml.MappingNode:
+			if err := flatten(v, key+"_", flat, sections); err != nil {
+				return err
+			}
+		case v.Kind == yaml.SequenceNode:
+			items := make([]string, 0, len(v.Content))
+			for _, item := range v.Content {
+				if item.Kind != yaml.ScalarNode {
+					return fmt.Errorf("line %d: %s must be a list of plain values", item.Line, key)
+				}
+				if strings.Contains(item.Value, ",") {
+					return fmt.Errorf("line %d: %s items cannot contain commas", item.Line, key)
+				}
+				items = append(items, item.Value)
+			}
+			flat[key] = strings.Join(items, ",")
+		}
+	}
+	return nil
+}
+
+// applySection decodes a structured setting into cfg.
+func applySection(cfg *Config, key string, n *yaml.Node) error {
+	if n.Kind == yaml.ScalarNode {
+		return nil // handled with the flat settings
+	}
+	switch key {
+	case "model_map":
+		return decodeModelMap(n, &cfg.ModelMap)
+	case "failover":
+		var list []UpstreamConfig
+		if err := n.Decode(&list); err != nil {
+			return err
+		}
+		cfg.Failover = list
+	case "pricing":
+		return decodePricing(n, &cfg.Pricing)
+	case "budgets":
+		return decodeBudgets(n, &cfg.Budgets)
+	case "providers":
+		m := make(map[string]UpstreamConfig)
+		if err := n.Decode(&m); err != nil {
+			return err
+		}
+		cfg.Providers = m
+	case "routes":
+		return decodeRoutes(n, &cfg.Routes)
+	case "extra_body":
+		m := make(map[string]interface{})
+		if err := n.Decode(&m); err != nil {
+			return err
+		}
+		cfg.ExtraBody = m
+	case "azure_deployments":
+		m := make(map[string]string)
+		if err := n.Decode(&m); err != nil {
+			return err
+		}
+		cfg.AzureDeployments = m
+	}
+	return nil
+}
+
+// decodeModelMap accepts a list of mappings, or a mapping from pattern to
+// either a model name or a mapping of settings. Order is preserved.
+func decodeModelMap(n *yaml.Node, dst *[]ModelMapping) error {
+	if n.Kind == yaml.SequenceNode {
+		return n.Decode(dst)
+	}
+	var res []ModelMapping
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		m := ModelMapping{}
+		if v := n.Content[i+1]; v.Kind == yaml.ScalarNode {
+			m.Model = v.Value
+		} else if err := v.Decode(&m); err != nil {
+			return err
+		}
+		m.Pattern = n.Content[i].Value
+		res = append(res, m)
+	}
+	*dst = res
+	return nil
+}
+
+// decodeRoutes accepts a list of mappings, or a mapping from pattern to
+// either a profile name or {provider, model}. Order is preserved.
+func decodeRoutes(n *yaml.Node, dst *[]Route) error {
+	if n.Kind == yaml.SequenceNode {
+		return n.Decode(dst)
+	}
+	var res []Route
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		r := Route{}
+		if v := n.Content[i+1]; v.Kind == yaml.ScalarNode {
+			r.Provider = v.Value
+		} else if err := v.Decode(&r); err != nil {
+			return err
+		}
+		r.Pattern = n.Content[i].Value
+		res = append(res, r)
+	}
+	*dst = res
+	return nil
+}
+
+// decodePricing accepts a list of mappings, or a mapping from pattern to
+// {input, output}. Order is preserved.
+func decodePricing(n *yaml.Node, dst *[]ModelPrice) error {
+	if n.Kind == yaml.SequenceNode {
+		return n.Decode(dst)
+	}
+	var res []ModelPrice
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		var p ModelPrice
+		if err := n.Content[i+1].Decode(&p); err != nil {
+			return err
+		}
+		p.Pattern = n.Content[i].Value
+		res = append(res, p)
+	}
+	*dst = res
+	return nil
+}
+
+// decodeBudgets accepts a list of mappings, or a mapping from a name such
+// as "daily_usd" to either the hard limit or {hard, soft}.
+func decodeBudgets(n *yaml.Node, dst *[]Budget) error {
+	if n.Kind == yaml.SequenceNode {
+		return n.Decode(dst)
+	}
+	var res []Budget
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		var b Budget
+		if v := n.Content[i+1]; v.Kind == yaml.ScalarNode {
+			if err := v.Decode(&b.Hard); err != nil {
+				return err
+			}
+		} else if err := v.Decode(&b); err != nil {
+			return err
+		}
+		name := n.Content[i].Value
+		period, unit, _ := strings.Cut(name, "_")
+		if (period != "daily" && period != "monthly") || (unit != "usd" && unit != "tokens") {
+			return fmt.Errorf("line %d: unknown budget %q", n.Content[i].Line, name)
+		}
+		b.Period, b.Unit = period, unit
+		res = append(res, b)
+	}
+	*dst = res
+	return nil
+}
+
+// envRef matches ${VAR} and ${VAR:-default}.
+var envRef = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(?::-([^}]*))?\}`)
+
+// interpolate replaces environment variable references in every scalar
+// value under n, so secrets can stay out of the file. Unset variables
+// without a default become empty and are logged. Keys are left as is.
+func interpolate(n *yaml.Node) {
+	switch n.Kind {
+	case yaml.ScalarNode:
+		n.Value = expandEnv(n.Value)
+	case yaml.MappingNode:
+		for i := 1; i < len(n.Content); i += 2 {
+			interpolate(n.Content[i])
+		}
+	case yaml.SequenceNode, yaml.DocumentNode:
+		for _, c := range n.Content {
+			interpolate(c)
+		}
+	}
+}
+
+// expandEnv replaces environment variable references in s.
+func expandEnv(s string) string {
+	return envRef.ReplaceAllStringFunc(s, func(ref string) string {
+		m := envRef.FindStringSubmatch(ref)
+		if v, ok := os.LookupEnv(m[1]); ok && v != "" {
+			return v
+		}
+		if strings.Contains(ref, ":-") {
+			return m[2]
+		}
+		slog.Warn("Config references an unset environment variable", "name", m[1])
+		return ""
+	})
+}
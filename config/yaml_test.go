@@ -0,0 +1,69 @@
+package config
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeConfig makes content the only config file found, in a temporary
+// working and home directory.
+func writeConfig(t *testing.T, content string) {
+	t.Helper()
+	dir := t.TempDir()
+	t.Chdir(dir)
+	t.Setenv("HOME", dir)
+	if err := os.WriteFile("gopenbridge.yaml", []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInvalidYAMLIsAnError(t *testing.T) {
+	writeConfig(t, "model: gpt-4o\nretry:\n  max_attempts: 7\n   on: [429]\n")
+	if _, err := LoadConfig(); err == nil || !strings.Contains(err.Error(), "not valid YAML") || !strings.Contains(err.Error(), "line 4") {
+		t.Errorf("LoadConfig err = %v, want the parse error with its line", err)
+	}
+	if _, _, err := Validate(); err == nil || !strings.Contains(err.Error(), "not valid YAML") {
+		t.Errorf("Validate err = %v, want the parse error", err)
+	}
+}
+
+func TestNestedSectionsMatchFlatKeys(t *testing.T) {
+	writeConfig(t, "retry:\n  max_attempts: 3\nserver:\n  port: 9000\nauth_keys: [sk-a, sk-b]\n")
+	nested, problems, err := load()
+	if err != nil || len(problems) > 0 {
+		t.Fatalf("nested: %v, %v", problems, err)
+	}
+	writeConfig(t, "retry_max_attempts: 3\nport: 9000\nauth_keys: sk-a,sk-b\n")
+	flat, problems, err := load()
+	if err != nil || len(problems) > 0 {
+		t.Fatalf("flat: %v, %v", problems, err)
+	}
+	if nested.RetryMaxAttempts != 3 || nested.Port != 9000 || !reflect.DeepEqual(nested.AuthKeys, []string{"sk-a", "sk-b"}) {
+		t.Errorf("nested: retry_max_attempts %d, port %d, auth_keys %v", nested.RetryMaxAttempts, nested.Port, nested.AuthKeys)
+	}
+	if !reflect.DeepEqual(nested, flat) {
+		t.Errorf("nested and flat files load differently:\n%+v\n%+v", nested, flat)
+	}
+}
+
+func TestYAMLScalarsKeepTheirText(t *testing.T) {
+	// Values YAML would read as numbers or booleans reach applyKey as
+	// written
+	writeConfig(t, "api_key: 0123\nmodel: \"1.50\"\nauth_keys: [007, yes]\n")
+	cfg, problems, err := load()
+	if err != nil || len(problems) > 0 {
+		t.Fatalf("%v, %v", problems, err)
+	}
+	if cfg.APIKey != "0123" || cfg.Model != "1.50" || !reflect.DeepEqual(cfg.AuthKeys, []string{"007", "yes"}) {
+		t.Errorf("api_key %q, model %q, auth_keys %v", cfg.APIKey, cfg.Model, cfg.AuthKeys)
+	}
+}
+
+func TestYAMLListItemWithComma(t *testing.T) {
+	writeConfig(t, "model: gpt-4o\nauth_keys: [\"sk-a,sk-b\"]\n")
+	if _, _, err := load(); err == nil || !strings.Contains(err.Error(), "cannot contain commas") {
+		t.Errorf("err = %v, want the comma rejected", err)
+	}
+}
@@ -5,4 +5,5 @@ go 1.24
 require (
    github.com/google/uuid v1.3.0
    github.com/mattn/go-sqlite3 v1.14.16
+   gopkg.in/yaml.v3 v3.0.1
 )
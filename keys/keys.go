@@ -0,0 +1,170 @@
+// Package keys manages virtual API keys: named credentials issued to
+// clients of the proxy, stored hashed in SQLite with optional quotas.
+package keys
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"gopenbridge/migrate"
+)
+
+var (
+	// ErrNotFound is returned when no active key has the given name.
+	ErrNotFound = errors.New("key not found")
+	// ErrExists is returned when an active key already has the given name.
+	ErrExists = errors.New("key already exists")
+)
+
+// secretPrefix marks secrets issued by this package.
+const secretPrefix = "gob-"
+
+// Key is a virtual API key. The secret itself is never stored.
+type Key struct {
+	Name        string    `json:"name"`
+	Prefix      string    `json:"prefix"` // First characters of the secret, for identification
+	CreatedAt   time.Time `json:"created_at"`
+	RateLimit   int       `json:"rate_limit"`   // Requests per minute; zero is unlimited
+	DailyTokens int       `json:"daily_tokens"` // Tokens per UTC day; zero is unlimited
+}
+
+// Store persists virtual keys in the virtual_keys table.
+type Store struct {
+	db *sql.DB
+}
+
+// NewStore returns a store backed by db, migrating its table if needed.
+func NewStore(db *sql.DB) (*Store, error) {
+	if err := migrate.Apply(context.Background(), db, "keys", migrations); err != nil {
+		return nil, err
+	}
+	return &Store{db: db}, nil
+}
+
+// migrations are the schema changes of virtual_keys, in order.
+var migrations = []migrate.Migration{
+	migrate.Exec("create virtual_keys", `CREATE TABLE IF NOT EXISTS virtual_keys (
+		name TEXT PRIMARY KEY,
+		key_hash TEXT UNIQUE NOT NULL,
+		prefix TEXT,
+		created_at DATETIME,
+		rate_limit INTEGER,
+		daily_tokens INTEGER,
+		revoked_at DATETIME
+	)`),
+}
+
+// Create issues a key and returns it with its secret, which cannot be
+// recovered later.
+func (s *Store) Create(ctx context.Context, name string, rateLimit, dailyTokens int) (*Key, string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, "", err
+	}
+	secret := secretPrefix + hex.EncodeToString(buf)
+	k := &Key{Name: name, Prefix: secret[:len(secretPrefix)+6], CreatedAt: time.Now().UTC(), RateLimit: rateLimit, DailyTokens: dailyTokens}
+	// Revoked keys keep their row for auditing until the name is reissued
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM virtual_keys WHERE name = ? AND revoked_at IS NOT NULL", name); err != nil {
+		return nil, "", err
+	}
+	_, err := s.db.ExecContext(ctx,
+		"INSERT INTO virtual_keys(name, key_hash, prefix, created_at, rate_limit, daily_tokens) VALUES (?, ?, ?, ?, ?, ?)",
+		k.Name, hash(secret), k.Prefix, k.CreatedAt, k.RateLimit, k.DailyTokens)
+	if err != nil && strings.Contains(err.Error(), "UNIQUE constraint") {
+		return nil, "", ErrExists
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return k, secret, nil
+}
+
+// Lookup returns the active key with the given secret, or nil if none.
+func (s *Store) Lookup(ctx context.Context, secret string) (*Key, error) {
+	var k Key
+	err := s.db.QueryRowContext(ctx,
+		"SELECT name, COALESCE(prefix, ''), created_at, COALESCE(rate_limit, 0), COALESCE(daily_tokens, 0) FROM virtual_keys WHERE key_hash = ? AND revoked_at IS NULL",
+		hash(secret)).Scan(&k.Name, &k.Prefix, &k.CreatedAt, &k.RateLimit, &k.DailyTokens)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &k, nil
+}
+
+// List returns the active keys ordered by name.
+func (s *Store) List(ctx context.Context) ([]Key, error) {
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT name, COALESCE(prefix, ''), created_at, COALESCE(rate_limit, 0), COALESCE(daily_tokens, 0) FROM virtual_keys WHERE revoked_at IS NULL ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	res := []Key{}
+	for rows.Next() {
+		var k Key
+		if err := rows.Scan(&k.Name, &k.Prefix, &k.CreatedAt, &k.RateLimit, &k.DailyTokens); err != nil {
+			return nil, err
+		}
+		res = append(res, k)
+	}
+	return res, rows.Err()
+}
+
+// Active reports whether any key is active, which turns on authentication.
+func (s *Store) Active(ctx context.Context) (bool, error) {
+	var n int
+	err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM virtual_keys WHERE revoked_at IS NULL").Scan(&n)
+	return n > 0, err
+}
+
+// Revoke disables the active key called name.
+func (s *Store) Revoke(ctx context.Context, name string) error {
+	res, err := s.db.ExecContext(ctx, "UPDATE virtual_keys SET revoked_at = ? WHERE name = ? AND revoked_at IS NULL", time.Now().UTC(), name)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// FromRequest returns the key a client presented in x-api-key or as an
+// Authorization bearer token.
+func FromRequest(r *http.Request) string {
+	if key := r.Header.Get("X-Api-Key"); key != "" {
+		return key
+	}
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	return ""
+}
+
+// MatchStatic reports whether key is one of the configured static keys,
+// comparing in constant time.
+func MatchStatic(key string, static []string) bool {
+	for _, k := range static {
+		if subtle.ConstantTimeCompare([]byte(key), []byte(k)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// hash returns the stored form of a secret.
+func hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
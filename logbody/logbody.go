@@ -0,0 +1,115 @@
+// Package logbody stores the request and response bodies of api_logs rows:
+// as text, as gzip-compressed blobs, or in files referenced from the row,
+// optionally truncated so image-heavy conversations do not balloon the
+// database.
+package logbody
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// Storage modes, recorded in the body_storage column of each row. Rows
+// without one hold text.
+const (
+	Inline = "inline"
+	Gzip   = "gzip"
+	File   = "file"
+)
+
+// Options configure how bodies are stored.
+type Options struct {
+	MaxBytes int    // Bodies longer than this are truncated; zero keeps them whole
+	Storage  string // Inline, Gzip or File
+	Dir      string // Directory for File storage
+}
+
+// Truncate cuts body to at most max bytes, on a UTF-8 boundary, and appends
+// a marker recording how much was dropped. max <= 0 disables truncation.
+func Truncate(body string, max int) string {
+	if max <= 0 || len(body) <= max {
+		return body
+	}
+	cut := max
+	for cut > 0 && !utf8.RuneStart(body[cut]) {
+		cut--
+	}
+	return fmt.Sprintf("%s\n...[truncated %d bytes]", body[:cut], len(body)-cut)
+}
+
+// Truncated reports whether body ends with a marker added by Truncate.
+func Truncated(body string) bool {
+	i := strings.LastIndex(body, "\n...[truncated ")
+	return i >= 0 && strings.HasSuffix(body, " bytes]")
+}
+
+// Store truncates body and encodes it for the row id, returning the column
+// value and the storage mode it was written with. name tells the request
+// and response files of a row apart.
+func Store(o Options, id, name, body string) (interface{}, string, error) {
+	body = Truncate(body, o.MaxBytes)
+	switch o.Storage {
+	case Gzip:
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		zw.Write([]byte(body))
+		if err := zw.Close(); err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), Gzip, nil
+	case File:
+		if body == "" {
+			return "", File, nil
+		}
+		if err := os.MkdirAll(o.Dir, 0o700); err != nil {
+			return nil, "", err
+		}
+		path, err := filepath.Abs(filepath.Join(o.Dir, id+"."+name+".json"))
+		if err != nil {
+			return nil, "", err
+		}
+		if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+			return nil, "", err
+		}
+		return path, File, nil
+	}
+	return body, Inline, nil
+}
+
+// Load decodes a column value written with storage.
+func Load(storage string, value []byte) (string, error) {
+	if len(value) == 0 {
+		return "", nil
+	}
+	switch storage {
+	case Gzip:
+		zr, err := gzip.NewReader(bytes.NewReader(value))
+		if err != nil {
+			return "", err
+		}
+		data, err := io.ReadAll(zr)
+		return string(data), err
+	case File:
+		data, err := os.ReadFile(string(value))
+		return string(data), err
+	}
+	return string(value), nil
+}
+
+// Remove deletes the files of a row whose bodies were stored with storage.
+func Remove(storage string, values ...[]byte) {
+	if storage != File {
+		return
+	}
+	for _, v := range values {
+		if len(v) > 0 {
+			os.Remove(string(v))
+		}
+	}
+}
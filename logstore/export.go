@@ -0,0 +1,85 @@
+package logstore
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// Export formats.
+const (
+	JSONL = "jsonl" // One Log JSON object per line
+	CSV   = "csv"   // A header row, then one row per log
+)
+
+// ContentType returns the MIME type of an export format, and whether the
+// format is known.
+func ContentType(format string) (string, bool) {
+	switch format {
+	case JSONL:
+		return "application/x-ndjson", true
+	case CSV:
+		return "text/csv; charset=utf-8", true
+	}
+	return "", false
+}
+
+// csvHeader names the CSV columns, after the JSON field names.
+var csvHeader = []string{"id", "timestamp", "provider", "endpoint", "model", "status_code", "error_message",
+	"stop_reason", "prompt_tokens", "completion_tokens", "retries", "cost_usd", "key", "upstream_key", "user_id",
+	"anthropic_version", "anthropic_beta", "latency_ms"}
+
+// Export writes the rows of s matching f to w in format, oldest first, and
+// returns how many were written. Bodies are included if bodies is set.
+func Export(ctx context.Context, s Store, w io.Writer, format string, f Filter, bodies bool) (int, error) {
+	n := 0
+	switch format {
+	case JSONL:
+		enc := json.NewEncoder(w)
+		err := s.ExportLogs(ctx, f, bodies, func(l Log) error {
+			n++
+			return enc.Encode(l)
+		})
+		return n, err
+	case CSV:
+		cw := csv.NewWriter(w)
+		header := csvHeader
+		if bodies {
+			header = append(header[:len(header):len(header)], "request", "response", "client_request")
+		}
+		if err := cw.Write(header); err != nil {
+			return 0, err
+		}
+		err := s.ExportLogs(ctx, f, bodies, func(l Log) error {
+			n++
+			return cw.Write(csvRecord(l, bodies))
+		})
+		cw.Flush()
+		if err == nil {
+			err = cw.Error()
+		}
+		return n, err
+	}
+	return 0, fmt.Errorf("unknown export format %q, want %s or %s", format, JSONL, CSV)
+}
+
+// csvRecord returns the csvHeader fields of l, then its bodies if bodies
+// is set.
+func csvRecord(l Log, bodies bool) []string {
+	cost := ""
+	if l.CostUSD != nil {
+		cost = strconv.FormatFloat(*l.CostUSD, 'f', -1, 64)
+	}
+	rec := []string{l.ID, l.Timestamp.UTC().Format(time.RFC3339Nano), l.Provider, l.Endpoint, l.Model,
+		strconv.Itoa(l.StatusCode), l.ErrorMessage, l.StopReason, strconv.Itoa(l.PromptTokens),
+		strconv.Itoa(l.CompletionTokens), strconv.Itoa(l.Retries), cost, l.KeyName, l.UpstreamKey, l.UserID,
+		l.AnthropicVersion, l.AnthropicBeta, strconv.FormatInt(l.LatencyMs, 10)}
+	if bodies {
+		rec = append(rec, l.Request, l.Response, l.ClientRequest)
+	}
+	return rec
+}
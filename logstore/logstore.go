@@ -0,0 +1,122 @@
+// Package logstore records finished requests and answers queries over them:
+// the request log browsed in the admin dashboard and the usage aggregates
+// that budgets and quotas are checked against. Store abstracts the backend;
+// SQLite is the default implementation.
+package logstore
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrNotFound is returned for unknown log IDs.
+var ErrNotFound = errors.New("log not found")
+
+// Store is a request log backend.
+type Store interface {
+	// LogRequests records finished requests. Every record's usage is
+	// counted; its log row is stored only when Persist is set. Rows that
+	// cannot be written are logged and skipped, the error reports a failure
+	// of the whole batch.
+	LogRequests(ctx context.Context, records []Record) error
+	// QueryLogs returns the rows matching f, newest first, without bodies.
+	QueryLogs(ctx context.Context, f Filter) ([]Log, error)
+	// GetLog returns the row with id including its bodies, or ErrNotFound.
+	GetLog(ctx context.Context, id string) (*Log, error)
+	// ExportLogs calls fn with each row matching f, oldest first, with its
+	// bodies if bodies is set, stopping at the first error. Limit and
+	// Offset are ignored.
+	ExportLogs(ctx context.Context, f Filter, bodies bool, fn func(Log) error) error
+	// Usage aggregates the requests matching f by UTC day, upstream model,
+	// provider and upstream API key, newest day first.
+	Usage(ctx context.Context, f Filter) ([]UsageRow, error)
+	// Totals sums the requests matching f.
+	Totals(ctx context.Context, f Filter) (Totals, error)
+	// Prune deletes the log rows policy selects and reclaims their space.
+	// Usage counts are kept.
+	Prune(ctx context.Context, policy PrunePolicy) (PruneResult, error)
+}
+
+// Log is one request log row.
+type Log struct {
+	ID               string    `json:"id"`
+	Timestamp        time.Time `json:"timestamp"`
+	Provider         string    `json:"provider"` // Base URL of the upstream that served the request
+	Endpoint         string    `json:"endpoint"`
+	Model            string    `json:"model"`
+	StatusCode       int       `json:"status_code"`
+	ErrorMessage     string    `json:"error_message,omitempty"`
+	StopReason       string    `json:"stop_reason,omitempty"`
+	PromptTokens     int       `json:"prompt_tokens"`
+	CompletionTokens int       `json:"completion_tokens"`
+	Retries          int       `json:"retries"`                // Upstream retries before the final attempt
+	LatencyMs        int64     `json:"latency_ms"`             // From the client request to the end of the response, 0 if not recorded
+	CostUSD          *float64  `json:"cost_usd"`               // Estimated cost, nil when the model has no price
+	KeyName          string    `json:"key,omitempty"`          // Virtual key the request was made with
+	UpstreamKey      string    `json:"upstream_key,omitempty"` // Label of the upstream API key used
+	UserID           string    `json:"user_id,omitempty"`      // End user from metadata.user_id
+	AnthropicVersion string    `json:"anthropic_version,omitempty"`
+	AnthropicBeta    string    `json:"anthropic_beta,omitempty"` // Comma-separated client betas
+	Request          string    `json:"request,omitempty"`        // Body sent upstream
+	Response         string    `json:"response,omitempty"`       // Body received from upstream
+	ClientRequest    string    `json:"client_request,omitempty"` // Messages request as the client sent it
+}
+
+// Record is a finished request handed to LogRequests.
+type Record struct {
+	Log
+	Persist bool // store the log row, not only its usage
+}
+
+// Filter selects requests. Zero values do not filter.
+type Filter struct {
+	Model       string
+	Key         string // Virtual key name
+	UpstreamKey string // Upstream API key label, as logged
+	UserID      string // End user from metadata.user_id
+	Status      int
+	Since       time.Time
+	Until       time.Time
+	Limit       int // QueryLogs only
+	Offset      int // QueryLogs only
+}
+
+// UsageRow aggregates the requests of one UTC day, upstream model, provider
+// and upstream API key.
+type UsageRow struct {
+	Day              string   `json:"day"` // UTC date, YYYY-MM-DD
+	Model            string   `json:"model"`
+	Provider         string   `json:"provider"`
+	UpstreamKey      string   `json:"upstream_key,omitempty"`
+	Requests         int      `json:"requests"`
+	Errors           int      `json:"errors"` // Requests that ended with a 4xx or 5xx status
+	PromptTokens     int      `json:"prompt_tokens"`
+	CompletionTokens int      `json:"completion_tokens"`
+	CostUSD          *float64 `json:"cost_usd"` // nil when no request could be priced
+
+	// Requests logged without a cost, e.g. before pricing was configured,
+	// so callers can price them at query time
+	UnpricedRequests         int `json:"-"`
+	UnpricedPromptTokens     int `json:"-"`
+	UnpricedCompletionTokens int `json:"-"`
+}
+
+// Totals sums usage.
+type Totals struct {
+	Requests int
+	Tokens   int     // Prompt and completion tokens
+	CostUSD  float64 // Stored cost of priced requests
+}
+
+// PrunePolicy selects the log rows Prune deletes. Zero values do not prune.
+type PrunePolicy struct {
+	Before   time.Time // Rows logged before this
+	MaxBytes int64     // The oldest rows, while the store is larger than this
+}
+
+// PruneResult reports a Prune run.
+type PruneResult struct {
+	Deleted   int   // Log rows deleted
+	SizeBytes int64 // Store size afterwards
+}
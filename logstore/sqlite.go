@@ -0,0 +1,579 @@
+package logstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"gopenbridge/logbody"
+	"gopenbridge/migrate"
+)
+
+// SQLite stores request logs in the api_logs table and usage in
+// usage_daily, which counts requests whether or not their rows are kept.
+type SQLite struct {
+	db     *sql.DB
+	bodies func() logbody.Options // how request and response bodies are stored
+
+	insertLog   *sql.Stmt // insertLogSQL, prepared once for the write path
+	upsertUsage *sql.Stmt // upsertUsageSQL
+
+	vacuumWarning sync.Once
+}
+
+// NewSQLite returns a store on db, migrating its tables as needed. bodies
+// is consulted on every write, so it can follow config reloads.
+func NewSQLite(db *sql.DB, bodies func() logbody.Options) (*SQLite, error) {
+	if err := migrate.Apply(context.Background(), db, "logstore", migrations); err != nil {
+		return nil, err
+	}
+	s := &SQLite{db: db, bodies: bodies}
+	var err error
+	if s.insertLog, err = db.Prepare(insertLogSQL); err != nil {
+		return nil, err
+	}
+	if s.upsertUsage, err = db.Prepare(upsertUsageSQL); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// migrations are the schema changes of the log tables, in order.
+var migrations = []migrate.Migration{
+	{Name: "create api_logs", Up: createLogTable},
+	{Name: "create usage_daily", Up: createUsageTable},
+	// QueryLogs filters on these and sorts by timestamp, as does Prune
+	migrate.Exec("index api_logs",
+		"CREATE INDEX IF NOT EXISTS idx_api_logs_timestamp ON api_logs(timestamp)",
+		"CREATE INDEX IF NOT EXISTS idx_api_logs_model ON api_logs(model, timestamp)",
+		"CREATE INDEX IF NOT EXISTS idx_api_logs_status ON api_logs(status_code, timestamp)"),
+	// The request as the client sent it, for replay
+	migrate.Exec("add api_logs.client_request", "ALTER TABLE api_logs ADD COLUMN client_request TEXT"),
+	migrate.Exec("add api_logs.latency_ms", "ALTER TABLE api_logs ADD COLUMN latency_ms INTEGER"),
+}
+
+// createLogTable creates api_logs, adding the columns an api_logs created
+// before migrations may lack.
+func createLogTable(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS api_logs (
+		id TEXT PRIMARY KEY,
+		timestamp DATETIME,
+		provider TEXT,
+		endpoint TEXT,
+		model TEXT,
+		request TEXT,
+		response TEXT,
+		status_code INTEGER,
+		error_message TEXT,
+		prompt_tokens INTEGER,
+		completion_tokens INTEGER,
+		stop_reason TEXT,
+		retries INTEGER,
+		cost_usd REAL,
+		key_name TEXT,
+		upstream_key TEXT,
+		user_id TEXT,
+		anthropic_version TEXT,
+		anthropic_beta TEXT,
+		body_storage TEXT
+	)`)
+	if err != nil {
+		return err
+	}
+	for _, c := range []struct{ name, decl string }{
+		{"stop_reason", "TEXT"},
+		{"retries", "INTEGER"},
+		{"cost_usd", "REAL"},
+		{"key_name", "TEXT"},
+		{"upstream_key", "TEXT"},
+		{"user_id", "TEXT"},
+		{"anthropic_version", "TEXT"},
+		{"anthropic_beta", "TEXT"},
+		{"body_storage", "TEXT"},
+	} {
+		if err := migrate.AddColumn(ctx, tx, "api_logs", c.name, c.decl); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createUsageTable creates usage_daily. A new table is filled from the rows
+// already in api_logs, so budgets carry over.
+func createUsageTable(ctx context.Context, tx *sql.Tx) error {
+	var exists int
+	if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'usage_daily'").Scan(&exists); err != nil {
+		return err
+	}
+	_, err := tx.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS usage_daily (
+		day TEXT NOT NULL,
+		model TEXT NOT NULL,
+		provider TEXT NOT NULL,
+		key_name TEXT NOT NULL,
+		upstream_key TEXT NOT NULL,
+		user_id TEXT NOT NULL,
+		status_code INTEGER NOT NULL,
+		requests INTEGER NOT NULL,
+		prompt_tokens INTEGER NOT NULL,
+		completion_tokens INTEGER NOT NULL,
+		cost_usd REAL,
+		unpriced_requests INTEGER NOT NULL,
+		unpriced_prompt_tokens INTEGER NOT NULL,
+		unpriced_completion_tokens INTEGER NOT NULL,
+		PRIMARY KEY (day, model, provider, key_name, upstream_key, user_id, status_code)
+	)`)
+	if err != nil || exists > 0 {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO usage_daily
+		SELECT substr(timestamp, 1, 10), COALESCE(model, ''), COALESCE(provider, ''), COALESCE(key_name, ''),
+			COALESCE(upstream_key, ''), COALESCE(user_id, ''), COALESCE(status_code, 0),
+			COUNT(*), SUM(COALESCE(prompt_tokens, 0)), SUM(COALESCE(completion_tokens, 0)), SUM(cost_usd),
+			COUNT(*) - COUNT(cost_usd),
+			SUM(CASE WHEN cost_usd IS NULL THEN COALESCE(prompt_tokens, 0) ELSE 0 END),
+			SUM(CASE WHEN cost_usd IS NULL THEN COALESCE(completion_tokens, 0) ELSE 0 END)
+		FROM api_logs GROUP BY 1, 2, 3, 4, 5, 6, 7`)
+	return err
+}
+
+const insertLogSQL = `INSERT INTO api_logs(id, timestamp, provider, endpoint, model, request, response, status_code, error_message, prompt_tokens, completion_tokens, stop_reason, retries, cost_usd, key_name, upstream_key, user_id, anthropic_version, anthropic_beta, body_storage, client_request, latency_ms) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+// upsertUsageSQL adds one request to its usage_daily row.
+const upsertUsageSQL = `INSERT INTO usage_daily(day, model, provider, key_name, upstream_key, user_id, status_code,
+	requests, prompt_tokens, completion_tokens, cost_usd, unpriced_requests, unpriced_prompt_tokens, unpriced_completion_tokens)
+	VALUES (?, ?, ?, ?, ?, ?, ?, 1, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT(day, model, provider, key_name, upstream_key, user_id, status_code) DO UPDATE SET
+		requests = requests + 1,
+		prompt_tokens = prompt_tokens + excluded.prompt_tokens,
+		completion_tokens = completion_tokens + excluded.completion_tokens,
+		cost_usd = CASE WHEN excluded.cost_usd IS NULL THEN cost_usd ELSE COALESCE(cost_usd, 0) + excluded.cost_usd END,
+		unpriced_requests = unpriced_requests + excluded.unpriced_requests,
+		unpriced_prompt_tokens = unpriced_prompt_tokens + excluded.unpriced_prompt_tokens,
+		unpriced_completion_tokens = unpriced_completion_tokens + excluded.unpriced_completion_tokens`
+
+// LogRequests satisfies Store, writing records in one transaction.
+func (s *SQLite) LogRequests(ctx context.Context, records []Record) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	logs := tx.StmtContext(ctx, s.insertLog)
+	defer logs.Close()
+	usage := tx.StmtContext(ctx, s.upsertUsage)
+	defer usage.Close()
+	opts := s.bodies()
+	for _, r := range records {
+		if _, err := usage.ExecContext(ctx, usageArgs(r.Log)...); err != nil {
+			slog.Error("Failed to record API usage", "id", r.ID, "error", err)
+		}
+		if !r.Persist {
+			continue
+		}
+		if _, err := logs.ExecContext(ctx, logArgs(r.Log, opts)...); err != nil {
+			slog.Error("Failed to persist API log", "id", r.ID, "error", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// logArgs returns the insertLogSQL arguments for l. Bodies that cannot be
+// stored as opts asks are kept inline.
+func logArgs(l Log, opts logbody.Options) []interface{} {
+	bodies, storage, err := storeBodies(l, opts)
+	if err != nil {
+		slog.Error("Failed to store API log bodies, storing them inline", "id", l.ID, "error", err)
+		opts.Storage = logbody.Inline
+		bodies, storage, _ = storeBodies(l, opts)
+	}
+	return []interface{}{
+		l.ID,
+		l.Timestamp.UTC(),
+		l.Provider,
+		l.Endpoint,
+		l.Model,
+		bodies[0],
+		bodies[1],
+		l.StatusCode,
+		l.ErrorMessage,
+		l.PromptTokens,
+		l.CompletionTokens,
+		l.StopReason,
+		l.Retries,
+		l.CostUSD,
+		nullString(l.KeyName),
+		nullString(l.UpstreamKey),
+		nullString(l.UserID),
+		nullString(l.AnthropicVersion),
+		nullString(l.AnthropicBeta),
+		storage,
+		bodies[2],
+		l.LatencyMs,
+	}
+}
+
+// storeBodies stores the request, response and client request of l as opts
+// asks, returning their column values and storage mode.
+func storeBodies(l Log, opts logbody.Options) ([3]interface{}, string, error) {
+	var values [3]interface{}
+	var storage string
+	var errs []error
+	for i, b := range []struct{ name, body string }{
+		{"request", l.Request},
+		{"response", l.Response},
+		{"client_request", l.ClientRequest},
+	} {
+		var err error
+		values[i], storage, err = logbody.Store(opts, l.ID, b.name, b.body)
+		errs = append(errs, err)
+	}
+	return values, storage, errors.Join(errs...)
+}
+
+// usageArgs returns the upsertUsageSQL arguments for l.
+func usageArgs(l Log) []interface{} {
+	unpriced, unpricedPrompt, unpricedCompletion := 0, 0, 0
+	if l.CostUSD == nil {
+		unpriced, unpricedPrompt, unpricedCompletion = 1, l.PromptTokens, l.CompletionTokens
+	}
+	return []interface{}{
+		l.Timestamp.UTC().Format(time.DateOnly),
+		l.Model,
+		l.Provider,
+		l.KeyName,
+		l.UpstreamKey,
+		l.UserID,
+		l.StatusCode,
+		l.PromptTokens,
+		l.CompletionTokens,
+		l.CostUSD,
+		unpriced,
+		unpricedPrompt,
+		unpricedCompletion,
+	}
+}
+
+// nullString returns s, or nil for an empty s so it is stored as NULL.
+func nullString(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// summaryColumns are the columns listed without the request and response bodies.
+const summaryColumns = `id, timestamp, COALESCE(provider, ''), COALESCE(endpoint, ''), COALESCE(model, ''),
+	COALESCE(status_code, 0), COALESCE(error_message, ''), COALESCE(stop_reason, ''),
+	COALESCE(prompt_tokens, 0), COALESCE(completion_tokens, 0), COALESCE(retries, 0), cost_usd, COALESCE(key_name, ''),
+	COALESCE(upstream_key, ''), COALESCE(user_id, ''), COALESCE(anthropic_version, ''), COALESCE(anthropic_beta, ''),
+	COALESCE(latency_ms, 0)`
+
+// summaryDest returns the scan destinations for summaryColumns.
+func summaryDest(l *Log) []interface{} {
+	return []interface{}{&l.ID, &l.Timestamp, &l.Provider, &l.Endpoint, &l.Model, &l.StatusCode,
+		&l.ErrorMessage, &l.StopReason, &l.PromptTokens, &l.CompletionTokens, &l.Retries, &l.CostUSD, &l.KeyName,
+		&l.UpstreamKey, &l.UserID, &l.AnthropicVersion, &l.AnthropicBeta, &l.LatencyMs}
+}
+
+// where returns the WHERE clause selecting f's rows, or "" when f does not
+// filter, and its arguments. With byDay the rows are usage_daily's, which
+// cover whole UTC days: since and until select the days they fall in.
+func (f Filter) where(byDay bool) (string, []interface{}) {
+	var where []string
+	var args []interface{}
+	if f.Model != "" {
+		where = append(where, "model = ?")
+		args = append(args, f.Model)
+	}
+	if f.Key != "" {
+		where = append(where, "key_name = ?")
+		args = append(args, f.Key)
+	}
+	if f.UpstreamKey != "" {
+		where = append(where, "upstream_key = ?")
+		args = append(args, f.UpstreamKey)
+	}
+	if f.UserID != "" {
+		where = append(where, "user_id = ?")
+		args = append(args, f.UserID)
+	}
+	if f.Status != 0 {
+		where = append(where, "status_code = ?")
+		args = append(args, f.Status)
+	}
+	switch {
+	case byDay && !f.Since.IsZero():
+		where = append(where, "day >= ?")
+		args = append(args, f.Since.UTC().Format(time.DateOnly))
+	case !f.Since.IsZero():
+		where = append(where, "timestamp >= ?")
+		args = append(args, f.Since.UTC())
+	}
+	switch {
+	case byDay && !f.Until.IsZero():
+		where = append(where, "day <= ?")
+		args = append(args, f.Until.UTC().Add(-time.Nanosecond).Format(time.DateOnly))
+	case !f.Until.IsZero():
+		where = append(where, "timestamp < ?")
+		args = append(args, f.Until.UTC())
+	}
+	if len(where) == 0 {
+		return "", args
+	}
+	return " WHERE " + strings.Join(where, " AND "), args
+}
+
+// QueryLogs satisfies Store.
+func (s *SQLite) QueryLogs(ctx context.Context, f Filter) ([]Log, error) {
+	where, args := f.where(false)
+	q := "SELECT " + summaryColumns + " FROM api_logs" + where + " ORDER BY timestamp DESC LIMIT ? OFFSET ?"
+	args = append(args, f.Limit, f.Offset)
+	rows, err := s.db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var res []Log
+	for rows.Next() {
+		var l Log
+		if err := rows.Scan(summaryDest(&l)...); err != nil {
+			return nil, err
+		}
+		res = append(res, l)
+	}
+	return res, rows.Err()
+}
+
+// GetLog satisfies Store. Bodies that cannot be loaded are replaced by a
+// note.
+func (s *SQLite) GetLog(ctx context.Context, id string) (*Log, error) {
+	var l Log
+	var b storedBodies
+	err := s.db.QueryRowContext(ctx, "SELECT "+summaryColumns+", "+bodyColumns+" FROM api_logs WHERE id = ?", id).
+		Scan(append(summaryDest(&l), b.dest()...)...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	b.load(&l)
+	return &l, nil
+}
+
+// ExportLogs satisfies Store. Bodies that cannot be loaded are replaced by
+// a note, as in GetLog.
+func (s *SQLite) ExportLogs(ctx context.Context, f Filter, bodies bool, fn func(Log) error) error {
+	where, args := f.where(false)
+	columns := summaryColumns
+	if bodies {
+		columns += ", " + bodyColumns
+	}
+	rows, err := s.db.QueryContext(ctx, "SELECT "+columns+" FROM api_logs"+where+" ORDER BY timestamp", args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var l Log
+		var b storedBodies
+		dest := summaryDest(&l)
+		if bodies {
+			dest = append(dest, b.dest()...)
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return err
+		}
+		if bodies {
+			b.load(&l)
+		}
+		if err := fn(l); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// bodyColumns are the columns storedBodies scans.
+const bodyColumns = "COALESCE(body_storage, ''), request, response, client_request"
+
+// storedBodies holds a row's bodies as stored.
+type storedBodies struct {
+	storage                          string
+	request, response, clientRequest []byte
+}
+
+// dest returns the scan destinations for bodyColumns.
+func (b *storedBodies) dest() []interface{} {
+	return []interface{}{&b.storage, &b.request, &b.response, &b.clientRequest}
+}
+
+// load decodes the bodies into l, replacing those that cannot be loaded,
+// e.g. deleted files, by a note.
+func (b *storedBodies) load(l *Log) {
+	for _, f := range []struct {
+		dst   *string
+		value []byte
+	}{{&l.Request, b.request}, {&l.Response, b.response}, {&l.ClientRequest, b.clientRequest}} {
+		var err error
+		if *f.dst, err = logbody.Load(b.storage, f.value); err != nil {
+			*f.dst = "(body unavailable: " + err.Error() + ")"
+		}
+	}
+}
+
+// Usage satisfies Store. It reads usage_daily, so since and until select
+// whole UTC days.
+func (s *SQLite) Usage(ctx context.Context, f Filter) ([]UsageRow, error) {
+	where, args := f.where(true)
+	rows, err := s.db.QueryContext(ctx, `SELECT day, model, provider, upstream_key,
+		SUM(requests), SUM(CASE WHEN status_code >= 400 THEN requests ELSE 0 END), SUM(prompt_tokens), SUM(completion_tokens), SUM(cost_usd),
+		SUM(unpriced_requests), SUM(unpriced_prompt_tokens), SUM(unpriced_completion_tokens)
+		FROM usage_daily`+where+` GROUP BY day, model, provider, upstream_key ORDER BY day DESC, model, provider, upstream_key`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var res []UsageRow
+	for rows.Next() {
+		var r UsageRow
+		if err := rows.Scan(&r.Day, &r.Model, &r.Provider, &r.UpstreamKey, &r.Requests, &r.Errors, &r.PromptTokens, &r.CompletionTokens, &r.CostUSD,
+			&r.UnpricedRequests, &r.UnpricedPromptTokens, &r.UnpricedCompletionTokens); err != nil {
+			return nil, err
+		}
+		res = append(res, r)
+	}
+	return res, rows.Err()
+}
+
+// Totals satisfies Store. Like Usage it counts whole UTC days.
+func (s *SQLite) Totals(ctx context.Context, f Filter) (Totals, error) {
+	where, args := f.where(true)
+	var t Totals
+	err := s.db.QueryRowContext(ctx, `SELECT COALESCE(SUM(requests), 0), COALESCE(SUM(prompt_tokens + completion_tokens), 0),
+		COALESCE(SUM(cost_usd), 0) FROM usage_daily`+where, args...).Scan(&t.Requests, &t.Tokens, &t.CostUSD)
+	return t, err
+}
+
+// pruneChunk is how many rows Prune deletes per statement, so the write
+// lock is released between chunks.
+const pruneChunk = 1000
+
+// Prune satisfies Store. The size compared against MaxBytes is the space
+// used inside the database file; bodies kept in files are not counted.
+// Freed pages are returned to the file system when the database was
+// created with incremental auto-vacuum.
+func (s *SQLite) Prune(ctx context.Context, policy PrunePolicy) (PruneResult, error) {
+	var res PruneResult
+	for !policy.Before.IsZero() {
+		n, err := s.deleteOldest(ctx, "timestamp < ?", policy.Before.UTC())
+		res.Deleted += n
+		if err != nil {
+			return res, err
+		}
+		if n < pruneChunk {
+			break
+		}
+	}
+	for policy.MaxBytes > 0 {
+		size, err := s.size(ctx)
+		if err != nil {
+			return res, err
+		}
+		if size <= policy.MaxBytes {
+			break
+		}
+		n, err := s.deleteOldest(ctx, "1 = 1")
+		res.Deleted += n
+		if err != nil {
+			return res, err
+		}
+		if n == 0 {
+			break
+		}
+	}
+	if res.Deleted > 0 {
+		s.reclaim(ctx)
+	}
+	var err error
+	res.SizeBytes, err = s.size(ctx)
+	return res, err
+}
+
+// deleteOldest deletes up to pruneChunk of the oldest rows matching cond,
+// with the files their bodies were stored in.
+func (s *SQLite) deleteOldest(ctx context.Context, cond string, args ...interface{}) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	rows, err := tx.QueryContext(ctx, "SELECT id, "+bodyColumns+" FROM api_logs WHERE "+cond+
+		" ORDER BY timestamp LIMIT ?", append(args, pruneChunk)...)
+	if err != nil {
+		return 0, err
+	}
+	type victim struct {
+		id     string
+		bodies storedBodies
+	}
+	var victims []victim
+	for rows.Next() {
+		var v victim
+		if err := rows.Scan(append([]interface{}{&v.id}, v.bodies.dest()...)...); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		victims = append(victims, v)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	stmt, err := tx.PrepareContext(ctx, "DELETE FROM api_logs WHERE id = ?")
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+	for _, v := range victims {
+		if _, err := stmt.ExecContext(ctx, v.id); err != nil {
+			return 0, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	for _, v := range victims {
+		logbody.Remove(v.bodies.storage, v.bodies.request, v.bodies.response, v.bodies.clientRequest)
+	}
+	return len(victims), nil
+}
+
+// size returns the bytes of the database file in use, not counting free
+// pages waiting to be reused.
+func (s *SQLite) size(ctx context.Context) (int64, error) {
+	var pages, free, pageSize int64
+	err := s.db.QueryRowContext(ctx, "SELECT page_count, freelist_count, page_size FROM pragma_page_count(), pragma_freelist_count(), pragma_page_size()").
+		Scan(&pages, &free, &pageSize)
+	return (pages - free) * pageSize, err
+}
+
+// reclaim returns free pages to the file system and truncates the WAL.
+// Failures are logged: the rows are gone either way.
+func (s *SQLite) reclaim(ctx context.Context) {
+	var mode int
+	if err := s.db.QueryRowContext(ctx, "PRAGMA auto_vacuum").Scan(&mode); err == nil && mode != 2 {
+		s.vacuumWarning.Do(func() {
+			slog.Warn("Database was created without incremental auto-vacuum, pruned space is reused but not returned to the file system; run VACUUM with auto_vacuum=INCREMENTAL to enable it")
+		})
+	}
+	if _, err := s.db.ExecContext(ctx, "PRAGMA incremental_vacuum"); err != nil {
+		slog.Warn("Failed to vacuum database", "error", err)
+	}
+	if _, err := s.db.ExecContext(ctx, "PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
+		slog.Warn("Failed to checkpoint database", "error", err)
+	}
+}
@@ -0,0 +1,114 @@
+// Package migrate versions the SQLite schema. Each store owns an ordered
+// list of migrations for its tables, and the schema_version table records
+// how many of them a database has applied, so upgrading gopenbridge
+// upgrades an existing database in place.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// Migration is one schema change. Migrations run in a transaction and must
+// never be edited or reordered once released; append new ones instead.
+type Migration struct {
+	Name string
+	Up   func(ctx context.Context, tx *sql.Tx) error
+}
+
+// Exec returns a migration running stmts in order.
+func Exec(name string, stmts ...string) Migration {
+	return Migration{Name: name, Up: func(ctx context.Context, tx *sql.Tx) error {
+		for _, stmt := range stmts {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	}}
+}
+
+// Apply runs the migrations of component that db has not applied yet. The
+// version of a component is the number of its migrations applied; each one
+// is committed together with its version, so an interrupted upgrade resumes
+// where it stopped. A database migrated by a newer gopenbridge is rejected.
+func Apply(ctx context.Context, db *sql.DB, component string, migrations []Migration) error {
+	_, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_version (
+		component TEXT PRIMARY KEY,
+		version INTEGER NOT NULL,
+		applied_at DATETIME
+	)`)
+	if err != nil {
+		return err
+	}
+	for {
+		done, err := step(ctx, db, component, migrations)
+		if err != nil || done {
+			return err
+		}
+	}
+}
+
+// Version returns the schema version of component in db, 0 if none of its
+// migrations were applied.
+func Version(ctx context.Context, db *sql.DB, component string) (int, error) {
+	var v int
+	err := db.QueryRowContext(ctx, "SELECT version FROM schema_version WHERE component = ?", component).Scan(&v)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return v, err
+}
+
+// step applies the next migration of component, reporting done when there
+// is none.
+func step(ctx context.Context, db *sql.DB, component string, migrations []Migration) (done bool, err error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	// Read inside the transaction, in case another process is migrating
+	var version int
+	err = tx.QueryRowContext(ctx, "SELECT version FROM schema_version WHERE component = ?", component).Scan(&version)
+	if err != nil && err != sql.ErrNoRows {
+		return false, err
+	}
+	if version > len(migrations) {
+		return false, fmt.Errorf("%s schema is at version %d, newer than the %d this gopenbridge knows; upgrade gopenbridge or use another db_path", component, version, len(migrations))
+	}
+	if version == len(migrations) {
+		return true, nil
+	}
+	m := migrations[version]
+	if err := m.Up(ctx, tx); err != nil {
+		return false, fmt.Errorf("%s migration %d (%s): %w", component, version+1, m.Name, err)
+	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO schema_version(component, version, applied_at) VALUES (?, ?, ?)
+		ON CONFLICT(component) DO UPDATE SET version = excluded.version, applied_at = excluded.applied_at`,
+		component, version+1, time.Now().UTC())
+	if err != nil {
+		return false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+	slog.Info("Applied schema migration", "component", component, "version", version+1, "name", m.Name)
+	return false, nil
+}
+
+// AddColumn adds a column to table unless it already has it. It lets a
+// component's first migration adopt databases created before migrations,
+// whose tables may lack some columns.
+func AddColumn(ctx context.Context, tx *sql.Tx, table, column, decl string) error {
+	var n int
+	err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?", table, column).Scan(&n)
+	if err != nil || n > 0 {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "ALTER TABLE "+table+" ADD COLUMN "+column+" "+decl)
+	return err
+}
@@ -32,18 +32,38 @@ type Message struct {
 
 // Tool describes a callable tool with its schema.
 type Tool struct {
-	Name        string                 `json:"name" yaml:"name"`
-	Description *string                `json:"description,omitempty" yaml:"description,omitempty"`
-	InputSchema map[string]interface{} `json:"input_schema" yaml:"input_schema"`
+	Name         string                 `json:"name" yaml:"name"`
+	Description  string                 `json:"description,omitempty" yaml:"description,omitempty"`
+	InputSchema  map[string]interface{} `json:"input_schema" yaml:"input_schema"`
+	CacheControl interface{}            `json:"cache_control,omitempty" yaml:"cache_control,omitempty"`
+}
+
+// Metadata describes the request for attribution; UserID identifies the
+// end user.
+type Metadata struct {
+	UserID string `json:"user_id,omitempty" yaml:"user_id,omitempty"`
+}
+
+// Thinking enables extended thinking with a budget of output tokens.
+type Thinking struct {
+	Type         string `json:"type" yaml:"type"`
+	BudgetTokens int    `json:"budget_tokens,omitempty" yaml:"budget_tokens,omitempty"`
 }
 
 // MessagesRequest models a request payload of chat messages.
+// System may be a plain string or a list of text blocks.
 type MessagesRequest struct {
-	Model       string      `json:"model" yaml:"model"`
-	Messages    []Message   `json:"messages" yaml:"messages"`
-	MaxTokens   *int        `json:"max_tokens,omitempty" yaml:"max_tokens,omitempty"`
-	Temperature *float64    `json:"temperature,omitempty" yaml:"temperature,omitempty"`
-	Stream      *bool       `json:"stream,omitempty" yaml:"stream,omitempty"`
-	Tools       []Tool      `json:"tools,omitempty" yaml:"tools,omitempty"`
-	ToolChoice  interface{} `json:"tool_choice" yaml:"tool_choice"`
+	Model         string      `json:"model" yaml:"model"`
+	Messages      []Message   `json:"messages" yaml:"messages"`
+	MaxTokens     *int        `json:"max_tokens,omitempty" yaml:"max_tokens,omitempty"`
+	Temperature   *float64    `json:"temperature,omitempty" yaml:"temperature,omitempty"`
+	TopP          *float64    `json:"top_p,omitempty" yaml:"top_p,omitempty"`
+	TopK          *int        `json:"top_k,omitempty" yaml:"top_k,omitempty"`
+	StopSequences []string    `json:"stop_sequences,omitempty" yaml:"stop_sequences,omitempty"`
+	Stream        *bool       `json:"stream,omitempty" yaml:"stream,omitempty"`
+	Tools         []Tool      `json:"tools,omitempty" yaml:"tools,omitempty"`
+	ToolChoice    interface{} `json:"tool_choice,omitempty" yaml:"tool_choice,omitempty"`
+	System        interface{} `json:"system,omitempty" yaml:"system,omitempty"`
+	Metadata      *Metadata   `json:"metadata,omitempty" yaml:"metadata,omitempty"`
+	Thinking      *Thinking   `json:"thinking,omitempty" yaml:"thinking,omitempty"`
 }
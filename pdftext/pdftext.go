@@ -0,0 +1,664 @@
+// Package pdftext extracts plain text from PDF files.
+//
+// It is a best-effort reader for text-based PDFs: it decodes Flate
+// compressed streams and object streams, maps glyph codes through font
+// ToUnicode CMaps and follows the text-showing operators of content streams.
+// Scanned documents, encrypted files and exotic encodings yield little or no
+// text.
+package pdftext
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/hex"
+	"errors"
+	"io"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// ErrNoText is returned when a file contains no extractable text.
+var ErrNoText = errors.New("pdftext: no text found")
+
+// maxStreamSize caps the decompressed size of a single stream.
+const maxStreamSize = 64 << 20
+
+var (
+	objRe     = regexp.MustCompile(`(\d+)\s+(\d+)\s+obj\b`)
+	refRe     = regexp.MustCompile(`/([^\s/<>\[\]()]+)\s+(\d+)\s+\d+\s+R`)
+	fontRe    = regexp.MustCompile(`/Font\s*(<<|(\d+)\s+\d+\s+R)`)
+	toUniRe   = regexp.MustCompile(`/ToUnicode\s+(\d+)\s+\d+\s+R`)
+	intKeyRe  = regexp.MustCompile(`/(N|First)\s+(\d+)`)
+	hexTokRe  = regexp.MustCompile(`<([0-9A-Fa-f\s]*)>`)
+	bfBlockRe = regexp.MustCompile(`(?s)begin(bfchar|bfrange)(.*?)endbf(?:char|range)`)
+)
+
+// object is one indirect object: its dictionary text and decoded stream.
+type object struct {
+	dict   string
+	stream []byte
+}
+
+// cmap maps glyph codes to text for one font.
+type cmap struct {
+	width int // code width in bytes
+	codes map[uint32]string
+}
+
+// Extract returns the text of a PDF file, pages separated by blank lines.
+func Extract(data []byte) (string, error) {
+	if !bytes.HasPrefix(bytes.TrimLeft(data, "\x00\t\r\n "), []byte("%PDF")) {
+		return "", errors.New("pdftext: not a PDF file")
+	}
+	if bytes.Contains(data, []byte("/Encrypt")) {
+		return "", errors.New("pdftext: encrypted PDF")
+	}
+	objs := parseObjects(data)
+	fonts := fontMaps(objs)
+
+	var out strings.Builder
+	for _, num := range pageContents(objs) {
+		obj, ok := objs[num]
+		if !ok || obj.stream == nil {
+			continue
+		}
+		if txt := strings.TrimSpace(showText(obj.stream, fonts)); txt != "" {
+			if out.Len() > 0 {
+				out.WriteString("\n\n")
+			}
+			out.WriteString(txt)
+		}
+	}
+	if out.Len() == 0 {
+		return "", ErrNoText
+	}
+	return out.String(), nil
+}
+
+// parseObjects indexes the file's indirect objects by number, expanding
+// object streams. Later definitions win, as with incremental updates.
+func parseObjects(data []byte) map[int]*object {
+	objs := map[int]*object{}
+	locs := objRe.FindAllSubmatchIndex(data, -1)
+	for i, loc := range locs {
+		end := len(data)
+		if i+1 < len(locs) {
+			end = locs[i+1][0]
+		}
+		body := data[loc[1]:end]
+		if j := bytes.Index(body, []byte("endobj")); j != -1 {
+			body = body[:j]
+		}
+		num, _ := strconv.Atoi(string(data[loc[2]:loc[3]]))
+		objs[num] = parseObject(body)
+	}
+	for _, obj := range objs {
+		if obj.stream != nil && strings.Contains(obj.dict, "/ObjStm") {
+			expandObjStm(obj, objs)
+		}
+	}
+	return objs
+}
+
+// parseObject splits an object body into dictionary and decoded stream.
+func parseObject(body []byte) *object {
+	i := bytes.Index(body, []byte("stream"))
+	if i == -1 {
+		return &object{dict: string(body)}
+	}
+	obj := &object{dict: string(body[:i])}
+	raw := body[i+len("stream"):]
+	raw = bytes.TrimPrefix(raw, []byte("\r"))
+	raw = bytes.TrimPrefix(raw, []byte("\n"))
+	if j := bytes.LastIndex(raw, []byte("endstream")); j != -1 {
+		raw = raw[:j]
+	}
+	switch {
+	case strings.Contains(obj.dict, "/FlateDecode"):
+		obj.stream = inflate(raw)
+	case !strings.Contains(obj.dict, "/Filter"):
+		obj.stream = raw
+	}
+	return obj
+}
+
+// inflate decompresses a Flate stream, keeping whatever decodes before an
+// error since many writers pad or truncate streams.
+func inflate(raw []byte) []byte {
+	r, err := zlib.NewReader(bytes.NewReader(raw))
+	if err != nil {
+		return nil
+	}
+	defer r.Close()
+	out, _ := io.ReadAll(io.LimitReader(r, maxStreamSize))
+	return out
+}
+
+// expandObjStm adds the objects packed in an object stream to objs,
+// unless they are defined directly.
+func expandObjStm(stm *object, objs map[int]*object) {
+	var n, first int
+	for _, m := range intKeyRe.FindAllStringSubmatch(stm.dict, -1) {
+		v, _ := strconv.Atoi(m[2])
+		if m[1] == "N" {
+			n = v
+		} else {
+			first = v
+		}
+	}
+	if first > len(stm.stream) {
+		return
+	}
+	header := strings.Fields(string(stm.stream[:first]))
+	for i := 0; i+1 < len(header) && i/2 < n; i += 2 {
+		num, _ := strconv.Atoi(header[i])
+		off, _ := strconv.Atoi(header[i+1])
+		end := len(stm.stream)
+		if i+3 < len(header) {
+			next, _ := strconv.Atoi(header[i+3])
+			end = first + next
+		}
+		start := first + off
+		if start > end || end > len(stm.stream) {
+			continue
+		}
+		if _, ok := objs[num]; !ok {
+			objs[num] = &object{dict: string(stm.stream[start:end])}
+		}
+	}
+}
+
+// pageContents returns the content stream object numbers of all pages in
+// page tree order, falling back to object order for a broken tree.
+func pageContents(objs map[int]*object) []int {
+	var pages []int
+	kids := map[int]bool{}
+	for _, obj := range objs {
+		for _, num := range kidRefs(obj.dict) {
+			kids[num] = true
+		}
+	}
+	seen := map[int]bool{}
+	var walk func(num int)
+	walk = func(num int) {
+		obj, ok := objs[num]
+		if !ok || seen[num] {
+			return
+		}
+		seen[num] = true
+		if isPage(obj.dict) {
+			pages = append(pages, num)
+			return
+		}
+		for _, kid := range kidRefs(obj.dict) {
+			walk(kid)
+		}
+	}
+	var roots []int
+	for num, obj := range objs {
+		if !kids[num] && strings.Contains(obj.dict, "/Kids") {
+			roots = append(roots, num)
+		}
+	}
+	slices.Sort(roots)
+	for _, num := range roots {
+		walk(num)
+	}
+	if len(pages) == 0 {
+		for num, obj := range objs {
+			if isPage(obj.dict) {
+				pages = append(pages, num)
+			}
+		}
+		slices.Sort(pages)
+	}
+	var res []int
+	for _, num := range pages {
+		res = append(res, contentRefs(objs, objs[num].dict)...)
+	}
+	return res
+}
+
+// kidRefs returns the references in a page tree node's /Kids array.
+func kidRefs(dict string) []int {
+	i := strings.Index(dict, "/Kids")
+	if i == -1 {
+		return nil
+	}
+	rest := strings.TrimSpace(dict[i+len("/Kids"):])
+	j := strings.Index(rest, "]")
+	if !strings.HasPrefix(rest, "[") || j == -1 {
+		return nil
+	}
+	return refList(rest[1:j])
+}
+
+// isPage reports whether dict is a page, as opposed to the page tree.
+func isPage(dict string) bool {
+	i := strings.Index(dict, "/Type")
+	if i == -1 {
+		return false
+	}
+	rest := strings.TrimSpace(dict[i+len("/Type"):])
+	return strings.HasPrefix(rest, "/Page") && !strings.HasPrefix(rest, "/Pages")
+}
+
+// contentRefs returns the objects referenced by a page's /Contents, which
+// is a single reference or an array of them, possibly indirect.
+func contentRefs(objs map[int]*object, dict string) []int {
+	i := strings.Index(dict, "/Contents")
+	if i == -1 {
+		return nil
+	}
+	rest := strings.TrimSpace(dict[i+len("/Contents"):])
+	if strings.HasPrefix(rest, "[") {
+		if j := strings.Index(rest, "]"); j != -1 {
+			return refList(rest[1:j])
+		}
+		return nil
+	}
+	refs := refList(rest)
+	if len(refs) == 0 {
+		return nil
+	}
+	if obj, ok := objs[refs[0]]; ok && obj.stream == nil {
+		// An indirect array of content streams
+		if arr := strings.TrimSpace(obj.dict); strings.HasPrefix(arr, "[") {
+			return refList(strings.Trim(arr, "[]"))
+		}
+	}
+	return refs[:1]
+}
+
+// refList parses "N G R" references from s, stopping at the first token
+// that is not part of one.
+func refList(s string) []int {
+	f := strings.Fields(s)
+	var res []int
+	for i := 0; i+2 < len(f) && f[i+2] == "R"; i += 3 {
+		num, err := strconv.Atoi(f[i])
+		if err != nil {
+			break
+		}
+		res = append(res, num)
+	}
+	return res
+}
+
+// fontMaps returns the ToUnicode CMap of each font resource name. Names
+// are resolved across all resource dictionaries, which is exact for the
+// common case of documents that name each font consistently.
+func fontMaps(objs map[int]*object) map[string]*cmap {
+	fonts := map[string]*cmap{}
+	for _, obj := range objs {
+		for _, m := range fontRe.FindAllStringSubmatchIndex(obj.dict, -1) {
+			var res string
+			if m[4] != -1 {
+				num, _ := strconv.Atoi(obj.dict[m[4]:m[5]])
+				if ref, ok := objs[num]; ok {
+					res = ref.dict
+				}
+			} else {
+				res = obj.dict[m[2]:]
+				if j := strings.Index(res, ">>"); j != -1 {
+					res = res[:j]
+				}
+			}
+			for _, r := range refRe.FindAllStringSubmatch(res, -1) {
+				num, _ := strconv.Atoi(r[2])
+				font, ok := objs[num]
+				if !ok {
+					continue
+				}
+				if u := toUniRe.FindStringSubmatch(font.dict); u != nil {
+					cnum, _ := strconv.Atoi(u[1])
+					if c, ok := objs[cnum]; ok && c.stream != nil {
+						fonts[r[1]] = parseCMap(c.stream)
+					}
+				}
+			}
+		}
+	}
+	return fonts
+}
+
+// parseCMap reads the bfchar and bfrange mappings of a ToUnicode CMap.
+func parseCMap(data []byte) *cmap {
+	cm := &cmap{width: 1, codes: map[uint32]string{}}
+	for _, blk := range bfBlockRe.FindAllSubmatch(data, -1) {
+		body := string(blk[2])
+		if string(blk[1]) == "bfchar" {
+			toks := hexTokRe.FindAllStringSubmatch(body, -1)
+			for i := 0; i+1 < len(toks); i += 2 {
+				code, w := hexCode(toks[i][1])
+				cm.codes[code] = utf16Hex(toks[i+1][1])
+				cm.width = max(cm.width, w)
+			}
+			continue
+		}
+		for _, line := range strings.Split(body, "\n") {
+			toks := hexTokRe.FindAllStringSubmatch(line, -1)
+			if len(toks) < 2 {
+				continue
+			}
+			lo, w := hexCode(toks[0][1])
+			hi, _ := hexCode(toks[1][1])
+			cm.width = max(cm.width, w)
+			if hi < lo || hi-lo > 0xffff {
+				continue
+			}
+			if len(toks) > 3 || strings.Contains(line, "[") {
+				// Destination array: one string per code
+				for i, t := range toks[2:] {
+					cm.codes[lo+uint32(i)] = utf16Hex(t[1])
+				}
+				continue
+			}
+			if len(toks) < 3 {
+				continue
+			}
+			base := []rune(utf16Hex(toks[2][1]))
+			if len(base) == 0 {
+				continue
+			}
+			for c := lo; c <= hi; c++ {
+				r := append([]rune{}, base...)
+				r[len(r)-1] += rune(c - lo)
+				cm.codes[c] = string(r)
+			}
+		}
+	}
+	return cm
+}
+
+// hexCode parses a CMap source code and returns it with its byte width.
+func hexCode(s string) (uint32, int) {
+	s = strings.Join(strings.Fields(s), "")
+	v, _ := strconv.ParseUint(s, 16, 32)
+	return uint32(v), (len(s) + 1) / 2
+}
+
+// utf16Hex decodes a CMap destination, hex UTF-16BE, to a string.
+func utf16Hex(s string) string {
+	b, _ := hex.DecodeString(strings.Join(strings.Fields(s), ""))
+	return decodeUTF16(b)
+}
+
+// decodeUTF16 decodes big-endian UTF-16 bytes.
+func decodeUTF16(b []byte) string {
+	u := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		u = append(u, uint16(b[i])<<8|uint16(b[i+1]))
+	}
+	return string(utf16.Decode(u))
+}
+
+// decode maps a string operand to text using the current font's CMap, or
+// as Latin-1 when the font has none.
+func decode(s []byte, cm *cmap) string {
+	if cm == nil {
+		if len(s) >= 2 && s[0] == 0xfe && s[1] == 0xff {
+			return decodeUTF16(s[2:])
+		}
+		r := make([]rune, len(s))
+		for i, c := range s {
+			r[i] = rune(c)
+		}
+		return string(r)
+	}
+	var out strings.Builder
+	for i := 0; i+cm.width <= len(s); i += cm.width {
+		var code uint32
+		for _, c := range s[i : i+cm.width] {
+			code = code<<8 | uint32(c)
+		}
+		if txt, ok := cm.codes[code]; ok {
+			out.WriteString(txt)
+		} else if cm.width == 1 {
+			out.WriteRune(rune(code))
+		}
+	}
+	return out.String()
+}
+
+// showText runs the text operators of a content stream and returns the
+// text they show.
+func showText(content []byte, fonts map[string]*cmap) string {
+	var out strings.Builder
+	var font *cmap
+	var operands []token
+	newline := func() {
+		if s := out.String(); s != "" && !strings.HasSuffix(s, "\n") {
+			out.WriteByte('\n')
+		}
+	}
+	lex := lexer{data: content}
+	for {
+		tok, ok := lex.next()
+		if !ok {
+			break
+		}
+		if tok.kind != opToken {
+			operands = append(operands, tok)
+			continue
+		}
+		switch tok.text {
+		case "Tf":
+			if len(operands) >= 2 && operands[len(operands)-2].kind == nameToken {
+				font = fonts[operands[len(operands)-2].text]
+			}
+		case "Tj":
+			if n := len(operands); n > 0 && operands[n-1].kind == stringToken {
+				out.WriteString(decode(operands[n-1].bytes, font))
+			}
+		case "'", `"`:
+			newline()
+			if n := len(operands); n > 0 && operands[n-1].kind == stringToken {
+				out.WriteString(decode(operands[n-1].bytes, font))
+			}
+		case "TJ":
+			for _, t := range arrayOperand(operands) {
+				switch t.kind {
+				case stringToken:
+					out.WriteString(decode(t.bytes, font))
+				case numberToken:
+					// A large negative adjustment is a word gap
+					if v, _ := strconv.ParseFloat(t.text, 64); v < -200 {
+						out.WriteByte(' ')
+					}
+				}
+			}
+		case "Td", "TD":
+			if n := len(operands); n >= 2 {
+				if ty, _ := strconv.ParseFloat(operands[n-1].text, 64); ty != 0 {
+					newline()
+				} else {
+					out.WriteByte(' ')
+				}
+			}
+		case "T*", "Tm", "ET":
+			newline()
+		}
+		operands = operands[:0]
+	}
+	return out.String()
+}
+
+// arrayOperand returns the elements of the last array operand.
+func arrayOperand(operands []token) []token {
+	start := -1
+	for i := len(operands) - 1; i >= 0; i-- {
+		if operands[i].kind == arrayStartToken {
+			start = i
+			break
+		}
+	}
+	if start == -1 {
+		return nil
+	}
+	return operands[start+1:]
+}
+
+type tokenKind int
+
+const (
+	opToken tokenKind = iota
+	numberToken
+	nameToken
+	stringToken
+	arrayStartToken
+	otherToken
+)
+
+// token is one content stream token. Strings carry their decoded bytes.
+type token struct {
+	kind  tokenKind
+	text  string
+	bytes []byte
+}
+
+// lexer splits a content stream into tokens.
+type lexer struct {
+	data []byte
+	pos  int
+}
+
+// next returns the next token; ok is false at the end of the stream.
+func (l *lexer) next() (token, bool) {
+	d := l.data
+	for l.pos < len(d) {
+		c := d[l.pos]
+		switch {
+		case isSpace(c):
+			l.pos++
+		case c == '%':
+			for l.pos < len(d) && d[l.pos] != '\n' && d[l.pos] != '\r' {
+				l.pos++
+			}
+		case c == '(':
+			return token{kind: stringToken, bytes: l.literal()}, true
+		case c == '<' && l.pos+1 < len(d) && d[l.pos+1] == '<', c == '>' && l.pos+1 < len(d) && d[l.pos+1] == '>':
+			l.pos += 2
+			return token{kind: otherToken}, true
+		case c == '<':
+			end := bytes.IndexByte(d[l.pos:], '>')
+			if end == -1 {
+				l.pos = len(d)
+				return token{}, false
+			}
+			s := strings.Join(strings.Fields(string(d[l.pos+1:l.pos+end])), "")
+			if len(s)%2 == 1 {
+				s += "0"
+			}
+			b, _ := hex.DecodeString(s)
+			l.pos += end + 1
+			return token{kind: stringToken, bytes: b}, true
+		case c == '[':
+			l.pos++
+			return token{kind: arrayStartToken}, true
+		case c == ']', c == '{', c == '}', c == ')', c == '>':
+			l.pos++
+			return token{kind: otherToken}, true
+		case c == '/':
+			start := l.pos + 1
+			l.pos++
+			for l.pos < len(d) && !isSpace(d[l.pos]) && !isDelim(d[l.pos]) {
+				l.pos++
+			}
+			return token{kind: nameToken, text: string(d[start:l.pos])}, true
+		default:
+			start := l.pos
+			for l.pos < len(d) && !isSpace(d[l.pos]) && !isDelim(d[l.pos]) {
+				l.pos++
+			}
+			word := string(d[start:l.pos])
+			if word == "BI" {
+				l.skipInlineImage()
+				continue
+			}
+			if _, err := strconv.ParseFloat(word, 64); err == nil {
+				return token{kind: numberToken, text: word}, true
+			}
+			return token{kind: opToken, text: word}, true
+		}
+	}
+	return token{}, false
+}
+
+// literal reads a parenthesized string, handling nesting and escapes.
+func (l *lexer) literal() []byte {
+	d := l.data
+	l.pos++ // (
+	var out []byte
+	depth := 1
+	for l.pos < len(d) {
+		c := d[l.pos]
+		l.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return out
+			}
+		case '\\':
+			if l.pos >= len(d) {
+				return out
+			}
+			e := d[l.pos]
+			l.pos++
+			switch e {
+			case 'n':
+				out = append(out, '\n')
+			case 'r':
+				out = append(out, '\r')
+			case 't':
+				out = append(out, '\t')
+			case 'b':
+				out = append(out, '\b')
+			case 'f':
+				out = append(out, '\f')
+			case '\r':
+				if l.pos < len(d) && d[l.pos] == '\n' {
+					l.pos++
+				}
+			case '\n':
+			default:
+				if e >= '0' && e <= '7' {
+					v := int(e - '0')
+					for i := 0; i < 2 && l.pos < len(d) && d[l.pos] >= '0' && d[l.pos] <= '7'; i++ {
+						v = v*8 + int(d[l.pos]-'0')
+						l.pos++
+					}
+					out = append(out, byte(v))
+				} else {
+					out = append(out, e)
+				}
+			}
+			continue
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// skipInlineImage moves past inline image data up to its EI operator.
+func (l *lexer) skipInlineImage() {
+	if i := bytes.Index(l.data[l.pos:], []byte("EI")); i != -1 {
+		l.pos += i + 2
+	} else {
+		l.pos = len(l.data)
+	}
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == '\f' || c == 0
+}
+
+func isDelim(c byte) bool {
+	return strings.IndexByte("()<>[]{}/%", c) != -1
+}
@@ -0,0 +1,165 @@
+package providers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"gopenbridge/models"
+)
+
+// anthropicVersion is the anthropic-version header sent upstream.
+const anthropicVersion = "2023-06-01"
+
+// Anthropic implements Provider for Anthropic's native Messages API, so
+// OpenAI-style clients of /v1/chat/completions can reach Claude models.
+// Requests and responses already use Anthropic's format and pass through.
+type Anthropic struct{}
+
+func init() {
+	Register(&Anthropic{})
+}
+
+// Name satisfies Provider.
+func (a *Anthropic) Name() string {
+	return "anthropic-messages"
+}
+
+// Endpoint satisfies Provider. Base URLs with or without /v1 are accepted.
+func (a *Anthropic) Endpoint(up Upstream, model string, stream bool) string {
+	base := strings.TrimSuffix(strings.TrimRight(up.BaseURL, "/"), "/v1")
+	return base + "/v1/messages"
+}
+
+// Authorize satisfies Provider.
+func (a *Anthropic) Authorize(req *http.Request, up Upstream) error {
+	req.Header.Set("x-api-key", up.APIKey)
+	req.Header.Set("anthropic-version", anthropicVersion)
+	return nil
+}
+
+// BuildPayload satisfies Provider.
+func (a *Anthropic) BuildPayload(req *models.MessagesRequest, opts Options) (map[string]interface{}, error) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	var payload map[string]interface{}
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return nil, err
+	}
+	delete(payload, "stream")
+	payload["max_tokens"] = opts.MaxTokens
+	return payload, nil
+}
+
+// MarkStream satisfies StreamMarker.
+func (a *Anthropic) MarkStream(payload map[string]interface{}) {
+	payload["stream"] = true
+}
+
+// ParseResponse satisfies Provider.
+func (a *Anthropic) ParseResponse(res map[string]interface{}, opts Options) (*Response, error) {
+	out := &Response{}
+	out.Content, _ = res["content"].([]interface{})
+	if len(out.Content) == 0 && opts.StrictResponseParsing {
+		return nil, ErrEmptyResponse
+	}
+	out.StopReason, _ = res["stop_reason"].(string)
+	if seq, ok := res["stop_sequence"].(string); ok {
+		out.StopSequence = &seq
+	}
+	usage, _ := res["usage"].(map[string]interface{})
+	out.Usage = anthropicUsage(usage)
+	return out, nil
+}
+
+// anthropicUsage reads an Anthropic usage object, whose input_tokens leave
+// out cached tokens.
+func anthropicUsage(usage map[string]interface{}) Usage {
+	in, _ := usage["input_tokens"].(float64)
+	out, _ := usage["output_tokens"].(float64)
+	read, _ := usage["cache_read_input_tokens"].(float64)
+	write, _ := usage["cache_creation_input_tokens"].(float64)
+	return Usage{InputTokens: int(in + read + write), OutputTokens: int(out), CacheReadTokens: int(read), CacheWriteTokens: int(write)}
+}
+
+// StreamTranslator satisfies Provider.
+func (a *Anthropic) StreamTranslator(id, model string, opts Options, emit EmitFunc) StreamTranslator {
+	return &anthropicStream{emit: emit, id: id, model: model}
+}
+
+// anthropicStream relays Anthropic stream events, noting the stop reason
+// and usage on the way. The upstream's own message_start opens the
+// message; Start and Finish only fill in when it is missing.
+type anthropicStream struct {
+	emit  EmitFunc
+	id    string
+	model string
+
+	started    bool
+	stopped    bool
+	stopReason string
+	usage      Usage
+}
+
+// Start satisfies StreamTranslator.
+func (t *anthropicStream) Start() error {
+	return nil
+}
+
+// Chunk satisfies StreamTranslator.
+func (t *anthropicStream) Chunk(chunk map[string]interface{}) error {
+	event, _ := chunk["type"].(string)
+	switch event {
+	case "message_start":
+		t.started = true
+		msg, _ := chunk["message"].(map[string]interface{})
+		usage, _ := msg["usage"].(map[string]interface{})
+		t.usage = anthropicUsage(usage)
+	case "message_delta":
+		delta, _ := chunk["delta"].(map[string]interface{})
+		t.stopReason, _ = delta["stop_reason"].(string)
+		usage, _ := chunk["usage"].(map[string]interface{})
+		if out, ok := usage["output_tokens"].(float64); ok {
+			t.usage.OutputTokens = int(out)
+		}
+	case "message_stop":
+		t.stopped = true
+	case "":
+		return nil
+	}
+	if !t.started {
+		t.started = true
+		if err := emitMessageStart(t.emit, t.id, t.model); err != nil {
+			return err
+		}
+	}
+	return t.emit(event, chunk)
+}
+
+// Finish satisfies StreamTranslator.
+func (t *anthropicStream) Finish() error {
+	if t.stopped {
+		return nil
+	}
+	if !t.started {
+		if err := emitMessageStart(t.emit, t.id, t.model); err != nil {
+			return err
+		}
+	}
+	return emitMessageEnd(t.emit, t.StopReason(), nil, t.usage)
+}
+
+// StopReason satisfies StreamTranslator.
+func (t *anthropicStream) StopReason() string {
+	if t.stopReason == "" {
+		return "end_turn"
+	}
+	return t.stopReason
+}
+
+// Usage satisfies StreamTranslator.
+func (t *anthropicStream) Usage() Usage {
+	return t.usage
+}
@@ -0,0 +1,44 @@
+package providers
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// defaultAzureAPIVersion is used when no api_version is configured.
+const defaultAzureAPIVersion = "2024-10-21"
+
+// Azure implements Provider for Azure OpenAI, which routes by deployment
+// name instead of model and authenticates with an api-key header.
+type Azure struct {
+	OpenAI
+}
+
+func init() {
+	Register(&Azure{OpenAI{ProviderName: "azure", StrictTools: true, ThinkingParam: "effort"}}, "openai.azure.com", "cognitiveservices.azure.com")
+}
+
+// Endpoint satisfies Provider. The deployment defaults to the model name
+// when no mapping is configured.
+func (a *Azure) Endpoint(up Upstream, model string, stream bool) string {
+	deployment := model
+	if d, ok := up.Deployments[model]; ok && d != "" {
+		deployment = d
+	}
+	version := up.APIVersion
+	if version == "" {
+		version = defaultAzureAPIVersion
+	}
+	base := strings.TrimRight(up.BaseURL, "/")
+	// Accept base URLs with or without the /openai suffix
+	base = strings.TrimSuffix(base, "/openai")
+	return base + "/openai/deployments/" + url.PathEscape(deployment) +
+		"/chat/completions?api-version=" + url.QueryEscape(version)
+}
+
+// Authorize satisfies Provider.
+func (a *Azure) Authorize(req *http.Request, up Upstream) error {
+	req.Header.Set("api-key", up.APIKey)
+	return nil
+}
@@ -0,0 +1,379 @@
+package providers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode"
+
+	"gopenbridge/awsauth"
+	"gopenbridge/models"
+)
+
+// Bedrock implements Provider for the Amazon Bedrock Converse API, signing
+// requests with SigV4 from standard AWS credentials.
+type Bedrock struct{}
+
+func init() {
+	Register(&Bedrock{}, "bedrock-runtime")
+}
+
+// Name satisfies Provider.
+func (b *Bedrock) Name() string {
+	return "bedrock"
+}
+
+// Endpoint satisfies Provider. Base URLs that do not point at AWS are
+// replaced by the regional Bedrock runtime endpoint.
+func (b *Bedrock) Endpoint(up Upstream, model string, stream bool) string {
+	base := strings.TrimRight(up.BaseURL, "/")
+	if !strings.Contains(base, "amazonaws.com") {
+		base = "https://bedrock-runtime." + b.region(up) + ".amazonaws.com"
+	}
+	action := "/converse"
+	if stream {
+		action = "/converse-stream"
+	}
+	// Model IDs contain ':' which AWS expects percent-encoded in the path
+	id := strings.ReplaceAll(url.PathEscape(model), ":", "%3A")
+	return base + "/model/" + id + action
+}
+
+// region returns the configured region, falling back to the AWS defaults.
+func (b *Bedrock) region(up Upstream) string {
+	if up.Region != "" {
+		return up.Region
+	}
+	if r := awsauth.DefaultRegion(up.AWSProfile); r != "" {
+		return r
+	}
+	return "us-east-1"
+}
+
+// Authorize satisfies Provider by signing the request with SigV4.
+func (b *Bedrock) Authorize(req *http.Request, up Upstream) error {
+	creds, err := awsauth.LoadCredentials(up.AWSProfile)
+	if err != nil {
+		return err
+	}
+	var body []byte
+	if req.GetBody != nil {
+		rc, err := req.GetBody()
+		if err != nil {
+			return err
+		}
+		body, err = io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return awsauth.Sign(req, body, creds, b.region(up), "bedrock", time.Now())
+}
+
+// BuildPayload satisfies Provider.
+func (b *Bedrock) BuildPayload(req *models.MessagesRequest, opts Options) (map[string]interface{}, error) {
+	var msgs []map[string]interface{}
+	for _, msg := range req.Messages {
+		content := bedrockContent(msg.Content, opts)
+		if len(content) == 0 {
+			continue
+		}
+		msgs = append(msgs, map[string]interface{}{"role": msg.Role, "content": content})
+	}
+	if len(msgs) == 0 {
+		return nil, errors.New("messages: at least one message with content is required")
+	}
+	inference := map[string]interface{}{"maxTokens": opts.MaxTokens}
+	if req.Temperature != nil {
+		inference["temperature"] = *req.Temperature
+	}
+	if req.TopP != nil {
+		inference["topP"] = *req.TopP
+	}
+	if len(req.StopSequences) > 0 {
+		inference["stopSequences"] = req.StopSequences
+	}
+	payload := map[string]interface{}{
+		"messages":        msgs,
+		"inferenceConfig": inference,
+	}
+	if sys := bedrockSystem(req.System); len(sys) > 0 {
+		payload["system"] = sys
+	}
+	extra := map[string]interface{}{}
+	if req.TopK != nil {
+		extra["top_k"] = *req.TopK
+	}
+	// Only Anthropic models on Bedrock take a thinking budget
+	if _, ok := thinkingBudget(req); ok && strings.Contains(req.Model, "anthropic.") {
+		extra["thinking"] = req.Thinking
+	}
+	if betas := bedrockBetas(opts.Betas); len(betas) > 0 && strings.Contains(req.Model, "anthropic.") {
+		extra["anthropic_beta"] = betas
+	}
+	if len(extra) > 0 {
+		payload["additionalModelRequestFields"] = extra
+	}
+	if len(req.Tools) > 0 {
+		var tools []interface{}
+		profile := schemaProfile(opts, "none")
+		for _, t := range req.Tools {
+			spec := map[string]interface{}{
+				"name":        t.Name,
+				"inputSchema": map[string]interface{}{"json": profile.Clean(t.InputSchema)},
+			}
+			if t.Description != "" {
+				spec["description"] = t.Description
+			}
+			tools = append(tools, map[string]interface{}{"toolSpec": spec})
+			if t.CacheControl != nil {
+				tools = append(tools, bedrockCachePoint())
+			}
+		}
+		toolConfig := map[string]interface{}{"tools": tools}
+		if choice := bedrockToolChoice(req.ToolChoice); choice != nil {
+			toolConfig["toolChoice"] = choice
+		}
+		payload["toolConfig"] = toolConfig
+	}
+	return payload, nil
+}
+
+// bedrockContent converts Anthropic message content into Converse blocks.
+// PDF documents become document blocks unless opts.ExtractDocuments is set,
+// and cache_control markers become cachePoint blocks.
+func bedrockContent(content interface{}, opts Options) []interface{} {
+	switch c := content.(type) {
+	case string:
+		if c == "" {
+			return nil
+		}
+		return []interface{}{map[string]interface{}{"text": c}}
+	case []interface{}:
+		var out []interface{}
+		for _, blk := range c {
+			b, ok := blk.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			switch t, _ := b["type"].(string); t {
+			case "text":
+				if s, _ := b["text"].(string); s != "" {
+					out = append(out, map[string]interface{}{"text": s})
+				}
+			case "image":
+				if img := bedrockImage(b); img != nil {
+					out = append(out, img)
+				}
+			case "document":
+				if data, ok := documentPDF(b); ok && !opts.ExtractDocuments {
+					out = append(out, map[string]interface{}{"document": map[string]interface{}{
+						"format": "pdf",
+						"name":   bedrockDocumentName(documentTitle(b)),
+						"source": map[string]interface{}{"bytes": data},
+					}})
+				} else {
+					out = append(out, map[string]interface{}{"text": documentText(b)})
+				}
+			case "tool_use":
+				input := b["input"]
+				if input == nil {
+					input = map[string]interface{}{}
+				}
+				out = append(out, map[string]interface{}{"toolUse": map[string]interface{}{
+					"toolUseId": b["id"],
+					"name":      b["name"],
+					"input":     input,
+				}})
+			case "tool_result":
+				isErr, _ := b["is_error"].(bool)
+				resContent := b["content"]
+				if isErr {
+					resContent = markToolError(resContent, opts.ToolErrorPrefix)
+				}
+				var parts []interface{}
+				for _, part := range bedrockContent(resContent, opts) {
+					// Tool results cannot hold cache points
+					if _, ok := part.(map[string]interface{})["cachePoint"]; !ok {
+						parts = append(parts, part)
+					}
+				}
+				if len(parts) == 0 {
+					parts = []interface{}{map[string]interface{}{"text": ""}}
+				}
+				result := map[string]interface{}{"toolUseId": b["tool_use_id"], "content": parts}
+				if isErr {
+					result["status"] = "error"
+				}
+				out = append(out, map[string]interface{}{"toolResult": result})
+			}
+			if cc, ok := b["cache_control"]; ok && cc != nil && len(out) > 0 {
+				out = append(out, bedrockCachePoint())
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// bedrockImage converts a base64 Anthropic image block, or returns nil.
+func bedrockImage(b map[string]interface{}) map[string]interface{} {
+	src, _ := b["source"].(map[string]interface{})
+	if kind, _ := src["type"].(string); kind != "base64" {
+		return nil
+	}
+	mediaType, _ := src["media_type"].(string)
+	return map[string]interface{}{"image": map[string]interface{}{
+		"format": strings.TrimPrefix(mediaType, "image/"),
+		"source": map[string]interface{}{"bytes": src["data"]},
+	}}
+}
+
+// bedrockDocumentName reduces a document title to the characters Converse
+// accepts in document names: letters, digits, single spaces, hyphens,
+// parentheses and square brackets.
+func bedrockDocumentName(title string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case unicode.IsLetter(r), unicode.IsDigit(r), strings.ContainsRune("-()[]", r):
+			return r
+		}
+		return ' '
+	}, title)
+	name = strings.Join(strings.Fields(name), " ")
+	if name == "" {
+		return "document"
+	}
+	return name
+}
+
+// bedrockCachePoint returns a Converse cachePoint block, which marks the end
+// of a cacheable prompt prefix like Anthropic's cache_control.
+func bedrockCachePoint() map[string]interface{} {
+	return map[string]interface{}{"cachePoint": map[string]interface{}{"type": "default"}}
+}
+
+// bedrockSystem converts the Anthropic system field. cache_control markers
+// become Converse cachePoint blocks.
+func bedrockSystem(system interface{}) []interface{} {
+	switch s := system.(type) {
+	case string:
+		if s == "" {
+			return nil
+		}
+		return []interface{}{map[string]interface{}{"text": s}}
+	case []interface{}:
+		var out []interface{}
+		for _, blk := range s {
+			b, ok := blk.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if txt, _ := b["text"].(string); txt != "" {
+				out = append(out, map[string]interface{}{"text": txt})
+				if cc, ok := b["cache_control"]; ok && cc != nil {
+					out = append(out, bedrockCachePoint())
+				}
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// bedrockToolChoice maps an Anthropic tool_choice to Converse's toolChoice.
+func bedrockToolChoice(choice interface{}) map[string]interface{} {
+	kind := ""
+	name := ""
+	switch c := choice.(type) {
+	case string:
+		kind = c
+	case map[string]interface{}:
+		kind, _ = c["type"].(string)
+		name, _ = c["name"].(string)
+	}
+	switch kind {
+	case "auto":
+		return map[string]interface{}{"auto": map[string]interface{}{}}
+	case "any", "required":
+		return map[string]interface{}{"any": map[string]interface{}{}}
+	case "tool":
+		return map[string]interface{}{"tool": map[string]interface{}{"name": name}}
+	}
+	return nil
+}
+
+// bedrockStopReason maps a Converse stopReason to Anthropic's.
+func bedrockStopReason(reason string) string {
+	switch reason {
+	case "tool_use", "max_tokens", "stop_sequence":
+		return reason
+	case "guardrail_intervened", "content_filtered":
+		return "refusal"
+	}
+	return "end_turn"
+}
+
+// ParseResponse satisfies Provider.
+func (b *Bedrock) ParseResponse(res map[string]interface{}, opts Options) (*Response, error) {
+	output, _ := res["output"].(map[string]interface{})
+	message, _ := output["message"].(map[string]interface{})
+	blocks, _ := message["content"].([]interface{})
+	out := &Response{}
+	for _, blk := range blocks {
+		bm, _ := blk.(map[string]interface{})
+		if txt, ok := bm["text"].(string); ok {
+			out.Content = append(out.Content, map[string]interface{}{"type": "text", "text": txt})
+		}
+		if tu, ok := bm["toolUse"].(map[string]interface{}); ok {
+			out.Content = append(out.Content, map[string]interface{}{
+				"type":  "tool_use",
+				"id":    tu["toolUseId"],
+				"name":  tu["name"],
+				"input": tu["input"],
+			})
+		}
+	}
+	if len(out.Content) == 0 {
+		if opts.StrictResponseParsing {
+			return nil, ErrEmptyResponse
+		}
+		out.Content = append(out.Content, map[string]interface{}{"type": "text", "text": ""})
+	}
+	reason, _ := res["stopReason"].(string)
+	out.StopReason = bedrockStopReason(reason)
+	if reason == "stop_sequence" {
+		fields, _ := res["additionalModelResponseFields"].(map[string]interface{})
+		out.StopSequence = matchedSequence(fields["stop_sequence"], opts.StopSequences)
+	}
+	usage, _ := res["usage"].(map[string]interface{})
+	out.Usage = bedrockUsage(usage)
+	return out, nil
+}
+
+// bedrockUsage reads a Converse usage object. Its inputTokens leaves out
+// cached tokens, which are added back to match Usage.
+func bedrockUsage(usage map[string]interface{}) Usage {
+	in, _ := usage["inputTokens"].(float64)
+	out, _ := usage["outputTokens"].(float64)
+	read, _ := usage["cacheReadInputTokens"].(float64)
+	write, _ := usage["cacheWriteInputTokens"].(float64)
+	return Usage{InputTokens: int(in + read + write), OutputTokens: int(out), CacheReadTokens: int(read), CacheWriteTokens: int(write)}
+}
+
+// StreamTranslator satisfies Provider.
+func (b *Bedrock) StreamTranslator(id, model string, opts Options, emit EmitFunc) StreamTranslator {
+	t := newBedrockStream(id, model, emit)
+	t.stopSeqs = opts.StopSequences
+	return t
+}
+
+// DecodeStream satisfies StreamDecoder; converse-stream responses use the
+// binary AWS event stream encoding.
+func (b *Bedrock) DecodeStream(r io.Reader) ChunkReader {
+	return &eventStreamReader{r: r}
+}
@@ -0,0 +1,135 @@
+package providers
+
+// bedrockStream converts Converse stream events into Anthropic SSE events.
+// Bedrock's event model mirrors Anthropic's closely, so blocks map one to one.
+type bedrockStream struct {
+	emit  EmitFunc
+	id    string
+	model string
+
+	open         map[int]int // Bedrock contentBlockIndex -> Anthropic block index
+	nextIndex    int
+	sawToolUse   bool
+	stopReason   string
+	stopSequence *string
+	stopSeqs     []string // requested stop sequences
+	usage        Usage
+}
+
+// newBedrockStream returns a translator that sends events through emit.
+func newBedrockStream(id, model string, emit EmitFunc) *bedrockStream {
+	return &bedrockStream{emit: emit, id: id, model: model, open: make(map[int]int)}
+}
+
+// Start satisfies StreamTranslator.
+func (t *bedrockStream) Start() error {
+	return emitMessageStart(t.emit, t.id, t.model)
+}
+
+// Chunk satisfies StreamTranslator.
+func (t *bedrockStream) Chunk(chunk map[string]interface{}) error {
+	if ev, ok := chunk["contentBlockStart"].(map[string]interface{}); ok {
+		idx, _ := ev["contentBlockIndex"].(float64)
+		start, _ := ev["start"].(map[string]interface{})
+		if tu, ok := start["toolUse"].(map[string]interface{}); ok {
+			t.sawToolUse = true
+			return t.startBlock(int(idx), map[string]interface{}{
+				"type":  "tool_use",
+				"id":    tu["toolUseId"],
+				"name":  tu["name"],
+				"input": map[string]interface{}{},
+			})
+		}
+	}
+	if ev, ok := chunk["contentBlockDelta"].(map[string]interface{}); ok {
+		idx, _ := ev["contentBlockIndex"].(float64)
+		delta, _ := ev["delta"].(map[string]interface{})
+		if txt, ok := delta["text"].(string); ok {
+			if _, open := t.open[int(idx)]; !open {
+				if err := t.startBlock(int(idx), map[string]interface{}{"type": "text", "text": ""}); err != nil {
+					return err
+				}
+			}
+			return t.emit("content_block_delta", map[string]interface{}{
+				"type":  "content_block_delta",
+				"index": t.open[int(idx)],
+				"delta": map[string]interface{}{"type": "text_delta", "text": txt},
+			})
+		}
+		if tu, ok := delta["toolUse"].(map[string]interface{}); ok {
+			partial, _ := tu["input"].(string)
+			return t.emit("content_block_delta", map[string]interface{}{
+				"type":  "content_block_delta",
+				"index": t.open[int(idx)],
+				"delta": map[string]interface{}{"type": "input_json_delta", "partial_json": partial},
+			})
+		}
+	}
+	if ev, ok := chunk["contentBlockStop"].(map[string]interface{}); ok {
+		idx, _ := ev["contentBlockIndex"].(float64)
+		return t.stopBlock(int(idx))
+	}
+	if ev, ok := chunk["messageStop"].(map[string]interface{}); ok {
+		t.stopReason, _ = ev["stopReason"].(string)
+		if t.stopReason == "stop_sequence" {
+			fields, _ := ev["additionalModelResponseFields"].(map[string]interface{})
+			t.stopSequence = matchedSequence(fields["stop_sequence"], t.stopSeqs)
+		}
+	}
+	if ev, ok := chunk["metadata"].(map[string]interface{}); ok {
+		usage, _ := ev["usage"].(map[string]interface{})
+		t.usage = bedrockUsage(usage)
+	}
+	return nil
+}
+
+// startBlock opens an Anthropic content block for a Bedrock block index.
+func (t *bedrockStream) startBlock(idx int, block map[string]interface{}) error {
+	t.open[idx] = t.nextIndex
+	t.nextIndex++
+	return t.emit("content_block_start", map[string]interface{}{
+		"type":          "content_block_start",
+		"index":         t.open[idx],
+		"content_block": block,
+	})
+}
+
+// stopBlock closes the Anthropic block for a Bedrock block index.
+func (t *bedrockStream) stopBlock(idx int) error {
+	anthIdx, ok := t.open[idx]
+	if !ok {
+		return nil
+	}
+	delete(t.open, idx)
+	return t.emit("content_block_stop", map[string]interface{}{"type": "content_block_stop", "index": anthIdx})
+}
+
+// Finish satisfies StreamTranslator.
+func (t *bedrockStream) Finish() error {
+	// Close blocks the upstream left open, in block order
+	for len(t.open) > 0 {
+		first := -1
+		for idx := range t.open {
+			if first == -1 || idx < first {
+				first = idx
+			}
+		}
+		if err := t.stopBlock(first); err != nil {
+			return err
+		}
+	}
+	return emitMessageEnd(t.emit, t.StopReason(), t.stopSequence, t.usage)
+}
+
+// StopReason satisfies StreamTranslator.
+func (t *bedrockStream) StopReason() string {
+	if t.stopReason == "" && t.sawToolUse {
+		return "tool_use"
+	}
+	return bedrockStopReason(t.stopReason)
+}
+
+// Usage satisfies StreamTranslator.
+func (t *bedrockStream) Usage() Usage {
+	return t.usage
+}
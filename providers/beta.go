@@ -0,0 +1,89 @@
+package providers
+
+import "strings"
+
+// BetaHandler is implemented by providers that act on the anthropic-beta
+// features a client requests. Requested betas reach BuildPayload in
+// Options.Betas.
+type BetaHandler interface {
+	// SupportsBeta reports whether requests for model honor beta.
+	SupportsBeta(model, beta string) bool
+	// BetaHeader returns the anthropic-beta header to send upstream for
+	// the requested betas, or "" for none.
+	BetaHeader(betas []string) string
+}
+
+// neutralBetas are prefixes of beta features that need nothing from an
+// adapter: client markers, and features that only tune how Anthropic
+// serves a request which other upstreams already behave like.
+var neutralBetas = []string{
+	"claude-code-",
+	"token-efficient-tools-",
+	"fine-grained-tool-streaming-",
+	"interleaved-thinking-",
+	"prompt-caching-",
+}
+
+// UnsupportedBetas returns the betas that requests for model through p
+// will not honor.
+func UnsupportedBetas(p Provider, model string, betas []string) []string {
+	h, _ := unwrap(p).(BetaHandler)
+	var res []string
+	for _, beta := range betas {
+		if neutralBeta(beta) || (h != nil && h.SupportsBeta(model, beta)) {
+			continue
+		}
+		res = append(res, beta)
+	}
+	return res
+}
+
+// BetaHeader returns the anthropic-beta header p sends upstream for betas.
+func BetaHeader(p Provider, betas []string) string {
+	if h, ok := unwrap(p).(BetaHandler); ok && len(betas) > 0 {
+		return h.BetaHeader(betas)
+	}
+	return ""
+}
+
+func neutralBeta(beta string) bool {
+	for _, prefix := range neutralBetas {
+		if strings.HasPrefix(beta, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// SupportsBeta satisfies BetaHandler. Anthropic's API takes every beta.
+func (a *Anthropic) SupportsBeta(model, beta string) bool {
+	return true
+}
+
+// BetaHeader satisfies BetaHandler.
+func (a *Anthropic) BetaHeader(betas []string) string {
+	return strings.Join(betas, ",")
+}
+
+// SupportsBeta satisfies BetaHandler. Claude models on Bedrock take betas
+// in the request body, see BuildPayload.
+func (b *Bedrock) SupportsBeta(model, beta string) bool {
+	return strings.Contains(model, "anthropic.")
+}
+
+// BetaHeader satisfies BetaHandler. Bedrock takes betas in the body.
+func (b *Bedrock) BetaHeader(betas []string) string {
+	return ""
+}
+
+// bedrockBetas returns the betas passed to Claude models on Bedrock, which
+// leaves out client markers it does not know.
+func bedrockBetas(betas []string) []string {
+	var res []string
+	for _, beta := range betas {
+		if !strings.HasPrefix(beta, "claude-code-") {
+			res = append(res, beta)
+		}
+	}
+	return res
+}
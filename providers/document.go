@@ -0,0 +1,83 @@
+package providers
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"gopenbridge/pdftext"
+)
+
+// documentPDF returns the base64 data of a PDF document block, or false
+// when the block holds something else.
+func documentPDF(b map[string]interface{}) (string, bool) {
+	src, _ := b["source"].(map[string]interface{})
+	kind, _ := src["type"].(string)
+	mediaType, _ := src["media_type"].(string)
+	data, _ := src["data"].(string)
+	if kind != "base64" || mediaType != "application/pdf" || data == "" {
+		return "", false
+	}
+	return data, true
+}
+
+// documentTitle returns a document block's title, or a generic name.
+func documentTitle(b map[string]interface{}) string {
+	if title, _ := b["title"].(string); title != "" {
+		return title
+	}
+	return "document"
+}
+
+// documentText renders a document block as text: PDFs are extracted
+// locally and plain text is used as is. The title and context are kept so
+// the model can tell documents apart. A document that cannot be read
+// becomes a note saying so rather than disappearing from the conversation.
+func documentText(b map[string]interface{}) string {
+	body, err := readDocument(b)
+	if err != nil {
+		slog.Debug("Could not read document", "title", documentTitle(b), "error", err)
+		return fmt.Sprintf("[Document %q could not be read: %v]", documentTitle(b), err)
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "<document title=%q>\n", documentTitle(b))
+	if ctx, _ := b["context"].(string); ctx != "" {
+		fmt.Fprintf(&sb, "<context>%s</context>\n", ctx)
+	}
+	sb.WriteString(body)
+	sb.WriteString("\n</document>")
+	return sb.String()
+}
+
+// readDocument returns the text held by a document block's source.
+func readDocument(b map[string]interface{}) (string, error) {
+	src, _ := b["source"].(map[string]interface{})
+	kind, _ := src["type"].(string)
+	mediaType, _ := src["media_type"].(string)
+	switch kind {
+	case "text":
+		data, _ := src["data"].(string)
+		return data, nil
+	case "content":
+		return contentText(src["content"]), nil
+	case "base64":
+		data, _ := src["data"].(string)
+		raw, err := base64.StdEncoding.DecodeString(data)
+		if err != nil {
+			return "", fmt.Errorf("invalid base64 data: %w", err)
+		}
+		switch {
+		case mediaType == "application/pdf":
+			return pdftext.Extract(raw)
+		case strings.HasPrefix(mediaType, "text/"):
+			return string(raw), nil
+		}
+		return "", fmt.Errorf("unsupported media type %q", mediaType)
+	case "url":
+		url, _ := src["url"].(string)
+		return "", fmt.Errorf("documents by URL are not supported (%s)", url)
+	}
+	return "", errors.New("missing document source")
+}
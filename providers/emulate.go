@@ -0,0 +1,401 @@
+package providers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"gopenbridge/models"
+)
+
+// Markers delimiting an emulated tool call in the model's text.
+const (
+	toolCallOpen  = "<tool_call>"
+	toolCallClose = "</tool_call>"
+)
+
+// emulatedTools wraps a provider whose models lack native function calling.
+// Tool definitions are described in the system prompt, earlier tool calls
+// and results are replayed as text, and <tool_call> blocks in the model's
+// reply are turned back into tool_use blocks.
+type emulatedTools struct {
+	Provider
+}
+
+// unwrap returns the provider p emulates tools for, or p itself, so
+// optional interfaces can be checked.
+func unwrap(p Provider) Provider {
+	if e, ok := p.(emulatedTools); ok {
+		return e.Provider
+	}
+	return p
+}
+
+// EmulateTools returns p with tool calling emulated through the prompt.
+func EmulateTools(p Provider) Provider {
+	if _, ok := p.(emulatedTools); ok {
+		return p
+	}
+	return emulatedTools{p}
+}
+
+// BuildPayload satisfies Provider.
+func (e emulatedTools) BuildPayload(req *models.MessagesRequest, opts Options) (map[string]interface{}, error) {
+	return e.Provider.BuildPayload(emulatedRequest(req), opts)
+}
+
+// ParseResponse satisfies Provider.
+func (e emulatedTools) ParseResponse(res map[string]interface{}, opts Options) (*Response, error) {
+	parsed, err := e.Provider.ParseResponse(res, opts)
+	if err != nil {
+		return nil, err
+	}
+	var content []interface{}
+	found := false
+	for _, blk := range parsed.Content {
+		b, ok := blk.(map[string]interface{})
+		txt, _ := b["text"].(string)
+		if !ok || b["type"] != "text" || !strings.Contains(txt, toolCallOpen) {
+			content = append(content, blk)
+			continue
+		}
+		before, calls := parseToolCalls(txt)
+		if len(calls) == 0 {
+			content = append(content, blk)
+			continue
+		}
+		found = true
+		if strings.TrimSpace(before) != "" {
+			content = append(content, map[string]interface{}{"type": "text", "text": strings.TrimSpace(before)})
+		}
+		for _, c := range calls {
+			content = append(content, c)
+		}
+	}
+	parsed.Content = content
+	if found && parsed.StopReason != "max_tokens" {
+		parsed.StopReason, parsed.StopSequence = "tool_use", nil
+	}
+	return parsed, nil
+}
+
+// StreamTranslator satisfies Provider.
+func (e emulatedTools) StreamTranslator(id, model string, opts Options, emit EmitFunc) StreamTranslator {
+	s := &emulatedStream{emit: emit, textIndex: -1}
+	s.StreamTranslator = e.Provider.StreamTranslator(id, model, opts, s.intercept)
+	return s
+}
+
+// emulatedRequest returns a copy of req with its tools described in the
+// system prompt and tool_use and tool_result blocks rewritten as text. req
+// is not modified.
+func emulatedRequest(req *models.MessagesRequest) *models.MessagesRequest {
+	r := *req
+	r.Tools, r.ToolChoice = nil, nil
+	if prompt := toolPrompt(req); prompt != "" {
+		switch sys := req.System.(type) {
+		case string:
+			if sys != "" {
+				prompt = sys + "\n\n" + prompt
+			}
+			r.System = prompt
+		case []interface{}:
+			r.System = append(sys[:len(sys):len(sys)], map[string]interface{}{"type": "text", "text": prompt})
+		default:
+			r.System = prompt
+		}
+	}
+	names := map[string]string{} // tool_use id → name, for tool results
+	r.Messages = make([]models.Message, len(req.Messages))
+	for i, msg := range req.Messages {
+		blocks, ok := msg.Content.([]interface{})
+		if !ok {
+			r.Messages[i] = msg
+			continue
+		}
+		rewritten := make([]interface{}, len(blocks))
+		for j, blk := range blocks {
+			rewritten[j] = blk
+			b, _ := blk.(map[string]interface{})
+			switch b["type"] {
+			case "tool_use":
+				id, _ := b["id"].(string)
+				name, _ := b["name"].(string)
+				names[id] = name
+				rewritten[j] = map[string]interface{}{"type": "text", "text": formatToolCall(name, b["input"])}
+			case "tool_result":
+				id, _ := b["tool_use_id"].(string)
+				rewritten[j] = map[string]interface{}{"type": "text", "text": formatToolResult(names[id], b)}
+			}
+		}
+		msg.Content = rewritten
+		r.Messages[i] = msg
+	}
+	return &r
+}
+
+// toolPrompt describes req's tools and how to call them, or returns "" when
+// the request has no tools or forbids calling them.
+func toolPrompt(req *models.MessagesRequest) string {
+	if len(req.Tools) == 0 {
+		return ""
+	}
+	choice, _ := req.ToolChoice.(map[string]interface{})
+	kind, _ := choice["type"].(string)
+	if kind == "none" {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteString("You can call tools to help with the request. The available tools are listed below with JSON Schemas for their input.\n\n<tools>\n")
+	for _, t := range req.Tools {
+		def, _ := json.Marshal(map[string]interface{}{"name": t.Name, "description": t.Description, "input_schema": t.InputSchema})
+		sb.Write(def)
+		sb.WriteByte('\n')
+	}
+	sb.WriteString("</tools>\n\nTo call a tool, reply with a block in exactly this format, where input matches the tool's schema:\n")
+	sb.WriteString(toolCallOpen + "\n{\"name\": \"tool_name\", \"input\": {\"arg\": \"value\"}}\n" + toolCallClose + "\n\n")
+	sb.WriteString("You may write a short explanation before the block. Write nothing after your last tool call: stop and wait for the results, which come back in <tool_result> blocks. Never write a <tool_result> yourself. Only call the tools listed above; if none is needed, answer normally.")
+	switch kind {
+	case "any":
+		sb.WriteString("\n\nYou must call at least one tool in this reply.")
+	case "tool":
+		name, _ := choice["name"].(string)
+		fmt.Fprintf(&sb, "\n\nYou must call the %s tool in this reply.", name)
+	}
+	if disable, _ := choice["disable_parallel_tool_use"].(bool); disable {
+		sb.WriteString("\n\nCall at most one tool in this reply.")
+	}
+	return sb.String()
+}
+
+// formatToolCall renders a tool call the way the model is asked to write it.
+func formatToolCall(name string, input interface{}) string {
+	if input == nil {
+		input = map[string]interface{}{}
+	}
+	call, _ := json.Marshal(map[string]interface{}{"name": name, "input": input})
+	return toolCallOpen + "\n" + string(call) + "\n" + toolCallClose
+}
+
+// formatToolResult renders a tool_result block as text. Only the text of
+// the result is kept.
+func formatToolResult(name string, b map[string]interface{}) string {
+	attrs := ""
+	if name != "" {
+		attrs += fmt.Sprintf(" name=%q", name)
+	}
+	if isErr, _ := b["is_error"].(bool); isErr {
+		attrs += ` error="true"`
+	}
+	return "<tool_result" + attrs + ">\n" + contentText(b["content"]) + "\n</tool_result>"
+}
+
+// parseToolCalls splits text into the text before the first tool call and
+// tool_use blocks for the calls. A final call may lack its closing marker
+// when the model stopped early. Calls that cannot be decoded are dropped
+// with a warning, and so is any text after the last call, which is usually
+// an invented result.
+func parseToolCalls(text string) (string, []map[string]interface{}) {
+	start := strings.Index(text, toolCallOpen)
+	if start == -1 {
+		return text, nil
+	}
+	before, rest := text[:start], text[start:]
+	var calls []map[string]interface{}
+	for {
+		i := strings.Index(rest, toolCallOpen)
+		if i == -1 {
+			break
+		}
+		rest = rest[i+len(toolCallOpen):]
+		body := rest
+		if j := strings.Index(rest, toolCallClose); j != -1 {
+			body, rest = rest[:j], rest[j+len(toolCallClose):]
+		} else {
+			rest = ""
+		}
+		call, err := decodeToolCall(body)
+		if err != nil {
+			slog.Warn("Could not decode emulated tool call", "error", err, "call", body)
+			continue
+		}
+		calls = append(calls, call)
+	}
+	return before, calls
+}
+
+// decodeToolCall turns the JSON body of a <tool_call> block into a tool_use
+// block. Arguments may also be given as "arguments" or "parameters", and as
+// an encoded JSON string.
+func decodeToolCall(body string) (map[string]interface{}, error) {
+	var call map[string]interface{}
+	if err := json.Unmarshal([]byte(strings.TrimSpace(body)), &call); err != nil {
+		fixed, ok := repairJSON(body)
+		if !ok {
+			return nil, err
+		}
+		json.Unmarshal([]byte(fixed), &call)
+	}
+	name, _ := call["name"].(string)
+	if name == "" {
+		return nil, fmt.Errorf("tool call has no name")
+	}
+	var input interface{} = map[string]interface{}{}
+	for _, key := range []string{"input", "arguments", "parameters"} {
+		if v, ok := call[key]; ok {
+			input = v
+			break
+		}
+	}
+	if s, ok := input.(string); ok {
+		args, err := parseToolArgs(s, true)
+		if err != nil {
+			return nil, err
+		}
+		input = args
+	}
+	if _, ok := input.(map[string]interface{}); !ok {
+		return nil, fmt.Errorf("tool call input is not an object")
+	}
+	return map[string]interface{}{
+		"type":  "tool_use",
+		"id":    uuid.New().String()[:12],
+		"name":  name,
+		"input": input,
+	}, nil
+}
+
+// emulatedStream sits between a provider's stream translator and the
+// client. Text is passed through until a tool call begins; from there it is
+// held back and turned into tool_use blocks when the text block ends. Text
+// that might be the start of the marker is held until it can be told apart.
+type emulatedStream struct {
+	StreamTranslator
+	emit EmitFunc
+
+	textIndex int             // Index of the open text block, -1 if none
+	pending   strings.Builder // Text not yet sent
+	calling   bool            // pending holds tool calls
+	shift     int             // Added to later block indices for the tool_use blocks inserted
+	sawCalls  bool
+}
+
+// intercept receives the inner translator's events.
+func (s *emulatedStream) intercept(event string, data interface{}) error {
+	ev, _ := data.(map[string]interface{})
+	idx, hasIdx := ev["index"].(int)
+	if hasIdx && s.shift > 0 {
+		ev["index"] = idx + s.shift
+		idx += s.shift
+	}
+	switch event {
+	case "content_block_start":
+		if b, _ := ev["content_block"].(map[string]interface{}); b["type"] == "text" {
+			s.textIndex = idx
+		}
+	case "content_block_delta":
+		delta, _ := ev["delta"].(map[string]interface{})
+		if idx == s.textIndex && delta["type"] == "text_delta" {
+			txt, _ := delta["text"].(string)
+			return s.text(txt)
+		}
+	case "content_block_stop":
+		if idx == s.textIndex {
+			err := s.endText(idx)
+			s.textIndex = -1
+			return err
+		}
+	case "message_delta":
+		if d, _ := ev["delta"].(map[string]interface{}); d != nil && s.sawCalls && d["stop_reason"] != "max_tokens" {
+			d["stop_reason"], d["stop_sequence"] = "tool_use", nil
+		}
+	}
+	return s.emit(event, data)
+}
+
+// text handles a text delta for the open text block.
+func (s *emulatedStream) text(txt string) error {
+	s.pending.WriteString(txt)
+	if s.calling {
+		return nil
+	}
+	buf := s.pending.String()
+	send := buf
+	if i := strings.Index(buf, toolCallOpen); i != -1 {
+		send = buf[:i]
+		s.calling = true
+	} else {
+		send = buf[:len(buf)-markerPrefixLen(buf)]
+	}
+	s.pending.Reset()
+	s.pending.WriteString(buf[len(send):])
+	return s.sendText(send)
+}
+
+// endText closes the text block at index, followed by any tool calls it
+// held.
+func (s *emulatedStream) endText(index int) error {
+	buf := s.pending.String()
+	s.pending.Reset()
+	var calls []map[string]interface{}
+	if s.calling {
+		s.calling = false
+		var before string
+		if before, calls = parseToolCalls(buf); len(calls) > 0 {
+			buf = before
+		}
+	}
+	if err := s.sendText(buf); err != nil {
+		return err
+	}
+	if err := s.emit("content_block_stop", map[string]interface{}{"type": "content_block_stop", "index": index}); err != nil {
+		return err
+	}
+	for i, c := range calls {
+		s.shift++
+		s.sawCalls = true
+		args, err := json.Marshal(c["input"])
+		if err != nil {
+			return err
+		}
+		if err := emitToolUseBlock(s.emit, index+1+i, c["id"].(string), c["name"].(string), string(args)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sendText emits txt as a delta of the open text block.
+func (s *emulatedStream) sendText(txt string) error {
+	if txt == "" {
+		return nil
+	}
+	return s.emit("content_block_delta", map[string]interface{}{
+		"type":  "content_block_delta",
+		"index": s.textIndex,
+		"delta": map[string]interface{}{"type": "text_delta", "text": txt},
+	})
+}
+
+// markerPrefixLen returns the length of the longest suffix of s that could
+// begin the tool call marker.
+func markerPrefixLen(s string) int {
+	for n := min(len(s), len(toolCallOpen)-1); n > 0; n-- {
+		if strings.HasSuffix(s, toolCallOpen[:n]) {
+			return n
+		}
+	}
+	return 0
+}
+
+// StopReason satisfies StreamTranslator.
+func (s *emulatedStream) StopReason() string {
+	reason := s.StreamTranslator.StopReason()
+	if s.sawCalls && reason != "max_tokens" {
+		return "tool_use"
+	}
+	return reason
+}
@@ -0,0 +1,180 @@
+package providers
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopenbridge/models"
+)
+
+func TestParseToolCalls(t *testing.T) {
+	read := map[string]interface{}{"path": "a.txt"}
+	tests := []struct {
+		name       string
+		text       string
+		wantBefore string
+		wantInputs []map[string]interface{}
+	}{
+		{"no call", "Just an answer.", "Just an answer.", nil},
+		{"one call", "Let me look.\n<tool_call>\n{\"name\": \"read\", \"input\": {\"path\": \"a.txt\"}}\n</tool_call>", "Let me look.\n", []map[string]interface{}{read}},
+		{"unclosed final call", "<tool_call>{\"name\": \"read\", \"input\": {\"path\": \"a.txt\"}}", "", []map[string]interface{}{read}},
+		{"arguments as a string", "<tool_call>{\"name\": \"read\", \"arguments\": \"{\\\"path\\\": \\\"a.txt\\\"}\"}</tool_call>", "", []map[string]interface{}{read}},
+		{"parameters", "<tool_call>{\"name\": \"read\", \"parameters\": {\"path\": \"a.txt\"}}</tool_call>", "", []map[string]interface{}{read}},
+		{"no input", "<tool_call>{\"name\": \"read\"}</tool_call>", "", []map[string]interface{}{{}}},
+		{"undecodable call dropped", "<tool_call>not json</tool_call><tool_call>{\"name\": \"read\", \"input\": {\"path\": \"a.txt\"}}</tool_call>", "", []map[string]interface{}{read}},
+		{"invented result dropped", "<tool_call>{\"name\": \"read\", \"input\": {\"path\": \"a.txt\"}}</tool_call>\n<tool_result>hello</tool_result>", "", []map[string]interface{}{read}},
+		{"two calls", "<tool_call>{\"name\": \"read\", \"input\": {\"path\": \"a.txt\"}}</tool_call><tool_call>{\"name\": \"read\", \"input\": {\"path\": \"b.txt\"}}</tool_call>", "", []map[string]interface{}{read, {"path": "b.txt"}}},
+	}
+	for _, tt := range tests {
+		before, calls := parseToolCalls(tt.text)
+		if before != tt.wantBefore {
+			t.Errorf("%s: text before = %q, want %q", tt.name, before, tt.wantBefore)
+		}
+		var inputs []map[string]interface{}
+		for _, c := range calls {
+			if c["type"] != "tool_use" || c["name"] != "read" || c["id"] == "" {
+				t.Errorf("%s: call = %v, want a tool_use block for read", tt.name, c)
+			}
+			inputs = append(inputs, c["input"].(map[string]interface{}))
+		}
+		if !reflect.DeepEqual(inputs, tt.wantInputs) {
+			t.Errorf("%s: inputs = %v, want %v", tt.name, inputs, tt.wantInputs)
+		}
+	}
+}
+
+func TestEmulatedRequest(t *testing.T) {
+	req := &models.MessagesRequest{
+		System: "Be brief.",
+		Tools:  []models.Tool{{Name: "read", Description: "Read a file", InputSchema: map[string]interface{}{"type": "object"}}},
+		Messages: []models.Message{
+			{Role: "user", Content: "Read a.txt"},
+			{Role: "assistant", Content: []interface{}{map[string]interface{}{"type": "tool_use", "id": "t1", "name": "read", "input": map[string]interface{}{"path": "a.txt"}}}},
+			{Role: "user", Content: []interface{}{map[string]interface{}{"type": "tool_result", "tool_use_id": "t1", "content": "hello", "is_error": true}}},
+		},
+	}
+	r := emulatedRequest(req)
+	if r.Tools != nil {
+		t.Error("tools still sent natively")
+	}
+	sys, _ := r.System.(string)
+	if !strings.HasPrefix(sys, "Be brief.\n\n") || !strings.Contains(sys, `"name":"read"`) || !strings.Contains(sys, toolCallOpen) {
+		t.Errorf("system prompt lacks the original prompt or the tool description: %q", sys)
+	}
+	call := r.Messages[1].Content.([]interface{})[0].(map[string]interface{})
+	if call["type"] != "text" || call["text"] != toolCallOpen+"\n{\"input\":{\"path\":\"a.txt\"},\"name\":\"read\"}\n"+toolCallClose {
+		t.Errorf("tool_use rewritten as %v", call)
+	}
+	result := r.Messages[2].Content.([]interface{})[0].(map[string]interface{})
+	if result["text"] != "<tool_result name=\"read\" error=\"true\">\nhello\n</tool_result>" {
+		t.Errorf("tool_result rewritten as %v", result)
+	}
+	if len(req.Tools) != 1 || req.Messages[1].Content.([]interface{})[0].(map[string]interface{})["type"] != "tool_use" {
+		t.Error("the original request was modified")
+	}
+	if toolPrompt(&models.MessagesRequest{Tools: req.Tools, ToolChoice: map[string]interface{}{"type": "none"}}) != "" {
+		t.Error("tools described although tool_choice is none")
+	}
+}
+
+func TestEmulatedParseResponse(t *testing.T) {
+	body := map[string]interface{}{"choices": []interface{}{map[string]interface{}{
+		"message":       map[string]interface{}{"content": "Let me look.\n<tool_call>{\"name\": \"read\", \"input\": {\"path\": \"a.txt\"}}</tool_call>"},
+		"finish_reason": "stop",
+	}}}
+	res, err := EmulateTools(mustGet(t, "openai")).ParseResponse(body, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Content) != 2 || res.StopReason != "tool_use" {
+		t.Fatalf("content = %v, stop_reason %q, want text and a tool_use block", res.Content, res.StopReason)
+	}
+	if txt := res.Content[0].(map[string]interface{})["text"]; txt != "Let me look." {
+		t.Errorf("text = %q", txt)
+	}
+	if call := res.Content[1].(map[string]interface{}); call["type"] != "tool_use" || call["name"] != "read" {
+		t.Errorf("tool call = %v", call)
+	}
+}
+
+// streamEvent is one event emitted by a stream translator.
+type streamEvent struct {
+	name string
+	data map[string]interface{}
+}
+
+func TestEmulatedOllamaStream(t *testing.T) {
+	// NDJSON as Ollama sends it, with the marker split across lines
+	upstream := `{"message":{"role":"assistant","content":"Let me look.<tool"}}
+{"message":{"role":"assistant","content":"_call>{\"name\": \"read\", \"input\": {\"path\": \"a.txt\"}}</tool_call>"}}
+{"message":{"role":"assistant","content":""},"done":true,"done_reason":"stop","prompt_eval_count":20,"eval_count":9}
+`
+	prov := EmulateTools(mustGet(t, "ollama"))
+	var events []streamEvent
+	tr := prov.StreamTranslator("msg_1", "qwen3", Options{}, func(name string, data interface{}) error {
+		events = append(events, streamEvent{name, data.(map[string]interface{})})
+		return nil
+	})
+	if err := tr.Start(); err != nil {
+		t.Fatal(err)
+	}
+	chunks := 0
+	r := NewChunkReader(prov, strings.NewReader(upstream))
+	for {
+		chunk, _, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if chunk == nil {
+			t.Fatal("undecodable chunk: the stream was not read as NDJSON")
+		}
+		chunks++
+		if err := tr.Chunk(chunk); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tr.Finish(); err != nil {
+		t.Fatal(err)
+	}
+	if chunks != 3 {
+		t.Fatalf("read %d chunks, want 3", chunks)
+	}
+
+	var text, args, stopReason string
+	var tool map[string]interface{}
+	for _, ev := range events {
+		switch ev.name {
+		case "content_block_start":
+			if b := ev.data["content_block"].(map[string]interface{}); b["type"] == "tool_use" {
+				tool = b
+			}
+		case "content_block_delta":
+			d := ev.data["delta"].(map[string]interface{})
+			if d["type"] == "text_delta" {
+				text += d["text"].(string)
+			} else {
+				args += d["partial_json"].(string)
+			}
+		case "message_delta":
+			stopReason, _ = ev.data["delta"].(map[string]interface{})["stop_reason"].(string)
+		}
+	}
+	if text != "Let me look." {
+		t.Errorf("streamed text = %q, want the text before the call", text)
+	}
+	if tool == nil || tool["name"] != "read" || args != `{"path":"a.txt"}` {
+		t.Errorf("tool_use = %v with input %s, want read with a.txt", tool, args)
+	}
+	if stopReason != "tool_use" || tr.StopReason() != "tool_use" {
+		t.Errorf("stop_reason = %q, %q, want tool_use", stopReason, tr.StopReason())
+	}
+	if u := tr.Usage(); u.InputTokens != 20 || u.OutputTokens != 9 {
+		t.Errorf("usage = %+v", u)
+	}
+}
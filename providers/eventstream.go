@@ -0,0 +1,112 @@
+package providers
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// eventStreamReader decodes the binary AWS event stream framing used by
+// Bedrock's streaming APIs. Each event is returned as a chunk keyed by its
+// event type, e.g. {"contentBlockDelta": {...}}.
+type eventStreamReader struct {
+	r io.Reader
+}
+
+// Next satisfies ChunkReader.
+func (e *eventStreamReader) Next() (map[string]interface{}, []byte, error) {
+	// Prelude: total length, headers length, prelude CRC
+	var prelude [12]byte
+	if _, err := io.ReadFull(e.r, prelude[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, nil, errors.New("truncated event stream message")
+		}
+		return nil, nil, err
+	}
+	total := binary.BigEndian.Uint32(prelude[0:4])
+	headersLen := binary.BigEndian.Uint32(prelude[4:8])
+	if crc32.ChecksumIEEE(prelude[:8]) != binary.BigEndian.Uint32(prelude[8:12]) {
+		return nil, nil, errors.New("event stream prelude checksum mismatch")
+	}
+	if total < 16+headersLen || total > 16<<20 {
+		return nil, nil, fmt.Errorf("invalid event stream message length %d", total)
+	}
+	rest := make([]byte, total-12)
+	if _, err := io.ReadFull(e.r, rest); err != nil {
+		return nil, nil, errors.New("truncated event stream message")
+	}
+	msgCRC := binary.BigEndian.Uint32(rest[len(rest)-4:])
+	crc := crc32.Update(crc32.ChecksumIEEE(prelude[:]), crc32.IEEETable, rest[:len(rest)-4])
+	if crc != msgCRC {
+		return nil, nil, errors.New("event stream message checksum mismatch")
+	}
+	headers, err := parseEventHeaders(rest[:headersLen])
+	if err != nil {
+		return nil, nil, err
+	}
+	payload := rest[headersLen : len(rest)-4]
+	if headers[":message-type"] == "exception" || headers[":message-type"] == "error" {
+		kind := headers[":exception-type"]
+		if kind == "" {
+			kind = headers[":error-code"]
+		}
+		return nil, payload, fmt.Errorf("upstream stream error %s: %s", kind, payload)
+	}
+	var body interface{}
+	if json.Unmarshal(payload, &body) != nil {
+		return nil, payload, nil
+	}
+	return map[string]interface{}{headers[":event-type"]: body}, payload, nil
+}
+
+// parseEventHeaders decodes event stream headers, keeping string values.
+func parseEventHeaders(b []byte) (map[string]string, error) {
+	res := make(map[string]string)
+	for len(b) > 0 {
+		nameLen := int(b[0])
+		if len(b) < 2+nameLen {
+			return nil, errors.New("malformed event stream header")
+		}
+		name := string(b[1 : 1+nameLen])
+		typ := b[1+nameLen]
+		b = b[2+nameLen:]
+		var size int
+		switch typ {
+		case 0, 1: // bool true / false
+			size = 0
+		case 2: // byte
+			size = 1
+		case 3: // short
+			size = 2
+		case 4: // int
+			size = 4
+		case 5, 8: // long, timestamp
+			size = 8
+		case 9: // uuid
+			size = 16
+		case 6, 7: // bytes, string: 2-byte length prefix
+			if len(b) < 2 {
+				return nil, errors.New("malformed event stream header")
+			}
+			n := int(binary.BigEndian.Uint16(b[:2]))
+			if len(b) < 2+n {
+				return nil, errors.New("malformed event stream header")
+			}
+			if typ == 7 {
+				res[name] = string(b[2 : 2+n])
+			}
+			b = b[2+n:]
+			continue
+		default:
+			return nil, fmt.Errorf("unknown event stream header type %d", typ)
+		}
+		if len(b) < size {
+			return nil, errors.New("malformed event stream header")
+		}
+		b = b[size:]
+	}
+	return res, nil
+}
@@ -0,0 +1,317 @@
+package providers
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/google/uuid"
+	"gopenbridge/models"
+)
+
+// defaultGeminiBaseURL is used when the configured base URL is not Google's.
+const defaultGeminiBaseURL = "https://generativelanguage.googleapis.com/v1beta"
+
+// Gemini implements Provider for Google's native generateContent API, which
+// handles tool-heavy workloads better than its OpenAI compatibility layer.
+type Gemini struct{}
+
+func init() {
+	Register(&Gemini{}, "generativelanguage.googleapis.com")
+}
+
+// Name satisfies Provider.
+func (g *Gemini) Name() string {
+	return "gemini"
+}
+
+// Endpoint satisfies Provider. A base URL pointing at the OpenAI
+// compatibility layer is mapped back to the native API.
+func (g *Gemini) Endpoint(up Upstream, model string, stream bool) string {
+	base := strings.TrimSuffix(strings.TrimRight(up.BaseURL, "/"), "/openai")
+	if !strings.Contains(base, "googleapis.com") {
+		base = defaultGeminiBaseURL
+	}
+	model = strings.TrimPrefix(model, "models/")
+	if stream {
+		return base + "/models/" + url.PathEscape(model) + ":streamGenerateContent?alt=sse"
+	}
+	return base + "/models/" + url.PathEscape(model) + ":generateContent"
+}
+
+// Authorize satisfies Provider.
+func (g *Gemini) Authorize(req *http.Request, up Upstream) error {
+	req.Header.Set("x-goog-api-key", up.APIKey)
+	return nil
+}
+
+// BuildPayload satisfies Provider.
+func (g *Gemini) BuildPayload(req *models.MessagesRequest, opts Options) (map[string]interface{}, error) {
+	// functionResponse parts need the function name, which Anthropic
+	// tool_result blocks only reference by tool_use id
+	toolNames := make(map[string]string)
+	var contents []interface{}
+	for _, msg := range req.Messages {
+		role := "user"
+		if msg.Role == "assistant" {
+			role = "model"
+		}
+		parts := geminiParts(msg.Content, toolNames, opts)
+		if len(parts) == 0 {
+			continue
+		}
+		contents = append(contents, map[string]interface{}{"role": role, "parts": parts})
+	}
+	if len(contents) == 0 {
+		return nil, errors.New("messages: at least one message with content is required")
+	}
+	genCfg := map[string]interface{}{"maxOutputTokens": opts.MaxTokens}
+	if req.Temperature != nil {
+		genCfg["temperature"] = *req.Temperature
+	}
+	if req.TopP != nil {
+		genCfg["topP"] = *req.TopP
+	}
+	if req.TopK != nil {
+		genCfg["topK"] = *req.TopK
+	}
+	if len(req.StopSequences) > 0 {
+		genCfg["stopSequences"] = req.StopSequences
+	}
+	if budget, ok := thinkingBudget(req); ok && geminiThinks(req.Model) {
+		genCfg["thinkingConfig"] = map[string]interface{}{"thinkingBudget": min(budget, geminiMaxThinking)}
+	}
+	payload := map[string]interface{}{
+		"contents":         contents,
+		"generationConfig": genCfg,
+	}
+	if sys := contentText(req.System); sys != "" {
+		payload["systemInstruction"] = map[string]interface{}{
+			"parts": []interface{}{map[string]interface{}{"text": sys}},
+		}
+	}
+	if len(req.Tools) > 0 {
+		var decls []interface{}
+		profile := schemaProfile(opts, "gemini")
+		for _, t := range req.Tools {
+			decl := map[string]interface{}{"name": t.Name, "description": t.Description}
+			if len(t.InputSchema) > 0 {
+				decl["parameters"] = profile.Clean(t.InputSchema)
+			}
+			decls = append(decls, decl)
+		}
+		payload["tools"] = []interface{}{map[string]interface{}{"functionDeclarations": decls}}
+		if cfg := geminiToolConfig(req.ToolChoice); cfg != nil {
+			payload["toolConfig"] = cfg
+		}
+	}
+	return payload, nil
+}
+
+// geminiParts converts Anthropic message content into Gemini parts,
+// recording tool_use names in toolNames for later tool results. PDF
+// documents are sent inline unless opts.ExtractDocuments is set.
+func geminiParts(content interface{}, toolNames map[string]string, opts Options) []interface{} {
+	switch c := content.(type) {
+	case string:
+		if c == "" {
+			return nil
+		}
+		return []interface{}{map[string]interface{}{"text": c}}
+	case []interface{}:
+		var out []interface{}
+		for _, blk := range c {
+			b, ok := blk.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			switch t, _ := b["type"].(string); t {
+			case "text":
+				if s, _ := b["text"].(string); s != "" {
+					out = append(out, map[string]interface{}{"text": s})
+				}
+			case "image":
+				src, _ := b["source"].(map[string]interface{})
+				if kind, _ := src["type"].(string); kind == "base64" {
+					out = append(out, map[string]interface{}{"inlineData": map[string]interface{}{
+						"mimeType": src["media_type"],
+						"data":     src["data"],
+					}})
+				}
+			case "document":
+				if data, ok := documentPDF(b); ok && !opts.ExtractDocuments {
+					out = append(out, map[string]interface{}{"inlineData": map[string]interface{}{
+						"mimeType": "application/pdf",
+						"data":     data,
+					}})
+				} else {
+					out = append(out, map[string]interface{}{"text": documentText(b)})
+				}
+			case "tool_use":
+				id, _ := b["id"].(string)
+				name, _ := b["name"].(string)
+				toolNames[id] = name
+				args := b["input"]
+				if args == nil {
+					args = map[string]interface{}{}
+				}
+				out = append(out, map[string]interface{}{"functionCall": map[string]interface{}{
+					"name": name,
+					"args": args,
+				}})
+			case "tool_result":
+				id, _ := b["tool_use_id"].(string)
+				key := "result"
+				resContent := b["content"]
+				if isErr, _ := b["is_error"].(bool); isErr {
+					key = "error"
+					resContent = markToolError(resContent, opts.ToolErrorPrefix)
+				}
+				out = append(out, map[string]interface{}{"functionResponse": map[string]interface{}{
+					"name":     toolNames[id],
+					"response": map[string]interface{}{key: contentText(resContent)},
+				}})
+				// Function responses carry text only; images follow inline
+				out = append(out, geminiParts(contentImages(resContent), toolNames, opts)...)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// contentText flattens a string or list of text blocks into one string.
+func contentText(content interface{}) string {
+	switch c := content.(type) {
+	case string:
+		return c
+	case []interface{}:
+		var texts []string
+		for _, blk := range c {
+			if b, ok := blk.(map[string]interface{}); ok {
+				if s, _ := b["text"].(string); s != "" {
+					texts = append(texts, s)
+				}
+			}
+		}
+		return strings.Join(texts, "\n")
+	}
+	return ""
+}
+
+// contentImages returns the image blocks in a list of content blocks.
+func contentImages(content interface{}) []interface{} {
+	blocks, _ := content.([]interface{})
+	var images []interface{}
+	for _, blk := range blocks {
+		if b, ok := blk.(map[string]interface{}); ok && b["type"] == "image" {
+			images = append(images, b)
+		}
+	}
+	return images
+}
+
+// geminiToolConfig maps an Anthropic tool_choice to Gemini's toolConfig.
+func geminiToolConfig(choice interface{}) map[string]interface{} {
+	kind := ""
+	name := ""
+	switch c := choice.(type) {
+	case string:
+		kind = c
+	case map[string]interface{}:
+		kind, _ = c["type"].(string)
+		name, _ = c["name"].(string)
+	}
+	fc := map[string]interface{}{}
+	switch kind {
+	case "auto":
+		fc["mode"] = "AUTO"
+	case "any", "required":
+		fc["mode"] = "ANY"
+	case "tool":
+		fc["mode"] = "ANY"
+		fc["allowedFunctionNames"] = []string{name}
+	case "none":
+		fc["mode"] = "NONE"
+	default:
+		return nil
+	}
+	return map[string]interface{}{"functionCallingConfig": fc}
+}
+
+// geminiStopReason maps a Gemini finishReason to Anthropic's stop_reason.
+func geminiStopReason(reason string, sawToolUse bool) string {
+	if sawToolUse {
+		return "tool_use"
+	}
+	switch reason {
+	case "MAX_TOKENS":
+		return "max_tokens"
+	case "SAFETY", "RECITATION", "BLOCKLIST", "PROHIBITED_CONTENT", "SPII":
+		return "refusal"
+	}
+	return "end_turn"
+}
+
+// geminiFunctionCall converts a functionCall part into a tool_use block.
+func geminiFunctionCall(fc map[string]interface{}) map[string]interface{} {
+	id, _ := fc["id"].(string)
+	if id == "" {
+		id = uuid.New().String()[:12]
+	}
+	args, _ := fc["args"].(map[string]interface{})
+	if args == nil {
+		args = map[string]interface{}{}
+	}
+	return map[string]interface{}{"type": "tool_use", "id": id, "name": fc["name"], "input": args}
+}
+
+// geminiUsage extracts token counts from usageMetadata.
+func geminiUsage(res map[string]interface{}) Usage {
+	usage, _ := res["usageMetadata"].(map[string]interface{})
+	in, _ := usage["promptTokenCount"].(float64)
+	out, _ := usage["candidatesTokenCount"].(float64)
+	cached, _ := usage["cachedContentTokenCount"].(float64)
+	return Usage{InputTokens: int(in), OutputTokens: int(out), CacheReadTokens: int(cached)}
+}
+
+// ParseResponse satisfies Provider.
+func (g *Gemini) ParseResponse(res map[string]interface{}, opts Options) (*Response, error) {
+	candidates, _ := res["candidates"].([]interface{})
+	var cand map[string]interface{}
+	if len(candidates) > 0 {
+		cand, _ = candidates[0].(map[string]interface{})
+	}
+	content, _ := cand["content"].(map[string]interface{})
+	parts, _ := content["parts"].([]interface{})
+	out := &Response{}
+	var text strings.Builder
+	sawToolUse := false
+	for _, p := range parts {
+		pm, _ := p.(map[string]interface{})
+		if s, ok := pm["text"].(string); ok {
+			text.WriteString(s)
+		}
+		if fc, ok := pm["functionCall"].(map[string]interface{}); ok {
+			out.Content = append(out.Content, geminiFunctionCall(fc))
+			sawToolUse = true
+		}
+	}
+	if text.Len() > 0 || len(out.Content) == 0 {
+		if text.Len() == 0 && opts.StrictResponseParsing {
+			return nil, ErrEmptyResponse
+		}
+		textBlock := map[string]interface{}{"type": "text", "text": text.String()}
+		out.Content = append([]interface{}{textBlock}, out.Content...)
+	}
+	reason, _ := cand["finishReason"].(string)
+	out.StopReason = geminiStopReason(reason, sawToolUse)
+	out.Usage = geminiUsage(res)
+	return out, nil
+}
+
+// StreamTranslator satisfies Provider.
+func (g *Gemini) StreamTranslator(id, model string, opts Options, emit EmitFunc) StreamTranslator {
+	return &geminiStream{emit: emit, id: id, model: model}
+}
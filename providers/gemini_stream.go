@@ -0,0 +1,121 @@
+package providers
+
+import "encoding/json"
+
+// geminiStream converts streamGenerateContent responses into Anthropic SSE
+// events. Text parts become text deltas; function calls arrive whole and are
+// emitted as complete tool_use blocks.
+type geminiStream struct {
+	emit  EmitFunc
+	id    string
+	model string
+
+	nextIndex    int
+	textOpen     bool
+	textIndex    int
+	sawToolUse   bool
+	finishReason string
+	usage        Usage
+}
+
+// Start satisfies StreamTranslator.
+func (t *geminiStream) Start() error {
+	return emitMessageStart(t.emit, t.id, t.model)
+}
+
+// Chunk satisfies StreamTranslator.
+func (t *geminiStream) Chunk(chunk map[string]interface{}) error {
+	if _, ok := chunk["usageMetadata"]; ok {
+		t.usage = geminiUsage(chunk)
+	}
+	candidates, _ := chunk["candidates"].([]interface{})
+	if len(candidates) == 0 {
+		return nil
+	}
+	cand, _ := candidates[0].(map[string]interface{})
+	if reason, ok := cand["finishReason"].(string); ok {
+		t.finishReason = reason
+	}
+	content, _ := cand["content"].(map[string]interface{})
+	parts, _ := content["parts"].([]interface{})
+	for _, p := range parts {
+		pm, _ := p.(map[string]interface{})
+		if s, ok := pm["text"].(string); ok && s != "" {
+			if err := t.textDelta(s); err != nil {
+				return err
+			}
+		}
+		if fc, ok := pm["functionCall"].(map[string]interface{}); ok {
+			if err := t.toolUse(geminiFunctionCall(fc)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// textDelta forwards a text fragment, opening a text block if needed.
+func (t *geminiStream) textDelta(txt string) error {
+	if !t.textOpen {
+		t.textOpen = true
+		t.textIndex = t.nextIndex
+		t.nextIndex++
+		err := t.emit("content_block_start", map[string]interface{}{
+			"type":          "content_block_start",
+			"index":         t.textIndex,
+			"content_block": map[string]interface{}{"type": "text", "text": ""},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return t.emit("content_block_delta", map[string]interface{}{
+		"type":  "content_block_delta",
+		"index": t.textIndex,
+		"delta": map[string]interface{}{"type": "text_delta", "text": txt},
+	})
+}
+
+// closeText closes the open text block, if any.
+func (t *geminiStream) closeText() error {
+	if !t.textOpen {
+		return nil
+	}
+	t.textOpen = false
+	return t.emit("content_block_stop", map[string]interface{}{"type": "content_block_stop", "index": t.textIndex})
+}
+
+// toolUse emits a complete tool_use block.
+func (t *geminiStream) toolUse(block map[string]interface{}) error {
+	if err := t.closeText(); err != nil {
+		return err
+	}
+	t.sawToolUse = true
+	args, err := json.Marshal(block["input"])
+	if err != nil {
+		return err
+	}
+	id, _ := block["id"].(string)
+	name, _ := block["name"].(string)
+	idx := t.nextIndex
+	t.nextIndex++
+	return emitToolUseBlock(t.emit, idx, id, name, string(args))
+}
+
+// Finish satisfies StreamTranslator.
+func (t *geminiStream) Finish() error {
+	if err := t.closeText(); err != nil {
+		return err
+	}
+	return emitMessageEnd(t.emit, t.StopReason(), nil, t.usage)
+}
+
+// StopReason satisfies StreamTranslator.
+func (t *geminiStream) StopReason() string {
+	return geminiStopReason(t.finishReason, t.sawToolUse)
+}
+
+// Usage satisfies StreamTranslator.
+func (t *geminiStream) Usage() Usage {
+	return t.usage
+}
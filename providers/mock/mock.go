@@ -0,0 +1,367 @@
+// Package mock is an OpenAI-compatible chat completions server that answers
+// without a model, so the conversion pipeline can be exercised end to end
+// in tests and demos without an API key.
+//
+// Replies are canned or echo the last user message. A user message can
+// steer the next answer with directives: "[mock:tool]" calls the first
+// offered tool (or "[mock:tool=NAME]" a named one) with placeholder
+// arguments built from its schema, and "[mock:error=429]" fails with that
+// status. A tool_choice requiring a tool is honored the same way.
+package mock
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Options configures the server.
+type Options struct {
+	Reply      string        // Completion text; empty echoes the last user message
+	Latency    time.Duration // Delay before each response
+	ChunkDelay time.Duration // Delay between streamed chunks
+	ErrorRate  float64       // Fraction of requests failing with a 500
+	Models     []string      // Models listed by GET /models; "mock" if empty
+}
+
+// directive matches "[mock:tool]", "[mock:tool=NAME]" and "[mock:error=CODE]".
+var directive = regexp.MustCompile(`\[mock:(tool|error)(?:=([^\]]*))?\]`)
+
+// Server answers /chat/completions and /models under any path prefix.
+type Server struct {
+	opts Options
+	seq  atomic.Uint64
+}
+
+// New returns a server with opts.
+func New(opts Options) *Server {
+	return &Server{opts: opts}
+}
+
+// Start serves a mock with opts on a free loopback port until close is
+// called, returning the base URL to configure as an OpenAI-compatible
+// upstream.
+func Start(opts Options) (baseURL string, close func() error, err error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", nil, err
+	}
+	srv := &http.Server{Handler: New(opts)}
+	go srv.Serve(ln)
+	return "http://" + ln.Addr().String() + "/v1", srv.Close, nil
+}
+
+// ServeHTTP satisfies http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/models"):
+		s.models(w)
+	case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/chat/completions"):
+		s.complete(w, r)
+	default:
+		writeError(w, http.StatusNotFound, "unknown endpoint "+r.Method+" "+r.URL.Path)
+	}
+}
+
+func (s *Server) models(w http.ResponseWriter) {
+	names := s.opts.Models
+	if len(names) == 0 {
+		names = []string{"mock"}
+	}
+	data := make([]interface{}, len(names))
+	for i, n := range names {
+		data[i] = map[string]interface{}{"id": n, "object": "model", "owned_by": "gopenbridge-mock"}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"object": "list", "data": data})
+}
+
+// request is the part of a chat completions request the mock reads.
+type request struct {
+	Model    string    `json:"model"`
+	Messages []message `json:"messages"`
+	Tools    []struct {
+		Function struct {
+			Name       string          `json:"name"`
+			Parameters json.RawMessage `json:"parameters"`
+		} `json:"function"`
+	} `json:"tools"`
+	ToolChoice    json.RawMessage `json:"tool_choice"`
+	Stream        bool            `json:"stream"`
+	StreamOptions *struct {
+		IncludeUsage bool `json:"include_usage"`
+	} `json:"stream_options"`
+}
+
+type message struct {
+	Role    string          `json:"role"`
+	Content json.RawMessage `json:"content"`
+}
+
+// text returns the message text, from a string or text content parts.
+func (m message) text() string {
+	var s string
+	if json.Unmarshal(m.Content, &s) == nil {
+		return s
+	}
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	json.Unmarshal(m.Content, &parts)
+	var texts []string
+	for _, p := range parts {
+		if p.Type == "text" {
+			texts = append(texts, p.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// toolCall is a function call in the answer.
+type toolCall struct {
+	name, args string
+}
+
+func (s *Server) complete(w http.ResponseWriter, r *http.Request) {
+	var req request
+	body, err := io.ReadAll(r.Body)
+	if err == nil {
+		err = json.Unmarshal(body, &req)
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request: "+err.Error())
+		return
+	}
+	if s.opts.Latency > 0 {
+		select {
+		case <-time.After(s.opts.Latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	// Directives only apply to a user turn, so a tool result is answered
+	// with text rather than another call
+	var last string
+	if n := len(req.Messages); n > 0 && req.Messages[n-1].Role == "user" {
+		last = req.Messages[n-1].text()
+	}
+	var call *toolCall
+	for _, m := range directive.FindAllStringSubmatch(last, -1) {
+		switch m[1] {
+		case "error":
+			status, err := strconv.Atoi(m[2])
+			if err != nil || status < 400 || status > 599 {
+				status = http.StatusInternalServerError
+			}
+			if status == http.StatusTooManyRequests {
+				w.Header().Set("Retry-After", "1")
+			}
+			writeError(w, status, "mock error requested by [mock:error]")
+			return
+		case "tool":
+			call = req.toolCall(m[2])
+		}
+	}
+	if call == nil {
+		call = req.forcedCall()
+	}
+	if s.opts.ErrorRate > 0 && rand.Float64() < s.opts.ErrorRate {
+		writeError(w, http.StatusInternalServerError, "mock error injected by error_rate")
+		return
+	}
+	text := s.opts.Reply
+	if call != nil {
+		text = ""
+	} else if text == "" {
+		text = "Mock reply to: " + strings.TrimSpace(directive.ReplaceAllString(last, ""))
+		if last == "" {
+			text = "Mock reply."
+		}
+	}
+	id := fmt.Sprintf("chatcmpl-mock-%d", s.seq.Add(1))
+	usage := map[string]interface{}{"prompt_tokens": len(body)/4 + 1, "completion_tokens": len(text)/4 + 1}
+	if call != nil {
+		usage["completion_tokens"] = len(call.args)/4 + 1
+	}
+	usage["total_tokens"] = usage["prompt_tokens"].(int) + usage["completion_tokens"].(int)
+	if req.Stream {
+		s.stream(w, r, &req, id, text, call, usage)
+		return
+	}
+	msg := map[string]interface{}{"role": "assistant", "content": text}
+	finish := "stop"
+	if call != nil {
+		msg["content"] = nil
+		msg["tool_calls"] = []interface{}{call.json(0)}
+		finish = "tool_calls"
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"id":      id,
+		"object":  "chat.completion",
+		"created": time.Now().Unix(),
+		"model":   req.Model,
+		"choices": []interface{}{map[string]interface{}{"index": 0, "message": msg, "finish_reason": finish}},
+		"usage":   usage,
+	})
+}
+
+// stream answers with chat.completion.chunk events, the text word by word.
+func (s *Server) stream(w http.ResponseWriter, r *http.Request, req *request, id, text string, call *toolCall, usage map[string]interface{}) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	flusher, _ := w.(http.Flusher)
+	created := time.Now().Unix()
+	send := func(delta map[string]interface{}, finish interface{}) bool {
+		chunk := map[string]interface{}{
+			"id":      id,
+			"object":  "chat.completion.chunk",
+			"created": created,
+			"model":   req.Model,
+			"choices": []interface{}{map[string]interface{}{"index": 0, "delta": delta, "finish_reason": finish}},
+		}
+		if delta == nil {
+			chunk["choices"] = []interface{}{}
+			chunk["usage"] = usage
+		}
+		data, _ := json.Marshal(chunk)
+		fmt.Fprintf(w, "data: %s\n\n", data)
+		if flusher != nil {
+			flusher.Flush()
+		}
+		if s.opts.ChunkDelay > 0 {
+			select {
+			case <-time.After(s.opts.ChunkDelay):
+			case <-r.Context().Done():
+				return false
+			}
+		}
+		return r.Context().Err() == nil
+	}
+	if !send(map[string]interface{}{"role": "assistant", "content": ""}, nil) {
+		return
+	}
+	for _, word := range strings.SplitAfter(text, " ") {
+		if word != "" && !send(map[string]interface{}{"content": word}, nil) {
+			return
+		}
+	}
+	finish := "stop"
+	if call != nil {
+		if !send(map[string]interface{}{"tool_calls": []interface{}{call.json(0)}}, nil) {
+			return
+		}
+		finish = "tool_calls"
+	}
+	if !send(map[string]interface{}{}, finish) {
+		return
+	}
+	if req.StreamOptions != nil && req.StreamOptions.IncludeUsage {
+		send(nil, nil)
+	}
+	fmt.Fprint(w, "data: [DONE]\n\n")
+}
+
+// toolCall returns a call to the tool named name, or to the first tool when
+// name is empty, or nil if the request offers no such tool.
+func (req *request) toolCall(name string) *toolCall {
+	for _, t := range req.Tools {
+		if name == "" || t.Function.Name == name {
+			args, _ := json.Marshal(placeholder(t.Function.Parameters))
+			return &toolCall{name: t.Function.Name, args: string(args)}
+		}
+	}
+	return nil
+}
+
+// forcedCall returns the call tool_choice requires, if it requires one.
+func (req *request) forcedCall() *toolCall {
+	var mode string
+	if json.Unmarshal(req.ToolChoice, &mode) == nil {
+		if mode == "required" {
+			return req.toolCall("")
+		}
+		return nil
+	}
+	var choice struct {
+		Type     string `json:"type"`
+		Function struct {
+			Name string `json:"name"`
+		} `json:"function"`
+	}
+	if json.Unmarshal(req.ToolChoice, &choice) == nil && choice.Type == "function" {
+		return req.toolCall(choice.Function.Name)
+	}
+	return nil
+}
+
+// json returns the call as a tool_calls entry at index.
+func (c *toolCall) json(index int) map[string]interface{} {
+	return map[string]interface{}{
+		"index":    index,
+		"id":       fmt.Sprintf("call_mock_%d", index),
+		"type":     "function",
+		"function": map[string]interface{}{"name": c.name, "arguments": c.args},
+	}
+}
+
+// placeholder returns a value satisfying the JSON schema, filling required
+// properties (all of them if none are required) with dummy values.
+func placeholder(schema json.RawMessage) interface{} {
+	var s struct {
+		Type       interface{}                `json:"type"`
+		Enum       []interface{}              `json:"enum"`
+		Properties map[string]json.RawMessage `json:"properties"`
+		Required   []string                   `json:"required"`
+		Items      json.RawMessage            `json:"items"`
+	}
+	json.Unmarshal(schema, &s)
+	if len(s.Enum) > 0 {
+		return s.Enum[0]
+	}
+	typ, _ := s.Type.(string)
+	if types, ok := s.Type.([]interface{}); ok && len(types) > 0 {
+		typ, _ = types[0].(string)
+	}
+	switch typ {
+	case "string":
+		return "mock"
+	case "integer", "number":
+		return 1
+	case "boolean":
+		return true
+	case "array":
+		return []interface{}{}
+	}
+	obj := map[string]interface{}{}
+	names := s.Required
+	if len(names) == 0 {
+		for n := range s.Properties {
+			names = append(names, n)
+		}
+	}
+	for _, n := range names {
+		obj[n] = placeholder(s.Properties[n])
+	}
+	return obj
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes an OpenAI error object.
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]interface{}{
+		"error": map[string]interface{}{"message": msg, "type": "mock_error", "code": status},
+	})
+}
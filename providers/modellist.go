@@ -0,0 +1,109 @@
+package providers
+
+import "strings"
+
+// ModelLister is implemented by providers whose upstream can list the
+// models it serves.
+type ModelLister interface {
+	// ModelsEndpoints returns the URLs to GET for the upstream's models.
+	ModelsEndpoints(up Upstream) []string
+	// ParseModels extracts model IDs from one decoded list response.
+	ParseModels(res map[string]interface{}) []string
+}
+
+// Lister returns p's ModelLister, looking through tool emulation.
+func Lister(p Provider) (ModelLister, bool) {
+	l, ok := unwrap(p).(ModelLister)
+	return l, ok
+}
+
+// listIDs collects the string field key of each object in list.
+func listIDs(list interface{}, key string) []string {
+	items, _ := list.([]interface{})
+	var res []string
+	for _, item := range items {
+		m, _ := item.(map[string]interface{})
+		if id, _ := m[key].(string); id != "" {
+			res = append(res, id)
+		}
+	}
+	return res
+}
+
+// ModelsEndpoints satisfies ModelLister.
+func (o *OpenAI) ModelsEndpoints(up Upstream) []string {
+	return []string{strings.TrimRight(up.BaseURL, "/") + "/models"}
+}
+
+// ParseModels satisfies ModelLister.
+func (o *OpenAI) ParseModels(res map[string]interface{}) []string {
+	return listIDs(res["data"], "id")
+}
+
+// ModelsEndpoints satisfies ModelLister. Azure lists base models rather
+// than the deployments requests are sent to, so it is not queried.
+func (a *Azure) ModelsEndpoints(up Upstream) []string {
+	return nil
+}
+
+// ModelsEndpoints satisfies ModelLister.
+func (g *Gemini) ModelsEndpoints(up Upstream) []string {
+	base := strings.TrimSuffix(strings.TrimRight(up.BaseURL, "/"), "/openai")
+	if !strings.Contains(base, "googleapis.com") {
+		base = defaultGeminiBaseURL
+	}
+	return []string{base + "/models?pageSize=1000"}
+}
+
+// ParseModels satisfies ModelLister.
+func (g *Gemini) ParseModels(res map[string]interface{}) []string {
+	ids := listIDs(res["models"], "name")
+	for i, id := range ids {
+		ids[i] = strings.TrimPrefix(id, "models/")
+	}
+	return ids
+}
+
+// ModelsEndpoints satisfies ModelLister. Inference profiles are listed as
+// well, since their IDs are used in place of model IDs.
+func (b *Bedrock) ModelsEndpoints(up Upstream) []string {
+	base := "https://bedrock." + b.region(up) + ".amazonaws.com"
+	return []string{base + "/foundation-models", base + "/inference-profiles?maxResults=1000"}
+}
+
+// ParseModels satisfies ModelLister.
+func (b *Bedrock) ParseModels(res map[string]interface{}) []string {
+	return append(listIDs(res["modelSummaries"], "modelId"), listIDs(res["inferenceProfileSummaries"], "inferenceProfileId")...)
+}
+
+// ModelsEndpoints satisfies ModelLister.
+func (o *Ollama) ModelsEndpoints(up Upstream) []string {
+	base := strings.TrimRight(up.BaseURL, "/")
+	base = strings.TrimSuffix(base, "/v1")
+	base = strings.TrimSuffix(base, "/api")
+	return []string{base + "/api/tags"}
+}
+
+// ParseModels satisfies ModelLister. Models tagged latest are also listed
+// without the tag, the way Ollama resolves them.
+func (o *Ollama) ParseModels(res map[string]interface{}) []string {
+	var ids []string
+	for _, id := range listIDs(res["models"], "name") {
+		ids = append(ids, id)
+		if name, ok := strings.CutSuffix(id, ":latest"); ok {
+			ids = append(ids, name)
+		}
+	}
+	return ids
+}
+
+// ModelsEndpoints satisfies ModelLister.
+func (a *Anthropic) ModelsEndpoints(up Upstream) []string {
+	base := strings.TrimSuffix(strings.TrimRight(up.BaseURL, "/"), "/v1")
+	return []string{base + "/v1/models?limit=1000"}
+}
+
+// ParseModels satisfies ModelLister.
+func (a *Anthropic) ParseModels(res map[string]interface{}) []string {
+	return listIDs(res["data"], "id")
+}
@@ -0,0 +1,276 @@
+package providers
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"gopenbridge/models"
+)
+
+// Ollama implements Provider for Ollama's native /api/chat endpoint, which
+// exposes keep_alive and model options the OpenAI shim does not.
+type Ollama struct{}
+
+func init() {
+	Register(&Ollama{}, ":11434")
+}
+
+// Name satisfies Provider.
+func (o *Ollama) Name() string {
+	return "ollama"
+}
+
+// Endpoint satisfies Provider. Base URLs pointing at the OpenAI shim (/v1) or
+// the native API root (/api) are both accepted.
+func (o *Ollama) Endpoint(up Upstream, model string, stream bool) string {
+	base := strings.TrimRight(up.BaseURL, "/")
+	base = strings.TrimSuffix(base, "/v1")
+	base = strings.TrimSuffix(base, "/api")
+	return base + "/api/chat"
+}
+
+// Authorize satisfies Provider. Ollama itself is unauthenticated, but a key is
+// sent when configured for instances behind an authenticating proxy.
+func (o *Ollama) Authorize(req *http.Request, up Upstream) error {
+	if up.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+up.APIKey)
+	}
+	return nil
+}
+
+// BuildPayload satisfies Provider.
+func (o *Ollama) BuildPayload(req *models.MessagesRequest, opts Options) (map[string]interface{}, error) {
+	// Tool messages are matched by function name, which Anthropic
+	// tool_result blocks only reference by tool_use id
+	toolNames := make(map[string]string)
+	var msgs []interface{}
+	if sys := contentText(req.System); sys != "" {
+		msgs = append(msgs, map[string]interface{}{"role": "system", "content": sys})
+	}
+	for _, msg := range req.Messages {
+		msgs = append(msgs, ollamaMessages(msg, toolNames, opts.ToolErrorPrefix)...)
+	}
+	if len(msgs) == 0 {
+		return nil, errors.New("messages: at least one message with content is required")
+	}
+	options := map[string]interface{}{"num_predict": opts.MaxTokens}
+	if req.Temperature != nil {
+		options["temperature"] = *req.Temperature
+	}
+	if req.TopP != nil {
+		options["top_p"] = *req.TopP
+	}
+	if req.TopK != nil {
+		options["top_k"] = *req.TopK
+	}
+	if len(req.StopSequences) > 0 {
+		options["stop"] = req.StopSequences
+	}
+	if opts.NumCtx > 0 {
+		options["num_ctx"] = opts.NumCtx
+	}
+	payload := map[string]interface{}{
+		"model":    req.Model,
+		"messages": msgs,
+		"options":  options,
+		// Ollama streams unless told otherwise; streamRequest overrides this
+		"stream": false,
+	}
+	if opts.KeepAlive != "" {
+		payload["keep_alive"] = opts.KeepAlive
+	}
+	if len(req.Tools) > 0 {
+		var tools []interface{}
+		profile := schemaProfile(opts, "none")
+		for _, t := range req.Tools {
+			tools = append(tools, map[string]interface{}{
+				"type": "function",
+				"function": map[string]interface{}{
+					"name":        t.Name,
+					"description": t.Description,
+					"parameters":  profile.Clean(t.InputSchema),
+				},
+			})
+		}
+		payload["tools"] = tools
+	}
+	return payload, nil
+}
+
+// ollamaMessages converts one Anthropic message into Ollama chat messages.
+// Tool results become separate tool-role messages; images are attached as
+// base64 strings.
+func ollamaMessages(msg models.Message, toolNames map[string]string, toolErrorPrefix string) []interface{} {
+	blocks, ok := msg.Content.([]interface{})
+	if !ok {
+		if s, _ := msg.Content.(string); s != "" {
+			return []interface{}{map[string]interface{}{"role": msg.Role, "content": s}}
+		}
+		return nil
+	}
+	var texts []string
+	var images []interface{}
+	var toolCalls []interface{}
+	var results []interface{}
+	for _, blk := range blocks {
+		b, ok := blk.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		switch t, _ := b["type"].(string); t {
+		case "text":
+			if s, _ := b["text"].(string); s != "" {
+				texts = append(texts, s)
+			}
+		case "image":
+			src, _ := b["source"].(map[string]interface{})
+			if kind, _ := src["type"].(string); kind == "base64" {
+				images = append(images, src["data"])
+			}
+		case "document":
+			// Ollama has no file inputs, so documents are always inlined
+			texts = append(texts, documentText(b))
+		case "tool_use":
+			id, _ := b["id"].(string)
+			name, _ := b["name"].(string)
+			toolNames[id] = name
+			args := b["input"]
+			if args == nil {
+				args = map[string]interface{}{}
+			}
+			toolCalls = append(toolCalls, map[string]interface{}{
+				"function": map[string]interface{}{"name": name, "arguments": args},
+			})
+		case "tool_result":
+			id, _ := b["tool_use_id"].(string)
+			resContent := b["content"]
+			if isErr, _ := b["is_error"].(bool); isErr {
+				resContent = markToolError(resContent, toolErrorPrefix)
+			}
+			result := map[string]interface{}{
+				"role":      "tool",
+				"content":   contentText(resContent),
+				"tool_name": toolNames[id],
+			}
+			var resImages []interface{}
+			for _, img := range contentImages(resContent) {
+				src, _ := img.(map[string]interface{})["source"].(map[string]interface{})
+				if kind, _ := src["type"].(string); kind == "base64" {
+					resImages = append(resImages, src["data"])
+				}
+			}
+			if len(resImages) > 0 {
+				result["images"] = resImages
+			}
+			results = append(results, result)
+		}
+	}
+	// Tool results answer the previous assistant turn, so they come first
+	out := results
+	if len(texts) > 0 || len(images) > 0 || len(toolCalls) > 0 {
+		entry := map[string]interface{}{"role": msg.Role, "content": strings.Join(texts, "\n")}
+		if len(images) > 0 {
+			entry["images"] = images
+		}
+		if len(toolCalls) > 0 {
+			entry["tool_calls"] = toolCalls
+		}
+		out = append(out, entry)
+	}
+	return out
+}
+
+// ollamaToolCall converts an Ollama tool call, whose arguments are already
+// an object, into a tool_use block.
+func ollamaToolCall(tc map[string]interface{}) map[string]interface{} {
+	fn, _ := tc["function"].(map[string]interface{})
+	args, _ := fn["arguments"].(map[string]interface{})
+	if args == nil {
+		args = map[string]interface{}{}
+	}
+	id, _ := tc["id"].(string)
+	if id == "" {
+		id = uuid.New().String()[:12]
+	}
+	return map[string]interface{}{"type": "tool_use", "id": id, "name": fn["name"], "input": args}
+}
+
+// ollamaStopReason maps done_reason to Anthropic's stop_reason.
+func ollamaStopReason(reason string, sawToolUse bool) string {
+	if sawToolUse {
+		return "tool_use"
+	}
+	if reason == "length" {
+		return "max_tokens"
+	}
+	return "end_turn"
+}
+
+// ollamaUsage extracts token counts from a final response.
+func ollamaUsage(res map[string]interface{}) Usage {
+	in, _ := res["prompt_eval_count"].(float64)
+	out, _ := res["eval_count"].(float64)
+	return Usage{InputTokens: int(in), OutputTokens: int(out)}
+}
+
+// ParseResponse satisfies Provider.
+func (o *Ollama) ParseResponse(res map[string]interface{}, opts Options) (*Response, error) {
+	message, _ := res["message"].(map[string]interface{})
+	out := &Response{}
+	if thinking, _ := message["thinking"].(string); thinking != "" && opts.ReasoningAsThinking {
+		out.Content = append(out.Content, map[string]interface{}{"type": "thinking", "thinking": thinking, "signature": ""})
+	}
+	txt, _ := message["content"].(string)
+	toolCalls, _ := message["tool_calls"].([]interface{})
+	if txt != "" || len(toolCalls) == 0 {
+		if txt == "" && opts.StrictResponseParsing {
+			return nil, ErrEmptyResponse
+		}
+		out.Content = append(out.Content, map[string]interface{}{"type": "text", "text": txt})
+	}
+	for _, tc := range toolCalls {
+		tcMap, _ := tc.(map[string]interface{})
+		out.Content = append(out.Content, ollamaToolCall(tcMap))
+	}
+	reason, _ := res["done_reason"].(string)
+	out.StopReason = ollamaStopReason(reason, len(toolCalls) > 0)
+	out.Usage = ollamaUsage(res)
+	return out, nil
+}
+
+// StreamTranslator satisfies Provider.
+func (o *Ollama) StreamTranslator(id, model string, opts Options, emit EmitFunc) StreamTranslator {
+	return &ollamaStream{emit: emit, id: id, model: model, thinking: opts.ReasoningAsThinking}
+}
+
+// DecodeStream satisfies StreamDecoder; Ollama streams newline-delimited JSON.
+func (o *Ollama) DecodeStream(r io.Reader) ChunkReader {
+	return &ndjsonReader{r: bufio.NewReader(r)}
+}
+
+// ndjsonReader decodes one JSON object per line.
+type ndjsonReader struct {
+	r *bufio.Reader
+}
+
+// Next satisfies ChunkReader.
+func (n *ndjsonReader) Next() (map[string]interface{}, []byte, error) {
+	for {
+		line, err := n.r.ReadBytes('\n')
+		if trimmed := strings.TrimSpace(string(line)); trimmed != "" {
+			var chunk map[string]interface{}
+			if json.Unmarshal([]byte(trimmed), &chunk) != nil {
+				chunk = nil
+			}
+			return chunk, []byte(trimmed), nil
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package providers
+
+import "encoding/json"
+
+// ollamaStream converts /api/chat stream lines into Anthropic SSE events.
+// Ollama delivers tool calls whole, so they are emitted as complete tool_use
+// blocks.
+type ollamaStream struct {
+	emit  EmitFunc
+	id    string
+	model string
+
+	nextIndex  int
+	textOpen   bool
+	textIndex  int
+	textKind   string // "text" or "thinking"
+	thinking   bool   // translate thinking fragments into thinking blocks
+	sawToolUse bool
+	doneReason string
+	usage      Usage
+}
+
+// Start satisfies StreamTranslator.
+func (t *ollamaStream) Start() error {
+	return emitMessageStart(t.emit, t.id, t.model)
+}
+
+// Chunk satisfies StreamTranslator.
+func (t *ollamaStream) Chunk(chunk map[string]interface{}) error {
+	message, _ := chunk["message"].(map[string]interface{})
+	if s, _ := message["thinking"].(string); s != "" && t.thinking {
+		if err := t.textDelta("thinking", s); err != nil {
+			return err
+		}
+	}
+	if s, _ := message["content"].(string); s != "" {
+		if err := t.textDelta("text", s); err != nil {
+			return err
+		}
+	}
+	toolCalls, _ := message["tool_calls"].([]interface{})
+	for _, tc := range toolCalls {
+		tcMap, _ := tc.(map[string]interface{})
+		if err := t.toolUse(ollamaToolCall(tcMap)); err != nil {
+			return err
+		}
+	}
+	if done, _ := chunk["done"].(bool); done {
+		t.doneReason, _ = chunk["done_reason"].(string)
+		t.usage = ollamaUsage(chunk)
+	}
+	return nil
+}
+
+// textDelta forwards a text or thinking fragment, opening a block of that
+// kind if needed.
+func (t *ollamaStream) textDelta(kind, txt string) error {
+	if t.textOpen && t.textKind != kind {
+		if err := t.closeText(); err != nil {
+			return err
+		}
+	}
+	if !t.textOpen {
+		t.textOpen = true
+		t.textIndex = t.nextIndex
+		t.textKind = kind
+		t.nextIndex++
+		err := t.emit("content_block_start", map[string]interface{}{
+			"type":          "content_block_start",
+			"index":         t.textIndex,
+			"content_block": emptyBlock(kind),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return t.emit("content_block_delta", map[string]interface{}{
+		"type":  "content_block_delta",
+		"index": t.textIndex,
+		"delta": blockDelta(kind, txt),
+	})
+}
+
+// closeText closes the open text or thinking block, if any.
+func (t *ollamaStream) closeText() error {
+	if !t.textOpen {
+		return nil
+	}
+	t.textOpen = false
+	return t.emit("content_block_stop", map[string]interface{}{"type": "content_block_stop", "index": t.textIndex})
+}
+
+// toolUse emits a complete tool_use block.
+func (t *ollamaStream) toolUse(block map[string]interface{}) error {
+	if err := t.closeText(); err != nil {
+		return err
+	}
+	t.sawToolUse = true
+	args, err := json.Marshal(block["input"])
+	if err != nil {
+		return err
+	}
+	id, _ := block["id"].(string)
+	name, _ := block["name"].(string)
+	idx := t.nextIndex
+	t.nextIndex++
+	return emitToolUseBlock(t.emit, idx, id, name, string(args))
+}
+
+// Finish satisfies StreamTranslator.
+func (t *ollamaStream) Finish() error {
+	if err := t.closeText(); err != nil {
+		return err
+	}
+	return emitMessageEnd(t.emit, t.StopReason(), nil, t.usage)
+}
+
+// StopReason satisfies StreamTranslator.
+func (t *ollamaStream) StopReason() string {
+	return ollamaStopReason(t.doneReason, t.sawToolUse)
+}
+
+// Usage satisfies StreamTranslator.
+func (t *ollamaStream) Usage() Usage {
+	return t.usage
+}
@@ -0,0 +1,590 @@
+package providers
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"gopenbridge/models"
+)
+
+// openAICompatibleName is the fallback provider for unrecognized base URLs.
+const openAICompatibleName = "openai-compatible"
+
+// ErrEmptyResponse is returned by ParseResponse in strict mode when an
+// upstream response has no recognizable content or tool call.
+var ErrEmptyResponse = errors.New("upstream response contained no content or tool call")
+
+// OpenAI implements Provider for OpenAI chat completions and the many
+// providers that mirror its API. The fields describe each flavor's quirks.
+type OpenAI struct {
+	ProviderName    string
+	LegacyFunctions bool   // send tools as the deprecated functions/function_call fields
+	PromptCaching   bool   // understands cache_control on content parts
+	TopKKey         string // payload key carrying top_k; empty if unsupported
+	FileInputs      bool   // accepts PDFs as file content parts
+	SchemaProfile   string // default tool schema cleanup profile, see SchemaProfile
+	StrictTools     bool   // accepts strict: true function definitions
+	// ThinkingParam says how a thinking budget is sent: "effort" as
+	// reasoning_effort to reasoning models, "max_tokens" in a reasoning
+	// object, "thinking" as is. Empty drops it.
+	ThinkingParam string
+}
+
+func init() {
+	Register(&OpenAI{ProviderName: "openai", FileInputs: true, StrictTools: true, ThinkingParam: "effort"}, "api.openai.com")
+	Register(&OpenAI{ProviderName: "groq", LegacyFunctions: true, SchemaProfile: "basic"}, "groq.com")
+	Register(&OpenAI{ProviderName: "openrouter", PromptCaching: true, TopKKey: "top_k", FileInputs: true, StrictTools: true, ThinkingParam: "max_tokens"}, "openrouter.ai")
+	Register(&OpenAI{ProviderName: "fireworks", TopKKey: "top_k"}, "fireworks.ai")
+	Register(&OpenAI{ProviderName: "huggingface", SchemaProfile: "basic"}, "huggingface.co")
+	Register(&OpenAI{ProviderName: "anthropic", PromptCaching: true, TopKKey: "top_k", ThinkingParam: "thinking"}, "anthropic.com")
+	Register(&OpenAI{ProviderName: "together", TopKKey: "top_k"}, "together.xyz", "together.ai")
+	// Unknown servers may reject top_k like OpenAI does, so it is dropped;
+	// vLLM or llama.cpp users can set it with extra_body instead
+	Register(&OpenAI{ProviderName: openAICompatibleName})
+}
+
+// Name satisfies Provider.
+func (o *OpenAI) Name() string {
+	return o.ProviderName
+}
+
+// Endpoint satisfies Provider.
+func (o *OpenAI) Endpoint(up Upstream, model string, stream bool) string {
+	return strings.TrimRight(up.BaseURL, "/") + "/chat/completions"
+}
+
+// Authorize satisfies Provider.
+func (o *OpenAI) Authorize(req *http.Request, up Upstream) error {
+	req.Header.Set("Authorization", "Bearer "+up.APIKey)
+	return nil
+}
+
+// BuildPayload satisfies Provider.
+func (o *OpenAI) BuildPayload(req *models.MessagesRequest, opts Options) (map[string]interface{}, error) {
+	// Convert messages and tools
+	if !o.FileInputs {
+		opts.ExtractDocuments = true
+	}
+	opts.PromptCaching = o.PromptCaching
+	msgs := convertMessages(req.Messages, opts)
+	reasoning := opts.ReasoningModel || reasoningModel(req.Model)
+	if sys := convertSystem(req.System, o.PromptCaching, systemRole(reasoning)); sys != nil {
+		msgs = append([]map[string]interface{}{sys}, msgs...)
+	}
+	var toolsOrFuncs []map[string]interface{}
+	if len(req.Tools) > 0 {
+		toolsOrFuncs = o.convertTools(req.Tools, schemaProfile(opts, o.SchemaProfile), o.strict(opts))
+	}
+	// Build payload
+	payload := map[string]interface{}{
+		"model":    req.Model,
+		"messages": msgs,
+	}
+	if reasoning {
+		// Reasoning models count hidden reasoning against the limit and
+		// reject sampling parameters and stop sequences
+		payload["max_completion_tokens"] = opts.MaxTokens
+		if req.Temperature != nil || req.TopP != nil || len(req.StopSequences) > 0 {
+			slog.Debug("Dropping sampling parameters unsupported by reasoning model", "model", req.Model)
+		}
+	} else {
+		payload["temperature"] = req.Temperature
+		payload["max_tokens"] = opts.MaxTokens
+		if req.TopP != nil {
+			payload["top_p"] = *req.TopP
+		}
+		if len(req.StopSequences) > 0 {
+			payload["stop"] = req.StopSequences
+		}
+	}
+	if req.Metadata != nil && req.Metadata.UserID != "" {
+		payload["user"] = req.Metadata.UserID
+	}
+	// top_k is not part of the OpenAI API; only forward it where supported
+	if req.TopK != nil && !reasoning {
+		if o.TopKKey != "" {
+			payload[o.TopKKey] = *req.TopK
+		} else {
+			slog.Debug("Dropping top_k, unsupported by provider", "provider", o.ProviderName)
+		}
+	}
+	if budget, ok := thinkingBudget(req); ok {
+		o.addThinking(payload, req, budget, reasoning)
+	}
+	// Add tools/functions based on provider
+	if len(toolsOrFuncs) > 0 {
+		choice, parallel := openAIToolChoice(req.ToolChoice, o.LegacyFunctions)
+		if o.LegacyFunctions {
+			payload["functions"] = toolsOrFuncs
+			payload["function_call"] = choice
+			slog.Debug("Using legacy functions format", "provider", o.ProviderName)
+		} else {
+			payload["tools"] = toolsOrFuncs
+			payload["tool_choice"] = choice
+			if !parallel {
+				payload["parallel_tool_calls"] = false
+			}
+			slog.Debug("Using standard tools format", "provider", o.ProviderName)
+		}
+	}
+	return payload, nil
+}
+
+// addThinking sends a thinking budget in the form the provider takes, or
+// drops it when the provider or model has no equivalent. reasoning says
+// whether the model is a reasoning model.
+func (o *OpenAI) addThinking(payload map[string]interface{}, req *models.MessagesRequest, budget int, reasoning bool) {
+	switch {
+	case o.ThinkingParam == "effort" && reasoning:
+		payload["reasoning_effort"] = reasoningEffort(budget)
+	case o.ThinkingParam == "max_tokens":
+		payload["reasoning"] = map[string]interface{}{"max_tokens": budget}
+	case o.ThinkingParam == "thinking":
+		payload["thinking"] = req.Thinking
+	default:
+		slog.Debug("Dropping thinking, unsupported by provider or model", "provider", o.ProviderName, "model", req.Model)
+	}
+}
+
+// ParseResponse satisfies Provider.
+func (o *OpenAI) ParseResponse(ocRes map[string]interface{}, opts Options) (*Response, error) {
+	// Extract choice
+	choices, _ := ocRes["choices"].([]interface{})
+	var choice, message map[string]interface{}
+	if len(choices) > 0 {
+		choice, _ = choices[0].(map[string]interface{})
+		message, _ = choice["message"].(map[string]interface{})
+	}
+	finish, _ := choice["finish_reason"].(string)
+	res := &Response{StopReason: openAIStopReason(finish)}
+
+	// Detect tool invocation (try multiple formats)
+	// 1. Modern tools format: tool_calls array (OpenRouter, OpenAI with tools)
+	if toolCalls, ok := message["tool_calls"].([]interface{}); ok && len(toolCalls) > 0 {
+		slog.Debug("Detected tool_calls format (OpenRouter/OpenAI tools)")
+		for _, tc := range toolCalls {
+			tcMap, _ := tc.(map[string]interface{})
+			funcData, _ := tcMap["function"].(map[string]interface{})
+
+			toolID, _ := tcMap["id"].(string)
+			if toolID == "" {
+				toolID = uuid.New().String()[:12]
+			}
+
+			s, _ := funcData["arguments"].(string)
+			args := res.toolArgs(toolID, s, opts.RepairToolArgs)
+			if o.strict(opts) {
+				dropNulls(args)
+			}
+
+			res.Content = append(res.Content, map[string]interface{}{
+				"type":  "tool_use",
+				"id":    toolID,
+				"name":  funcData["name"],
+				"input": args,
+			})
+		}
+		if res.StopReason != "max_tokens" {
+			res.StopReason = "tool_use"
+		}
+	} else {
+		// 2. Legacy formats: function_call or tool (Groq, older OpenAI)
+		var fc map[string]interface{}
+		if raw, ok := message["function_call"].(map[string]interface{}); ok {
+			slog.Debug("Detected function_call format (Groq/legacy)")
+			fc = raw
+		} else if raw, ok := message["tool"].(map[string]interface{}); ok {
+			slog.Debug("Detected tool format")
+			fc = raw
+		}
+
+		if fc != nil {
+			// Single function/tool call
+			toolID := uuid.New().String()[:12]
+			s, _ := fc["arguments"].(string)
+			args := res.toolArgs(toolID, s, opts.RepairToolArgs)
+			res.Content = append(res.Content, map[string]interface{}{
+				"type":  "tool_use",
+				"id":    toolID,
+				"name":  fc["name"],
+				"input": args,
+			})
+			if res.StopReason != "max_tokens" {
+				res.StopReason = "tool_use"
+			}
+		} else {
+			// No tool calls - just text
+			txt, _ := message["content"].(string)
+			if txt == "" && res.StopReason == "end_turn" && opts.StrictResponseParsing {
+				return nil, ErrEmptyResponse
+			}
+			res.Content = append(res.Content, map[string]interface{}{
+				"type": "text",
+				"text": txt,
+			})
+		}
+	}
+	if txt := openAIReasoning(message); txt != "" && opts.ReasoningAsThinking {
+		thinking := map[string]interface{}{"type": "thinking", "thinking": txt, "signature": ""}
+		res.Content = append([]interface{}{thinking}, res.Content...)
+	}
+	if seq, ok := openAIStopSequence(choice, opts.StopSequences); ok && res.StopReason == "end_turn" {
+		res.StopReason, res.StopSequence = "stop_sequence", seq
+	}
+	usage, _ := ocRes["usage"].(map[string]interface{})
+	res.Usage = openAIUsage(usage)
+	return res, nil
+}
+
+// strict reports whether tools are sent as strict function definitions.
+// Legacy functions have no strict flag.
+func (o *OpenAI) strict(opts Options) bool {
+	return opts.StrictTools && o.StrictTools && !o.LegacyFunctions
+}
+
+// openAIToolChoice maps an Anthropic tool_choice to OpenAI's tool_choice,
+// or function_call when legacy is set, and reports whether parallel tool
+// calls stay allowed. Legacy function calling cannot force "any" tool, so
+// that falls back to "auto".
+func openAIToolChoice(choice interface{}, legacy bool) (interface{}, bool) {
+	kind, name := "auto", ""
+	parallel := true
+	switch c := choice.(type) {
+	case string:
+		kind = c
+	case map[string]interface{}:
+		if t, _ := c["type"].(string); t != "" {
+			kind = t
+		}
+		name, _ = c["name"].(string)
+		if fn, ok := c["function"].(map[string]interface{}); ok && name == "" {
+			name, _ = fn["name"].(string) // already in OpenAI form
+		}
+		if disable, _ := c["disable_parallel_tool_use"].(bool); disable {
+			parallel = false
+		}
+	}
+	switch kind {
+	case "any", "required":
+		if legacy {
+			return "auto", parallel
+		}
+		return "required", parallel
+	case "tool", "function":
+		if name == "" {
+			break
+		}
+		if legacy {
+			return map[string]interface{}{"name": name}, parallel
+		}
+		return map[string]interface{}{"type": "function", "function": map[string]interface{}{"name": name}}, parallel
+	case "none":
+		return "none", parallel
+	}
+	return "auto", parallel
+}
+
+// openAIStopReason maps an OpenAI finish_reason to Anthropic's stop_reason.
+// Tool calls are detected from the message itself, since some providers
+// finish them with a plain "stop"; a call cut off by the token limit still
+// reports max_tokens so clients know its input is incomplete.
+func openAIStopReason(finish string) string {
+	switch finish {
+	case "length":
+		return "max_tokens"
+	case "content_filter":
+		return "refusal"
+	}
+	return "end_turn"
+}
+
+// openAIReasoning returns the reasoning text of a message or stream delta:
+// reasoning_content from DeepSeek and vLLM, or reasoning from OpenRouter
+// and Groq.
+func openAIReasoning(m map[string]interface{}) string {
+	if s, _ := m["reasoning_content"].(string); s != "" {
+		return s
+	}
+	s, _ := m["reasoning"].(string)
+	return s
+}
+
+// StreamTranslator satisfies Provider.
+func (o *OpenAI) StreamTranslator(id, model string, opts Options, emit EmitFunc) StreamTranslator {
+	t := newOpenAIStream(id, model, emit)
+	t.stopSeqs = opts.StopSequences
+	t.thinking = opts.ReasoningAsThinking
+	switch {
+	case o.strict(opts) && opts.RepairToolArgs:
+		t.rewriteArgs = func(args string) string { return dropNullArgs(repairArgs(args)) }
+	case o.strict(opts):
+		t.rewriteArgs = dropNullArgs
+	case opts.RepairToolArgs:
+		t.rewriteArgs = repairArgs
+	}
+	return t
+}
+
+// convertMessages maps Anthropic payload to OpenAI messages. Tool results
+// flagged with is_error get opts.ToolErrorPrefix prepended to their content.
+// Images become image_url parts; since tool messages only carry text, images
+// returned by tools follow the tool messages in a user message. PDF
+// documents become file parts unless opts.ExtractDocuments is set; other
+// documents are inlined as text. With opts.PromptCaching, text blocks
+// carrying cache_control end a text part that keeps the marker.
+func convertMessages(msgs []models.Message, opts Options) []map[string]interface{} {
+	var out []map[string]interface{}
+	for _, msg := range msgs {
+		switch c := msg.Content.(type) {
+		case string:
+			out = append(out, map[string]interface{}{"role": msg.Role, "content": c})
+		case []interface{}:
+			// collect text and tool_calls
+			textAcc := ""
+			var tcalls []map[string]interface{}
+			var toolsRes []map[string]interface{}
+			var parts []interface{}      // image and file parts
+			var toolImages []interface{} // image parts from tool results
+			for _, blk := range c {
+				b, ok := blk.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				t, _ := b["type"].(string)
+				switch t {
+				case "text":
+					s, _ := b["text"].(string)
+					if cc, ok := b["cache_control"]; ok && cc != nil && opts.PromptCaching {
+						// Close a text part at the cache boundary
+						parts = append(parts, map[string]interface{}{"type": "text", "text": textAcc + s, "cache_control": cc})
+						textAcc = ""
+						continue
+					}
+					textAcc += s
+				case "document":
+					if data, ok := documentPDF(b); ok && !opts.ExtractDocuments {
+						parts = append(parts, map[string]interface{}{
+							"type": "file",
+							"file": map[string]interface{}{
+								"filename":  documentTitle(b) + ".pdf",
+								"file_data": "data:application/pdf;base64," + data,
+							},
+						})
+						continue
+					}
+					if textAcc != "" && !strings.HasSuffix(textAcc, "\n") {
+						textAcc += "\n\n"
+					}
+					textAcc += documentText(b) + "\n\n"
+				case "image":
+					if img := openAIImagePart(b); img != nil {
+						parts = append(parts, img)
+					}
+				case "tool_use":
+					id, _ := b["id"].(string)
+					name, _ := b["name"].(string)
+					input := b["input"]
+					args, _ := json.Marshal(input)
+					tcalls = append(tcalls, map[string]interface{}{ // function call spec
+						"id":   id,
+						"type": "function",
+						"function": map[string]interface{}{
+							"name":      name,
+							"arguments": string(args),
+						},
+					})
+				case "tool_result":
+					resContent := b["content"]
+					if isErr, _ := b["is_error"].(bool); isErr {
+						resContent = markToolError(resContent, opts.ToolErrorPrefix)
+					}
+					text, images := toolResultContent(resContent)
+					toolsRes = append(toolsRes, map[string]interface{}{ // tool response
+						"role":         "tool",
+						"content":      text,
+						"tool_call_id": b["tool_use_id"],
+					})
+					if len(images) > 0 {
+						id, _ := b["tool_use_id"].(string)
+						toolImages = append(toolImages, map[string]interface{}{"type": "text", "text": "Images returned by tool call " + id + ":"})
+						toolImages = append(toolImages, images...)
+					}
+				}
+			}
+			// Tool messages must directly follow the assistant's tool calls
+			out = append(out, toolsRes...)
+			if len(toolImages) > 0 {
+				out = append(out, map[string]interface{}{"role": "user", "content": toolImages})
+			}
+			if textAcc != "" || len(tcalls) > 0 || len(parts) > 0 {
+				entry := map[string]interface{}{"role": msg.Role, "content": textAcc}
+				if len(parts) > 0 {
+					if textAcc != "" {
+						parts = append(parts, map[string]interface{}{"type": "text", "text": textAcc})
+					}
+					entry["content"] = parts
+				}
+				if len(tcalls) > 0 {
+					entry["tool_calls"] = tcalls
+				}
+				out = append(out, entry)
+			}
+		}
+	}
+	return out
+}
+
+// openAIImagePart converts an Anthropic image block into an image_url
+// part, or returns nil for an unknown source.
+func openAIImagePart(b map[string]interface{}) map[string]interface{} {
+	src, _ := b["source"].(map[string]interface{})
+	var url string
+	switch kind, _ := src["type"].(string); kind {
+	case "base64":
+		mediaType, _ := src["media_type"].(string)
+		data, _ := src["data"].(string)
+		url = "data:" + mediaType + ";base64," + data
+	case "url":
+		url, _ = src["url"].(string)
+	}
+	if url == "" {
+		return nil
+	}
+	return map[string]interface{}{"type": "image_url", "image_url": map[string]interface{}{"url": url}}
+}
+
+// toolResultContent splits tool_result content into the text of a tool
+// message and image parts, which tool messages cannot hold. Documents are
+// inlined as text.
+func toolResultContent(content interface{}) (string, []interface{}) {
+	blocks, ok := content.([]interface{})
+	if !ok {
+		return contentText(content), nil
+	}
+	var texts []string
+	var images []interface{}
+	for _, blk := range blocks {
+		b, ok := blk.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		switch t, _ := b["type"].(string); t {
+		case "text":
+			if s, _ := b["text"].(string); s != "" {
+				texts = append(texts, s)
+			}
+		case "image":
+			if img := openAIImagePart(b); img != nil {
+				images = append(images, img)
+			}
+		case "document":
+			texts = append(texts, documentText(b))
+		}
+	}
+	return strings.Join(texts, "\n"), images
+}
+
+// markToolError prepends prefix to a tool_result content, which may be a
+// plain string or a list of content blocks.
+func markToolError(content interface{}, prefix string) interface{} {
+	switch c := content.(type) {
+	case string:
+		return prefix + c
+	case []interface{}:
+		marked := []interface{}{map[string]interface{}{"type": "text", "text": strings.TrimSpace(prefix)}}
+		return append(marked, c...)
+	case nil:
+		return strings.TrimSpace(prefix)
+	}
+	return content
+}
+
+// systemRole returns the OpenAI role for system prompts. Reasoning models
+// expect "developer" instead of "system".
+func systemRole(reasoning bool) string {
+	if reasoning {
+		return "developer"
+	}
+	return "system"
+}
+
+// convertSystem maps the Anthropic system field (string or array of text
+// blocks) to an OpenAI message with the given role. Block structure and
+// cache_control boundaries are kept when promptCaching is set; otherwise the
+// text is concatenated and the markers are dropped.
+func convertSystem(system interface{}, promptCaching bool, role string) map[string]interface{} {
+	switch s := system.(type) {
+	case string:
+		if s == "" {
+			return nil
+		}
+		return map[string]interface{}{"role": role, "content": s}
+	case []interface{}:
+		var parts []map[string]interface{}
+		var texts []string
+		hasCache := false
+		for _, blk := range s {
+			b, ok := blk.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			txt, _ := b["text"].(string)
+			if txt == "" {
+				continue
+			}
+			part := map[string]interface{}{"type": "text", "text": txt}
+			if cc, ok := b["cache_control"]; ok && cc != nil {
+				part["cache_control"] = cc
+				hasCache = true
+			}
+			parts = append(parts, part)
+			texts = append(texts, txt)
+		}
+		if len(texts) == 0 {
+			return nil
+		}
+		if hasCache && promptCaching {
+			return map[string]interface{}{"role": role, "content": parts}
+		}
+		return map[string]interface{}{"role": role, "content": strings.Join(texts, "\n")}
+	}
+	return nil
+}
+
+// convertTools maps Tool definitions to the provider's tools or functions
+// format, cleaning their schemas to fit profile. With strict, tools whose
+// schema can be tightened are marked strict.
+func (o *OpenAI) convertTools(tools []models.Tool, profile SchemaProfile, strict bool) []map[string]interface{} {
+	var out []map[string]interface{}
+	for _, t := range tools {
+		params := profile.Clean(t.InputSchema)
+		if o.LegacyFunctions {
+			// Legacy functions format: name, description, parameters
+			out = append(out, map[string]interface{}{
+				"name":        t.Name,
+				"description": t.Description,
+				"parameters":  params,
+			})
+			continue
+		}
+		// OpenRouter, OpenAI, Fireworks use tools format with type and function wrapper
+		fn := map[string]interface{}{
+			"name":        t.Name,
+			"description": t.Description,
+			"parameters":  params,
+		}
+		if strict {
+			if tight, ok := strictSchema(params); ok {
+				fn["parameters"], fn["strict"] = tight, true
+			} else {
+				slog.Debug("Sending tool without strict, schema not expressible", "tool", t.Name)
+			}
+		}
+		out = append(out, map[string]interface{}{"type": "function", "function": fn})
+	}
+	return out
+}
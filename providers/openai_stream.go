@@ -0,0 +1,301 @@
+package providers
+
+import (
+	"log/slog"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// streamToolCall accumulates a tool call streamed by the upstream in fragments.
+type streamToolCall struct {
+	ID   string
+	Name string
+	Args strings.Builder
+
+	index   int  // content block index once started
+	started bool // content_block_start has been sent
+	sent    int  // bytes of Args already sent as input_json_delta
+	closed  bool // content_block_stop has been sent
+}
+
+// openAIStream converts OpenAI chat completion chunks into Anthropic SSE
+// events (message_start, content_block_*, message_delta, message_stop).
+type openAIStream struct {
+	emit  EmitFunc
+	id    string
+	model string
+
+	nextIndex    int // index of the next content block
+	textOpen     bool
+	textIndex    int
+	textKind     string // "text" or "thinking"
+	tools        []*streamToolCall
+	toolsByIndex map[int]*streamToolCall // keyed by OpenAI tool_calls index
+	openTool     *streamToolCall         // tool_use block currently streaming
+
+	stopSeqs     []string // requested stop sequences
+	stopSequence *string  // matched stop sequence
+	stopMatched  bool
+	finish       string // finish_reason of the choice, once sent
+
+	thinking bool // translate reasoning fragments into thinking blocks
+
+	// rewriteArgs, when set, transforms each tool call's complete
+	// arguments, which are then sent in one delta when the block closes
+	rewriteArgs func(string) string
+
+	usage Usage
+}
+
+// newOpenAIStream returns a translator that sends events through emit.
+func newOpenAIStream(id, model string, emit EmitFunc) *openAIStream {
+	return &openAIStream{emit: emit, id: id, model: model, toolsByIndex: make(map[int]*streamToolCall)}
+}
+
+// Start emits message_start followed by a ping, as Anthropic does.
+func (t *openAIStream) Start() error {
+	return emitMessageStart(t.emit, t.id, t.model)
+}
+
+// Chunk translates a single decoded OpenAI stream chunk.
+func (t *openAIStream) Chunk(chunk map[string]interface{}) error {
+	if usage, ok := chunk["usage"].(map[string]interface{}); ok {
+		t.usage = openAIUsage(usage)
+	}
+	choices, _ := chunk["choices"].([]interface{})
+	if len(choices) == 0 {
+		return nil
+	}
+	ch, _ := choices[0].(map[string]interface{})
+	if finish, _ := ch["finish_reason"].(string); finish != "" {
+		t.finish = finish
+	}
+	if seq, ok := openAIStopSequence(ch, t.stopSeqs); ok {
+		t.stopSequence, t.stopMatched = seq, true
+	}
+	delta, _ := ch["delta"].(map[string]interface{})
+	if txt := openAIReasoning(delta); txt != "" && t.thinking {
+		if err := t.textDelta("thinking", txt); err != nil {
+			return err
+		}
+	}
+	if txt, _ := delta["content"].(string); txt != "" {
+		if err := t.textDelta("text", txt); err != nil {
+			return err
+		}
+	}
+	// Modern tools format: tool_calls fragments keyed by index
+	if toolCalls, ok := delta["tool_calls"].([]interface{}); ok {
+		for _, tc := range toolCalls {
+			tcMap, _ := tc.(map[string]interface{})
+			idx, _ := tcMap["index"].(float64)
+			funcData, _ := tcMap["function"].(map[string]interface{})
+			id, _ := tcMap["id"].(string)
+			if err := t.toolDelta(int(idx), id, funcData); err != nil {
+				return err
+			}
+		}
+	}
+	// Legacy function_call format (Groq, older OpenAI)
+	if fc, ok := delta["function_call"].(map[string]interface{}); ok {
+		if err := t.toolDelta(0, "", fc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// textDelta forwards a text or thinking fragment, opening a block of that
+// kind if needed.
+func (t *openAIStream) textDelta(kind, txt string) error {
+	if err := t.closeTool(); err != nil {
+		return err
+	}
+	if t.textOpen && t.textKind != kind {
+		if err := t.closeText(); err != nil {
+			return err
+		}
+	}
+	if !t.textOpen {
+		t.textOpen = true
+		t.textIndex = t.nextIndex
+		t.textKind = kind
+		t.nextIndex++
+		err := t.emit("content_block_start", map[string]interface{}{
+			"type":          "content_block_start",
+			"index":         t.textIndex,
+			"content_block": emptyBlock(kind),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return t.emit("content_block_delta", map[string]interface{}{
+		"type":  "content_block_delta",
+		"index": t.textIndex,
+		"delta": blockDelta(kind, txt),
+	})
+}
+
+// closeText ends the open text or thinking block, if any.
+func (t *openAIStream) closeText() error {
+	if !t.textOpen {
+		return nil
+	}
+	t.textOpen = false
+	return t.emit("content_block_stop", map[string]interface{}{"type": "content_block_stop", "index": t.textIndex})
+}
+
+// toolDelta handles a tool call fragment. Once the call's name is known it
+// is streamed as a tool_use block, its argument fragments forwarded as
+// input_json_delta events. Blocks cannot interleave, so starting a call
+// closes the previous block.
+func (t *openAIStream) toolDelta(idx int, id string, funcData map[string]interface{}) error {
+	call, ok := t.toolsByIndex[idx]
+	if !ok {
+		call = &streamToolCall{}
+		t.toolsByIndex[idx] = call
+		t.tools = append(t.tools, call)
+	}
+	if id != "" && !call.started {
+		call.ID = id
+	}
+	if name, _ := funcData["name"].(string); name != "" && !call.started {
+		call.Name = name
+	}
+	if args, _ := funcData["arguments"].(string); args != "" {
+		call.Args.WriteString(args)
+	}
+	if call.closed {
+		// A fragment for a finished block cannot be streamed; upstreams
+		// send calls in order, so this is not expected
+		slog.Debug("Dropping out-of-order tool call fragment", "tool", call.Name)
+		return nil
+	}
+	if !call.started {
+		if call.Name == "" {
+			return nil // wait for the name
+		}
+		if err := t.startTool(call); err != nil {
+			return err
+		}
+	}
+	return t.flushArgs(call)
+}
+
+// startTool closes the open block and opens a tool_use block for call.
+func (t *openAIStream) startTool(call *streamToolCall) error {
+	if err := t.closeText(); err != nil {
+		return err
+	}
+	if err := t.closeTool(); err != nil {
+		return err
+	}
+	if call.ID == "" {
+		call.ID = uuid.New().String()[:12]
+	}
+	call.index = t.nextIndex
+	t.nextIndex++
+	call.started = true
+	t.openTool = call
+	return t.emit("content_block_start", map[string]interface{}{
+		"type":  "content_block_start",
+		"index": call.index,
+		"content_block": map[string]interface{}{
+			"type":  "tool_use",
+			"id":    call.ID,
+			"name":  call.Name,
+			"input": map[string]interface{}{},
+		},
+	})
+}
+
+// flushArgs sends argument text received since the last flush.
+func (t *openAIStream) flushArgs(call *streamToolCall) error {
+	if t.rewriteArgs != nil && !call.closed {
+		return nil
+	}
+	args := call.Args.String()
+	if call.sent == len(args) {
+		return nil
+	}
+	partial := args[call.sent:]
+	call.sent = len(args)
+	return t.emit("content_block_delta", map[string]interface{}{
+		"type":  "content_block_delta",
+		"index": call.index,
+		"delta": map[string]interface{}{"type": "input_json_delta", "partial_json": partial},
+	})
+}
+
+// closeTool ends the streaming tool_use block, if any. A call that sent no
+// arguments gets an empty object so clients can parse its input.
+func (t *openAIStream) closeTool() error {
+	call := t.openTool
+	if call == nil {
+		return nil
+	}
+	t.openTool = nil
+	call.closed = true
+	if strings.TrimSpace(call.Args.String()) == "" {
+		call.Args.WriteString("{}")
+	}
+	if t.rewriteArgs != nil {
+		args := t.rewriteArgs(call.Args.String())
+		call.Args.Reset()
+		call.Args.WriteString(args)
+	}
+	if err := t.flushArgs(call); err != nil {
+		return err
+	}
+	return t.emit("content_block_stop", map[string]interface{}{"type": "content_block_stop", "index": call.index})
+}
+
+// Finish closes open blocks, emits tool calls whose name never arrived and
+// ends the message.
+func (t *openAIStream) Finish() error {
+	if err := t.closeText(); err != nil {
+		return err
+	}
+	if err := t.closeTool(); err != nil {
+		return err
+	}
+	for _, call := range t.tools {
+		if call.started {
+			continue
+		}
+		if call.ID == "" {
+			call.ID = uuid.New().String()[:12]
+		}
+		args := call.Args.String()
+		if strings.TrimSpace(args) == "" {
+			args = "{}"
+		}
+		if t.rewriteArgs != nil {
+			args = t.rewriteArgs(args)
+		}
+		idx := t.nextIndex
+		t.nextIndex++
+		if err := emitToolUseBlock(t.emit, idx, call.ID, call.Name, args); err != nil {
+			return err
+		}
+	}
+	return emitMessageEnd(t.emit, t.StopReason(), t.stopSequence, t.usage)
+}
+
+// StopReason returns the Anthropic stop_reason for what has been seen so far.
+func (t *openAIStream) StopReason() string {
+	if len(t.tools) > 0 && t.finish != "length" {
+		return "tool_use"
+	}
+	if t.stopMatched {
+		return "stop_sequence"
+	}
+	return openAIStopReason(t.finish)
+}
+
+// Usage returns the token counts seen so far.
+func (t *openAIStream) Usage() Usage {
+	return t.usage
+}
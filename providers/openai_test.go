@@ -0,0 +1,213 @@
+package providers
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"gopenbridge/models"
+)
+
+// mustGet returns the registered provider called name.
+func mustGet(t *testing.T, name string) Provider {
+	t.Helper()
+	p, ok := Get(name)
+	if !ok {
+		t.Fatalf("provider %q is not registered", name)
+	}
+	return p
+}
+
+// buildPayload builds the payload for req through the provider called name.
+func buildPayload(t *testing.T, name string, req *models.MessagesRequest, opts Options) map[string]interface{} {
+	t.Helper()
+	if req.Model == "" {
+		req.Model = "test-model"
+	}
+	if req.Messages == nil {
+		req.Messages = []models.Message{{Role: "user", Content: "Hi"}}
+	}
+	if opts.MaxTokens == 0 {
+		opts.MaxTokens = 100
+	}
+	payload, err := mustGet(t, name).BuildPayload(req, opts)
+	if err != nil {
+		t.Fatalf("%s: BuildPayload: %v", name, err)
+	}
+	return payload
+}
+
+func TestConvertSystemCacheControl(t *testing.T) {
+	ephemeral := map[string]interface{}{"type": "ephemeral"}
+	system := []interface{}{
+		map[string]interface{}{"type": "text", "text": "You are terse.", "cache_control": ephemeral},
+		map[string]interface{}{"type": "text", "text": "Long reference text."},
+		map[string]interface{}{"type": "text", "text": "Today is Monday.", "cache_control": ephemeral},
+	}
+	parts := []map[string]interface{}{
+		{"type": "text", "text": "You are terse.", "cache_control": ephemeral},
+		{"type": "text", "text": "Long reference text."},
+		{"type": "text", "text": "Today is Monday.", "cache_control": ephemeral},
+	}
+	joined := "You are terse.\nLong reference text.\nToday is Monday."
+	tests := []struct {
+		provider string
+		system   interface{}
+		want     interface{}
+	}{
+		// Caching providers keep the blocks and their markers
+		{"openrouter", system, parts},
+		{"anthropic", system, parts},
+		// Others get the text joined, without markers
+		{"groq", system, joined},
+		{"openai", system, joined},
+		{"openrouter", "Plain prompt.", "Plain prompt."},
+		{"groq", "Plain prompt.", "Plain prompt."},
+	}
+	for _, tt := range tests {
+		payload := buildPayload(t, tt.provider, &models.MessagesRequest{System: tt.system}, Options{})
+		msgs := payload["messages"].([]map[string]interface{})
+		if msgs[0]["role"] != "system" {
+			t.Fatalf("%s: first message role = %v, want system", tt.provider, msgs[0]["role"])
+		}
+		if got := msgs[0]["content"]; !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: system content = %#v, want %#v", tt.provider, got, tt.want)
+		}
+	}
+}
+
+func TestConvertSystemWithoutMarkers(t *testing.T) {
+	// Blocks without cache_control are joined even for caching providers
+	system := []interface{}{
+		map[string]interface{}{"type": "text", "text": "One."},
+		map[string]interface{}{"type": "text", "text": "Two."},
+	}
+	got := convertSystem(system, true, "system")
+	if got["content"] != "One.\nTwo." {
+		t.Errorf("content = %#v, want the joined text", got["content"])
+	}
+	if convertSystem([]interface{}{}, true, "system") != nil {
+		t.Error("empty system produced a message")
+	}
+}
+
+func TestParseResponseUnrecognized(t *testing.T) {
+	tests := []struct {
+		provider string
+		body     map[string]interface{}
+	}{
+		{"openai", map[string]interface{}{"id": "x", "object": "something.else"}},
+		{"groq", map[string]interface{}{"choices": []interface{}{map[string]interface{}{"message": map[string]interface{}{"content": ""}}}}},
+		{"gemini", map[string]interface{}{"promptFeedback": map[string]interface{}{"blockReason": "OTHER"}}},
+		{"ollama", map[string]interface{}{"model": "llama3", "done": true}},
+		{"bedrock", map[string]interface{}{"output": map[string]interface{}{}}},
+		{"anthropic-messages", map[string]interface{}{"type": "message", "content": []interface{}{}}},
+	}
+	for _, tt := range tests {
+		p := mustGet(t, tt.provider)
+		if _, err := p.ParseResponse(tt.body, Options{StrictResponseParsing: true}); !errors.Is(err, ErrEmptyResponse) {
+			t.Errorf("%s strict: err = %v, want ErrEmptyResponse", tt.provider, err)
+		}
+		res, err := p.ParseResponse(tt.body, Options{})
+		if err != nil {
+			t.Errorf("%s lenient: err = %v", tt.provider, err)
+			continue
+		}
+		if tt.provider == "anthropic-messages" {
+			// Passed through as the upstream sent it
+			continue
+		}
+		if len(res.Content) != 1 || !reflect.DeepEqual(res.Content[0], map[string]interface{}{"type": "text", "text": ""}) {
+			t.Errorf("%s lenient: content = %#v, want one empty text block", tt.provider, res.Content)
+		}
+	}
+}
+
+func TestParseResponseStrictAcceptsContent(t *testing.T) {
+	body := map[string]interface{}{"choices": []interface{}{map[string]interface{}{
+		"message":       map[string]interface{}{"content": "Hi"},
+		"finish_reason": "stop",
+	}}}
+	res, err := mustGet(t, "openai").ParseResponse(body, Options{StrictResponseParsing: true})
+	if err != nil {
+		t.Fatalf("strict parse of a normal response: %v", err)
+	}
+	if res.Content[0].(map[string]interface{})["text"] != "Hi" {
+		t.Errorf("content = %#v", res.Content)
+	}
+}
+
+func TestToolResultErrorMarked(t *testing.T) {
+	blocks := []interface{}{map[string]interface{}{"type": "text", "text": "file not found"}}
+	tests := []struct {
+		name    string
+		content interface{}
+		isError bool
+		want    string
+	}{
+		{"string", "file not found", true, "ERROR: file not found"},
+		{"blocks", blocks, true, "ERROR:\nfile not found"},
+		{"nil", nil, true, "ERROR:"},
+		{"not an error", "file not found", false, "file not found"},
+	}
+	for _, tt := range tests {
+		req := &models.MessagesRequest{Messages: []models.Message{
+			{Role: "user", Content: "Read a.txt"},
+			{Role: "assistant", Content: []interface{}{map[string]interface{}{"type": "tool_use", "id": "t1", "name": "read", "input": map[string]interface{}{}}}},
+			{Role: "user", Content: []interface{}{map[string]interface{}{"type": "tool_result", "tool_use_id": "t1", "content": tt.content, "is_error": tt.isError}}},
+		}}
+		payload := buildPayload(t, "openai", req, Options{ToolErrorPrefix: "ERROR: "})
+		var got interface{}
+		for _, m := range payload["messages"].([]map[string]interface{}) {
+			if m["role"] == "tool" {
+				got = m["content"]
+			}
+		}
+		if got != tt.want {
+			t.Errorf("%s: forwarded tool content = %#v, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestTopKForwarding(t *testing.T) {
+	// lookup finds top_k where each provider puts it, if at all
+	nested := func(key, field string) func(map[string]interface{}) (interface{}, bool) {
+		return func(p map[string]interface{}) (interface{}, bool) {
+			m, _ := p[key].(map[string]interface{})
+			v, ok := m[field]
+			return v, ok
+		}
+	}
+	topLevel := func(p map[string]interface{}) (interface{}, bool) {
+		v, ok := p["top_k"]
+		return v, ok
+	}
+	tests := []struct {
+		provider string
+		lookup   func(map[string]interface{}) (interface{}, bool)
+		want     bool
+	}{
+		{"openrouter", topLevel, true},
+		{"fireworks", topLevel, true},
+		{"together", topLevel, true},
+		{"gemini", nested("generationConfig", "topK"), true},
+		{"ollama", nested("options", "top_k"), true},
+		{"bedrock", nested("additionalModelRequestFields", "top_k"), true},
+		// Not part of the OpenAI API, and unknown servers may reject it
+		{"openai", topLevel, false},
+		{"groq", topLevel, false},
+		{"openai-compatible", topLevel, false},
+	}
+	for _, tt := range tests {
+		topK := 40
+		payload := buildPayload(t, tt.provider, &models.MessagesRequest{TopK: &topK}, Options{})
+		got, ok := tt.lookup(payload)
+		if ok != tt.want {
+			t.Errorf("%s: top_k forwarded = %v, want %v (payload %v)", tt.provider, ok, tt.want, payload)
+			continue
+		}
+		if ok && got != 40 {
+			t.Errorf("%s: top_k = %#v, want 40", tt.provider, got)
+		}
+	}
+}
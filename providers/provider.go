@@ -0,0 +1,146 @@
+// Package providers adapts Anthropic Messages requests to upstream model APIs.
+//
+// Each backend implements Provider and registers itself from an init function,
+// so adding a provider is a new file rather than an edit to the proxy.
+package providers
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"gopenbridge/models"
+)
+
+// Options carries per-request settings resolved by the proxy.
+type Options struct {
+	MaxTokens             int      // Resolved max output tokens
+	ToolErrorPrefix       string   // Prefix marking tool results flagged with is_error
+	StrictResponseParsing bool     // Reject responses with no content or tool call
+	KeepAlive             string   // Ollama keep_alive duration
+	NumCtx                int      // Ollama context window size
+	ExtractDocuments      bool     // Send PDF documents as locally extracted text
+	StopSequences         []string // Requested stop_sequences, to name the one matched
+	SchemaProfile         string   // Tool schema cleanup profile; empty uses the provider's default
+	StrictTools           bool     // Send strict function definitions where supported
+	RepairToolArgs        bool     // Fix malformed JSON in tool call arguments
+	ReasoningAsThinking   bool     // Return upstream reasoning as thinking blocks
+	ReasoningModel        bool     // Treat the model as an OpenAI reasoning model regardless of its name
+	PromptCaching         bool     // Keep cache_control markers on message text
+	Betas                 []string // Requested anthropic-beta features, see BetaHandler
+}
+
+// Upstream describes where and how to reach a provider.
+type Upstream struct {
+	BaseURL     string
+	APIKey      string
+	APIVersion  string            // Azure api-version query parameter
+	Deployments map[string]string // Azure deployment name per model
+	Region      string            // AWS region for Bedrock
+	AWSProfile  string            // AWS shared credentials profile for Bedrock
+}
+
+// Response is an upstream response translated to Anthropic message parts.
+type Response struct {
+	Content      []interface{}
+	StopReason   string
+	StopSequence *string // Matched stop sequence, if known
+	Usage
+	// ToolArgErrors says why a tool_use block's arguments could not be
+	// decoded, by block id. Those blocks carry an empty input.
+	ToolArgErrors map[string]string
+}
+
+// EmitFunc sends one Anthropic SSE event to the client.
+type EmitFunc func(event string, data interface{}) error
+
+// StreamTranslator converts decoded upstream stream chunks into Anthropic
+// SSE events sent through an EmitFunc.
+type StreamTranslator interface {
+	// Start emits the events that open the message.
+	Start() error
+	// Chunk translates one decoded upstream chunk.
+	Chunk(chunk map[string]interface{}) error
+	// Finish closes open blocks and ends the message.
+	Finish() error
+	// StopReason returns the Anthropic stop_reason for what has been seen so far.
+	StopReason() string
+	// Usage returns the token counts seen so far.
+	Usage() Usage
+}
+
+// Provider translates between Anthropic requests and one upstream API.
+type Provider interface {
+	// Name identifies the provider, e.g. "groq".
+	Name() string
+	// Endpoint returns the upstream URL for a request to model.
+	Endpoint(up Upstream, model string, stream bool) string
+	// Authorize adds credentials for up to an outgoing request.
+	Authorize(req *http.Request, up Upstream) error
+	// BuildPayload converts an Anthropic request into the upstream payload.
+	BuildPayload(req *models.MessagesRequest, opts Options) (map[string]interface{}, error)
+	// ParseResponse converts a decoded upstream response into Anthropic parts.
+	ParseResponse(res map[string]interface{}, opts Options) (*Response, error)
+	// StreamTranslator returns a translator for the upstream's stream chunks.
+	StreamTranslator(id, model string, opts Options, emit EmitFunc) StreamTranslator
+}
+
+// detector maps a base URL substring to a provider name.
+type detector struct {
+	host string
+	name string
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Provider)
+	detectors  []detector // longest host first, so specific matches win
+)
+
+// Register makes a provider available by name. hosts are base URL
+// substrings used by Detect to pick the provider automatically.
+func Register(p Provider, hosts ...string) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[p.Name()] = p
+	for _, h := range hosts {
+		detectors = append(detectors, detector{host: h, name: p.Name()})
+	}
+	sort.SliceStable(detectors, func(i, j int) bool {
+		return len(detectors[i].host) > len(detectors[j].host)
+	})
+}
+
+// Get returns the provider registered under name.
+func Get(name string) (Provider, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	p, ok := registry[name]
+	return p, ok
+}
+
+// Detect determines the provider from the base URL, falling back to the
+// generic OpenAI-compatible provider.
+func Detect(baseURL string) Provider {
+	baseURL = strings.ToLower(baseURL)
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	for _, d := range detectors {
+		if strings.Contains(baseURL, d.host) {
+			return registry[d.name]
+		}
+	}
+	return registry[openAICompatibleName]
+}
+
+// Resolve returns the provider named name, or detects it from baseURL when
+// name is empty or unknown.
+func Resolve(name, baseURL string) Provider {
+	if name != "" {
+		if p, ok := Get(name); ok {
+			return p
+		}
+	}
+	return Detect(baseURL)
+}
@@ -0,0 +1,218 @@
+package providers
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+)
+
+// parseToolArgs decodes JSON tool arguments into an object. Malformed
+// arguments are run through repairJSON when repair is set. On failure the
+// input is empty and the error says why.
+func parseToolArgs(s string, repair bool) (map[string]interface{}, error) {
+	args := map[string]interface{}{}
+	if strings.TrimSpace(s) == "" {
+		return args, nil
+	}
+	err := json.Unmarshal([]byte(s), &args)
+	if err == nil {
+		return args, nil
+	}
+	if repair {
+		if fixed, ok := repairJSON(s); ok {
+			args = map[string]interface{}{}
+			if json.Unmarshal([]byte(fixed), &args) == nil {
+				return args, nil
+			}
+		}
+	}
+	return map[string]interface{}{}, errors.New("arguments are not a valid JSON object: " + err.Error())
+}
+
+// repairArgs returns JSON tool arguments repaired if needed, or unchanged
+// when they are valid or beyond repair.
+func repairArgs(s string) string {
+	if json.Valid([]byte(s)) {
+		return s
+	}
+	if fixed, ok := repairJSON(s); ok {
+		return fixed
+	}
+	return s
+}
+
+// repairJSON makes a best-effort fix of a malformed JSON object as models
+// tend to produce it: wrapped in a code fence or prose, with single-quoted
+// strings, Python literals, trailing commas, raw newlines in strings, or
+// cut off before its closing brackets. It reports false if the result is
+// still not a JSON object.
+func repairJSON(s string) (string, bool) {
+	s = strings.TrimSpace(s)
+	if i := strings.Index(s, "```"); i != -1 {
+		s = s[i+3:]
+		s = strings.TrimPrefix(s, "json")
+		if j := strings.Index(s, "```"); j != -1 {
+			s = s[:j]
+		}
+	}
+	start := strings.IndexByte(s, '{')
+	if start == -1 {
+		return "", false
+	}
+	s = s[start:]
+
+	var out strings.Builder
+	var stack []byte // open brackets
+	var quote byte   // delimiter of the current string, 0 outside strings
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if quote != 0 {
+			switch {
+			case c == '\\' && i+1 < len(s):
+				if s[i+1] == '\'' {
+					out.WriteByte('\'') // \' is not a JSON escape
+				} else {
+					out.WriteByte(c)
+					out.WriteByte(s[i+1])
+				}
+				i++
+			case c == quote:
+				out.WriteByte('"')
+				quote = 0
+			case c == '"':
+				out.WriteString(`\"`) // inside a single-quoted string
+			case c == '\n':
+				out.WriteString(`\n`)
+			case c == '\r':
+				out.WriteString(`\r`)
+			case c == '\t':
+				out.WriteString(`\t`)
+			default:
+				out.WriteByte(c)
+			}
+			continue
+		}
+		switch c {
+		case '"', '\'':
+			quote = c
+			out.WriteByte('"')
+		case '{', '[':
+			stack = append(stack, c)
+			out.WriteByte(c)
+		case '}', ']':
+			trimTrailingComma(&out)
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+			out.WriteByte(c)
+			if len(stack) == 0 {
+				return validObject(out.String()) // ignore anything after the object
+			}
+		default:
+			if word, lit := pythonLiteral(s[i:]); lit != "" {
+				out.WriteString(lit)
+				i += len(word) - 1
+				continue
+			}
+			out.WriteByte(c)
+		}
+	}
+	// Truncated: close the open string and brackets
+	if quote != 0 {
+		out.WriteByte('"')
+	}
+	trimDangling(&out, len(stack) > 0 && stack[len(stack)-1] == '{')
+	for i := len(stack) - 1; i >= 0; i-- {
+		if stack[i] == '{' {
+			out.WriteByte('}')
+		} else {
+			out.WriteByte(']')
+		}
+	}
+	return validObject(out.String())
+}
+
+// pythonLiteral recognizes True, False and None at the start of s and
+// returns the word and its JSON spelling.
+func pythonLiteral(s string) (string, string) {
+	for word, lit := range map[string]string{"True": "true", "False": "false", "None": "null"} {
+		if strings.HasPrefix(s, word) && (len(s) == len(word) || !isWordByte(s[len(word)])) {
+			return word, lit
+		}
+	}
+	return "", ""
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// trimTrailingComma removes a comma, and whitespace after it, at the end
+// of out.
+func trimTrailingComma(out *strings.Builder) {
+	s := strings.TrimRight(out.String(), " \t\r\n")
+	if strings.HasSuffix(s, ",") {
+		out.Reset()
+		out.WriteString(s[:len(s)-1])
+	}
+}
+
+// trimDangling drops an incomplete trailing member of a truncated object,
+// such as a key without a value, so the brackets can be closed. inObject
+// reports whether the innermost open bracket is a brace.
+func trimDangling(out *strings.Builder, inObject bool) {
+	s := strings.TrimRight(out.String(), " \t\r\n")
+	if inObject && strings.HasSuffix(s, `"`) {
+		// A key cut off before its colon
+		if i := strings.LastIndex(s[:len(s)-1], `"`); i != -1 {
+			if before := strings.TrimRight(s[:i], " \t\r\n"); strings.HasSuffix(before, ",") || strings.HasSuffix(before, "{") {
+				s = before
+			}
+		}
+	}
+	for {
+		switch {
+		case strings.HasSuffix(s, ","):
+			s = strings.TrimRight(s[:len(s)-1], " \t\r\n")
+			continue
+		case strings.HasSuffix(s, ":"):
+			// Drop the key too
+			s = strings.TrimRight(s[:len(s)-1], " \t\r\n")
+			if strings.HasSuffix(s, `"`) {
+				if i := strings.LastIndex(s[:len(s)-1], `"`); i != -1 {
+					s = strings.TrimRight(s[:i], " \t\r\n")
+				}
+			}
+			continue
+		}
+		break
+	}
+	out.Reset()
+	out.WriteString(s)
+}
+
+// validObject reports whether s is a JSON object.
+func validObject(s string) (string, bool) {
+	var obj map[string]interface{}
+	if json.Unmarshal([]byte(s), &obj) != nil || obj == nil {
+		return "", false
+	}
+	return s, true
+}
+
+// toolArgs decodes the arguments of tool call id, recording in
+// r.ToolArgErrors why they could not be used.
+func (r *Response) toolArgs(id, s string, repair bool) map[string]interface{} {
+	args, err := parseToolArgs(s, repair)
+	if err != nil {
+		slog.Warn("Unusable tool call arguments", "tool_use_id", id, "error", err)
+		if r.ToolArgErrors == nil {
+			r.ToolArgErrors = map[string]string{}
+		}
+		r.ToolArgErrors[id] = err.Error()
+	} else if repair && !json.Valid([]byte(s)) && strings.TrimSpace(s) != "" {
+		slog.Info("Repaired malformed tool call arguments", "tool_use_id", id)
+	}
+	return args
+}
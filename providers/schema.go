@@ -0,0 +1,392 @@
+package providers
+
+import (
+	"encoding/json"
+	"log/slog"
+	"maps"
+	"slices"
+)
+
+// SchemaProfile describes the JSON Schema subset an upstream accepts in
+// tool parameters. Clean rewrites schemas to fit it instead of letting the
+// upstream reject the whole request.
+type SchemaProfile struct {
+	Drop          []string // keywords removed wherever they appear
+	Formats       []string // string formats kept; nil keeps every format
+	ResolveRefs   bool     // inline $ref to $defs and definitions
+	FlattenUnions bool     // replace anyOf/oneOf/allOf with a single schema
+	Nullable      bool     // express ["T", "null"] types as nullable: true
+	ConstToEnum   bool     // express const as a one-value enum
+	PruneRequired bool     // drop required names without a property
+}
+
+// schemaProfiles are the built-in profiles by name.
+var schemaProfiles = map[string]SchemaProfile{
+	"none": {},
+	// Strict OpenAI-compatible servers such as Groq reject metadata
+	// keywords and formats outside the common set
+	"basic": {
+		Drop:    []string{"$schema", "$id", "$comment"},
+		Formats: []string{"date-time", "date", "time", "duration", "email", "hostname", "ipv4", "ipv6", "uuid"},
+	},
+	// Gemini takes an OpenAPI 3.0 schema subset
+	"gemini": {
+		Drop: []string{"$schema", "$id", "$comment", "$defs", "definitions", "additionalProperties", "default",
+			"examples", "patternProperties", "propertyNames", "unevaluatedProperties", "dependentRequired",
+			"dependentSchemas", "if", "then", "else", "not", "contains", "exclusiveMinimum", "exclusiveMaximum",
+			"minContains", "maxContains", "const"},
+		Formats:       []string{"enum", "date-time"},
+		ResolveRefs:   true,
+		FlattenUnions: true,
+		Nullable:      true,
+		ConstToEnum:   true,
+		PruneRequired: true,
+	},
+}
+
+// schemaProfile returns the profile named by opts.SchemaProfile, or the
+// provider's default def when none is configured.
+func schemaProfile(opts Options, def string) SchemaProfile {
+	name := opts.SchemaProfile
+	if name == "" {
+		name = def
+	}
+	p, ok := schemaProfiles[name]
+	if !ok && name != "" {
+		slog.Warn("Unknown tool schema profile, leaving schemas unchanged", "profile", name)
+	}
+	return p
+}
+
+// maxRefDepth bounds $ref inlining so recursive schemas terminate.
+const maxRefDepth = 3
+
+// Clean returns a copy of schema rewritten to fit p. schema is not modified.
+func (p SchemaProfile) Clean(schema map[string]interface{}) map[string]interface{} {
+	if schema == nil {
+		return nil
+	}
+	defs := map[string]interface{}{}
+	for _, key := range []string{"definitions", "$defs"} {
+		if d, ok := schema[key].(map[string]interface{}); ok {
+			for name, def := range d {
+				defs["#/"+key+"/"+name] = def
+			}
+		}
+	}
+	res, _ := p.clean(schema, defs, 0).(map[string]interface{})
+	return res
+}
+
+// clean rewrites one schema node.
+func (p SchemaProfile) clean(v interface{}, defs map[string]interface{}, depth int) interface{} {
+	node, ok := v.(map[string]interface{})
+	if !ok {
+		return v
+	}
+	node = maps.Clone(node)
+	if ref, ok := node["$ref"].(string); ok && p.ResolveRefs {
+		delete(node, "$ref")
+		if def, ok := defs[ref].(map[string]interface{}); ok && depth < maxRefDepth {
+			node = mergeSchema(maps.Clone(def), node)
+			depth++
+		} else if len(node) == 0 {
+			node["type"] = "object" // recursive or unknown reference
+		}
+	}
+	if p.FlattenUnions {
+		node = flattenUnions(node)
+		if _, ok := node["$ref"]; ok && p.ResolveRefs {
+			return p.clean(node, defs, depth+1) // the chosen alternative was a reference
+		}
+	}
+	if types, ok := node["type"].([]interface{}); ok && p.Nullable {
+		var kept []interface{}
+		for _, t := range types {
+			if t == "null" {
+				node["nullable"] = true
+			} else {
+				kept = append(kept, t)
+			}
+		}
+		if len(kept) == 0 {
+			delete(node, "type")
+		} else {
+			node["type"] = kept[0] // a single type is all the profile allows
+		}
+	}
+	if c, ok := node["const"]; ok && p.ConstToEnum {
+		if _, hasEnum := node["enum"]; !hasEnum {
+			node["enum"] = []interface{}{c}
+		}
+	}
+	if f, ok := node["format"].(string); ok && p.Formats != nil && !slices.Contains(p.Formats, f) {
+		delete(node, "format")
+	}
+	for _, key := range p.Drop {
+		delete(node, key)
+	}
+	// Recurse into subschemas
+	if props, ok := node["properties"].(map[string]interface{}); ok {
+		cleaned := make(map[string]interface{}, len(props))
+		for name, prop := range props {
+			cleaned[name] = p.clean(prop, defs, depth)
+		}
+		node["properties"] = cleaned
+		if req, ok := node["required"].([]interface{}); ok && p.PruneRequired {
+			var kept []interface{}
+			for _, r := range req {
+				if name, _ := r.(string); cleaned[name] != nil {
+					kept = append(kept, r)
+				}
+			}
+			node["required"] = kept
+			if len(kept) == 0 {
+				delete(node, "required")
+			}
+		}
+	}
+	for _, key := range []string{"items", "additionalProperties", "not"} {
+		if sub, ok := node[key].(map[string]interface{}); ok {
+			node[key] = p.clean(sub, defs, depth)
+		}
+	}
+	for _, key := range []string{"anyOf", "oneOf", "allOf", "prefixItems"} {
+		if list, ok := node[key].([]interface{}); ok {
+			cleaned := make([]interface{}, len(list))
+			for i, sub := range list {
+				cleaned[i] = p.clean(sub, defs, depth)
+			}
+			node[key] = cleaned
+		}
+	}
+	for _, key := range []string{"$defs", "definitions"} {
+		if d, ok := node[key].(map[string]interface{}); ok {
+			cleaned := make(map[string]interface{}, len(d))
+			for name, def := range d {
+				cleaned[name] = p.clean(def, defs, depth)
+			}
+			node[key] = cleaned
+		}
+	}
+	return node
+}
+
+// flattenUnions replaces allOf with the merge of its schemas, and anyOf or
+// oneOf with their first alternative other than null, which marks the
+// result nullable.
+func flattenUnions(node map[string]interface{}) map[string]interface{} {
+	if list, ok := node["allOf"].([]interface{}); ok {
+		delete(node, "allOf")
+		for _, sub := range list {
+			if m, ok := sub.(map[string]interface{}); ok {
+				node = mergeSchema(node, m)
+			}
+		}
+	}
+	for _, key := range []string{"anyOf", "oneOf"} {
+		list, ok := node[key].([]interface{})
+		if !ok {
+			continue
+		}
+		delete(node, key)
+		var pick map[string]interface{}
+		for _, sub := range list {
+			m, ok := sub.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if m["type"] == "null" {
+				node["nullable"] = true
+				continue
+			}
+			if pick == nil {
+				pick = m
+			}
+		}
+		if pick != nil {
+			node = mergeSchema(node, pick)
+		}
+	}
+	return node
+}
+
+// mergeSchema adds src's keywords to dst, combining properties and
+// required lists. Keywords already in dst win.
+func mergeSchema(dst, src map[string]interface{}) map[string]interface{} {
+	for k, v := range src {
+		switch k {
+		case "properties":
+			props, _ := dst[k].(map[string]interface{})
+			merged := maps.Clone(props)
+			if merged == nil {
+				merged = map[string]interface{}{}
+			}
+			if sp, ok := v.(map[string]interface{}); ok {
+				for name, prop := range sp {
+					if _, exists := merged[name]; !exists {
+						merged[name] = prop
+					}
+				}
+			}
+			dst[k] = merged
+		case "required":
+			req, _ := dst[k].([]interface{})
+			merged := slices.Clone(req)
+			if sr, ok := v.([]interface{}); ok {
+				for _, r := range sr {
+					if !slices.Contains(merged, r) {
+						merged = append(merged, r)
+					}
+				}
+			}
+			dst[k] = merged
+		default:
+			if _, exists := dst[k]; !exists {
+				dst[k] = v
+			}
+		}
+	}
+	return dst
+}
+
+// strictSchema tightens schema for OpenAI strict function calling: every
+// object forbids additional properties and requires all of its properties,
+// with optional ones made nullable instead. It reports false for schemas
+// strict mode cannot express, such as free-form objects, so the tool is
+// sent without strict.
+func strictSchema(schema map[string]interface{}) (map[string]interface{}, bool) {
+	res, ok := tighten(schema)
+	m, _ := res.(map[string]interface{})
+	return m, ok && m != nil
+}
+
+// tighten applies strictSchema to one node.
+func tighten(v interface{}) (interface{}, bool) {
+	node, ok := v.(map[string]interface{})
+	if !ok {
+		return v, true
+	}
+	node = maps.Clone(node)
+	if _, ok := node["$ref"]; ok {
+		return node, true
+	}
+	if node["type"] == "object" || node["properties"] != nil {
+		props, _ := node["properties"].(map[string]interface{})
+		if len(props) == 0 || node["patternProperties"] != nil {
+			return node, false
+		}
+		if extra, ok := node["additionalProperties"]; ok && extra != false {
+			return node, false
+		}
+		required, _ := node["required"].([]interface{})
+		cleaned := make(map[string]interface{}, len(props))
+		var names []interface{}
+		for _, name := range slices.Sorted(maps.Keys(props)) {
+			prop, ok := tighten(props[name])
+			if !ok {
+				return node, false
+			}
+			if !slices.Contains(required, interface{}(name)) {
+				prop = nullable(prop)
+			}
+			cleaned[name] = prop
+			names = append(names, name)
+		}
+		node["properties"] = cleaned
+		node["required"] = names
+		node["additionalProperties"] = false
+	}
+	if items, ok := node["items"]; ok {
+		t, ok := tighten(items)
+		if !ok {
+			return node, false
+		}
+		node["items"] = t
+	}
+	for _, key := range []string{"anyOf", "$defs", "definitions"} {
+		switch sub := node[key].(type) {
+		case []interface{}:
+			list := make([]interface{}, len(sub))
+			for i, s := range sub {
+				t, ok := tighten(s)
+				if !ok {
+					return node, false
+				}
+				list[i] = t
+			}
+			node[key] = list
+		case map[string]interface{}:
+			defs := make(map[string]interface{}, len(sub))
+			for name, s := range sub {
+				t, ok := tighten(s)
+				if !ok {
+					return node, false
+				}
+				defs[name] = t
+			}
+			node[key] = defs
+		}
+	}
+	return node, true
+}
+
+// nullable lets a schema also accept null, standing in for an optional
+// property under strict mode's everything-required rule.
+func nullable(v interface{}) interface{} {
+	node, ok := v.(map[string]interface{})
+	if !ok {
+		return v
+	}
+	switch t := node["type"].(type) {
+	case string:
+		if t != "null" {
+			node["type"] = []interface{}{t, "null"}
+		}
+		if enum, ok := node["enum"].([]interface{}); ok && !slices.Contains(enum, nil) {
+			node["enum"] = append(slices.Clone(enum), nil)
+		}
+	case []interface{}:
+		if !slices.Contains(t, interface{}("null")) {
+			node["type"] = append(slices.Clone(t), "null")
+		}
+	default:
+		return map[string]interface{}{"anyOf": []interface{}{node, map[string]interface{}{"type": "null"}}}
+	}
+	return node
+}
+
+// dropNulls removes null members from obj and nested objects. Strict mode
+// makes models send null for optional properties, which clients expect to
+// be omitted instead.
+func dropNulls(obj map[string]interface{}) {
+	for k, v := range obj {
+		switch c := v.(type) {
+		case nil:
+			delete(obj, k)
+		case map[string]interface{}:
+			dropNulls(c)
+		case []interface{}:
+			for _, item := range c {
+				if m, ok := item.(map[string]interface{}); ok {
+					dropNulls(m)
+				}
+			}
+		}
+	}
+}
+
+// dropNullArgs applies dropNulls to JSON tool arguments, returning them
+// unchanged when they are not an object.
+func dropNullArgs(args string) string {
+	var obj map[string]interface{}
+	if err := json.Unmarshal([]byte(args), &obj); err != nil || obj == nil {
+		return args
+	}
+	dropNulls(obj)
+	b, err := json.Marshal(obj)
+	if err != nil {
+		return args
+	}
+	return string(b)
+}
@@ -0,0 +1,92 @@
+package providers
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// decode parses a JSON schema literal.
+func decode(t *testing.T, s string) map[string]interface{} {
+	t.Helper()
+	var m map[string]interface{}
+	if err := json.Unmarshal([]byte(s), &m); err != nil {
+		t.Fatalf("bad schema %s: %v", s, err)
+	}
+	return m
+}
+
+func TestSchemaProfileClean(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile string
+		schema  string
+		want    string
+	}{
+		{
+			name:    "$schema",
+			profile: "basic",
+			schema:  `{"$schema":"http://json-schema.org/draft-07/schema#","type":"object","properties":{"a":{"type":"string"}}}`,
+			want:    `{"type":"object","properties":{"a":{"type":"string"}}}`,
+		},
+		{
+			name:    "formats",
+			profile: "basic",
+			schema:  `{"type":"object","properties":{"url":{"type":"string","format":"uri"},"mail":{"type":"string","format":"email"}}}`,
+			want:    `{"type":"object","properties":{"url":{"type":"string"},"mail":{"type":"string","format":"email"}}}`,
+		},
+		{
+			name:    "additionalProperties and anyOf kept",
+			profile: "basic",
+			schema:  `{"type":"object","additionalProperties":false,"properties":{"a":{"anyOf":[{"type":"string"},{"type":"null"}]}}}`,
+			want:    `{"type":"object","additionalProperties":false,"properties":{"a":{"anyOf":[{"type":"string"},{"type":"null"}]}}}`,
+		},
+		{
+			name:    "$schema",
+			profile: "gemini",
+			schema:  `{"$schema":"https://json-schema.org/draft/2020-12/schema","type":"object","properties":{"a":{"type":"string"}}}`,
+			want:    `{"type":"object","properties":{"a":{"type":"string"}}}`,
+		},
+		{
+			name:    "formats",
+			profile: "gemini",
+			schema:  `{"type":"object","properties":{"url":{"type":"string","format":"uri"},"at":{"type":"string","format":"date-time"}}}`,
+			want:    `{"type":"object","properties":{"url":{"type":"string"},"at":{"type":"string","format":"date-time"}}}`,
+		},
+		{
+			name:    "additionalProperties",
+			profile: "gemini",
+			schema:  `{"type":"object","additionalProperties":false,"properties":{"tags":{"type":"object","additionalProperties":{"type":"string"}}}}`,
+			want:    `{"type":"object","properties":{"tags":{"type":"object"}}}`,
+		},
+		{
+			name:    "anyOf with null",
+			profile: "gemini",
+			schema:  `{"type":"object","properties":{"a":{"anyOf":[{"type":"string","format":"uri"},{"type":"null"}]}},"required":["a"]}`,
+			want:    `{"type":"object","properties":{"a":{"type":"string","nullable":true}},"required":["a"]}`,
+		},
+		{
+			name:    "anyOf of references",
+			profile: "gemini",
+			schema:  `{"type":"object","$defs":{"Point":{"type":"object","properties":{"x":{"type":"number"}}}},"properties":{"p":{"anyOf":[{"$ref":"#/$defs/Point"},{"type":"string"}]}}}`,
+			want:    `{"type":"object","properties":{"p":{"type":"object","properties":{"x":{"type":"number"}}}}}`,
+		},
+		{
+			name:    "nothing to change",
+			profile: "none",
+			schema:  `{"$schema":"x","type":"object","additionalProperties":false,"properties":{"u":{"type":"string","format":"uri"}}}`,
+			want:    `{"$schema":"x","type":"object","additionalProperties":false,"properties":{"u":{"type":"string","format":"uri"}}}`,
+		},
+	}
+	for _, tt := range tests {
+		schema := decode(t, tt.schema)
+		got := schemaProfiles[tt.profile].Clean(schema)
+		if want := decode(t, tt.want); !reflect.DeepEqual(got, want) {
+			b, _ := json.Marshal(got)
+			t.Errorf("%s, %s: got %s, want %s", tt.profile, tt.name, b, tt.want)
+		}
+		if !reflect.DeepEqual(schema, decode(t, tt.schema)) {
+			t.Errorf("%s, %s: Clean modified its input", tt.profile, tt.name)
+		}
+	}
+}
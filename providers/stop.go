@@ -0,0 +1,44 @@
+package providers
+
+import "slices"
+
+// stopSequenceFields are the choice fields OpenAI-compatible servers use to
+// name the stop string that ended generation: vLLM's stop_reason, SGLang's
+// matched_stop and stop_sequence from Anthropic-flavored routers.
+var stopSequenceFields = []string{"stop_reason", "matched_stop", "stop_sequence"}
+
+// openAIStopSequence reports whether one of seqs ended an OpenAI choice and
+// returns it. OpenAI itself finishes with a plain "stop" either way, so only
+// servers that report the match are detected.
+func openAIStopSequence(choice map[string]interface{}, seqs []string) (*string, bool) {
+	if len(seqs) == 0 {
+		return nil, false
+	}
+	for _, key := range stopSequenceFields {
+		if s, ok := choice[key].(string); ok && slices.Contains(seqs, s) {
+			return &s, true
+		}
+	}
+	if reason, _ := choice["native_finish_reason"].(string); reason == "stop_sequence" {
+		return soleSequence(seqs), true
+	}
+	return nil, false
+}
+
+// matchedSequence returns v if it names one of seqs, otherwise the single
+// requested sequence, which must be the one that matched.
+func matchedSequence(v interface{}, seqs []string) *string {
+	if s, ok := v.(string); ok && slices.Contains(seqs, s) {
+		return &s
+	}
+	return soleSequence(seqs)
+}
+
+// soleSequence returns the only requested stop sequence, or nil when there
+// are several and the match is unknown.
+func soleSequence(seqs []string) *string {
+	if len(seqs) != 1 {
+		return nil
+	}
+	return &seqs[0]
+}
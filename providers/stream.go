@@ -0,0 +1,156 @@
+package providers
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"strings"
+)
+
+// ChunkReader yields decoded chunks from an upstream stream.
+type ChunkReader interface {
+	// Next returns the next chunk with its raw encoding, or io.EOF once the
+	// stream ends. A nil chunk with a nil error marks an undecodable chunk.
+	Next() (map[string]interface{}, []byte, error)
+}
+
+// StreamDecoder is implemented by providers whose streams are not
+// server-sent events.
+type StreamDecoder interface {
+	DecodeStream(r io.Reader) ChunkReader
+}
+
+// StreamMarker is implemented by providers that request a streamed
+// response with something other than OpenAI's stream and stream_options.
+type StreamMarker interface {
+	MarkStream(payload map[string]interface{})
+}
+
+// MarkStream requests a streamed response with usage in prov's payload.
+func MarkStream(prov Provider, payload map[string]interface{}) {
+	if m, ok := unwrap(prov).(StreamMarker); ok {
+		m.MarkStream(payload)
+		return
+	}
+	payload["stream"] = true
+	payload["stream_options"] = map[string]interface{}{"include_usage": true}
+}
+
+// NewChunkReader returns a reader for prov's stream framing, defaulting to
+// server-sent events.
+func NewChunkReader(prov Provider, r io.Reader) ChunkReader {
+	if d, ok := unwrap(prov).(StreamDecoder); ok {
+		return d.DecodeStream(r)
+	}
+	return &sseReader{r: bufio.NewReader(r)}
+}
+
+// sseReader decodes the JSON payloads of "data:" lines, stopping at [DONE].
+type sseReader struct {
+	r *bufio.Reader
+}
+
+// Next satisfies ChunkReader.
+func (s *sseReader) Next() (map[string]interface{}, []byte, error) {
+	for {
+		line, err := s.r.ReadString('\n')
+		line = strings.TrimSpace(line)
+		if data, ok := strings.CutPrefix(line, "data:"); ok {
+			data = strings.TrimSpace(data)
+			if data == "[DONE]" {
+				return nil, nil, io.EOF
+			}
+			var chunk map[string]interface{}
+			if json.Unmarshal([]byte(data), &chunk) != nil {
+				chunk = nil
+			}
+			return chunk, []byte(data), nil
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+}
+
+// emitMessageStart sends message_start followed by a ping, as Anthropic does.
+func emitMessageStart(emit EmitFunc, id, model string) error {
+	err := emit("message_start", map[string]interface{}{
+		"type": "message_start",
+		"message": map[string]interface{}{
+			"id":            id,
+			"type":          "message",
+			"role":          "assistant",
+			"model":         model,
+			"content":       []interface{}{},
+			"stop_reason":   nil,
+			"stop_sequence": nil,
+			"usage":         map[string]interface{}{"input_tokens": 0, "output_tokens": 0},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	return emit("ping", map[string]interface{}{"type": "ping"})
+}
+
+// emitToolUseBlock sends a complete tool_use block at index, with the input
+// delivered as a single input_json_delta.
+func emitToolUseBlock(emit EmitFunc, index int, id, name, argsJSON string) error {
+	events := []struct {
+		name string
+		data map[string]interface{}
+	}{
+		{"content_block_start", map[string]interface{}{
+			"type":  "content_block_start",
+			"index": index,
+			"content_block": map[string]interface{}{
+				"type":  "tool_use",
+				"id":    id,
+				"name":  name,
+				"input": map[string]interface{}{},
+			},
+		}},
+		{"content_block_delta", map[string]interface{}{
+			"type":  "content_block_delta",
+			"index": index,
+			"delta": map[string]interface{}{"type": "input_json_delta", "partial_json": argsJSON},
+		}},
+		{"content_block_stop", map[string]interface{}{"type": "content_block_stop", "index": index}},
+	}
+	for _, ev := range events {
+		if err := emit(ev.name, ev.data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// emitMessageEnd sends the final message_delta and message_stop events.
+// stopSequence is the matched stop sequence, or nil.
+func emitMessageEnd(emit EmitFunc, stopReason string, stopSequence *string, usage Usage) error {
+	err := emit("message_delta", map[string]interface{}{
+		"type":  "message_delta",
+		"delta": map[string]interface{}{"stop_reason": stopReason, "stop_sequence": stopSequence},
+		"usage": usage.JSON(),
+	})
+	if err != nil {
+		return err
+	}
+	return emit("message_stop", map[string]interface{}{"type": "message_stop"})
+}
+
+// emptyBlock returns the content_block that opens a text or thinking block.
+func emptyBlock(kind string) map[string]interface{} {
+	if kind == "thinking" {
+		return map[string]interface{}{"type": "thinking", "thinking": "", "signature": ""}
+	}
+	return map[string]interface{}{"type": "text", "text": ""}
+}
+
+// blockDelta returns the delta that appends txt to a text or thinking block.
+func blockDelta(kind, txt string) map[string]interface{} {
+	if kind == "thinking" {
+		return map[string]interface{}{"type": "thinking_delta", "thinking": txt}
+	}
+	return map[string]interface{}{"type": "text_delta", "text": txt}
+}
@@ -0,0 +1,53 @@
+package providers
+
+import (
+	"strings"
+
+	"gopenbridge/models"
+)
+
+// thinkingBudget returns the budget of an enabled thinking request, or
+// false when the request does not ask for thinking.
+func thinkingBudget(req *models.MessagesRequest) (int, bool) {
+	if req.Thinking == nil || req.Thinking.Type != "enabled" {
+		return 0, false
+	}
+	return req.Thinking.BudgetTokens, true
+}
+
+// reasoningEffort maps a thinking budget to an OpenAI reasoning_effort.
+// Claude Code asks for about 4k tokens to "think" and 32k to "ultrathink".
+func reasoningEffort(budget int) string {
+	switch {
+	case budget <= 4096:
+		return "low"
+	case budget <= 16384:
+		return "medium"
+	}
+	return "high"
+}
+
+// reasoningModel reports whether model is named like an OpenAI reasoning
+// model, such as o3 or gpt-5, ignoring any vendor prefix. Deployments with
+// other names are configured with reasoning_models.
+func reasoningModel(model string) bool {
+	name := strings.ToLower(model)
+	if i := strings.LastIndex(name, "/"); i != -1 {
+		name = name[i+1:]
+	}
+	if len(name) > 1 && name[0] == 'o' && name[1] >= '0' && name[1] <= '9' {
+		return true
+	}
+	return strings.HasPrefix(name, "gpt-5")
+}
+
+// geminiMaxThinking is the largest thinking budget every Gemini 2.5 model
+// accepts.
+const geminiMaxThinking = 24576
+
+// geminiThinks reports whether a Gemini model accepts a thinking budget,
+// which arrived with Gemini 2.5.
+func geminiThinks(model string) bool {
+	name := strings.TrimPrefix(strings.ToLower(model), "models/")
+	return !strings.HasPrefix(name, "gemini-1") && !strings.HasPrefix(name, "gemini-2.0")
+}
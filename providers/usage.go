@@ -0,0 +1,43 @@
+package providers
+
+// Usage holds an upstream response's token counts. InputTokens covers the
+// whole prompt, including the tokens read from or written to the prompt
+// cache.
+type Usage struct {
+	InputTokens      int
+	OutputTokens     int
+	CacheReadTokens  int // Prompt tokens served from the upstream's cache
+	CacheWriteTokens int // Prompt tokens written to the upstream's cache
+}
+
+// JSON renders u as an Anthropic usage object. Anthropic counts cached
+// tokens apart from input_tokens, so they are subtracted from it.
+func (u Usage) JSON() map[string]interface{} {
+	res := map[string]interface{}{
+		"input_tokens":  max(u.InputTokens-u.CacheReadTokens-u.CacheWriteTokens, 0),
+		"output_tokens": u.OutputTokens,
+	}
+	if u.CacheReadTokens > 0 || u.CacheWriteTokens > 0 {
+		res["cache_read_input_tokens"] = u.CacheReadTokens
+		res["cache_creation_input_tokens"] = u.CacheWriteTokens
+	}
+	return res
+}
+
+// openAIUsage reads an OpenAI usage object. Cache hits are reported as
+// prompt_tokens_details.cached_tokens by OpenAI and OpenRouter, which also
+// reports cache_write_tokens, and as prompt_cache_hit_tokens by DeepSeek.
+func openAIUsage(usage map[string]interface{}) Usage {
+	pt, _ := usage["prompt_tokens"].(float64)
+	ct, _ := usage["completion_tokens"].(float64)
+	u := Usage{InputTokens: int(pt), OutputTokens: int(ct)}
+	details, _ := usage["prompt_tokens_details"].(map[string]interface{})
+	if read, ok := details["cached_tokens"].(float64); ok {
+		u.CacheReadTokens = int(read)
+	} else if read, ok := usage["prompt_cache_hit_tokens"].(float64); ok {
+		u.CacheReadTokens = int(read)
+	}
+	write, _ := details["cache_write_tokens"].(float64)
+	u.CacheWriteTokens = int(write)
+	return u
+}
@@ -0,0 +1,77 @@
+package providers
+
+import (
+	"fmt"
+	"net/url"
+
+	"gopenbridge/awsauth"
+)
+
+// Validator is implemented by providers with requirements on their
+// upstream settings.
+type Validator interface {
+	// Validate describes what up lacks for the provider, nil if nothing.
+	Validate(up Upstream) []string
+}
+
+// Validate returns what is wrong with reaching up through p: a base URL
+// that is not an http or https URL, and whatever p's Validator reports,
+// looking through tool emulation.
+func Validate(p Provider, up Upstream) []string {
+	var res []string
+	if up.BaseURL != "" {
+		if u, err := url.Parse(up.BaseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			res = append(res, fmt.Sprintf("base_url %q is not an http or https URL", up.BaseURL))
+		}
+	}
+	if v, ok := unwrap(p).(Validator); ok {
+		res = append(res, v.Validate(up)...)
+	}
+	return res
+}
+
+// Validate satisfies Validator. Hosted providers need an API key; generic
+// OpenAI-compatible servers are often local and may not.
+func (o *OpenAI) Validate(up Upstream) []string {
+	var res []string
+	if up.BaseURL == "" {
+		res = append(res, "base_url is required")
+	}
+	if up.APIKey == "" && o.ProviderName != openAICompatibleName {
+		res = append(res, "api_key is required for "+o.ProviderName)
+	}
+	return res
+}
+
+// Validate satisfies Validator.
+func (a *Anthropic) Validate(up Upstream) []string {
+	if up.APIKey == "" {
+		return []string{"api_key is required for anthropic-messages"}
+	}
+	return nil
+}
+
+// Validate satisfies Validator.
+func (g *Gemini) Validate(up Upstream) []string {
+	if up.APIKey == "" {
+		return []string{"api_key is required for gemini"}
+	}
+	return nil
+}
+
+// Validate satisfies Validator.
+func (o *Ollama) Validate(up Upstream) []string {
+	if up.BaseURL == "" {
+		return []string{"base_url is required, e.g. http://localhost:11434"}
+	}
+	return nil
+}
+
+// Validate satisfies Validator. Requests are signed with AWS credentials
+// rather than an API key.
+func (b *Bedrock) Validate(up Upstream) []string {
+	if _, err := awsauth.LoadCredentials(up.AWSProfile); err != nil {
+		return []string{"no AWS credentials: " + err.Error()}
+	}
+	return nil
+}
@@ -0,0 +1,232 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"gopenbridge/models"
+	"gopenbridge/providers"
+)
+
+// aggregateWith performs one buffered request against an upstream marked
+// always_stream: req is sent with stream=true and the translated events are
+// collected into the message a non-streaming upstream would have returned.
+func (p *ChatProxy) aggregateWith(ctx context.Context, t target, req *models.MessagesRequest, opts providers.Options, includeRaw bool) (map[string]interface{}, error) {
+	logID := requestFrom(ctx).id
+	r, payload, err := p.buildPayload(ctx, t, req, opts)
+	if err != nil {
+		return nil, err
+	}
+	providers.MarkStream(t.prov, payload)
+	body, _ := json.Marshal(payload)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	httpRes, endpoint, retries, err := p.sendUpstream(ctx, t, logID, r, body, true)
+	if err != nil {
+		return nil, err
+	}
+	defer httpRes.Body.Close()
+	if httpRes.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(httpRes.Body)
+		requestFrom(ctx).failed = &logEntry{
+			ID:         logID,
+			Provider:   t.up.BaseURL,
+			Endpoint:   endpoint,
+			Model:      r.Model,
+			Request:    string(body),
+			Response:   string(data),
+			StatusCode: httpRes.StatusCode,
+			Retries:    retries,
+		}
+		if _, err := p.decodeUpstream(ctx, httpRes, data); err != nil {
+			return nil, err
+		}
+		return nil, upstreamResponseError(httpRes, fmt.Sprintf("upstream returned status %d", httpRes.StatusCode))
+	}
+
+	var agg messageAggregator
+	tr := t.prov.StreamTranslator("msg_"+logID, r.Model, opts, agg.event)
+	var idleExpired atomic.Bool
+	var idle *time.Timer
+	if p.cfg().StreamIdleTimeout > 0 {
+		idle = time.AfterFunc(p.cfg().StreamIdleTimeout, func() {
+			idleExpired.Store(true)
+			cancel()
+		})
+		defer idle.Stop()
+	}
+	var raw strings.Builder
+	streamErr := func() error {
+		if err := tr.Start(); err != nil {
+			return err
+		}
+		reader := providers.NewChunkReader(t.prov, httpRes.Body)
+		for {
+			chunk, data, readErr := reader.Next()
+			if readErr == io.EOF {
+				break
+			}
+			if readErr != nil {
+				return readErr
+			}
+			if idle != nil {
+				idle.Reset(p.cfg().StreamIdleTimeout)
+			}
+			raw.Write(data)
+			raw.WriteString("\n")
+			if chunk == nil {
+				requestFrom(ctx).logger.Debug("Skipping undecodable stream chunk", "data", string(data))
+			} else if errRaw, exists := chunk["error"]; exists {
+				return fmt.Errorf("upstream stream error: %v", errRaw)
+			} else if err := tr.Chunk(chunk); err != nil {
+				return err
+			}
+		}
+		return tr.Finish()
+	}()
+	if idleExpired.Load() {
+		streamErr = fmt.Errorf("upstream stream idle for %s", p.cfg().StreamIdleTimeout)
+	}
+
+	usage := tr.Usage()
+	entry := logEntry{
+		ID:               logID,
+		Provider:         t.up.BaseURL,
+		Endpoint:         endpoint,
+		Model:            r.Model,
+		Request:          string(body),
+		Response:         raw.String(),
+		StatusCode:       httpRes.StatusCode,
+		StopReason:       tr.StopReason(),
+		PromptTokens:     usage.InputTokens,
+		CompletionTokens: usage.OutputTokens,
+		Retries:          retries,
+		CostUSD:          p.cost(r.Model, usage.InputTokens, usage.OutputTokens),
+	}
+	if streamErr != nil {
+		entry.ErrorMessage = streamErr.Error()
+		if ctx.Err() != nil && !idleExpired.Load() {
+			entry.StopReason = stopReasonCancelled
+			p.persistLog(ctx, entry)
+			return nil, ctx.Err()
+		}
+		p.persistLog(ctx, entry)
+		return nil, upstreamAPIError(streamErr.Error())
+	}
+	requestFrom(ctx).costUSD = entry.CostUSD
+	p.persistLog(ctx, entry)
+
+	res := agg.message()
+	content, _ := res["content"].([]interface{})
+	requestFrom(ctx).toolNames.restore(content)
+	if opts.RepairToolArgs {
+		requestFrom(ctx).toolArgProblems = checkToolArgs(req.Tools, &providers.Response{Content: content}, requestFrom(ctx).logger)
+	}
+	if includeRaw {
+		res["upstream_response"] = raw.String()
+	}
+	return res, nil
+}
+
+// messageAggregator rebuilds a message from the Anthropic SSE events of its
+// stream.
+type messageAggregator struct {
+	msg    map[string]interface{}
+	blocks []map[string]interface{}
+	inputs map[int]*strings.Builder // partial_json of tool_use blocks, by index
+}
+
+// event satisfies the emit callback of a StreamTranslator.
+func (a *messageAggregator) event(name string, data interface{}) error {
+	// Translators emit their own map shapes, so events are normalized
+	// through JSON
+	var ev map[string]interface{}
+	b, _ := json.Marshal(data)
+	json.Unmarshal(b, &ev)
+	index := -1
+	if f, ok := ev["index"].(float64); ok {
+		index = int(f)
+	}
+	switch name {
+	case "message_start":
+		a.msg, _ = ev["message"].(map[string]interface{})
+	case "content_block_start":
+		blk, _ := ev["content_block"].(map[string]interface{})
+		for len(a.blocks) <= index {
+			a.blocks = append(a.blocks, nil)
+		}
+		if index >= 0 {
+			a.blocks[index] = blk
+		}
+	case "content_block_delta":
+		if index < 0 || index >= len(a.blocks) || a.blocks[index] == nil {
+			return nil
+		}
+		blk := a.blocks[index]
+		delta, _ := ev["delta"].(map[string]interface{})
+		switch delta["type"] {
+		case "text_delta":
+			s, _ := delta["text"].(string)
+			prev, _ := blk["text"].(string)
+			blk["text"] = prev + s
+		case "thinking_delta":
+			s, _ := delta["thinking"].(string)
+			prev, _ := blk["thinking"].(string)
+			blk["thinking"] = prev + s
+		case "signature_delta":
+			blk["signature"] = delta["signature"]
+		case "input_json_delta":
+			s, _ := delta["partial_json"].(string)
+			if a.inputs == nil {
+				a.inputs = map[int]*strings.Builder{}
+			}
+			if a.inputs[index] == nil {
+				a.inputs[index] = &strings.Builder{}
+			}
+			a.inputs[index].WriteString(s)
+		}
+	case "message_delta":
+		if a.msg == nil {
+			a.msg = map[string]interface{}{}
+		}
+		delta, _ := ev["delta"].(map[string]interface{})
+		maps.Copy(a.msg, delta)
+		if u, ok := ev["usage"].(map[string]interface{}); ok {
+			usage, _ := a.msg["usage"].(map[string]interface{})
+			if usage == nil {
+				usage = map[string]interface{}{}
+			}
+			maps.Copy(usage, u)
+			a.msg["usage"] = usage
+		}
+	}
+	return nil
+}
+
+// message returns the aggregated message.
+func (a *messageAggregator) message() map[string]interface{} {
+	res := map[string]interface{}{"type": "message", "role": "assistant"}
+	maps.Copy(res, a.msg)
+	content := []interface{}{}
+	for i, blk := range a.blocks {
+		if blk == nil {
+			continue
+		}
+		if sb, ok := a.inputs[i]; ok && blk["type"] == "tool_use" {
+			var input interface{}
+			if json.Unmarshal([]byte(sb.String()), &input) == nil {
+				blk["input"] = input
+			}
+		}
+		content = append(content, blk)
+	}
+	res["content"] = content
+	return res
+}
@@ -0,0 +1,59 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"gopenbridge/keys"
+	"gopenbridge/logstore"
+)
+
+// authenticate checks the client's x-api-key or bearer token against the
+// configured static keys and the virtual key store. Authentication is
+// disabled while neither has any keys. Requests made with a virtual key are
+// tagged with it in ctx and held to its rate limit and daily token quota.
+func (p *ChatProxy) authenticate(ctx context.Context, r *http.Request) error {
+	active, err := p.keys.Active(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load virtual keys: %w", err)
+	}
+	if len(p.cfg().AuthKeys) == 0 && !active {
+		return nil
+	}
+	secret := keys.FromRequest(r)
+	if secret == "" {
+		return unauthenticated("x-api-key header is required")
+	}
+	if keys.MatchStatic(secret, p.cfg().AuthKeys) {
+		return nil
+	}
+	key, err := p.keys.Lookup(ctx, secret)
+	if err != nil {
+		return fmt.Errorf("failed to look up virtual key: %w", err)
+	}
+	if key == nil {
+		return unauthenticated("invalid x-api-key")
+	}
+	info := requestFrom(ctx)
+	info.key = key
+	info.logger = info.logger.With("key", key.Name)
+	if key.RateLimit > 0 {
+		if ok, wait := p.limiterFor("vkey:"+key.Name, key.RateLimit).allow(); !ok {
+			err := rateLimited(fmt.Sprintf("key %q exceeded its rate limit of %d requests per minute", key.Name, key.RateLimit))
+			err.RetryAfter = wait
+			return err
+		}
+	}
+	if key.DailyTokens > 0 {
+		used, err := p.logStore.Totals(ctx, logstore.Filter{Key: key.Name, Since: time.Now()})
+		if err != nil {
+			return fmt.Errorf("failed to compute key usage: %w", err)
+		}
+		if used.Tokens >= key.DailyTokens {
+			return rateLimited(fmt.Sprintf("key %q exhausted its daily quota of %d tokens", key.Name, key.DailyTokens))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,440 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopenbridge/batches"
+	"gopenbridge/keys"
+	"gopenbridge/models"
+	"gopenbridge/sched"
+)
+
+const (
+	// batchExpiry is how long a batch may take before its remaining
+	// requests expire, as with Anthropic's API.
+	batchExpiry = 24 * time.Hour
+	// batchPollInterval is how often idle batch workers look for work they
+	// were not woken for, e.g. requests queued again after a restart.
+	batchPollInterval = 5 * time.Second
+	// maxBatchRequests caps the requests in one batch.
+	maxBatchRequests = 100000
+)
+
+// customIDPattern matches the custom_id values Anthropic accepts.
+var customIDPattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// ServeBatches answers the Message Batches API under /v1/messages/batches:
+// create, list, retrieve, results, cancel and delete. Batched requests are
+// stored in the database and run in the background by the batch workers.
+// Clients using a virtual key only see the batches they created.
+func (p *ChatProxy) ServeBatches(w http.ResponseWriter, r *http.Request) {
+	info := newRequestInfo()
+	ctx := withRequestInfo(r.Context(), info)
+	writeRequestID(w, info)
+	if err := p.authenticate(ctx, r); err != nil {
+		p.fail(ctx, w, err)
+		return
+	}
+	if p.cfg().BatchWorkers <= 0 {
+		writeError(w, &APIError{Status: http.StatusNotFound, Type: "not_found_error", Message: "message batches are disabled"})
+		return
+	}
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/v1/messages/batches"), "/")
+	id, action, _ := strings.Cut(rest, "/")
+	switch {
+	case id == "" && r.Method == http.MethodPost:
+		p.createBatch(ctx, w, r)
+	case id == "" && r.Method == http.MethodGet:
+		p.listBatches(ctx, w, r)
+	case action == "" && r.Method == http.MethodGet:
+		if b := p.findBatch(ctx, w, id); b != nil {
+			writeBatch(w, r, b)
+		}
+	case action == "" && r.Method == http.MethodDelete:
+		if b := p.findBatch(ctx, w, id); b != nil {
+			p.deleteBatch(ctx, w, b)
+		}
+	case action == "results" && r.Method == http.MethodGet:
+		if b := p.findBatch(ctx, w, id); b != nil {
+			p.writeBatchResults(ctx, w, b)
+		}
+	case action == "cancel" && r.Method == http.MethodPost:
+		if b := p.findBatch(ctx, w, id); b != nil {
+			p.cancelBatch(ctx, w, r, b)
+		}
+	case action != "" && action != "results" && action != "cancel":
+		writeError(w, &APIError{Status: http.StatusNotFound, Type: "not_found_error", Message: "not found: " + r.URL.Path})
+	default:
+		writeError(w, &APIError{Status: http.StatusMethodNotAllowed, Type: "invalid_request_error", Message: "method not allowed"})
+	}
+}
+
+// batchOwner is the virtual key name batches created in ctx belong to,
+// empty for static auth keys and open proxies.
+func batchOwner(ctx context.Context) string {
+	if k := requestFrom(ctx).key; k != nil {
+		return k.Name
+	}
+	return ""
+}
+
+// createBatch validates and stores a new batch, then wakes a worker.
+func (p *ChatProxy) createBatch(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	if err := p.limitInbound(ctx, r); err != nil {
+		p.fail(ctx, w, err)
+		return
+	}
+	if err := p.checkBudgets(ctx, w); err != nil {
+		p.fail(ctx, w, err)
+		return
+	}
+	var body struct {
+		Requests []batches.Item `json:"requests"`
+	}
+	if _, err := p.decodeBody(w, r, &body); err != nil {
+		p.fail(ctx, w, err)
+		return
+	}
+	if len(body.Requests) == 0 {
+		p.fail(ctx, w, invalidRequest("requests: must contain at least one request"))
+		return
+	}
+	if len(body.Requests) > maxBatchRequests {
+		p.fail(ctx, w, invalidRequest(fmt.Sprintf("requests: at most %d requests are allowed", maxBatchRequests)))
+		return
+	}
+	seen := make(map[string]bool, len(body.Requests))
+	for i, item := range body.Requests {
+		if !customIDPattern.MatchString(item.CustomID) {
+			p.fail(ctx, w, invalidRequest(fmt.Sprintf("requests.%d.custom_id: must be 1-64 letters, digits, underscores or hyphens", i)))
+			return
+		}
+		if seen[item.CustomID] {
+			p.fail(ctx, w, invalidRequest(fmt.Sprintf("requests.%d.custom_id: duplicate custom_id %q", i, item.CustomID)))
+			return
+		}
+		seen[item.CustomID] = true
+		var req models.MessagesRequest
+		if err := json.Unmarshal(item.Params, &req); err != nil {
+			p.fail(ctx, w, invalidRequest(fmt.Sprintf("requests.%d.params: %v", i, err)))
+			return
+		}
+		if req.Stream != nil && *req.Stream {
+			p.fail(ctx, w, invalidRequest(fmt.Sprintf("requests.%d.params.stream: streaming is not supported in batches", i)))
+			return
+		}
+	}
+	b, err := p.batches.Create(ctx, batchOwner(ctx), body.Requests)
+	if err != nil {
+		p.fail(ctx, w, fmt.Errorf("failed to store batch: %w", err))
+		return
+	}
+	requestFrom(ctx).logger.Info("Created message batch", "batch_id", b.ID, "requests", len(body.Requests))
+	p.wakeBatchWorker()
+	writeBatch(w, r, b)
+}
+
+// listBatches answers GET /v1/messages/batches, newest first, with the
+// limit, after_id and before_id parameters.
+func (p *ChatProxy) listBatches(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	limit := 20
+	if v, err := strconv.Atoi(q.Get("limit")); err == nil {
+		if v < 1 || v > 1000 {
+			writeError(w, invalidRequest("limit must be between 1 and 1000"))
+			return
+		}
+		limit = v
+	}
+	all, err := p.batches.List(ctx)
+	if err != nil {
+		p.fail(ctx, w, fmt.Errorf("failed to list batches: %w", err))
+		return
+	}
+	owner := batchOwner(ctx)
+	var list []*batches.Batch
+	for _, id := range all {
+		b, err := p.batches.Get(ctx, id)
+		if err != nil {
+			p.fail(ctx, w, fmt.Errorf("failed to load batch: %w", err))
+			return
+		}
+		if owner == "" || b.KeyName == owner {
+			list = append(list, b)
+		}
+	}
+	start, end := 0, len(list)
+	if id := q.Get("after_id"); id != "" {
+		start = slices.IndexFunc(list, func(b *batches.Batch) bool { return b.ID == id }) + 1
+	}
+	if id := q.Get("before_id"); id != "" {
+		if i := slices.IndexFunc(list, func(b *batches.Batch) bool { return b.ID == id }); i != -1 {
+			end = i
+		}
+	}
+	if start > end {
+		start = end
+	}
+	page := list[start:end]
+	hasMore := false
+	if len(page) > limit {
+		hasMore = true
+		if q.Get("before_id") != "" {
+			page = page[len(page)-limit:]
+		} else {
+			page = page[:limit]
+		}
+	}
+	data := make([]map[string]interface{}, len(page))
+	for i, b := range page {
+		data[i] = batchObject(r, b)
+	}
+	res := map[string]interface{}{"data": data, "has_more": hasMore, "first_id": nil, "last_id": nil}
+	if len(page) > 0 {
+		res["first_id"], res["last_id"] = page[0].ID, page[len(page)-1].ID
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+// findBatch loads a batch the client may see, writing a not_found_error
+// and returning nil otherwise.
+func (p *ChatProxy) findBatch(ctx context.Context, w http.ResponseWriter, id string) *batches.Batch {
+	b, err := p.batches.Get(ctx, id)
+	if err == nil && (batchOwner(ctx) == "" || b.KeyName == batchOwner(ctx)) {
+		return b
+	}
+	if err == nil || errors.Is(err, batches.ErrNotFound) {
+		writeError(w, &APIError{Status: http.StatusNotFound, Type: "not_found_error", Message: "message batch: " + id})
+		return nil
+	}
+	p.fail(ctx, w, fmt.Errorf("failed to load batch: %w", err))
+	return nil
+}
+
+// cancelBatch cancels a batch's pending requests and returns the batch.
+func (p *ChatProxy) cancelBatch(ctx context.Context, w http.ResponseWriter, r *http.Request, b *batches.Batch) {
+	if b.EndedAt == nil {
+		if err := p.batches.Cancel(ctx, b.ID); err != nil {
+			p.fail(ctx, w, fmt.Errorf("failed to cancel batch: %w", err))
+			return
+		}
+	}
+	b = p.findBatch(ctx, w, b.ID)
+	if b != nil {
+		writeBatch(w, r, b)
+	}
+}
+
+// deleteBatch removes an ended batch and its results.
+func (p *ChatProxy) deleteBatch(ctx context.Context, w http.ResponseWriter, b *batches.Batch) {
+	err := p.batches.Delete(ctx, b.ID)
+	if errors.Is(err, batches.ErrNotEnded) {
+		writeError(w, invalidRequest("message batch "+b.ID+" cannot be deleted while it is processing; cancel it first"))
+		return
+	}
+	if err != nil {
+		p.fail(ctx, w, fmt.Errorf("failed to delete batch: %w", err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"id": b.ID, "type": "message_batch_deleted"})
+}
+
+// writeBatchResults streams an ended batch's results as JSONL, one line per
+// request in submission order.
+func (p *ChatProxy) writeBatchResults(ctx context.Context, w http.ResponseWriter, b *batches.Batch) {
+	if b.EndedAt == nil {
+		writeError(w, invalidRequest("message batch "+b.ID+" is still processing; results are available once it has ended"))
+		return
+	}
+	results, err := p.batches.Results(ctx, b.ID)
+	if err != nil {
+		p.fail(ctx, w, fmt.Errorf("failed to load batch results: %w", err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-jsonl")
+	enc := json.NewEncoder(w)
+	for _, res := range results {
+		var result interface{} = res.Result
+		if res.Result == nil {
+			result = map[string]interface{}{"type": res.Status}
+		}
+		enc.Encode(map[string]interface{}{"custom_id": res.CustomID, "result": result})
+	}
+}
+
+// writeBatch writes b as a message_batch object.
+func writeBatch(w http.ResponseWriter, r *http.Request, b *batches.Batch) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(batchObject(r, b))
+}
+
+// batchObject renders b in Anthropic's message_batch format. The results URL
+// points back at the proxy that served r.
+func batchObject(r *http.Request, b *batches.Batch) map[string]interface{} {
+	status := "in_progress"
+	if b.CancelInitiatedAt != nil {
+		status = "canceling"
+	}
+	var resultsURL interface{}
+	if b.EndedAt != nil {
+		status = "ended"
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+		resultsURL = scheme + "://" + r.Host + "/v1/messages/batches/" + b.ID + "/results"
+	}
+	return map[string]interface{}{
+		"id":                  b.ID,
+		"type":                "message_batch",
+		"processing_status":   status,
+		"request_counts":      b.Counts,
+		"created_at":          b.CreatedAt,
+		"ended_at":            b.EndedAt,
+		"expires_at":          b.CreatedAt.Add(batchExpiry),
+		"cancel_initiated_at": b.CancelInitiatedAt,
+		"archived_at":         nil,
+		"results_url":         resultsURL,
+	}
+}
+
+// StartBatchWorkers runs the configured number of batch workers until ctx
+// is done, and expires batches older than a day. The worker count is read
+// once; changing batch_workers needs a restart.
+func (p *ChatProxy) StartBatchWorkers(ctx context.Context) {
+	n := p.cfg().BatchWorkers
+	if n <= 0 {
+		return
+	}
+	for range n {
+		go p.batchWorker(ctx)
+	}
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for {
+			if err := p.batches.Expire(ctx, time.Now().Add(-batchExpiry)); err != nil && ctx.Err() == nil {
+				slog.Error("Failed to expire message batches", "error", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	slog.Info("Started batch workers", "workers", n, "rate_limit", p.cfg().BatchRateLimit)
+}
+
+// wakeBatchWorker signals one idle batch worker, if none is signaled yet.
+func (p *ChatProxy) wakeBatchWorker() {
+	select {
+	case p.batchWake <- struct{}{}:
+	default:
+	}
+}
+
+// batchWorker claims and runs pending batched requests one at a time.
+func (p *ChatProxy) batchWorker(ctx context.Context) {
+	for {
+		req, err := p.batches.Claim(ctx)
+		if err != nil && ctx.Err() == nil {
+			slog.Error("Failed to claim batched request", "error", err)
+		}
+		if req == nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-p.batchWake:
+			case <-time.After(batchPollInterval):
+			}
+			continue
+		}
+		// More requests are likely pending, so pass the signal on to
+		// another idle worker.
+		p.wakeBatchWorker()
+		if !p.waitBatchSlot(ctx) {
+			return
+		}
+		p.runBatchRequest(ctx, req)
+	}
+}
+
+// waitBatchSlot blocks until batch_rate_limit allows another request,
+// reporting false if ctx ends first.
+func (p *ChatProxy) waitBatchSlot(ctx context.Context) bool {
+	for {
+		limit := p.cfg().BatchRateLimit
+		if limit <= 0 {
+			return true
+		}
+		ok, wait := p.limiterFor("batches", limit).allow()
+		if ok {
+			return true
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(wait):
+		}
+	}
+}
+
+// runBatchRequest sends one batched request upstream at background priority
+// and records its result. Requests interrupted by shutdown are left
+// processing and queued again on the next start.
+func (p *ChatProxy) runBatchRequest(ctx context.Context, breq *batches.Request) {
+	info := newRequestInfo()
+	info.priority = sched.Background
+	if breq.KeyName != "" {
+		info.key = &keys.Key{Name: breq.KeyName}
+	}
+	info.logger = info.logger.With("batch_id", breq.BatchID, "custom_id", breq.CustomID)
+	ctx = withRequestInfo(ctx, info)
+
+	info.clientRequest = breq.Params
+	var req models.MessagesRequest
+	json.Unmarshal(breq.Params, &req)
+	req.Stream = nil
+	if req.Metadata != nil {
+		info.userID = req.Metadata.UserID
+	}
+	res, err := p.processRequest(ctx, &req, false)
+	if ctx.Err() != nil {
+		return
+	}
+	status := batches.StatusSucceeded
+	result := map[string]interface{}{"type": "succeeded", "message": res}
+	if err != nil {
+		info.logger.Warn("Batched request failed", "error", err)
+		p.persistFailure(ctx, err)
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) {
+			apiErr = upstreamAPIError(err.Error())
+		}
+		status = batches.StatusErrored
+		result = map[string]interface{}{
+			"type": "errored",
+			"error": map[string]interface{}{
+				"type":  "error",
+				"error": map[string]interface{}{"type": apiErr.Type, "message": apiErr.Message},
+			},
+		}
+	}
+	data, _ := json.Marshal(result)
+	if err := p.batches.Finish(ctx, breq.BatchID, breq.CustomID, status, data); err != nil {
+		info.logger.Error("Failed to record batched request result", "error", err)
+	}
+}
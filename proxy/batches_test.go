@@ -0,0 +1,49 @@
+package proxy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"gopenbridge/config"
+)
+
+func TestCreateBatchRequestTooLarge(t *testing.T) {
+	p := newTestProxy(t, "http://127.0.0.1:0", func(cfg *config.Config) {
+		cfg.BatchWorkers = 1
+		cfg.MaxRequestBytes = 4096
+	})
+	h := DecompressRequests(http.HandlerFunc(p.ServeBatches))
+	post := func(prompt string) *httptest.ResponseRecorder {
+		body := `{"requests":[{"custom_id":"a","params":{"model":"test-model","max_tokens":100,"messages":[{"role":"user","content":"` + prompt + `"}]}}]}`
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		zw.Write([]byte(body))
+		zw.Close()
+		r := httptest.NewRequest(http.MethodPost, "/v1/messages/batches", &buf)
+		r.Header.Set("Content-Type", "application/json")
+		r.Header.Set("Content-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	if w := post("Hi"); w.Code != http.StatusOK {
+		t.Fatalf("small batch: status %d: %s", w.Code, w.Body)
+	}
+	// Compresses to a few hundred bytes, well under the limit
+	w := post(strings.Repeat("a", 1<<20))
+	var res struct {
+		Error struct {
+			Type string `json:"type"`
+		} `json:"error"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &res)
+	if w.Code != http.StatusRequestEntityTooLarge || res.Error.Type != "request_too_large" {
+		t.Errorf("oversized batch: status %d: %s, want a 413 request_too_large", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,44 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strings"
+
+	"gopenbridge/providers"
+)
+
+// knownAnthropicVersions are the anthropic-version values the bridge
+// understands. Others are served the same way, with a warning.
+var knownAnthropicVersions = []string{"2023-06-01", "2023-01-01"}
+
+// readAnthropicHeaders records the client's anthropic-version and
+// anthropic-beta headers on info, warning once about unknown versions.
+func (p *ChatProxy) readAnthropicHeaders(r *http.Request, info *requestInfo) {
+	info.anthropicVersion = r.Header.Get("anthropic-version")
+	for _, v := range r.Header.Values("anthropic-beta") {
+		for _, beta := range strings.Split(v, ",") {
+			if beta = strings.TrimSpace(beta); beta != "" && !slices.Contains(info.betas, beta) {
+				info.betas = append(info.betas, beta)
+			}
+		}
+	}
+	if v := info.anthropicVersion; v != "" && !slices.Contains(knownAnthropicVersions, v) {
+		if _, seen := p.warned.LoadOrStore("version:"+v, true); !seen {
+			info.logger.Warn("Unknown anthropic-version, serving as 2023-06-01", "anthropic_version", v)
+		}
+	}
+}
+
+// warnBetas logs the requested betas t will not honor for model, once per
+// upstream and beta.
+func (p *ChatProxy) warnBetas(ctx context.Context, t target, model string) {
+	info := requestFrom(ctx)
+	for _, beta := range providers.UnsupportedBetas(t.prov, model, info.betas) {
+		if _, seen := p.warned.LoadOrStore("beta:"+t.up.BaseURL+":"+beta, true); !seen {
+			info.logger.Warn("Upstream does not support requested beta feature, ignoring it",
+				"beta", beta, "provider", t.prov.Name(), "upstream", t.up.BaseURL)
+		}
+	}
+}
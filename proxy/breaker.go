@@ -0,0 +1,103 @@
+package proxy
+
+import (
+	"sync"
+	"time"
+)
+
+// breakerState is the state of a circuitBreaker.
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// circuitBreaker trips open after a run of consecutive upstream failures and
+// rejects requests until the cooldown passes, then lets a single trial
+// request through to decide whether to close again.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	state     breakerState
+	openedAt  time.Time
+	trial     bool // a half-open trial request is in flight
+	now       func() time.Time
+}
+
+// newCircuitBreaker returns a breaker that opens after threshold consecutive
+// failures. A threshold of zero or less disables the breaker.
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{threshold: threshold, cooldown: cooldown, now: time.Now}
+}
+
+// configure applies a reloaded threshold and cooldown, keeping the state.
+func (b *circuitBreaker) configure(threshold int, cooldown time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.threshold, b.cooldown = threshold, cooldown
+}
+
+// Allow reports whether a request may be sent upstream. Every request it
+// allows must end with Success, Failure or Abort, or a half-open breaker
+// would wait for its trial forever.
+func (b *circuitBreaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.threshold <= 0 {
+		return true
+	}
+	switch b.state {
+	case breakerOpen:
+		if b.now().Sub(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = breakerHalfOpen
+		b.trial = true
+		return true
+	case breakerHalfOpen:
+		if b.trial {
+			return false
+		}
+		b.trial = true
+		return true
+	}
+	return true
+}
+
+// Success records a successful upstream call and closes the breaker.
+func (b *circuitBreaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+	b.state = breakerClosed
+	b.trial = false
+}
+
+// Failure records a failed upstream call, opening the breaker once the
+// threshold is reached or when a half-open trial fails.
+func (b *circuitBreaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.threshold <= 0 {
+		return
+	}
+	b.failures++
+	if b.state == breakerHalfOpen || b.failures >= b.threshold {
+		b.state = breakerOpen
+		b.openedAt = b.now()
+		b.trial = false
+	}
+}
+
+// Abort ends an allowed request that says nothing about the upstream, such
+// as one the client cancelled or that never got a concurrency slot. A
+// half-open breaker lets the next request through as its trial.
+func (b *circuitBreaker) Abort() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.trial = false
+}
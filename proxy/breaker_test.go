@@ -0,0 +1,114 @@
+package proxy
+
+import (
+	"testing"
+	"time"
+)
+
+// testBreaker returns a breaker on a fake clock and the function that
+// advances it.
+func testBreaker(threshold int, cooldown time.Duration) (*circuitBreaker, func(time.Duration)) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	b := newCircuitBreaker(threshold, cooldown)
+	b.now = func() time.Time { return now }
+	return b, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestBreakerOpensAfterThreshold(t *testing.T) {
+	b, _ := testBreaker(3, time.Minute)
+	for i := range 2 {
+		if !b.Allow() {
+			t.Fatalf("request %d rejected before the threshold", i+1)
+		}
+		b.Failure()
+	}
+	if !b.Allow() {
+		t.Fatal("rejected before the third failure")
+	}
+	b.Failure()
+	if b.Allow() {
+		t.Fatal("allowed after 3 consecutive failures")
+	}
+}
+
+func TestBreakerSuccessResetsFailures(t *testing.T) {
+	b, _ := testBreaker(2, time.Minute)
+	b.Failure()
+	b.Success()
+	b.Failure()
+	if !b.Allow() {
+		t.Fatal("opened on failures that were not consecutive")
+	}
+}
+
+func TestBreakerHalfOpensAfterCooldown(t *testing.T) {
+	b, advance := testBreaker(1, time.Minute)
+	b.Failure()
+	advance(59 * time.Second)
+	if b.Allow() {
+		t.Fatal("allowed before the cooldown passed")
+	}
+	advance(time.Second)
+	if !b.Allow() {
+		t.Fatal("no trial after the cooldown")
+	}
+	if b.Allow() {
+		t.Fatal("second request allowed while the trial is in flight")
+	}
+	b.Success()
+	if !b.Allow() || !b.Allow() {
+		t.Fatal("not closed after a successful trial")
+	}
+}
+
+func TestBreakerFailedTrialReopens(t *testing.T) {
+	b, advance := testBreaker(5, time.Minute)
+	for range 5 {
+		b.Failure()
+	}
+	advance(time.Minute)
+	if !b.Allow() {
+		t.Fatal("no trial after the cooldown")
+	}
+	b.Failure()
+	if b.Allow() {
+		t.Fatal("allowed right after a failed trial")
+	}
+	advance(time.Minute)
+	if !b.Allow() {
+		t.Fatal("no new trial after another cooldown")
+	}
+}
+
+func TestBreakerAbortReleasesTrial(t *testing.T) {
+	b, advance := testBreaker(1, time.Minute)
+	b.Failure()
+	advance(time.Minute)
+	if !b.Allow() {
+		t.Fatal("no trial after the cooldown")
+	}
+	b.Abort()
+	if !b.Allow() {
+		t.Fatal("aborted trial was not released for the next request")
+	}
+	if b.Allow() {
+		t.Fatal("second request allowed while the new trial is in flight")
+	}
+}
+
+func TestBreakerConfigure(t *testing.T) {
+	b, advance := testBreaker(0, time.Minute)
+	b.Failure()
+	if !b.Allow() {
+		t.Fatal("disabled breaker rejected a request")
+	}
+	b.configure(1, 10*time.Second)
+	b.Failure()
+	if b.Allow() {
+		t.Fatal("reconfigured threshold not applied")
+	}
+	advance(10 * time.Second)
+	if !b.Allow() {
+		t.Fatal("reconfigured cooldown not applied")
+	}
+}
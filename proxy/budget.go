@@ -0,0 +1,69 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopenbridge/logstore"
+)
+
+// budgetHeader lists soft budgets that have been reached, e.g.
+// "daily_usd=8.12/8".
+const budgetHeader = "X-Gopenbridge-Budget-Warning"
+
+// checkBudgets compares usage counted by the log store for the current UTC day
+// and month against the configured budgets. A reached hard limit rejects
+// the request with a rate_limit_error; reached soft limits are logged and
+// reported in budgetHeader.
+func (p *ChatProxy) checkBudgets(ctx context.Context, w http.ResponseWriter) error {
+	if len(p.cfg().Budgets) == 0 {
+		return nil
+	}
+	now := time.Now().UTC()
+	day, err := p.logStore.Totals(ctx, logstore.Filter{Since: now})
+	var month logstore.Totals
+	if err == nil {
+		month, err = p.logStore.Totals(ctx, logstore.Filter{Since: time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)})
+	}
+	if err != nil {
+		// Budgets are best effort: an unreadable store must not take the proxy down
+		requestFrom(ctx).logger.Error("Failed to compute budget usage", "error", err)
+		return nil
+	}
+	var warnings []string
+	for _, b := range p.cfg().Budgets {
+		var used float64
+		switch b.Name() {
+		case "daily_tokens":
+			used = float64(day.Tokens)
+		case "daily_usd":
+			used = day.CostUSD
+		case "monthly_tokens":
+			used = float64(month.Tokens)
+		case "monthly_usd":
+			used = month.CostUSD
+		}
+		if b.Hard > 0 && used >= b.Hard {
+			return rateLimited(fmt.Sprintf("%s budget exhausted: used %s of %s", b.Name(), formatUsage(used), formatUsage(b.Hard)))
+		}
+		if b.Soft > 0 && used >= b.Soft {
+			requestFrom(ctx).logger.Warn("Soft budget reached", "budget", b.Name(), "used", used, "soft_limit", b.Soft)
+			warnings = append(warnings, b.Name()+"="+formatUsage(used)+"/"+formatUsage(b.Soft))
+		}
+	}
+	if len(warnings) > 0 {
+		w.Header().Set(budgetHeader, strings.Join(warnings, ", "))
+	}
+	return nil
+}
+
+// formatUsage renders a token count or dollar amount to at most four
+// decimals.
+func formatUsage(v float64) string {
+	return strconv.FormatFloat(math.Round(v*1e4)/1e4, 'f', -1, 64)
+}
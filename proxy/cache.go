@@ -0,0 +1,121 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"gopenbridge/cache"
+	"gopenbridge/models"
+)
+
+// cacheHeader tells the client whether a cacheable response was served
+// from the response cache ("hit") or the upstream ("miss").
+const cacheHeader = "X-Gopenbridge-Cache"
+
+// cacheProvider is logged as the provider of responses served from cache.
+const cacheProvider = "cache"
+
+// cachedEvent is one SSE event of a cached stream.
+type cachedEvent struct {
+	Event string          `json:"event"`
+	Data  json.RawMessage `json:"data"`
+}
+
+// cacheKey returns the response cache key for req, or "" when the response
+// must not be cached: the cache is off, the request is not deterministic
+// (temperature 0), or the client sent Cache-Control: no-store. Streaming
+// and buffered responses are cached separately.
+func (p *ChatProxy) cacheKey(r *http.Request, req *models.MessagesRequest, stream bool) string {
+	cfg := p.cfg()
+	if p.cache == nil || !cfg.CacheEnabled || req.Temperature == nil || *req.Temperature != 0 {
+		return ""
+	}
+	if strings.Contains(r.Header.Get("Cache-Control"), "no-store") {
+		return ""
+	}
+	// Metadata only attributes the request, so users share entries
+	normalized := *req
+	normalized.Stream = &stream
+	normalized.Metadata = nil
+	return cache.Key(cfg.BaseURL, normalized)
+}
+
+// serveCached writes the cached response for key, reporting false on a
+// miss. Cached messages get the current request's ID.
+func (p *ChatProxy) serveCached(ctx context.Context, w http.ResponseWriter, req *models.MessagesRequest, key string, stream bool) bool {
+	value, ok := p.cache.Get(ctx, key)
+	if !ok {
+		return false
+	}
+	info := requestFrom(ctx)
+	id := "msg_" + info.id
+	var stopReason string
+	if stream {
+		var events []cachedEvent
+		if err := json.Unmarshal(value, &events); err != nil {
+			info.logger.Warn("Ignoring unreadable cache entry", "error", err)
+			return false
+		}
+		flusher, _ := w.(http.Flusher)
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set(cacheHeader, "hit")
+		w.WriteHeader(http.StatusOK)
+		for _, e := range events {
+			sr, err := writeEvent(w, e, id)
+			if err != nil {
+				break
+			}
+			if sr != "" {
+				stopReason = sr
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	} else {
+		var res map[string]interface{}
+		if err := json.Unmarshal(value, &res); err != nil {
+			info.logger.Warn("Ignoring unreadable cache entry", "error", err)
+			return false
+		}
+		res["id"] = id
+		stopReason, _ = res["stop_reason"].(string)
+		w.Header().Set(cacheHeader, "hit")
+		data, _ := json.Marshal(res)
+		p.writeBody(w, info, append(data, '\n'))
+	}
+	body, _ := json.Marshal(req)
+	p.persistLog(ctx, logEntry{
+		ID:         info.id,
+		Provider:   cacheProvider,
+		Model:      req.Model,
+		Request:    string(body),
+		Response:   string(value),
+		StatusCode: http.StatusOK,
+		StopReason: stopReason,
+	})
+	return true
+}
+
+// writeEvent writes a recorded SSE event, giving message_start the message
+// ID id. It returns the stop reason carried by a message_delta.
+func writeEvent(w http.ResponseWriter, e cachedEvent, id string) (string, error) {
+	data := []byte(e.Data)
+	var stopReason string
+	var m map[string]interface{}
+	if err := json.Unmarshal(data, &m); err == nil {
+		if msg, ok := m["message"].(map[string]interface{}); ok && e.Event == "message_start" {
+			msg["id"] = id
+			data, _ = json.Marshal(m)
+		}
+		if delta, ok := m["delta"].(map[string]interface{}); ok && e.Event == "message_delta" {
+			stopReason, _ = delta["stop_reason"].(string)
+		}
+	}
+	_, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Event, data)
+	return stopReason, err
+}
@@ -0,0 +1,41 @@
+package proxy
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"gopenbridge/cassette"
+	"gopenbridge/config"
+)
+
+// openCassette returns the cassette cassette_record or cassette_replay
+// names, or nil when neither is set.
+func openCassette(cfg *config.Config) (*cassette.Cassette, error) {
+	switch {
+	case cfg.CassetteRecord != "" && cfg.CassetteReplay != "":
+		return nil, errors.New("cassette_record and cassette_replay cannot both be set")
+	case cfg.CassetteRecord != "":
+		slog.Info("Recording upstream exchanges", "cassette", cfg.CassetteRecord)
+		return cassette.Record(cfg.CassetteRecord)
+	case cfg.CassetteReplay != "":
+		c, err := cassette.Replay(cfg.CassetteReplay)
+		if err != nil {
+			return nil, err
+		}
+		slog.Info("Replaying upstream exchanges instead of calling upstreams", "cassette", cfg.CassetteReplay, "exchanges", c.Len())
+		return c, nil
+	}
+	return nil, nil
+}
+
+// upstreamClient returns newUpstreamClient(cfg), recording to or replaying
+// from the cassette if there is one.
+func (p *ChatProxy) upstreamClient(cfg *config.Config) (*http.Client, error) {
+	client, err := newUpstreamClient(cfg)
+	if err != nil || p.cassette == nil {
+		return client, err
+	}
+	client.Transport = p.cassette.Transport(client.Transport)
+	return client, nil
+}
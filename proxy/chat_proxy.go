@@ -2,69 +2,74 @@ package proxy
 
 import (
    "bytes"
+   "context"
    "database/sql"
    "encoding/json"
+   "errors"
    "fmt"
    "io"
-   "log"
+   "log/slog"
    "net/http"
+   "os"
+   "path"
+   "slices"
    "strings"
+   "sync"
+   "sync/atomic"
    "time"
 
-   "github.com/google/uuid"
    _ "github.com/mattn/go-sqlite3"
+   "gopenbridge/batches"
+   "gopenbridge/cache"
+   "gopenbridge/cassette"
+   "gopenbridge/catalog"
    "gopenbridge/config"
+   "gopenbridge/keys"
+   "gopenbridge/logstore"
+   "gopenbridge/models"
+   "gopenbridge/providers"
+   "gopenbridge/sched"
+   "gopenbridge/secrets"
+   "gopenbridge/tracing"
 )
 
-// ContentBlock represents a text block.
-type ContentBlock struct {
-	Type string `json:"type"`
-	Text string `json:"text"`
-}
+// ChatProxy handles Anthropic-style payloads and forwards to OpenAI.
+type ChatProxy struct {
+   live atomic.Pointer[config.Config] // swapped by Reload
+   db   *sql.DB
 
-// ToolUseBlock represents a function call request.
-type ToolUseBlock struct {
-	Type  string                 `json:"type"`
-	ID    string                 `json:"id"`
-	Name  string                 `json:"name"`
-	Input map[string]interface{} `json:"input"`
-}
+	client  atomic.Pointer[http.Client] // shared so upstream connections are reused
+	tracer  *tracing.Tracer             // nil when tracing is disabled
+	keys    *keys.Store
+	secrets *secrets.Cache // resolves API keys kept in secret managers
+	cache   *cache.Cache   // response cache
+	flights flightGroup    // in-flight requests, for de-duplication
 
-// ToolResultBlock represents a function call result.
-type ToolResultBlock struct {
-	Type      string      `json:"type"`
-	ToolUseID string      `json:"tool_use_id"`
-	Content   interface{} `json:"content"`
-}
+	limitersMu sync.Mutex
+	limiters   map[string]*tokenBucket // inbound rate limits, see limitInbound
 
-// Message is an incoming or outgoing message.
-type Message struct {
-	Role    string      `json:"role"`
-	Content interface{} `json:"content"`
-}
+	keyPoolsMu sync.Mutex
+	keyPools   map[string]*keyPool // pooled API keys, keyed by upstream base URL
 
-// Tool describes a function to expose.
-type Tool struct {
-	Name        string                 `json:"name"`
-	Description string                 `json:"description,omitempty"`
-	InputSchema map[string]interface{} `json:"input_schema"`
-}
+	schedulersMu sync.Mutex
+	schedulers   map[string]*sched.Scheduler // keyed by upstream base URL
 
-// MessagesRequest is the expected request payload.
-type MessagesRequest struct {
-	Model       string      `json:"model"`
-	Messages    []Message   `json:"messages"`
-	MaxTokens   *int        `json:"max_tokens,omitempty"`
-	Temperature *float64    `json:"temperature,omitempty"`
-	Stream      *bool       `json:"stream,omitempty"`
-	Tools       []Tool      `json:"tools,omitempty"`
-	ToolChoice  interface{} `json:"tool_choice,omitempty"`
-}
+	breakersMu sync.Mutex
+	breakers   map[string]*circuitBreaker // keyed by upstream base URL
 
-// ChatProxy handles Anthropic-style payloads and forwards to OpenAI.
-type ChatProxy struct {
-   cfg *config.Config
-   db  *sql.DB
+	catalog *catalog.Store // cached upstream model lists
+
+	batches   *batches.Store // Message Batches jobs, see StartBatchWorkers
+	batchWake chan struct{}  // signals idle batch workers that work arrived
+
+	logStore logstore.Store // request logs and usage
+	logs     *logWriter     // queues writes to logStore, see persistLog
+	janitor  janitorStats   // log pruning activity, see StartJanitor
+
+	cassette *cassette.Cassette // records or replays upstream exchanges, if set
+
+	started time.Time // when the proxy was created
+	warned  sync.Map  // one-time warnings already logged, by key
 }
 
 // NewChatProxy constructs a ChatProxy.
@@ -73,49 +78,242 @@ func NewChatProxy(cfg *config.Config) *ChatProxy {
    // Open SQLite database
    db, err := sql.Open("sqlite3", cfg.DBPath)
    if err != nil {
-       log.Fatalf("Failed to open DB: %v", err)
+       slog.Error("Failed to open DB", "path", cfg.DBPath, "error", err)
+       os.Exit(1)
+   }
+   // Let the log janitor return pruned pages to the OS. This only takes
+   // effect on a new database; existing ones need a VACUUM.
+   if _, err := db.Exec("PRAGMA auto_vacuum=INCREMENTAL;"); err != nil {
+       slog.Warn("Failed to set auto_vacuum INCREMENTAL", "error", err)
    }
    // Enable SQLite WAL journaling and set synchronous to NORMAL for performance
    if _, err := db.Exec("PRAGMA journal_mode=WAL;"); err != nil {
-       log.Printf("Failed to set journal_mode WAL: %v", err)
+       slog.Warn("Failed to set journal_mode WAL", "error", err)
    }
    if _, err := db.Exec("PRAGMA synchronous=NORMAL;"); err != nil {
-       log.Printf("Failed to set synchronous NORMAL: %v", err)
+       slog.Warn("Failed to set synchronous NORMAL", "error", err)
+   }
+   p := &ChatProxy{
+       db:          db,
+       tracer:      tracing.New(cfg.TracingEndpoint, "gopenbridge", cfg.TracingSampleRate),
+       breakers:    make(map[string]*circuitBreaker),
+       limiters:    make(map[string]*tokenBucket),
+       keyPools:    make(map[string]*keyPool),
+       schedulers:  make(map[string]*sched.Scheduler),
+       batchWake:   make(chan struct{}, 1),
+       started:     time.Now(),
+   }
+   p.live.Store(cfg)
+   p.secrets = secrets.NewCache(cfg.SecretsRefresh)
+   if p.cassette, err = openCassette(cfg); err != nil {
+       slog.Error("Failed to open cassette", "error", err)
+       os.Exit(1)
+   }
+   client, err := p.upstreamClient(cfg)
+   if err != nil {
+       slog.Error("Failed to configure upstream client", "error", err)
+       os.Exit(1)
+   }
+   p.client.Store(client)
+   cacheDB := db
+   if !cfg.CachePersist {
+       cacheDB = nil
+   }
+   if p.cache, err = cache.New(cacheDB, cfg.CacheMaxEntries, cfg.CacheTTL); err != nil {
+       slog.Error("Failed to create response cache table", "error", err)
+       os.Exit(1)
    }
-   // Create log table if not exists
-   createTable := `CREATE TABLE IF NOT EXISTS api_logs (
-       id TEXT PRIMARY KEY,
-       timestamp DATETIME,
-       provider TEXT,
-       endpoint TEXT,
-       model TEXT,
-       request TEXT,
-       response TEXT,
-       status_code INTEGER,
-       error_message TEXT,
-       prompt_tokens INTEGER,
-       completion_tokens INTEGER
-   );`
-   if _, err := db.Exec(createTable); err != nil {
-       log.Fatalf("Failed to create table: %v", err)
+   if p.keys, err = keys.NewStore(db); err != nil {
+       slog.Error("Failed to create virtual key table", "error", err)
+       os.Exit(1)
    }
-   return &ChatProxy{cfg: cfg, db: db}
+   if p.catalog, err = catalog.NewStore(db); err != nil {
+       slog.Error("Failed to create upstream model table", "error", err)
+       os.Exit(1)
+   }
+   if p.batches, err = batches.NewStore(db); err != nil {
+       slog.Error("Failed to create message batch tables", "error", err)
+       os.Exit(1)
+   }
+   if p.logStore, err = logstore.NewSQLite(db, p.bodyOptions); err != nil {
+       slog.Error("Failed to create log tables", "error", err)
+       os.Exit(1)
+   }
+   p.logs = newLogWriter(p.logStore, cfg.LogQueueSize, cfg.LogBatchSize)
+   return p
+}
+
+// Logs returns the store holding the request log and usage.
+func (p *ChatProxy) Logs() logstore.Store {
+	return p.logStore
+}
+
+// cfg returns the current configuration.
+func (p *ChatProxy) cfg() *config.Config {
+	return p.live.Load()
+}
+
+// Reload applies cfg to subsequent requests. The upstream client is rebuilt
+// so transport and TLS changes take effect on new connections; the log
+// database and tracing exporter are kept.
+func (p *ChatProxy) Reload(cfg *config.Config) error {
+	client, err := p.upstreamClient(cfg)
+	if err != nil {
+		return err
+	}
+	p.live.Store(cfg)
+	p.client.Swap(client).CloseIdleConnections()
+	return nil
 }
 
 // ServeHTTP satisfies http.Handler.
 func (p *ChatProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	var req MessagesRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "invalid JSON", http.StatusBadRequest)
+	ctx, span := p.tracer.Start(tracing.Extract(r.Context(), r.Header), "POST /v1/messages", tracing.KindServer)
+	defer span.End()
+	info := newRequestInfo()
+	ctx = withRequestInfo(ctx, info)
+	writeRequestID(w, info)
+	p.readAnthropicHeaders(r, info)
+	info.acceptsGzip = acceptsGzip(r)
+	if err := p.authenticate(ctx, r); err != nil {
+		span.SetError(err)
+		p.fail(ctx, w, err)
+		return
+	}
+	if err := p.limitInbound(ctx, r); err != nil {
+		span.SetError(err)
+		p.fail(ctx, w, err)
+		return
+	}
+	var req models.MessagesRequest
+	body, err := p.decodeBody(w, r, &req)
+	if err != nil {
+		span.SetError(err)
+		p.fail(ctx, w, err)
+		return
+	}
+	info.clientRequest = body
+	stream := req.Stream != nil && *req.Stream
+	info.priority = p.priorityFor(r, req.Model)
+	if req.Metadata != nil {
+		info.userID = req.Metadata.UserID
+	}
+	info.logger = info.logger.With("model", req.Model, "stream", stream)
+	span.SetAttr("gen_ai.request.model", req.Model)
+	span.SetAttr("stream", stream)
+	if err := p.checkBudgets(ctx, w); err != nil {
+		span.SetError(err)
+		p.fail(ctx, w, err)
+		return
+	}
+	info.cacheKey = p.cacheKey(r, &req, stream)
+	if info.cacheKey != "" {
+		if !strings.Contains(r.Header.Get("Cache-Control"), "no-cache") && p.serveCached(ctx, w, &req, info.cacheKey, stream) {
+			return
+		}
+		w.Header().Set(cacheHeader, "miss")
+	}
+	if key := p.flightKey(ctx, &req, stream); key != "" {
+		f, leader := p.flights.join(key)
+		if !leader {
+			info.logger.Debug("Joining identical in-flight request")
+			p.follow(ctx, w, &req, f, stream)
+			return
+		}
+		defer p.flights.leave(key, f)
+		info.flight = f
+	}
+	if stream {
+		p.streamRequest(ctx, w, &req)
 		return
 	}
-	res, err := p.processRequest(&req)
+	// Raw upstream responses may expose provider internals, so they are only
+	// attached when both the operator and the client opt in.
+	includeRaw := p.cfg().AllowRawUpstream && r.Header.Get("X-Include-Raw-Upstream") == "true"
+	res, err := p.processRequest(ctx, &req, includeRaw)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		span.SetError(err)
+		p.fail(ctx, w, err)
 		return
 	}
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(res)
+	if cost := requestFrom(ctx).costUSD; cost != nil {
+		w.Header().Set(costHeader, formatCost(*cost))
+	}
+	writeRateLimitHeaders(w, requestFrom(ctx))
+	data, _ := json.Marshal(res)
+	if info.cacheKey != "" && !includeRaw {
+		p.cache.Put(ctx, info.cacheKey, data)
+	}
+	if info.flight != nil {
+		info.flight.finish(data, nil)
+	}
+	p.writeBody(w, info, append(data, '\n'))
+}
+
+// fail logs err and writes it to the client as an Anthropic error.
+func (p *ChatProxy) fail(ctx context.Context, w http.ResponseWriter, err error) {
+	info := p.logFailure(ctx, err)
+	writeRateLimitHeaders(w, info)
+	writeError(w, err)
+}
+
+// failStream logs err and reports it as an error event on a stream that
+// has already started.
+func (p *ChatProxy) failStream(ctx context.Context, s *sseStream, err error) {
+	p.logFailure(ctx, err)
+	s.fail(err)
+}
+
+// logFailure logs a failed request, stores its upstream error response and
+// releases its followers.
+func (p *ChatProxy) logFailure(ctx context.Context, err error) *requestInfo {
+	info := requestFrom(ctx)
+	var apiErr *APIError
+	level := slog.LevelError
+	if errors.As(err, &apiErr) && apiErr.Status < 500 {
+		level = slog.LevelWarn
+	}
+	info.logger.Log(ctx, level, "Request failed", "error", err, "latency_ms", time.Since(info.start).Milliseconds())
+	p.persistFailure(ctx, err)
+	if info.flight != nil {
+		info.flight.finish(nil, err)
+	}
+	return info
+}
+
+// breakerFor returns the circuit breaker for an upstream, creating it on
+// first use and applying the current breaker_threshold and
+// breaker_cooldown, so reloads take effect.
+func (p *ChatProxy) breakerFor(upstream string) *circuitBreaker {
+	p.breakersMu.Lock()
+	defer p.breakersMu.Unlock()
+	cfg := p.cfg()
+	b, ok := p.breakers[upstream]
+	if !ok {
+		b = newCircuitBreaker(cfg.BreakerThreshold, cfg.BreakerCooldown)
+		p.breakers[upstream] = b
+	} else {
+		b.configure(cfg.BreakerThreshold, cfg.BreakerCooldown)
+	}
+	return b
+}
+
+// isNonJSONResponse reports whether an upstream body is obviously not JSON,
+// judged by its content type or a leading '<'.
+func isNonJSONResponse(contentType string, data []byte) bool {
+	if strings.Contains(strings.ToLower(contentType), "html") {
+		return true
+	}
+	return bytes.HasPrefix(bytes.TrimSpace(data), []byte("<"))
+}
+
+// snippet collapses whitespace in data and truncates it to n bytes.
+func snippet(data []byte, n int) string {
+	s := strings.Join(strings.Fields(string(data)), " ")
+	if len(s) > n {
+		return s[:n] + "..."
+	}
+	return s
 }
 
 // maskAPIKey obfuscates an API key by showing only its start and end.
@@ -126,109 +324,262 @@ func maskAPIKey(key string) string {
 	return key[:4] + "..." + key[len(key)-4:]
 }
 
-// detectProvider determines the provider type from the base URL.
-func detectProvider(baseURL string) string {
-	baseURL = strings.ToLower(baseURL)
-
-	// Check for specific provider patterns
-	if strings.Contains(baseURL, "groq.com") {
-		return "groq"
+// resolveOptions applies the default model and model mapping to req and
+// resolves the per-request provider options. A request without a model is
+// rejected, as Anthropic does, when there is no default_model either.
+func (p *ChatProxy) resolveOptions(ctx context.Context, req *models.MessagesRequest) (providers.Options, error) {
+	if req.Model == "" {
+		if p.cfg().DefaultModel == "" {
+			return providers.Options{}, invalidRequest("model: Field required")
+		}
+		req.Model = p.cfg().DefaultModel
+		requestFrom(ctx).logger.Info("Request omitted model, using default", "default_model", req.Model)
 	}
-	if strings.Contains(baseURL, "openrouter.ai") {
-		return "openrouter"
+	limit := p.cfg().MaxTokens
+	requested := req.Model
+	if m, ok := p.cfg().MapModel(req.Model); ok {
+		requestFrom(ctx).logger.Debug("Mapping model", "from", req.Model, "to", m.Model, "pattern", m.Pattern)
+		req.Model = m.Model
+		if m.MaxTokens > 0 {
+			limit = m.MaxTokens
+		}
+		if m.Temperature != nil {
+			req.Temperature = m.Temperature
+		}
+		requestFrom(ctx).extraBody = m.ExtraBody
 	}
-	if strings.Contains(baseURL, "api.openai.com") {
-		return "openai"
+	// A route chosen by the caller, as for replays, is kept
+	if r, ok := p.cfg().RouteFor(requested, req.Model); ok && requestFrom(ctx).route == nil {
+		requestFrom(ctx).logger.Debug("Routing model", "model", requested, "provider", r.Provider, "pattern", r.Pattern)
+		requestFrom(ctx).route = &r
 	}
-	if strings.Contains(baseURL, "fireworks.ai") {
-		return "fireworks"
+	// Determine max tokens
+	maxT, err := p.resolveMaxTokens(req, limit)
+	if err != nil {
+		return providers.Options{}, err
 	}
-	if strings.Contains(baseURL, "huggingface.co") {
-		return "huggingface"
+	requestFrom(ctx).toolNames = newToolNames(req)
+	return providers.Options{
+		MaxTokens:             maxT,
+		ToolErrorPrefix:       p.cfg().ToolErrorPrefix,
+		StrictResponseParsing: p.cfg().StrictResponseParsing,
+		KeepAlive:             p.cfg().OllamaKeepAlive,
+		NumCtx:                p.cfg().OllamaNumCtx,
+		ExtractDocuments:      p.cfg().ExtractDocuments,
+		StopSequences:         req.StopSequences,
+		SchemaProfile:         p.cfg().ToolSchemaProfile,
+		StrictTools:           p.cfg().StrictTools,
+		RepairToolArgs:        p.repairToolArgs(),
+		ReasoningAsThinking:   p.cfg().ReasoningAsThinking,
+		Betas:                 requestFrom(ctx).betas,
+	}, nil
+}
+
+// buildPayload converts req into t's upstream payload. The returned request
+// carries the model actually sent to t.
+func (p *ChatProxy) buildPayload(ctx context.Context, t target, req *models.MessagesRequest, opts providers.Options) (*models.MessagesRequest, map[string]interface{}, error) {
+	_, span := p.tracer.Start(ctx, "convert_payload", tracing.KindInternal)
+	defer span.End()
+	span.SetAttr("provider", t.prov.Name())
+	r := *requestFrom(ctx).toolNames.apply(req)
+	if t.model != "" {
+		r.Model = t.model
 	}
-	if strings.Contains(baseURL, "anthropic.com") {
-		return "anthropic"
+	opts.ReasoningModel = p.reasoningModel(r.Model)
+	p.warnBetas(ctx, t, r.Model)
+	payload, err := t.prov.BuildPayload(&r, opts)
+	if err != nil {
+		span.SetError(err)
+		return nil, nil, invalidRequest(err.Error())
 	}
+	mergeExtraBody(payload, t.extraBody)
+	mergeExtraBody(payload, requestFrom(ctx).extraBody)
+	return &r, payload, nil
+}
 
-	// Default to standard OpenAI-compatible format (tools)
-	return "openai-compatible"
+// reasoningModel reports whether the upstream model is listed in
+// ReasoningModels.
+func (p *ChatProxy) reasoningModel(model string) bool {
+	for _, pattern := range p.cfg().ReasoningModels {
+		if ok, _ := path.Match(pattern, model); ok || pattern == model {
+			return true
+		}
+	}
+	return false
 }
 
-// processRequest converts and forwards the request.
-func (p *ChatProxy) processRequest(req *MessagesRequest) (map[string]interface{}, error) {
-   // Generate log ID
-   logID := uuid.New().String()[:12]
-   // Detect provider type
-   provider := detectProvider(p.cfg.BaseURL)
-   // Convert messages and tools
-   msgs := convertMessages(req.Messages)
-	var toolsOrFuncs []map[string]interface{}
-	if len(req.Tools) > 0 {
-		toolsOrFuncs = convertToolsForProvider(req.Tools, provider)
+// sendUpstream posts body to the provider's endpoint through the upstream's
+// circuit breaker, retrying transient failures. It returns the response, the
+// endpoint and the number of retries. The caller must close the response
+// body. A client disconnect aborts the call and records a cancelled log row.
+func (p *ChatProxy) sendUpstream(ctx context.Context, t target, logID string, req *models.MessagesRequest, body []byte, stream bool) (*http.Response, string, int, error) {
+	endpoint := t.prov.Endpoint(t.up, req.Model, stream)
+	requestFrom(ctx).failed = nil
+	requestFrom(ctx).sent = body
+	ctx, span := p.tracer.Start(ctx, "upstream "+t.prov.Name(), tracing.KindClient)
+	defer span.End()
+	span.SetAttr("http.url", endpoint)
+	span.SetAttr("gen_ai.request.model", req.Model)
+	// Debug: log request payload
+	logger := requestFrom(ctx).logger
+	if logger.Enabled(ctx, slog.LevelDebug) {
+		logger.Debug("Upstream request", "endpoint", endpoint, "body", string(body))
 	}
-	// Determine max tokens
-	maxT := p.cfg.MaxTokens
-	if req.MaxTokens != nil && *req.MaxTokens < maxT {
-		maxT = *req.MaxTokens
-	}
-	// Build payload
-	payload := map[string]interface{}{
-		"model":       req.Model,
-		"messages":    msgs,
-		"temperature": req.Temperature,
-		"max_tokens":  maxT,
-	}
-	// Add tools/functions based on provider
-	if len(toolsOrFuncs) > 0 {
-		switch provider {
-		case "groq":
-			// Groq uses legacy functions format
-			payload["functions"] = toolsOrFuncs
-			if req.ToolChoice != nil {
-				payload["function_call"] = req.ToolChoice
-			} else {
-				payload["function_call"] = "auto"
-			}
-			if p.cfg.Debug {
-				log.Printf("DEBUG: Using Groq functions format")
-			}
-		default:
-			// OpenRouter, OpenAI, Fireworks, and most others use tools format
-			payload["tools"] = toolsOrFuncs
-			if req.ToolChoice != nil {
-				payload["tool_choice"] = req.ToolChoice
-			} else {
-				payload["tool_choice"] = "auto"
-			}
-			if p.cfg.Debug {
-				log.Printf("DEBUG: Using standard tools format for provider: %s", provider)
+	up := t.up
+	pool := p.keyPoolFor(t.up.BaseURL, t.keys)
+	rawKey := t.up.APIKey
+	if pool != nil {
+		rawKey, _ = pool.pick()
+	}
+	key, err := p.secrets.Resolve(ctx, rawKey)
+	if err != nil {
+		return nil, endpoint, 0, upstreamAPIError(fmt.Sprintf("failed to load upstream API key: %v", err))
+	}
+	up.APIKey = key
+	newRequest := func() (*http.Request, error) {
+		httpReq, _ := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(body))
+		if err := t.prov.Authorize(httpReq, up); err != nil {
+			return nil, upstreamAPIError(fmt.Sprintf("failed to authorize upstream request: %v", err))
+		}
+		httpReq.Header.Set("Content-Type", "application/json")
+		httpReq.Header.Set("X-Request-Id", logID)
+		if p.cfg().UpstreamCompression {
+			httpReq.Header.Set("Accept-Encoding", upstreamAcceptEncoding)
+		}
+		if h := providers.BetaHeader(t.prov, requestFrom(ctx).betas); h != "" {
+			httpReq.Header.Set("anthropic-beta", h)
+		}
+		tracing.Inject(ctx, httpReq.Header)
+		return httpReq, nil
+	}
+	httpReq, err := newRequest()
+	if err != nil {
+		return nil, endpoint, 0, err
+	}
+	breaker := p.breakerFor(t.up.BaseURL)
+	if !breaker.Allow() {
+		return nil, endpoint, 0, overloaded("upstream is unavailable, circuit breaker open")
+	}
+	release, err := p.acquireSlot(ctx, t)
+	if err != nil {
+		// A full queue or a cancelled wait says nothing about the upstream
+		breaker.Abort()
+		return nil, endpoint, 0, err
+	}
+	rp := p.retryPolicy()
+	if pool != nil {
+		// A rate limited key is rotated out rather than retried
+		rp.retryOn = slices.DeleteFunc(slices.Clone(rp.retryOn), func(s int) bool { return s == http.StatusTooManyRequests })
+	}
+	httpRes, retries, err := rp.do(p.client.Load(), httpReq)
+	// A key from a secret manager may have been rotated: fetch it again and
+	// retry once with the new value
+	if err == nil && httpRes.StatusCode == http.StatusUnauthorized && secrets.IsRef(rawKey) {
+		p.secrets.Invalidate(rawKey)
+		if fresh, ferr := p.secrets.Resolve(ctx, rawKey); ferr == nil && fresh != up.APIKey {
+			logger.Info("Upstream rejected API key, retrying with the refreshed secret", "upstream", t.up.BaseURL)
+			httpRes.Body.Close()
+			up.APIKey = fresh
+			if httpReq, err = newRequest(); err != nil {
+				release()
+				breaker.Abort()
+				return nil, endpoint, retries, err
 			}
+			var more int
+			httpRes, more, err = rp.do(p.client.Load(), httpReq)
+			retries += more + 1
 		}
 	}
-	// Marshal and send
-	body, _ := json.Marshal(payload)
-	endpoint := strings.TrimRight(p.cfg.BaseURL, "/") + "/chat/completions"
-	// Debug: log request payload
-	if p.cfg.Debug {
-		log.Printf("DEBUG: Request to %s: payload %s", endpoint, string(body))
-	}
-	httpReq, _ := http.NewRequest("POST", endpoint, bytes.NewReader(body))
-	httpReq.Header.Set("Authorization", "Bearer "+p.cfg.APIKey)
-	httpReq.Header.Set("Content-Type", "application/json")
-	client := &http.Client{}
-	httpRes, err := client.Do(httpReq)
+	// Bench a pooled key the upstream rate limited or rejected and try the
+	// next one, until every key has been tried
+	for tried := 1; pool != nil && err == nil && isKeyFailure(httpRes.StatusCode); tried++ {
+		cooldown := p.cfg().APIKeyCooldown
+		if d, ok := rp.retryAfter(httpRes.Header.Get("Retry-After")); ok && d > 0 {
+			cooldown = d
+		}
+		pool.bench(rawKey, cooldown)
+		if tried >= len(t.keys) {
+			break
+		}
+		next, ok := pool.pick()
+		if !ok {
+			break
+		}
+		resolved, rerr := p.secrets.Resolve(ctx, next)
+		if rerr != nil {
+			break
+		}
+		logger.Warn("Upstream refused API key, rotating to the next key",
+			"upstream", t.up.BaseURL, "status", httpRes.StatusCode, "key", keyLabel(rawKey), "next", keyLabel(next), "cooldown", cooldown)
+		httpRes.Body.Close()
+		rawKey, up.APIKey = next, resolved
+		if httpReq, err = newRequest(); err != nil {
+			release()
+			breaker.Abort()
+			return nil, endpoint, retries, err
+		}
+		var more int
+		httpRes, more, err = rp.do(p.client.Load(), httpReq)
+		retries += more + 1
+	}
+	requestFrom(ctx).upstreamKey = keyLabel(rawKey)
+	span.SetAttr("retries", retries)
 	if err != nil {
-		return nil, err
+		release()
+		span.SetError(err)
+		// A client disconnect aborts the upstream call; record what we know.
+		// It says nothing about the upstream's health
+		if ctx.Err() != nil {
+			breaker.Abort()
+			p.persistLog(ctx, logEntry{
+				ID:           logID,
+				Provider:     t.up.BaseURL,
+				Endpoint:     endpoint,
+				Model:        req.Model,
+				Request:      string(body),
+				ErrorMessage: ctx.Err().Error(),
+				StopReason:   stopReasonCancelled,
+				Retries:      retries,
+			})
+			return nil, endpoint, retries, ctx.Err()
+		}
+		breaker.Failure()
+		return nil, endpoint, retries, upstreamAPIError(fmt.Sprintf("upstream request failed: %v", err))
 	}
-	defer httpRes.Body.Close()
-	data, _ := io.ReadAll(httpRes.Body)
+	span.SetAttr("http.status_code", httpRes.StatusCode)
+	if err := decompressResponse(httpRes); err != nil {
+		httpRes.Body.Close()
+		release()
+		span.SetError(err)
+		breaker.Failure()
+		return nil, endpoint, retries, upstreamAPIError(err.Error())
+	}
+	httpRes.Body = &releaseOnClose{ReadCloser: httpRes.Body, release: release}
+	requestFrom(ctx).rateLimits = rateLimitHeaders(httpRes.Header, time.Now())
+	if httpRes.StatusCode >= 500 {
+		breaker.Failure()
+	} else {
+		breaker.Success()
+	}
+	return httpRes, endpoint, retries, nil
+}
+
+// decodeUpstream parses a buffered upstream response body, turning non-JSON
+// bodies and OpenAI error objects into errors.
+func (p *ChatProxy) decodeUpstream(ctx context.Context, httpRes *http.Response, data []byte) (map[string]interface{}, error) {
 	// Debug: log response status and body
-	if p.cfg.Debug {
-		log.Printf("DEBUG: Response status %s body: %s", httpRes.Status, string(data))
+	logger := requestFrom(ctx).logger
+	if logger.Enabled(ctx, slog.LevelDebug) {
+		logger.Debug("Upstream response", "status", httpRes.StatusCode, "body", string(data))
+	}
+	// Gateways and load balancers may answer with an HTML error page
+	if isNonJSONResponse(httpRes.Header.Get("Content-Type"), data) {
+		return nil, upstreamAPIError(fmt.Sprintf("upstream returned non-JSON response (status %d): %s",
+			httpRes.StatusCode, snippet(data, 200)))
 	}
 	var ocRes map[string]interface{}
 	if err := json.Unmarshal(data, &ocRes); err != nil {
-		return nil, err
+		return nil, upstreamAPIError(fmt.Sprintf("invalid upstream response (status %d): %v", httpRes.StatusCode, err))
 	}
 	// Check for OpenAI API errors and log details
 	if errRaw, exists := ocRes["error"]; exists {
@@ -236,205 +587,148 @@ func (p *ChatProxy) processRequest(req *MessagesRequest) (map[string]interface{}
 			code := errMap["code"]
 			msg := errMap["message"]
 			errType := errMap["type"]
-			log.Printf("ERROR: OpenAI API error code=%v type=%v message=%v", code, errType, msg)
-			return nil, fmt.Errorf("OpenAI API error: %v", msg)
-		}
-		log.Printf("ERROR: OpenAI API error response: %v", errRaw)
-		return nil, fmt.Errorf("OpenAI API error: %v", errRaw)
-	}
-	// Extract choice
-	choices, _ := ocRes["choices"].([]interface{})
-	var message map[string]interface{}
-	if len(choices) > 0 {
-		ch, _ := choices[0].(map[string]interface{})
-		message, _ = ch["message"].(map[string]interface{})
-	}
-	// Build content blocks
-	var content []interface{}
-	stopReason := "end_turn"
-
-	// Detect tool invocation (try multiple formats)
-	// 1. Modern tools format: tool_calls array (OpenRouter, OpenAI with tools)
-	if toolCalls, ok := message["tool_calls"].([]interface{}); ok && len(toolCalls) > 0 {
-		if p.cfg.Debug {
-			log.Printf("DEBUG: Detected tool_calls format (OpenRouter/OpenAI tools)")
+			logger.Error("Upstream API error", "status", httpRes.StatusCode, "code", code, "type", errType, "message", msg)
+			return nil, upstreamResponseError(httpRes, fmt.Sprintf("upstream error: %v", msg))
 		}
-		for _, tc := range toolCalls {
-			tcMap, _ := tc.(map[string]interface{})
-			funcData, _ := tcMap["function"].(map[string]interface{})
-
-			args := map[string]interface{}{}
-			if s, ok := funcData["arguments"].(string); ok {
-				json.Unmarshal([]byte(s), &args)
-			}
-
-			toolID, _ := tcMap["id"].(string)
-			if toolID == "" {
-				toolID = uuid.New().String()[:12]
-			}
+		logger.Error("Upstream API error", "status", httpRes.StatusCode, "error", errRaw)
+		return nil, upstreamResponseError(httpRes, fmt.Sprintf("upstream error: %v", errRaw))
+	}
+	if httpRes.StatusCode >= 400 {
+		return nil, upstreamResponseError(httpRes, fmt.Sprintf("upstream returned status %d: %s", httpRes.StatusCode, snippet(data, 200)))
+	}
+	return ocRes, nil
+}
 
-			content = append(content, map[string]interface{}{
-				"type":  "tool_use",
-				"id":    toolID,
-				"name":  funcData["name"],
-				"input": args,
-			})
-		}
-		stopReason = "tool_use"
-	} else {
-		// 2. Legacy formats: function_call or tool (Groq, older OpenAI)
-		var fc map[string]interface{}
-		if raw, ok := message["function_call"].(map[string]interface{}); ok {
-			if p.cfg.Debug {
-				log.Printf("DEBUG: Detected function_call format (Groq/legacy)")
-			}
-			fc = raw
-		} else if raw, ok := message["tool"].(map[string]interface{}); ok {
-			if p.cfg.Debug {
-				log.Printf("DEBUG: Detected tool format")
-			}
-			fc = raw
+// processRequest converts and forwards the request, failing over to the
+// next upstream when one is unavailable and aborting the upstream call when
+// ctx is cancelled. When includeRaw is set the untranslated upstream
+// response is attached as upstream_response.
+func (p *ChatProxy) processRequest(ctx context.Context, req *models.MessagesRequest, includeRaw bool) (map[string]interface{}, error) {
+	opts, err := p.resolveOptions(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	var res map[string]interface{}
+	err = p.withFailover(ctx, func(t target) error {
+		var err error
+		if t.alwaysStream {
+			res, err = p.aggregateWith(ctx, t, req, opts, includeRaw)
+		} else {
+			res, err = p.processWith(ctx, t, req, opts, includeRaw)
 		}
+		return err
+	})
+	if problems := requestFrom(ctx).toolArgProblems; err == nil && len(problems) > 0 && p.cfg().ToolArgRepair == toolArgRepairReask {
+		res = p.reaskToolArgs(ctx, req, opts, includeRaw, res, problems)
+	}
+	return res, err
+}
 
-		if fc != nil {
-			// Single function/tool call
-			args := map[string]interface{}{}
-			if s, ok := fc["arguments"].(string); ok {
-				json.Unmarshal([]byte(s), &args)
-			}
-			content = append(content, map[string]interface{}{
-				"type":  "tool_use",
-				"id":    uuid.New().String()[:12],
-				"name":  fc["name"],
-				"input": args,
-			})
-			stopReason = "tool_use"
-		} else {
-			// No tool calls - just text
-			txt, _ := message["content"].(string)
-			content = append(content, map[string]interface{}{
-				"type": "text",
-				"text": txt,
+// processWith performs one non-streaming request against t.
+func (p *ChatProxy) processWith(ctx context.Context, t target, req *models.MessagesRequest, opts providers.Options, includeRaw bool) (map[string]interface{}, error) {
+	logID := requestFrom(ctx).id
+	r, payload, err := p.buildPayload(ctx, t, req, opts)
+	if err != nil {
+		return nil, err
+	}
+	// Marshal and send
+	body, _ := json.Marshal(payload)
+	httpRes, endpoint, retries, err := p.sendUpstream(ctx, t, logID, r, body, false)
+	if err != nil {
+		return nil, err
+	}
+	defer httpRes.Body.Close()
+	data, err := io.ReadAll(httpRes.Body)
+	if err != nil {
+		if ctx.Err() != nil {
+			p.persistLog(ctx, logEntry{
+				ID:           logID,
+				Provider:     t.up.BaseURL,
+				Endpoint:     endpoint,
+				Model:        r.Model,
+				Request:      string(body),
+				Response:     string(data),
+				StatusCode:   httpRes.StatusCode,
+				ErrorMessage: ctx.Err().Error(),
+				StopReason:   stopReasonCancelled,
+				Retries:      retries,
 			})
+			return nil, ctx.Err()
+		}
+		return nil, upstreamAPIError(fmt.Sprintf("failed to read upstream response: %v", err))
+	}
+	ocRes, err := p.decodeUpstream(ctx, httpRes, data)
+	if err != nil {
+		requestFrom(ctx).failed = &logEntry{
+			ID:         logID,
+			Provider:   t.up.BaseURL,
+			Endpoint:   endpoint,
+			Model:      r.Model,
+			Request:    string(body),
+			Response:   string(data),
+			StatusCode: httpRes.StatusCode,
+			Retries:    retries,
 		}
+		return nil, err
 	}
-	// Assemble response
-	usage := map[string]interface{}{
-		"input_tokens":  ocRes["usage"].(map[string]interface{})["prompt_tokens"],
-		"output_tokens": ocRes["usage"].(map[string]interface{})["completion_tokens"],
+	parsed, err := t.prov.ParseResponse(ocRes, opts)
+	if err != nil {
+		requestFrom(ctx).logger.Error("Unrecognized upstream response shape", "body", string(data))
+		return nil, upstreamAPIError(err.Error())
 	}
+	requestFrom(ctx).toolNames.restore(parsed.Content)
+	if opts.RepairToolArgs {
+		requestFrom(ctx).toolArgProblems = checkToolArgs(req.Tools, parsed, requestFrom(ctx).logger)
+	}
+	cost := p.cost(r.Model, parsed.InputTokens, parsed.OutputTokens)
+	requestFrom(ctx).costUSD = cost
 	// Persist log entry
-	ptF, _ := usage["input_tokens"].(float64)
-	ctF, _ := usage["output_tokens"].(float64)
-	_, errExec := p.db.Exec(
-		`INSERT INTO api_logs(id, timestamp, provider, endpoint, model, request, response, status_code, error_message, prompt_tokens, completion_tokens) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-		logID,
-		time.Now().UTC(),
-		p.cfg.BaseURL,
-		endpoint,
-		req.Model,
-		string(body),
-		string(data),
-		httpRes.StatusCode,
-		"", // no error message
-		int(ptF),
-		int(ctF),
-	)
-	if errExec != nil {
-		log.Printf("Failed to persist API log: %v", errExec)
-	}
-	return map[string]interface{}{
+	p.persistLog(ctx, logEntry{
+		ID:               logID,
+		Provider:         t.up.BaseURL,
+		Endpoint:         endpoint,
+		Model:            r.Model,
+		Request:          string(body),
+		Response:         string(data),
+		StatusCode:       httpRes.StatusCode,
+		StopReason:       parsed.StopReason,
+		PromptTokens:     parsed.InputTokens,
+		CompletionTokens: parsed.OutputTokens,
+		Retries:          retries,
+		CostUSD:          cost,
+	})
+	res := map[string]interface{}{
 		"id":            "msg_" + logID,
-		"model":         req.Model,
+		"model":         r.Model,
 		"role":          "assistant",
 		"type":          "message",
-		"content":       content,
-		"stop_reason":   stopReason,
-		"stop_sequence": nil,
-		"usage":         usage,
-	}, nil
-}
-
-// convertMessages maps Anthropic payload to OpenAI messages.
-func convertMessages(msgs []Message) []map[string]interface{} {
-	var out []map[string]interface{}
-	for _, msg := range msgs {
-		switch c := msg.Content.(type) {
-		case string:
-			out = append(out, map[string]interface{}{"role": msg.Role, "content": c})
-		case []interface{}:
-			// collect text and tool_calls
-			textAcc := ""
-			var tcalls []map[string]interface{}
-			var toolsRes []map[string]interface{}
-			for _, blk := range c {
-				b, ok := blk.(map[string]interface{})
-				if !ok {
-					continue
-				}
-				t, _ := b["type"].(string)
-				switch t {
-				case "text":
-					if s, ok := b["text"].(string); ok {
-						textAcc += s
-					}
-				case "tool_use":
-					id, _ := b["id"].(string)
-					name, _ := b["name"].(string)
-					input := b["input"]
-					args, _ := json.Marshal(input)
-					tcalls = append(tcalls, map[string]interface{}{ // function call spec
-						"id":   id,
-						"type": "function",
-						"function": map[string]interface{}{
-							"name":      name,
-							"arguments": string(args),
-						},
-					})
-				case "tool_result":
-					toolsRes = append(toolsRes, map[string]interface{}{ // tool response
-						"role":         "tool",
-						"content":      b["content"],
-						"tool_call_id": b["tool_use_id"],
-					})
-				}
-			}
-			if textAcc != "" || len(tcalls) > 0 {
-				entry := map[string]interface{}{"role": msg.Role, "content": textAcc}
-				if len(tcalls) > 0 {
-					entry["tool_calls"] = tcalls
-				}
-				out = append(out, entry)
-			}
-			out = append(out, toolsRes...)
-		}
+		"content":       parsed.Content,
+		"stop_reason":   parsed.StopReason,
+		"stop_sequence": parsed.StopSequence,
+		"usage":         parsed.Usage.JSON(),
 	}
-	return out
+	if includeRaw {
+		res["upstream_response"] = json.RawMessage(data)
+	}
+	return res, nil
 }
 
-// convertToolsForProvider maps Tool definitions to provider-specific format.
-func convertToolsForProvider(tools []Tool, provider string) []map[string]interface{} {
-	var out []map[string]interface{}
-	for _, t := range tools {
-		switch provider {
-		case "groq":
-			// Groq uses legacy functions format: name, description, parameters
-			out = append(out, map[string]interface{}{
-				"name":        t.Name,
-				"description": t.Description,
-				"parameters":  t.InputSchema,
-			})
-		default:
-			// OpenRouter, OpenAI, Fireworks use tools format with type and function wrapper
-			out = append(out, map[string]interface{}{
-				"type": "function",
-				"function": map[string]interface{}{
-					"name":        t.Name,
-					"description": t.Description,
-					"parameters":  t.InputSchema,
-				},
-			})
+// resolveMaxTokens validates the requested max_tokens and caps it at limit.
+// A missing value falls back to limit unless StrictMaxTokens is set, in
+// which case it is rejected like Anthropic does.
+func (p *ChatProxy) resolveMaxTokens(req *models.MessagesRequest, limit int) (int, error) {
+	if req.MaxTokens == nil {
+		if p.cfg().StrictMaxTokens {
+			return 0, invalidRequest("max_tokens: Field required")
 		}
+		slog.Debug("max_tokens missing, using default", "max_tokens", limit)
+		return limit, nil
+	}
+	if *req.MaxTokens < 1 {
+		return 0, invalidRequest("max_tokens: must be greater than or equal to 1")
+	}
+	if *req.MaxTokens < limit {
+		return *req.MaxTokens, nil
 	}
-	return out
+	return limit, nil
 }
@@ -0,0 +1,287 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gopenbridge/config"
+	"gopenbridge/models"
+)
+
+// newTestProxy returns a proxy whose default upstream is upstream, with a
+// database in a temporary directory and no config file. Log rows are
+// written synchronously. configure, if set, adjusts the loaded config.
+func newTestProxy(t *testing.T, upstream string, configure func(cfg *config.Config)) *ChatProxy {
+	t.Helper()
+	dir := t.TempDir()
+	t.Chdir(dir)
+	t.Setenv("HOME", dir)
+	t.Setenv("OPENAI_BASE_URL", upstream)
+	t.Setenv("OPENAI_API_KEY", "test-key")
+	t.Setenv("OPENAI_MODEL", "test-model")
+	t.Setenv("DB_PATH", filepath.Join(dir, "test.db"))
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Provider = "openai"
+	cfg.LogQueueSize = 0
+	if configure != nil {
+		configure(cfg)
+	}
+	p := NewChatProxy(cfg)
+	t.Cleanup(func() { p.db.Close() })
+	return p
+}
+
+// testContext returns a context tracking a new request, as ServeHTTP
+// starts one.
+func testContext() context.Context {
+	return withRequestInfo(context.Background(), newRequestInfo())
+}
+
+func TestSendUpstreamReleasesTrialWhenQueueIsFull(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[]}`))
+	}))
+	defer upstream.Close()
+	p := newTestProxy(t, upstream.URL, func(cfg *config.Config) {
+		cfg.BreakerThreshold = 1
+		cfg.BreakerCooldown = time.Millisecond
+		cfg.UpstreamMaxQueue = 0
+	})
+	ctx := testContext()
+	tgt := p.targets(ctx)[0]
+	tgt.maxConcurrency = 1
+	req := &models.MessagesRequest{Model: "test-model"}
+
+	// Open the breaker and let the cooldown pass, so the next request is
+	// the half-open trial
+	p.breakerFor(upstream.URL).Failure()
+	time.Sleep(2 * time.Millisecond)
+
+	// The trial finds the upstream's only slot taken and no queue
+	release, err := p.acquireSlot(ctx, tgt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, _, err = p.sendUpstream(ctx, tgt, "log-1", req, []byte(`{}`), false)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Type != "overloaded_error" || !strings.Contains(apiErr.Message, "concurrent") {
+		t.Fatalf("sendUpstream with a full queue = %v, want a queue full error", err)
+	}
+	release()
+
+	res, _, _, err := p.sendUpstream(ctx, tgt, "log-2", req, []byte(`{}`), false)
+	if err != nil {
+		t.Fatalf("breaker stayed open after the trial was rejected for a full queue: %v", err)
+	}
+	res.Body.Close()
+}
+
+func TestSendUpstreamReleasesTrialWhenClientCancels(t *testing.T) {
+	var calls atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		if calls.Add(1) == 1 {
+			// The first request hangs until the client gives up
+			<-r.Context().Done()
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[]}`))
+	}))
+	defer upstream.Close()
+	p := newTestProxy(t, upstream.URL, func(cfg *config.Config) {
+		cfg.BreakerThreshold = 1
+		cfg.BreakerCooldown = time.Millisecond
+	})
+	tgt := p.targets(testContext())[0]
+	req := &models.MessagesRequest{Model: "test-model"}
+	p.breakerFor(upstream.URL).Failure()
+	time.Sleep(2 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(testContext(), 50*time.Millisecond)
+	defer cancel()
+	if _, _, _, err := p.sendUpstream(ctx, tgt, "log-1", req, []byte(`{}`), false); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("sendUpstream of a cancelled trial = %v, want the context's error", err)
+	}
+
+	res, _, _, err := p.sendUpstream(testContext(), tgt, "log-2", req, []byte(`{}`), false)
+	if err != nil {
+		t.Fatalf("breaker stayed open after the client cancelled the trial: %v", err)
+	}
+	res.Body.Close()
+}
+
+// proxyWithConfig returns a bare proxy on cfg, for methods that only read
+// the configuration.
+func proxyWithConfig(cfg *config.Config) *ChatProxy {
+	p := &ChatProxy{}
+	p.live.Store(cfg)
+	return p
+}
+
+func TestResolveMaxTokens(t *testing.T) {
+	intPtr := func(n int) *int { return &n }
+	tests := []struct {
+		name      string
+		strict    bool
+		maxTokens *int
+		want      int
+		wantErr   string
+	}{
+		{name: "missing, lenient", want: 4096},
+		{name: "missing, strict", strict: true, wantErr: "max_tokens: Field required"},
+		{name: "zero", maxTokens: intPtr(0), wantErr: "greater than or equal to 1"},
+		{name: "negative", maxTokens: intPtr(-5), strict: true, wantErr: "greater than or equal to 1"},
+		{name: "below the limit", maxTokens: intPtr(256), want: 256},
+		{name: "below the limit, strict", maxTokens: intPtr(256), strict: true, want: 256},
+		{name: "above the limit", maxTokens: intPtr(100000), want: 4096},
+	}
+	for _, tt := range tests {
+		p := proxyWithConfig(&config.Config{StrictMaxTokens: tt.strict})
+		got, err := p.resolveMaxTokens(&models.MessagesRequest{MaxTokens: tt.maxTokens}, 4096)
+		if tt.wantErr != "" {
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) || apiErr.Type != "invalid_request_error" || !strings.Contains(apiErr.Message, tt.wantErr) {
+				t.Errorf("%s: err = %v, want an invalid_request_error containing %q", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("%s: got %d, %v, want %d", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+// openAIReply is a minimal OpenAI chat completion answering "Hello".
+const openAIReply = `{"id":"c1","choices":[{"index":0,"message":{"role":"assistant","content":"Hello"},"finish_reason":"stop"}],"usage":{"prompt_tokens":5,"completion_tokens":1}}`
+
+// postMessages sends a non-streaming /v1/messages request through p and
+// returns the recorded response.
+func postMessages(p *ChatProxy, header http.Header) *httptest.ResponseRecorder {
+	body := `{"model":"test-model","max_tokens":100,"messages":[{"role":"user","content":"Hi"}]}`
+	r := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	for k, v := range header {
+		r.Header[k] = v
+	}
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, r)
+	return w
+}
+
+func TestIncludeRawUpstream(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(openAIReply))
+	}))
+	defer upstream.Close()
+	tests := []struct {
+		allow  bool
+		header string
+		want   bool
+	}{
+		{allow: false, header: "", want: false},
+		{allow: false, header: "true", want: false},
+		{allow: true, header: "", want: false},
+		{allow: true, header: "false", want: false},
+		{allow: true, header: "true", want: true},
+	}
+	for _, tt := range tests {
+		p := newTestProxy(t, upstream.URL, func(cfg *config.Config) { cfg.AllowRawUpstream = tt.allow })
+		header := http.Header{}
+		if tt.header != "" {
+			header.Set("X-Include-Raw-Upstream", tt.header)
+		}
+		w := postMessages(p, header)
+		if w.Code != http.StatusOK {
+			t.Fatalf("allow_raw_upstream=%v, header %q: status %d: %s", tt.allow, tt.header, w.Code, w.Body)
+		}
+		var res map[string]interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+			t.Fatal(err)
+		}
+		raw, got := res["upstream_response"]
+		if got != tt.want {
+			t.Errorf("allow_raw_upstream=%v, header %q: upstream_response present = %v, want %v", tt.allow, tt.header, got, tt.want)
+		}
+		if got && raw.(map[string]interface{})["id"] != "c1" {
+			t.Errorf("upstream_response = %v, want the upstream body", raw)
+		}
+	}
+}
+
+func TestHTMLUpstreamErrorPage(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.WriteHeader(http.StatusBadGateway)
+		w.Write([]byte("<html>\n<head><title>502 Bad Gateway</title></head>\n<body><h1>502 Bad Gateway</h1></body>\n</html>"))
+	}))
+	defer upstream.Close()
+	p := newTestProxy(t, upstream.URL, func(cfg *config.Config) { cfg.RetryMaxAttempts = 1 })
+	w := postMessages(p, nil)
+	var res struct {
+		Type  string `json:"type"`
+		Error struct {
+			Type    string `json:"type"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatalf("response is not JSON: %v: %s", err, w.Body)
+	}
+	if res.Type != "error" || res.Error.Type != "api_error" {
+		t.Fatalf("response = %s, want an api_error", w.Body)
+	}
+	for _, want := range []string{"status 502", "<title>502 Bad Gateway</title>"} {
+		if !strings.Contains(res.Error.Message, want) {
+			t.Errorf("error message %q lacks %q", res.Error.Message, want)
+		}
+	}
+}
+
+func TestResolveOptionsDefaultModel(t *testing.T) {
+	intPtr := func(n int) *int { return &n }
+	tests := []struct {
+		name         string
+		defaultModel string
+		model        string
+		want         string
+		wantErr      bool
+	}{
+		{name: "omitted, default set", defaultModel: "gpt-4o", want: "gpt-4o"},
+		{name: "given, default set", defaultModel: "gpt-4o", model: "gpt-4o-mini", want: "gpt-4o-mini"},
+		{name: "given, no default", model: "gpt-4o-mini", want: "gpt-4o-mini"},
+		{name: "omitted, no default", wantErr: true},
+	}
+	for _, tt := range tests {
+		p := proxyWithConfig(&config.Config{DefaultModel: tt.defaultModel, MaxTokens: 4096})
+		req := &models.MessagesRequest{Model: tt.model, MaxTokens: intPtr(100)}
+		_, err := p.resolveOptions(testContext(), req)
+		if tt.wantErr {
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) || apiErr.Type != "invalid_request_error" || !strings.Contains(apiErr.Message, "model") {
+				t.Errorf("%s: err = %v, want an invalid_request_error for the model", tt.name, err)
+			}
+			if req.Model != "" {
+				t.Errorf("%s: model = %q, want it left empty", tt.name, req.Model)
+			}
+			continue
+		}
+		if err != nil || req.Model != tt.want {
+			t.Errorf("%s: model = %q, %v, want %q", tt.name, req.Model, err, tt.want)
+		}
+	}
+}
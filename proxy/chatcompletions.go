@@ -0,0 +1,415 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"strings"
+	"time"
+
+	"gopenbridge/models"
+)
+
+// chatRequest is an inbound OpenAI chat completions request.
+type chatRequest struct {
+	Model               string                   `json:"model"`
+	Messages            []map[string]interface{} `json:"messages"`
+	MaxTokens           *int                     `json:"max_tokens,omitempty"`
+	MaxCompletionTokens *int                     `json:"max_completion_tokens,omitempty"`
+	Temperature         *float64                 `json:"temperature,omitempty"`
+	TopP                *float64                 `json:"top_p,omitempty"`
+	Stop                interface{}              `json:"stop,omitempty"`
+	Stream              *bool                    `json:"stream,omitempty"`
+	StreamOptions       *struct {
+		IncludeUsage bool `json:"include_usage"`
+	} `json:"stream_options,omitempty"`
+	Tools      []chatTool  `json:"tools,omitempty"`
+	ToolChoice interface{} `json:"tool_choice,omitempty"`
+	User       string      `json:"user,omitempty"`
+}
+
+// chatTool is an OpenAI function tool definition.
+type chatTool struct {
+	Type     string `json:"type"`
+	Function struct {
+		Name        string                 `json:"name"`
+		Description string                 `json:"description,omitempty"`
+		Parameters  map[string]interface{} `json:"parameters,omitempty"`
+	} `json:"function"`
+}
+
+// ServeChatCompletions answers POST /v1/chat/completions for OpenAI-style
+// clients. The request is translated to a Messages request and served by
+// ServeHTTP, sharing auth, routing, limits and logging with /v1/messages,
+// and the message, its event stream or the error is translated back.
+func (p *ChatProxy) ServeChatCompletions(w http.ResponseWriter, r *http.Request) {
+	var creq chatRequest
+	if _, err := p.decodeBody(w, r, &creq); err != nil {
+		writeOpenAIError(w, err)
+		return
+	}
+	req, err := messagesFromChat(&creq)
+	if err != nil {
+		writeOpenAIError(w, err)
+		return
+	}
+	body, _ := json.Marshal(req)
+	inner := r.Clone(r.Context())
+	inner.Header.Del("Accept-Encoding") // the translated body must stay readable
+	inner.Body = io.NopCloser(bytes.NewReader(body))
+	inner.ContentLength = int64(len(body))
+
+	includeUsage := creq.StreamOptions != nil && creq.StreamOptions.IncludeUsage
+	created := time.Now().Unix()
+	var id string
+	usage := make(map[string]interface{})
+	toolIndex := make(map[int]int) // Anthropic block index -> tool_calls index
+	chunk := func(delta map[string]interface{}, finish interface{}) map[string]interface{} {
+		return map[string]interface{}{
+			"id":      id,
+			"object":  "chat.completion.chunk",
+			"created": created,
+			"model":   creq.Model,
+			"choices": []interface{}{map[string]interface{}{"index": 0, "delta": delta, "finish_reason": finish}},
+		}
+	}
+	tw := &translatingWriter{ResponseWriter: w}
+	tw.event = func(w io.Writer, name string, data []byte) error {
+		var ev map[string]interface{}
+		json.Unmarshal(data, &ev)
+		var out []interface{}
+		switch name {
+		case "message_start":
+			msg, _ := ev["message"].(map[string]interface{})
+			msgID, _ := msg["id"].(string)
+			id = "chatcmpl-" + strings.TrimPrefix(msgID, "msg_")
+			u, _ := msg["usage"].(map[string]interface{})
+			maps.Copy(usage, u)
+			out = append(out, chunk(map[string]interface{}{"role": "assistant", "content": ""}, nil))
+		case "content_block_start":
+			block, _ := ev["content_block"].(map[string]interface{})
+			if block["type"] == "tool_use" {
+				idx, _ := ev["index"].(float64)
+				toolIndex[int(idx)] = len(toolIndex)
+				out = append(out, chunk(map[string]interface{}{"tool_calls": []interface{}{map[string]interface{}{
+					"index":    toolIndex[int(idx)],
+					"id":       block["id"],
+					"type":     "function",
+					"function": map[string]interface{}{"name": block["name"], "arguments": ""},
+				}}}, nil))
+			}
+		case "content_block_delta":
+			idx, _ := ev["index"].(float64)
+			delta, _ := ev["delta"].(map[string]interface{})
+			switch delta["type"] {
+			case "text_delta":
+				out = append(out, chunk(map[string]interface{}{"content": delta["text"]}, nil))
+			case "thinking_delta":
+				out = append(out, chunk(map[string]interface{}{"reasoning_content": delta["thinking"]}, nil))
+			case "input_json_delta":
+				out = append(out, chunk(map[string]interface{}{"tool_calls": []interface{}{map[string]interface{}{
+					"index":    toolIndex[int(idx)],
+					"function": map[string]interface{}{"arguments": delta["partial_json"]},
+				}}}, nil))
+			}
+		case "message_delta":
+			delta, _ := ev["delta"].(map[string]interface{})
+			reason, _ := delta["stop_reason"].(string)
+			out = append(out, chunk(map[string]interface{}{}, chatFinishReason(reason)))
+			// Anthropic sends only the counts that changed
+			u, _ := ev["usage"].(map[string]interface{})
+			maps.Copy(usage, u)
+			if includeUsage {
+				c := chunk(nil, nil)
+				c["choices"], c["usage"] = []interface{}{}, chatUsage(usage)
+				out = append(out, c)
+			}
+		case "message_stop":
+			_, err := io.WriteString(w, "data: [DONE]\n\n")
+			return err
+		case "error":
+			errObj, _ := ev["error"].(map[string]interface{})
+			out = append(out, map[string]interface{}{"error": openAIErrorBody(errObj)})
+		case "ping":
+			_, err := io.WriteString(w, ": ping\n\n")
+			return err
+		}
+		for _, o := range out {
+			b, _ := json.Marshal(o)
+			if _, err := fmt.Fprintf(w, "data: %s\n\n", b); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	tw.body = func(w http.ResponseWriter, status int, data []byte) {
+		var msg map[string]interface{}
+		if status != http.StatusOK {
+			rewriteOpenAIError(w, status, data)
+			return
+		}
+		if json.Unmarshal(data, &msg) != nil {
+			w.WriteHeader(status)
+			w.Write(data)
+			return
+		}
+		res, _ := json.Marshal(chatCompletion(msg, creq.Model, created))
+		w.WriteHeader(status)
+		w.Write(append(res, '\n'))
+	}
+	p.ServeHTTP(tw, inner)
+	tw.Close()
+}
+
+// messagesFromChat converts an OpenAI chat request to a Messages request.
+// System and developer messages become the system prompt, tool messages
+// become tool_result blocks and assistant tool calls become tool_use blocks.
+func messagesFromChat(c *chatRequest) (*models.MessagesRequest, error) {
+	req := &models.MessagesRequest{
+		Model:       c.Model,
+		MaxTokens:   c.MaxCompletionTokens,
+		Temperature: c.Temperature,
+		TopP:        c.TopP,
+		Stream:      c.Stream,
+	}
+	if req.MaxTokens == nil {
+		req.MaxTokens = c.MaxTokens
+	}
+	switch s := c.Stop.(type) {
+	case string:
+		req.StopSequences = []string{s}
+	case []interface{}:
+		for _, v := range s {
+			if str, ok := v.(string); ok {
+				req.StopSequences = append(req.StopSequences, str)
+			}
+		}
+	}
+	if c.User != "" {
+		req.Metadata = &models.Metadata{UserID: c.User}
+	}
+	for _, t := range c.Tools {
+		if t.Type != "" && t.Type != "function" {
+			return nil, invalidRequest(fmt.Sprintf("tools: unsupported tool type %q", t.Type))
+		}
+		schema := t.Function.Parameters
+		if schema == nil {
+			schema = map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}
+		}
+		req.Tools = append(req.Tools, models.Tool{Name: t.Function.Name, Description: t.Function.Description, InputSchema: schema})
+	}
+	switch tc := c.ToolChoice.(type) {
+	case string:
+		switch tc {
+		case "auto", "none":
+			req.ToolChoice = map[string]interface{}{"type": tc}
+		case "required":
+			req.ToolChoice = map[string]interface{}{"type": "any"}
+		}
+	case map[string]interface{}:
+		fn, _ := tc["function"].(map[string]interface{})
+		req.ToolChoice = map[string]interface{}{"type": "tool", "name": fn["name"]}
+	}
+	var system []string
+	for _, m := range c.Messages {
+		role, _ := m["role"].(string)
+		switch role {
+		case "system", "developer":
+			if txt := chatText(m["content"]); txt != "" {
+				system = append(system, txt)
+			}
+		case "user":
+			req.Messages = appendMessage(req.Messages, "user", chatBlocks(m["content"]))
+		case "assistant":
+			blocks := chatBlocks(m["content"])
+			calls, _ := m["tool_calls"].([]interface{})
+			for _, call := range calls {
+				cm, _ := call.(map[string]interface{})
+				fn, _ := cm["function"].(map[string]interface{})
+				args, _ := fn["arguments"].(string)
+				input := map[string]interface{}{}
+				if args != "" {
+					if err := json.Unmarshal([]byte(args), &input); err != nil {
+						return nil, invalidRequest("messages: tool call arguments are not a JSON object: " + err.Error())
+					}
+				}
+				blocks = append(blocks, map[string]interface{}{"type": "tool_use", "id": cm["id"], "name": fn["name"], "input": input})
+			}
+			req.Messages = appendMessage(req.Messages, "assistant", blocks)
+		case "tool":
+			req.Messages = appendMessage(req.Messages, "user", []interface{}{map[string]interface{}{
+				"type":        "tool_result",
+				"tool_use_id": m["tool_call_id"],
+				"content":     chatText(m["content"]),
+			}})
+		default:
+			return nil, invalidRequest(fmt.Sprintf("messages: unsupported role %q", role))
+		}
+	}
+	if len(system) > 0 {
+		req.System = strings.Join(system, "\n\n")
+	}
+	return req, nil
+}
+
+// appendMessage adds blocks to msgs, merging them into the last message
+// when it has the same role, since Anthropic requires alternating roles.
+func appendMessage(msgs []models.Message, role string, blocks []interface{}) []models.Message {
+	if len(blocks) == 0 {
+		return msgs
+	}
+	if n := len(msgs); n > 0 && msgs[n-1].Role == role {
+		prev, _ := msgs[n-1].Content.([]interface{})
+		msgs[n-1].Content = append(prev, blocks...)
+		return msgs
+	}
+	return append(msgs, models.Message{Role: role, Content: blocks})
+}
+
+// chatText returns the text of OpenAI message content: a string or an
+// array of text parts.
+func chatText(content interface{}) string {
+	var texts []string
+	for _, b := range chatBlocks(content) {
+		if bm, _ := b.(map[string]interface{}); bm["type"] == "text" {
+			texts = append(texts, bm["text"].(string))
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// chatBlocks converts OpenAI message content into Anthropic blocks. Image
+// parts with data URLs become base64 images, others URL images.
+func chatBlocks(content interface{}) []interface{} {
+	switch c := content.(type) {
+	case string:
+		if c == "" {
+			return nil
+		}
+		return []interface{}{map[string]interface{}{"type": "text", "text": c}}
+	case []interface{}:
+		var out []interface{}
+		for _, part := range c {
+			pm, _ := part.(map[string]interface{})
+			switch pm["type"] {
+			case "text":
+				if txt, _ := pm["text"].(string); txt != "" {
+					out = append(out, map[string]interface{}{"type": "text", "text": txt})
+				}
+			case "image_url":
+				img, _ := pm["image_url"].(map[string]interface{})
+				url, _ := img["url"].(string)
+				source := map[string]interface{}{"type": "url", "url": url}
+				if rest, ok := strings.CutPrefix(url, "data:"); ok {
+					if mediaType, data, ok := strings.Cut(rest, ";base64,"); ok {
+						source = map[string]interface{}{"type": "base64", "media_type": mediaType, "data": data}
+					}
+				}
+				out = append(out, map[string]interface{}{"type": "image", "source": source})
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// chatCompletion converts an Anthropic message into a chat.completion.
+func chatCompletion(msg map[string]interface{}, model string, created int64) map[string]interface{} {
+	var text, reasoning strings.Builder
+	var calls []interface{}
+	blocks, _ := msg["content"].([]interface{})
+	for _, blk := range blocks {
+		b, _ := blk.(map[string]interface{})
+		switch b["type"] {
+		case "text":
+			s, _ := b["text"].(string)
+			text.WriteString(s)
+		case "thinking":
+			s, _ := b["thinking"].(string)
+			reasoning.WriteString(s)
+		case "tool_use":
+			args, _ := json.Marshal(b["input"])
+			calls = append(calls, map[string]interface{}{
+				"id":       b["id"],
+				"type":     "function",
+				"function": map[string]interface{}{"name": b["name"], "arguments": string(args)},
+			})
+		}
+	}
+	message := map[string]interface{}{"role": "assistant", "content": nil}
+	if text.Len() > 0 {
+		message["content"] = text.String()
+	}
+	if reasoning.Len() > 0 {
+		message["reasoning_content"] = reasoning.String()
+	}
+	if len(calls) > 0 {
+		message["tool_calls"] = calls
+	}
+	id, _ := msg["id"].(string)
+	reason, _ := msg["stop_reason"].(string)
+	usage, _ := msg["usage"].(map[string]interface{})
+	return map[string]interface{}{
+		"id":      "chatcmpl-" + strings.TrimPrefix(id, "msg_"),
+		"object":  "chat.completion",
+		"created": created,
+		"model":   model,
+		"choices": []interface{}{map[string]interface{}{"index": 0, "message": message, "finish_reason": chatFinishReason(reason)}},
+		"usage":   chatUsage(usage),
+	}
+}
+
+// chatFinishReason maps an Anthropic stop_reason to an OpenAI finish_reason.
+func chatFinishReason(reason string) string {
+	switch reason {
+	case "max_tokens":
+		return "length"
+	case "tool_use":
+		return "tool_calls"
+	case "refusal":
+		return "content_filter"
+	}
+	return "stop"
+}
+
+// chatUsage converts Anthropic usage, where cached tokens are counted
+// apart, into OpenAI usage.
+func chatUsage(usage map[string]interface{}) map[string]interface{} {
+	in, _ := usage["input_tokens"].(float64)
+	out, _ := usage["output_tokens"].(float64)
+	read, _ := usage["cache_read_input_tokens"].(float64)
+	write, _ := usage["cache_creation_input_tokens"].(float64)
+	prompt := int(in + read + write)
+	return map[string]interface{}{
+		"prompt_tokens":         prompt,
+		"completion_tokens":     int(out),
+		"total_tokens":          prompt + int(out),
+		"prompt_tokens_details": map[string]interface{}{"cached_tokens": int(read)},
+	}
+}
+
+// openAIErrorBody converts an Anthropic error object into an OpenAI one.
+func openAIErrorBody(errObj map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{"message": errObj["message"], "type": errObj["type"], "param": nil, "code": nil}
+}
+
+// writeOpenAIError writes err in OpenAI's error format.
+func writeOpenAIError(w http.ResponseWriter, err error) {
+	tw := &translatingWriter{ResponseWriter: w, body: rewriteOpenAIError}
+	writeError(tw, err)
+	tw.Close()
+}
+
+// rewriteOpenAIError writes an Anthropic error response body in OpenAI's
+// error format.
+func rewriteOpenAIError(w http.ResponseWriter, status int, data []byte) {
+	var msg map[string]interface{}
+	json.Unmarshal(data, &msg)
+	errObj, _ := msg["error"].(map[string]interface{})
+	res, _ := json.Marshal(map[string]interface{}{"error": openAIErrorBody(errObj)})
+	w.WriteHeader(status)
+	w.Write(append(res, '\n'))
+}
@@ -0,0 +1,77 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+
+	"gopenbridge/config"
+)
+
+// newUpstreamClient returns the HTTP client shared by all upstream calls.
+// Its transport pools keep-alive connections and caches TLS sessions, so
+// back-to-back requests skip the TCP and TLS handshakes. There is no overall
+// timeout, since streaming responses may legitimately run for minutes.
+func newUpstreamClient(cfg *config.Config) (*http.Client, error) {
+	tlsCfg, err := upstreamTLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	dialer := &net.Dialer{Timeout: cfg.UpstreamConnectTimeout, KeepAlive: cfg.UpstreamIdleConnTimeout}
+	transport := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   cfg.UpstreamConnectTimeout,
+		ResponseHeaderTimeout: cfg.UpstreamResponseTimeout,
+		MaxIdleConns:          cfg.UpstreamMaxIdleConns,
+		MaxIdleConnsPerHost:   cfg.UpstreamMaxIdleConnsPerHost,
+		IdleConnTimeout:       cfg.UpstreamIdleConnTimeout,
+		TLSClientConfig:       tlsCfg,
+		ForceAttemptHTTP2:     cfg.UpstreamHTTP2,
+	}
+	if !cfg.UpstreamHTTP2 {
+		// A non-nil empty map disables HTTP/2 negotiation
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+	return &http.Client{Transport: transport}, nil
+}
+
+// upstreamTLSConfig builds the client TLS settings: a client certificate
+// for upstreams that require mTLS, extra CAs for private gateways and the
+// option to skip verification entirely.
+func upstreamTLSConfig(cfg *config.Config) (*tls.Config, error) {
+	tlsCfg := &tls.Config{
+		ClientSessionCache: tls.NewLRUClientSessionCache(0),
+		InsecureSkipVerify: cfg.UpstreamInsecureSkipVerify,
+	}
+	if cfg.UpstreamInsecureSkipVerify {
+		slog.Warn("Upstream TLS certificate verification is disabled")
+	}
+	if cfg.UpstreamClientCert != "" || cfg.UpstreamClientKey != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.UpstreamClientCert, cfg.UpstreamClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("load upstream client certificate: %w", err)
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+	if cfg.UpstreamCAFile != "" {
+		pem, err := os.ReadFile(cfg.UpstreamCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read upstream CA bundle: %w", err)
+		}
+		// Private CAs are trusted in addition to the system roots
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", cfg.UpstreamCAFile)
+		}
+		tlsCfg.RootCAs = pool
+	}
+	return tlsCfg, nil
+}
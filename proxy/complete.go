@@ -0,0 +1,184 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+
+	"gopenbridge/models"
+)
+
+// humanPrompt starts a user turn in a Text Completions prompt. The legacy
+// API always stops before the model writes one.
+const humanPrompt = "\n\nHuman:"
+
+// turnMarker matches the start of a turn in a Text Completions prompt.
+var turnMarker = regexp.MustCompile(`\n\n(Human|Assistant):`)
+
+// completionRequest is a legacy Text Completions request.
+type completionRequest struct {
+	Model             string           `json:"model"`
+	Prompt            string           `json:"prompt"`
+	MaxTokensToSample *int             `json:"max_tokens_to_sample"`
+	StopSequences     []string         `json:"stop_sequences,omitempty"`
+	Temperature       *float64         `json:"temperature,omitempty"`
+	TopP              *float64         `json:"top_p,omitempty"`
+	TopK              *int             `json:"top_k,omitempty"`
+	Stream            *bool            `json:"stream,omitempty"`
+	Metadata          *models.Metadata `json:"metadata,omitempty"`
+}
+
+// ServeComplete answers the legacy POST /v1/complete endpoint: the prompt is
+// translated to a Messages request, served by ServeHTTP, and the message or
+// its event stream is translated back to completions.
+func (p *ChatProxy) ServeComplete(w http.ResponseWriter, r *http.Request) {
+	var creq completionRequest
+	if _, err := p.decodeBody(w, r, &creq); err != nil {
+		writeError(w, err)
+		return
+	}
+	if strings.TrimSpace(creq.Prompt) == "" {
+		writeError(w, invalidRequest("prompt: field required"))
+		return
+	}
+	if creq.MaxTokensToSample == nil {
+		writeError(w, invalidRequest("max_tokens_to_sample: field required"))
+		return
+	}
+	system, msgs := promptMessages(creq.Prompt)
+	req := models.MessagesRequest{
+		Model:         creq.Model,
+		Messages:      msgs,
+		MaxTokens:     creq.MaxTokensToSample,
+		Temperature:   creq.Temperature,
+		TopP:          creq.TopP,
+		TopK:          creq.TopK,
+		StopSequences: creq.StopSequences,
+		Stream:        creq.Stream,
+		Metadata:      creq.Metadata,
+	}
+	if !slices.Contains(req.StopSequences, humanPrompt) {
+		req.StopSequences = append(slices.Clone(req.StopSequences), humanPrompt)
+	}
+	if system != "" {
+		req.System = system
+	}
+	body, _ := json.Marshal(req)
+	inner := r.Clone(r.Context())
+	inner.Header.Del("Accept-Encoding") // the translated body must stay readable
+	inner.Body = io.NopCloser(bytes.NewReader(body))
+	inner.ContentLength = int64(len(body))
+
+	var id, stopReason string
+	var stop interface{}
+	completion := func(text string, stopReason interface{}, stop interface{}) map[string]interface{} {
+		return map[string]interface{}{
+			"type":        "completion",
+			"id":          id,
+			"completion":  text,
+			"stop_reason": stopReason,
+			"stop":        stop,
+			"model":       creq.Model,
+		}
+	}
+	tw := &translatingWriter{ResponseWriter: w}
+	tw.event = func(w io.Writer, name string, data []byte) error {
+		var ev map[string]interface{}
+		json.Unmarshal(data, &ev)
+		var out interface{}
+		switch name {
+		case "message_start":
+			msg, _ := ev["message"].(map[string]interface{})
+			id, _ = msg["id"].(string)
+		case "content_block_delta":
+			delta, _ := ev["delta"].(map[string]interface{})
+			if txt, ok := delta["text"].(string); ok && delta["type"] == "text_delta" {
+				name, out = "completion", completion(txt, nil, nil)
+			}
+		case "message_delta":
+			delta, _ := ev["delta"].(map[string]interface{})
+			reason, _ := delta["stop_reason"].(string)
+			stopReason, stop = completionStopReason(reason), delta["stop_sequence"]
+		case "message_stop":
+			name, out = "completion", completion("", stopReason, stop)
+		case "ping", "error":
+			out = ev
+		}
+		if out == nil {
+			return nil
+		}
+		b, _ := json.Marshal(out)
+		_, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, b)
+		return err
+	}
+	tw.body = func(w http.ResponseWriter, status int, data []byte) {
+		var msg map[string]interface{}
+		if status != http.StatusOK || json.Unmarshal(data, &msg) != nil {
+			w.WriteHeader(status)
+			w.Write(data)
+			return
+		}
+		id, _ = msg["id"].(string)
+		var text strings.Builder
+		blocks, _ := msg["content"].([]interface{})
+		for _, blk := range blocks {
+			if b, _ := blk.(map[string]interface{}); b["type"] == "text" {
+				s, _ := b["text"].(string)
+				text.WriteString(s)
+			}
+		}
+		reason, _ := msg["stop_reason"].(string)
+		res, _ := json.Marshal(completion(text.String(), completionStopReason(reason), msg["stop_sequence"]))
+		w.WriteHeader(status)
+		w.Write(append(res, '\n'))
+	}
+	p.ServeHTTP(tw, inner)
+	tw.Close()
+}
+
+// promptMessages splits a "\n\nHuman: ...\n\nAssistant:" prompt into
+// messages. Text before the first turn becomes the system prompt, text
+// after a final "Assistant:" is kept as the start of the reply, and a
+// prompt without turns is one user message.
+func promptMessages(prompt string) (string, []models.Message) {
+	locs := turnMarker.FindAllStringSubmatchIndex(prompt, -1)
+	if len(locs) == 0 {
+		return "", []models.Message{{Role: "user", Content: strings.TrimSpace(prompt)}}
+	}
+	system := strings.TrimSpace(prompt[:locs[0][0]])
+	var msgs []models.Message
+	for i, loc := range locs {
+		end := len(prompt)
+		if i+1 < len(locs) {
+			end = locs[i+1][0]
+		}
+		text := strings.TrimSpace(prompt[loc[1]:end])
+		if text == "" {
+			continue
+		}
+		role := "user"
+		if prompt[loc[2]:loc[3]] == "Assistant" {
+			role = "assistant"
+		}
+		if n := len(msgs); n > 0 && msgs[n-1].Role == role {
+			msgs[n-1].Content = msgs[n-1].Content.(string) + "\n\n" + text
+			continue
+		}
+		msgs = append(msgs, models.Message{Role: role, Content: text})
+	}
+	return system, msgs
+}
+
+// completionStopReason maps a Messages stop_reason to the Text Completions
+// one, where any natural end counts as reaching a stop sequence.
+func completionStopReason(reason string) string {
+	if reason == "max_tokens" {
+		return "max_tokens"
+	}
+	return "stop_sequence"
+}
@@ -0,0 +1,128 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// upstreamAcceptEncoding is sent to upstreams when upstream_compression is
+// on. Setting it by hand turns off the transport's own gzip handling, so
+// responses are decoded by decompressResponse.
+const upstreamAcceptEncoding = "gzip, deflate"
+
+// decompressResponse replaces a gzip or deflate encoded response body with
+// its decoded content, so translation and logging see plain JSON.
+func decompressResponse(res *http.Response) error {
+	enc := strings.ToLower(strings.TrimSpace(res.Header.Get("Content-Encoding")))
+	if enc == "" || enc == "identity" {
+		return nil
+	}
+	body, err := decoder(enc, res.Body)
+	if err != nil {
+		return fmt.Errorf("failed to decode %s upstream response: %w", enc, err)
+	}
+	if body == nil {
+		return nil
+	}
+	res.Body = &decodedBody{Reader: body, raw: res.Body}
+	res.Header.Del("Content-Encoding")
+	res.Header.Del("Content-Length")
+	res.ContentLength = -1
+	res.Uncompressed = true
+	return nil
+}
+
+// decoder returns a reader decoding r with the content coding enc, or nil
+// for codings it does not know. Servers disagree on whether deflate means
+// zlib or raw DEFLATE, so both are accepted.
+func decoder(enc string, r io.Reader) (io.Reader, error) {
+	switch enc {
+	case "gzip", "x-gzip":
+		return gzip.NewReader(r)
+	case "deflate":
+		br := bufio.NewReader(r)
+		if head, err := br.Peek(2); err == nil && head[0]&0x0f == 8 && (uint(head[0])<<8|uint(head[1]))%31 == 0 {
+			return zlib.NewReader(br)
+		}
+		return flate.NewReader(br), nil
+	}
+	return nil, nil
+}
+
+// decodedBody closes the raw body under a decoding reader.
+type decodedBody struct {
+	io.Reader
+	raw io.ReadCloser
+}
+
+// Close satisfies io.Closer.
+func (b *decodedBody) Close() error {
+	if c, ok := b.Reader.(io.Closer); ok {
+		c.Close()
+	}
+	return b.raw.Close()
+}
+
+// DecompressRequests wraps h so request bodies sent with Content-Encoding
+// gzip or deflate are decoded before handlers read them. Clients on slow
+// links can compress the large tool definitions sent with every turn.
+func DecompressRequests(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		enc := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding")))
+		if enc == "" || enc == "identity" || r.Body == nil {
+			h.ServeHTTP(w, r)
+			return
+		}
+		body, err := decoder(enc, r.Body)
+		if err != nil || body == nil {
+			msg := "unsupported Content-Encoding: " + enc
+			if err != nil {
+				msg = fmt.Sprintf("invalid %s request body: %v", enc, err)
+			}
+			writeError(w, &APIError{Status: http.StatusUnsupportedMediaType, Type: "invalid_request_error", Message: msg})
+			return
+		}
+		r.Body = &decodedBody{Reader: body, raw: r.Body}
+		r.Header.Del("Content-Encoding")
+		r.Header.Del("Content-Length")
+		r.ContentLength = -1
+		h.ServeHTTP(w, r)
+	})
+}
+
+// writeBody writes a buffered JSON response, gzipped when the client
+// accepts it and the body is at least gzip_min_size bytes.
+func (p *ChatProxy) writeBody(w http.ResponseWriter, info *requestInfo, data []byte) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Add("Vary", "Accept-Encoding")
+	if minSize := p.cfg().GzipMinSize; minSize <= 0 || len(data) < minSize || !info.acceptsGzip {
+		w.Write(data)
+		return
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(data)
+	zw.Close()
+	w.Header().Set("Content-Encoding", "gzip")
+	w.Write(buf.Bytes())
+}
+
+// acceptsGzip reports whether r's Accept-Encoding allows gzip.
+func acceptsGzip(r *http.Request) bool {
+	for _, v := range r.Header.Values("Accept-Encoding") {
+		for _, part := range strings.Split(v, ",") {
+			coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+			if strings.EqualFold(strings.TrimSpace(coding), "gzip") && strings.ReplaceAll(params, " ", "") != "q=0" {
+				return true
+			}
+		}
+	}
+	return false
+}
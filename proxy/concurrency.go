@@ -0,0 +1,98 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"path"
+
+	"gopenbridge/sched"
+)
+
+// priorityHeader lets a client choose its queue priority: "interactive",
+// "normal" or "background".
+const priorityHeader = "X-Gopenbridge-Priority"
+
+// priorityFor picks a request's queue priority from priorityHeader, or else
+// from its model: background models (haiku by default) run after
+// interactive ones.
+func (p *ChatProxy) priorityFor(r *http.Request, model string) sched.Priority {
+	if prio, ok := sched.ParsePriority(r.Header.Get(priorityHeader)); ok {
+		return prio
+	}
+	for _, pattern := range p.cfg().BackgroundModels {
+		if ok, _ := path.Match(pattern, model); ok || pattern == model {
+			return sched.Background
+		}
+	}
+	return sched.Interactive
+}
+
+// schedulerFor returns the scheduler for an upstream, or nil when its
+// concurrency is unlimited. A scheduler is replaced when a reload changes
+// its limits; requests holding the old one's slots finish unaffected.
+func (p *ChatProxy) schedulerFor(t target) *sched.Scheduler {
+	max := t.maxConcurrency
+	if max == 0 {
+		max = p.cfg().UpstreamMaxConcurrency
+	}
+	if max <= 0 {
+		return nil
+	}
+	maxQueue := p.cfg().UpstreamMaxQueue
+	p.schedulersMu.Lock()
+	defer p.schedulersMu.Unlock()
+	s, ok := p.schedulers[t.up.BaseURL]
+	if ok {
+		if m, q := s.Limits(); m != max || q != maxQueue {
+			ok = false
+		}
+	}
+	if !ok {
+		s = sched.New(max, maxQueue)
+		p.schedulers[t.up.BaseURL] = s
+	}
+	return s
+}
+
+// acquireSlot waits for a free slot on t's upstream, returning a function
+// that frees it.
+func (p *ChatProxy) acquireSlot(ctx context.Context, t target) (func(), error) {
+	s := p.schedulerFor(t)
+	if s == nil {
+		return func() {}, nil
+	}
+	info := requestFrom(ctx)
+	release, wait, err := s.Acquire(ctx, info.priority)
+	info.queueWait += wait
+	if errors.Is(err, sched.ErrQueueFull) {
+		return nil, overloaded("too many concurrent requests to the upstream, try again later")
+	}
+	return release, err
+}
+
+// UpstreamStats returns scheduler statistics keyed by upstream base URL.
+func (p *ChatProxy) UpstreamStats() map[string]sched.Stats {
+	p.schedulersMu.Lock()
+	defer p.schedulersMu.Unlock()
+	res := make(map[string]sched.Stats, len(p.schedulers))
+	for url, s := range p.schedulers {
+		res[url] = s.Stats()
+	}
+	return res
+}
+
+// releaseOnClose gives back a concurrency slot once the response body is
+// closed, so streams hold their slot until they finish.
+type releaseOnClose struct {
+	io.ReadCloser
+	release func()
+}
+
+// Close satisfies io.Closer.
+func (r *releaseOnClose) Close() error {
+	err := r.ReadCloser.Close()
+	r.release()
+	return err
+}
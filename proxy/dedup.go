@@ -0,0 +1,187 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"gopenbridge/cache"
+	"gopenbridge/models"
+)
+
+// coalescedProvider is logged as the provider of responses shared from an
+// identical in-flight request.
+const coalescedProvider = "coalesced"
+
+// flight is a request in progress whose outcome is shared with identical
+// requests that arrive meanwhile: the buffered response, or the stream's
+// events as they are produced.
+type flight struct {
+	mu      sync.Mutex
+	changed chan struct{} // closed and replaced on every update
+	events  []cachedEvent
+	result  []byte
+	err     error
+	done    bool
+}
+
+// update applies fn under the lock and wakes waiters.
+func (f *flight) update(fn func()) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.done {
+		return
+	}
+	fn()
+	close(f.changed)
+	f.changed = make(chan struct{})
+}
+
+// emit records a stream event.
+func (f *flight) emit(e cachedEvent) {
+	f.update(func() { f.events = append(f.events, e) })
+}
+
+// finish records the outcome and releases waiters. Only the first call has
+// an effect.
+func (f *flight) finish(result []byte, err error) {
+	f.update(func() { f.result, f.err, f.done = result, err, true })
+}
+
+// flightGroup tracks in-flight requests by key.
+type flightGroup struct {
+	mu      sync.Mutex
+	flights map[string]*flight
+}
+
+// join returns the flight for key, creating it if there is none, in which
+// case the caller leads it and must call leave.
+func (g *flightGroup) join(key string) (*flight, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if f, ok := g.flights[key]; ok {
+		return f, false
+	}
+	if g.flights == nil {
+		g.flights = make(map[string]*flight)
+	}
+	f := &flight{changed: make(chan struct{})}
+	g.flights[key] = f
+	return f, true
+}
+
+// leave ends the leader's flight, so later requests start their own.
+func (g *flightGroup) leave(key string, f *flight) {
+	f.finish(nil, nil)
+	g.mu.Lock()
+	if g.flights[key] == f {
+		delete(g.flights, key)
+	}
+	g.mu.Unlock()
+}
+
+// flightKey returns the key identical requests share, or "" when
+// de-duplication is off. Requests made with different virtual keys are not
+// coalesced, so each stays within its own quota.
+func (p *ChatProxy) flightKey(ctx context.Context, req *models.MessagesRequest, stream bool) string {
+	cfg := p.cfg()
+	if !cfg.DedupRequests {
+		return ""
+	}
+	var keyName string
+	if k := requestFrom(ctx).key; k != nil {
+		keyName = k.Name
+	}
+	normalized := *req
+	normalized.Stream = &stream
+	return cache.Key(cfg.BaseURL, keyName, normalized)
+}
+
+// follow waits for the leader of f and writes its outcome as this
+// request's response, relaying stream events as they arrive.
+func (p *ChatProxy) follow(ctx context.Context, w http.ResponseWriter, req *models.MessagesRequest, f *flight, stream bool) {
+	info := requestFrom(ctx)
+	id := "msg_" + info.id
+	flusher, _ := w.(http.Flusher)
+	var (
+		started    bool
+		next       int
+		stopReason string
+		raw        []byte
+		result     []byte
+		err        error
+	)
+	for {
+		f.mu.Lock()
+		events := f.events[next:]
+		next = len(f.events)
+		done, changed := f.done, f.changed
+		result, err = f.result, f.err
+		f.mu.Unlock()
+		if stream && len(events) > 0 {
+			if !started {
+				w.Header().Set("Content-Type", "text/event-stream")
+				w.Header().Set("Cache-Control", "no-cache")
+				w.WriteHeader(http.StatusOK)
+				started = true
+			}
+			for _, e := range events {
+				if sr, werr := writeEvent(w, e, id); werr != nil {
+					return
+				} else if sr != "" {
+					stopReason = sr
+				}
+				raw = fmt.Appendf(raw, "event: %s\ndata: %s\n\n", e.Event, e.Data)
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		if done {
+			break
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return
+		}
+	}
+	if started {
+		p.persistFollower(ctx, req, raw, stopReason)
+		return
+	}
+	if err == nil && result == nil {
+		err = upstreamAPIError("identical in-flight request ended without a response")
+	}
+	if err != nil {
+		p.fail(ctx, w, err)
+		return
+	}
+	var res map[string]interface{}
+	if err := json.Unmarshal(result, &res); err != nil {
+		p.fail(ctx, w, err)
+		return
+	}
+	res["id"] = id
+	stopReason, _ = res["stop_reason"].(string)
+	data, _ := json.Marshal(res)
+	p.writeBody(w, info, append(data, '\n'))
+	p.persistFollower(ctx, req, result, stopReason)
+}
+
+// persistFollower logs a request answered from another's upstream call.
+// It carries no token usage, which was counted for the leader.
+func (p *ChatProxy) persistFollower(ctx context.Context, req *models.MessagesRequest, response []byte, stopReason string) {
+	body, _ := json.Marshal(req)
+	p.persistLog(ctx, logEntry{
+		ID:         requestFrom(ctx).id,
+		Provider:   coalescedProvider,
+		Model:      req.Model,
+		Request:    string(body),
+		Response:   string(response),
+		StatusCode: http.StatusOK,
+		StopReason: stopReason,
+	})
+}
@@ -0,0 +1,47 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"gopenbridge/models"
+	"gopenbridge/providers"
+)
+
+// SendDirect translates req for the upstream it is routed to and sends it
+// there without the bridge's queueing, retries, failover, caching and
+// logging, returning the raw upstream response. The caller must close its
+// body. gopenbridge bench times it to measure the bridge's overhead.
+func (p *ChatProxy) SendDirect(ctx context.Context, req *models.MessagesRequest) (*http.Response, error) {
+	ctx = withRequestInfo(ctx, newRequestInfo())
+	opts, err := p.resolveOptions(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	t := p.targets(ctx)[0]
+	r, payload, err := p.buildPayload(ctx, t, req, opts)
+	if err != nil {
+		return nil, err
+	}
+	stream := req.Stream != nil && *req.Stream
+	if stream {
+		providers.MarkStream(t.prov, payload)
+	}
+	body, _ := json.Marshal(payload)
+	up := t.up
+	if len(t.keys) > 0 {
+		up.APIKey = t.keys[0]
+	}
+	if up.APIKey, err = p.secrets.Resolve(ctx, up.APIKey); err != nil {
+		return nil, fmt.Errorf("failed to load upstream API key: %w", err)
+	}
+	httpReq, _ := http.NewRequestWithContext(ctx, "POST", t.prov.Endpoint(t.up, r.Model, stream), bytes.NewReader(body))
+	if err := t.prov.Authorize(httpReq, up); err != nil {
+		return nil, fmt.Errorf("failed to authorize upstream request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	return p.client.Load().Do(httpReq)
+}
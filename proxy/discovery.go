@@ -0,0 +1,256 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"gopenbridge/catalog"
+	"gopenbridge/config"
+	"gopenbridge/providers"
+	"gopenbridge/secrets"
+)
+
+// modelsMaxAge is how long a cached model list is trusted by ValidateModels.
+const modelsMaxAge = 24 * time.Hour
+
+// configuredUpstream is an upstream with the model names the config sends to it.
+type configuredUpstream struct {
+	prov   providers.Provider
+	up     providers.Upstream
+	models []string
+}
+
+// configuredUpstreams returns the default upstream, the provider profiles
+// and the failovers, one entry per base URL.
+func (p *ChatProxy) configuredUpstreams() []configuredUpstream {
+	cfg := p.cfg()
+	var res []configuredUpstream
+	add := func(prov providers.Provider, up providers.Upstream, models ...string) {
+		if up.BaseURL == "" {
+			return
+		}
+		i := slices.IndexFunc(res, func(u configuredUpstream) bool { return u.up.BaseURL == up.BaseURL })
+		if i == -1 {
+			res = append(res, configuredUpstream{prov: prov, up: up})
+			i = len(res) - 1
+		}
+		for _, m := range models {
+			if m != "" && !slices.Contains(res[i].models, m) {
+				res[i].models = append(res[i].models, m)
+			}
+		}
+	}
+	// Outside a routed request the first target is the default upstream
+	primary := p.targets(context.Background())[0]
+	add(primary.prov, primary.up, cfg.Model, cfg.SmallModel)
+	for _, m := range cfg.ModelMap {
+		add(primary.prov, primary.up, m.Model)
+	}
+	for _, name := range slices.Sorted(maps.Keys(cfg.Providers)) {
+		prof := cfg.Providers[name]
+		adapter := prof.Provider
+		if adapter == "" {
+			adapter = name
+		}
+		up := primary.up
+		up.BaseURL, up.APIKey = prof.BaseURL, firstKey(prof.Keys())
+		models := []string{prof.Model}
+		for _, r := range cfg.Routes {
+			if r.Provider == name {
+				models = append(models, r.Model)
+			}
+		}
+		add(providers.Resolve(adapter, prof.BaseURL), up, models...)
+	}
+	for _, f := range cfg.Failover {
+		up := primary.up
+		up.BaseURL, up.APIKey = f.BaseURL, firstKey(f.Keys())
+		add(providers.Resolve(f.Provider, f.BaseURL), up, f.Model)
+	}
+	return res
+}
+
+// fetchModels queries an upstream's model list. ok is false when the
+// provider cannot list models.
+func (p *ChatProxy) fetchModels(ctx context.Context, u configuredUpstream) (models []string, ok bool, err error) {
+	lister, ok := providers.Lister(u.prov)
+	if !ok {
+		return nil, false, nil
+	}
+	endpoints := lister.ModelsEndpoints(u.up)
+	if len(endpoints) == 0 {
+		return nil, false, nil
+	}
+	up := u.up
+	if up.APIKey, err = p.secrets.Resolve(ctx, up.APIKey); err != nil {
+		return nil, true, fmt.Errorf("failed to load upstream API key: %w", err)
+	}
+	for _, endpoint := range endpoints {
+		req, _ := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+		if err := u.prov.Authorize(req, up); err != nil {
+			return nil, true, fmt.Errorf("failed to authorize request: %w", err)
+		}
+		res, err := p.client.Load().Do(req)
+		if err != nil {
+			return nil, true, err
+		}
+		data, err := io.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			return nil, true, err
+		}
+		if res.StatusCode != http.StatusOK {
+			return nil, true, fmt.Errorf("GET %s: %s: %s", endpoint, res.Status, data[:min(len(data), 200)])
+		}
+		var body map[string]interface{}
+		if err := json.Unmarshal(data, &body); err != nil {
+			return nil, true, fmt.Errorf("GET %s: invalid JSON: %w", endpoint, err)
+		}
+		models = append(models, lister.ParseModels(body)...)
+	}
+	return models, true, nil
+}
+
+// RefreshModels queries the model list of every configured upstream that
+// can list models and caches the results. Upstreams that fail are skipped
+// and their errors joined.
+func (p *ChatProxy) RefreshModels(ctx context.Context) ([]catalog.Entry, error) {
+	return p.collectModels(ctx, p.refreshUpstream)
+}
+
+// ListModels queries the model lists like RefreshModels, for cfg and
+// without a ChatProxy: no database is opened and nothing is cached. It
+// serves checks that must leave the store alone, such as config validate.
+func ListModels(ctx context.Context, cfg *config.Config) ([]catalog.Entry, error) {
+	client, err := newUpstreamClient(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure upstream client: %w", err)
+	}
+	p := &ChatProxy{secrets: secrets.NewCache(cfg.SecretsRefresh)}
+	p.live.Store(cfg)
+	p.client.Store(client)
+	return p.collectModels(ctx, p.upstreamModels)
+}
+
+// collectModels calls fetch for every configured upstream, skipping those
+// that fail and joining their errors.
+func (p *ChatProxy) collectModels(ctx context.Context, fetch func(context.Context, configuredUpstream) (*catalog.Entry, error)) ([]catalog.Entry, error) {
+	var res []catalog.Entry
+	var errs []error
+	for _, u := range p.configuredUpstreams() {
+		e, err := fetch(ctx, u)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", u.up.BaseURL, err))
+		} else if e != nil {
+			res = append(res, *e)
+		}
+	}
+	return res, errors.Join(errs...)
+}
+
+// refreshUpstream fetches and caches one upstream's models, returning nil
+// when the provider cannot list them.
+func (p *ChatProxy) refreshUpstream(ctx context.Context, u configuredUpstream) (*catalog.Entry, error) {
+	e, err := p.upstreamModels(ctx, u)
+	if e == nil || err != nil {
+		return nil, err
+	}
+	if err := p.catalog.Save(ctx, *e); err != nil {
+		return nil, fmt.Errorf("failed to cache models: %w", err)
+	}
+	return e, nil
+}
+
+// upstreamModels fetches one upstream's models without caching them,
+// returning nil when the provider cannot list them.
+func (p *ChatProxy) upstreamModels(ctx context.Context, u configuredUpstream) (*catalog.Entry, error) {
+	models, ok, err := p.fetchModels(ctx, u)
+	if !ok || err != nil {
+		return nil, err
+	}
+	slices.Sort(models)
+	return &catalog.Entry{Upstream: u.up.BaseURL, Provider: u.prov.Name(), Models: slices.Compact(models), FetchedAt: time.Now().UTC()}, nil
+}
+
+// CachedModels returns the cached model lists.
+func (p *ChatProxy) CachedModels(ctx context.Context) ([]catalog.Entry, error) {
+	return p.catalog.List(ctx)
+}
+
+// ValidateModels checks the configured model names against each upstream's
+// model list, fetching lists older than modelsMaxAge, and logs a warning
+// for every name the upstream does not offer. It returns the number of
+// unknown names.
+func (p *ChatProxy) ValidateModels(ctx context.Context) int {
+	unknown := 0
+	for _, u := range p.configuredUpstreams() {
+		if len(u.models) == 0 {
+			continue
+		}
+		e, err := p.catalog.Get(ctx, u.up.BaseURL)
+		if err != nil {
+			slog.Warn("Failed to read cached models", "error", err)
+		}
+		if e == nil || time.Since(e.FetchedAt) > modelsMaxAge {
+			if e, err = p.refreshUpstream(ctx, u); err != nil {
+				slog.Warn("Could not list upstream models, skipping validation", "upstream", u.up.BaseURL, "error", err)
+				continue
+			}
+		}
+		if e == nil || len(e.Models) == 0 {
+			continue
+		}
+		for _, m := range u.models {
+			name := strings.TrimPrefix(m, "models/")
+			// ARNs and other paths name resources a list cannot show
+			if strings.HasPrefix(name, "arn:") || slices.Contains(e.Models, name) {
+				continue
+			}
+			unknown++
+			slog.Warn("Configured model is not offered by the upstream", "upstream", u.up.BaseURL, "model", m, "closest", closestModel(name, e.Models))
+		}
+	}
+	return unknown
+}
+
+// closestModel returns the entry of models with the smallest edit distance
+// to name, as a suggestion for typos.
+func closestModel(name string, models []string) string {
+	best, bestDist := "", -1
+	for _, m := range models {
+		if d := editDistance(strings.ToLower(name), strings.ToLower(m)); bestDist == -1 || d < bestDist {
+			best, bestDist = m, d
+		}
+	}
+	return best
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
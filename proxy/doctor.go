@@ -0,0 +1,254 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"time"
+
+	"gopenbridge/models"
+)
+
+// Check is the outcome of one Doctor check.
+type Check struct {
+	Name    string // What was checked
+	Detail  string // What was found
+	Err     error  // Why the check failed, nil if it passed
+	Skipped bool   // The check could not run
+}
+
+// doctorPrompt and doctorTool are the smallest requests that show whether
+// the upstream answers and calls tools.
+const (
+	doctorPrompt = `{"max_tokens": 32, "messages": [{"role": "user", "content": "Reply with the single word OK."}]}`
+	doctorTool   = `{"max_tokens": 256,
+		"messages": [{"role": "user", "content": "What is the weather in Paris? Use the get_weather tool."}],
+		"tools": [{"name": "get_weather", "description": "Get the current weather in a city",
+			"input_schema": {"type": "object", "properties": {"city": {"type": "string"}}, "required": ["city"]}}],
+		"tool_choice": {"type": "tool", "name": "get_weather"}}`
+)
+
+// Doctor sends small requests for the client model through the current
+// configuration, as Claude Code would, and reports whether the upstream
+// authenticates, offers the model, streams and calls tools. An empty model
+// uses default_model. The requests are logged like any request.
+func (p *ChatProxy) Doctor(ctx context.Context, model string) []Check {
+	checks := []Check{p.checkUpstream(ctx, model), p.checkModel(ctx, model)}
+	request := p.checkRequest(ctx, model)
+	checks = append(checks, request)
+	if request.Err != nil {
+		return append(checks,
+			Check{Name: "streaming", Skipped: true, Detail: "the request check failed"},
+			Check{Name: "tools", Skipped: true, Detail: "the request check failed"})
+	}
+	return append(checks, p.checkStream(ctx, model), p.checkTools(ctx, model))
+}
+
+// doctorRequest decodes one of the doctor requests for model.
+func doctorRequest(body, model string, stream bool) *models.MessagesRequest {
+	var req models.MessagesRequest
+	if err := json.Unmarshal([]byte(body), &req); err != nil {
+		panic("invalid doctor request: " + err.Error())
+	}
+	req.Model = model
+	if stream {
+		req.Stream = &stream
+	}
+	return &req
+}
+
+// doctorTarget resolves the upstream a request for model is sent to first,
+// and the model it is sent as.
+func (p *ChatProxy) doctorTarget(ctx context.Context, model string) (target, string, error) {
+	ctx = withRequestInfo(ctx, newRequestInfo())
+	req := doctorRequest(doctorPrompt, model, false)
+	if _, err := p.resolveOptions(ctx, req); err != nil {
+		return target{}, "", err
+	}
+	t := p.targets(ctx)[0]
+	if t.model != "" {
+		return t, t.model, nil
+	}
+	return t, req.Model, nil
+}
+
+func (p *ChatProxy) checkUpstream(ctx context.Context, model string) Check {
+	c := Check{Name: "upstream"}
+	t, upstreamModel, err := p.doctorTarget(ctx, model)
+	if err != nil {
+		c.Err = err
+		return c
+	}
+	c.Detail = fmt.Sprintf("%s at %s, model %s", t.prov.Name(), t.up.BaseURL, upstreamModel)
+	switch n := len(t.keys); n {
+	case 0:
+		c.Detail += ", no API key"
+	case 1:
+		c.Detail += ", 1 API key"
+	default:
+		c.Detail += fmt.Sprintf(", %d API keys", n)
+	}
+	if upstreamModel == "" {
+		c.Err = errors.New("no model: set default_model or pass a model")
+	}
+	return c
+}
+
+func (p *ChatProxy) checkModel(ctx context.Context, model string) Check {
+	c := Check{Name: "model"}
+	t, upstreamModel, err := p.doctorTarget(ctx, model)
+	if err != nil || upstreamModel == "" {
+		c.Skipped, c.Detail = true, "no upstream model"
+		return c
+	}
+	e, err := p.refreshUpstream(ctx, configuredUpstream{prov: t.prov, up: t.up})
+	switch {
+	case err != nil:
+		c.Skipped, c.Detail = true, "could not list upstream models: "+err.Error()
+	case e == nil || len(e.Models) == 0:
+		c.Skipped, c.Detail = true, t.prov.Name()+" upstreams do not list models"
+	case slices.Contains(e.Models, strings.TrimPrefix(upstreamModel, "models/")):
+		c.Detail = fmt.Sprintf("%s is one of %d models offered", upstreamModel, len(e.Models))
+	default:
+		c.Err = fmt.Errorf("%s is not offered by the upstream, closest is %s", upstreamModel, closestModel(upstreamModel, e.Models))
+	}
+	return c
+}
+
+// doctorMessage is the part of a translated message the checks read.
+type doctorMessage struct {
+	Content []struct {
+		Type  string          `json:"type"`
+		Text  string          `json:"text"`
+		Name  string          `json:"name"`
+		Input json.RawMessage `json:"input"`
+	} `json:"content"`
+	StopReason string `json:"stop_reason"`
+	Usage      struct {
+		InputTokens  int `json:"input_tokens"`
+		OutputTokens int `json:"output_tokens"`
+	} `json:"usage"`
+}
+
+// doctorSend sends a buffered doctor request and decodes the answer.
+func (p *ChatProxy) doctorSend(ctx context.Context, req *models.MessagesRequest) (*doctorMessage, time.Duration, error) {
+	info := newRequestInfo()
+	info.logger = info.logger.With("doctor", true)
+	ctx = withRequestInfo(ctx, info)
+	res, err := p.processRequest(ctx, req, false)
+	if err != nil {
+		p.logFailure(ctx, err)
+		return nil, 0, describeFailure(err)
+	}
+	data, _ := json.Marshal(res)
+	var msg doctorMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return nil, 0, fmt.Errorf("invalid message: %w", err)
+	}
+	return &msg, time.Since(info.start), nil
+}
+
+// describeFailure explains the upstream failures new setups usually hit.
+func describeFailure(err error) error {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return err
+	}
+	switch apiErr.Status {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return fmt.Errorf("authentication failed, check the API key: %w", err)
+	case http.StatusNotFound:
+		return fmt.Errorf("not found, check the base URL and model: %w", err)
+	}
+	return err
+}
+
+func (p *ChatProxy) checkRequest(ctx context.Context, model string) Check {
+	c := Check{Name: "request"}
+	msg, took, err := p.doctorSend(ctx, doctorRequest(doctorPrompt, model, false))
+	if err != nil {
+		c.Err = err
+		return c
+	}
+	var text string
+	for _, b := range msg.Content {
+		text += b.Text
+	}
+	c.Detail = fmt.Sprintf("answered %q in %s, %d input and %d output tokens",
+		snippet([]byte(text), 40), took.Round(time.Millisecond), msg.Usage.InputTokens, msg.Usage.OutputTokens)
+	if strings.TrimSpace(text) == "" {
+		c.Err = fmt.Errorf("empty answer, stop reason %s", msg.StopReason)
+	}
+	return c
+}
+
+func (p *ChatProxy) checkStream(ctx context.Context, model string) Check {
+	c := Check{Name: "streaming"}
+	info := newRequestInfo()
+	info.logger = info.logger.With("doctor", true)
+	rec := httptest.NewRecorder()
+	p.streamRequest(withRequestInfo(ctx, info), rec, doctorRequest(doctorPrompt, model, true))
+	took := time.Since(info.start)
+	if rec.Code != http.StatusOK {
+		c.Err = describeFailure(&APIError{Status: rec.Code, Type: "error", Message: snippet(rec.Body.Bytes(), 200)})
+		return c
+	}
+	body := rec.Body.String()
+	if i := strings.Index(body, "event: error\n"); i >= 0 {
+		c.Err = fmt.Errorf("error event: %s", snippet([]byte(body[i:]), 200))
+		return c
+	}
+	var events, deltas int
+	stopped := false
+	for _, line := range strings.Split(body, "\n") {
+		event, ok := strings.CutPrefix(line, "event: ")
+		if !ok {
+			continue
+		}
+		events++
+		switch event {
+		case "content_block_delta":
+			deltas++
+		case "message_stop":
+			stopped = true
+		}
+	}
+	c.Detail = fmt.Sprintf("%d events, %d deltas in %s", events, deltas, took.Round(time.Millisecond))
+	switch {
+	case !stopped:
+		c.Err = errors.New("the stream ended without message_stop")
+	case deltas == 0:
+		c.Err = errors.New("the stream had no content")
+	}
+	return c
+}
+
+func (p *ChatProxy) checkTools(ctx context.Context, model string) Check {
+	c := Check{Name: "tools"}
+	msg, took, err := p.doctorSend(ctx, doctorRequest(doctorTool, model, false))
+	if err != nil {
+		c.Err = err
+		return c
+	}
+	for _, b := range msg.Content {
+		if b.Type != "tool_use" {
+			continue
+		}
+		var input struct {
+			City string `json:"city"`
+		}
+		if b.Name != "get_weather" || json.Unmarshal(b.Input, &input) != nil || input.City == "" {
+			c.Err = fmt.Errorf("unexpected tool call %s(%s)", b.Name, b.Input)
+			return c
+		}
+		c.Detail = fmt.Sprintf("called %s(%s) in %s", b.Name, b.Input, took.Round(time.Millisecond))
+		return c
+	}
+	c.Err = fmt.Errorf("no tool call, stop reason %s; the model may not support tools, see emulate_tools", msg.StopReason)
+	return c
+}
@@ -0,0 +1,108 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// APIError is an error surfaced to clients in Anthropic's error format.
+type APIError struct {
+	Status  int    // HTTP status code
+	Type    string // Anthropic error type, e.g. invalid_request_error
+	Message string // Human-readable message
+	// RetryAfter is sent as the retry-after header when positive
+	RetryAfter time.Duration
+}
+
+// Error satisfies the error interface.
+func (e *APIError) Error() string {
+	return e.Type + ": " + e.Message
+}
+
+// invalidRequest builds a 400 invalid_request_error.
+func invalidRequest(msg string) *APIError {
+	return &APIError{Status: http.StatusBadRequest, Type: "invalid_request_error", Message: msg}
+}
+
+// upstreamAPIError builds a 500 api_error for an unusable upstream response.
+func upstreamAPIError(msg string) *APIError {
+	return &APIError{Status: http.StatusInternalServerError, Type: "api_error", Message: msg}
+}
+
+// overloaded builds a 529 overloaded_error.
+func overloaded(msg string) *APIError {
+	return &APIError{Status: 529, Type: "overloaded_error", Message: msg}
+}
+
+// requestTooLarge builds a 413 request_too_large error.
+func requestTooLarge(msg string) *APIError {
+	return &APIError{Status: http.StatusRequestEntityTooLarge, Type: "request_too_large", Message: msg}
+}
+
+// unauthenticated builds a 401 authentication_error.
+func unauthenticated(msg string) *APIError {
+	return &APIError{Status: http.StatusUnauthorized, Type: "authentication_error", Message: msg}
+}
+
+// rateLimited builds a 429 rate_limit_error.
+func rateLimited(msg string) *APIError {
+	return &APIError{Status: http.StatusTooManyRequests, Type: "rate_limit_error", Message: msg}
+}
+
+// upstreamError translates an upstream HTTP status into the matching
+// Anthropic error type and status code.
+func upstreamError(status int, msg string) *APIError {
+	switch {
+	case status == http.StatusBadRequest, status == http.StatusUnprocessableEntity:
+		return invalidRequest(msg)
+	case status == http.StatusUnauthorized:
+		return unauthenticated(msg)
+	case status == http.StatusForbidden:
+		return &APIError{Status: http.StatusForbidden, Type: "permission_error", Message: msg}
+	case status == http.StatusNotFound:
+		return &APIError{Status: http.StatusNotFound, Type: "not_found_error", Message: msg}
+	case status == http.StatusRequestEntityTooLarge:
+		return requestTooLarge(msg)
+	case status == http.StatusTooManyRequests:
+		return rateLimited(msg)
+	case status == http.StatusServiceUnavailable, status == 529:
+		return overloaded(msg)
+	}
+	return upstreamAPIError(msg)
+}
+
+// upstreamResponseError translates an upstream error response like
+// upstreamError. Rate limited and overloaded responses carry the upstream's
+// requested wait, so clients back off for as long as the upstream asked.
+func upstreamResponseError(res *http.Response, msg string) *APIError {
+	apiErr := upstreamError(res.StatusCode, msg)
+	if apiErr.Type == "rate_limit_error" || apiErr.Type == "overloaded_error" {
+		if d, ok := upstreamRetryAfter(res.Header, time.Now()); ok {
+			apiErr.RetryAfter = d
+		}
+	}
+	return apiErr
+}
+
+// writeError writes err as an Anthropic error object. Errors that are not an
+// APIError are reported as a 500 api_error.
+func writeError(w http.ResponseWriter, err error) {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		apiErr = upstreamAPIError(err.Error())
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if apiErr.RetryAfter > 0 {
+		w.Header().Set("Retry-After", retryAfterSeconds(apiErr.RetryAfter))
+	}
+	w.WriteHeader(apiErr.Status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"type": "error",
+		"error": map[string]interface{}{
+			"type":    apiErr.Type,
+			"message": apiErr.Message,
+		},
+	})
+}
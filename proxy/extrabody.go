@@ -0,0 +1,24 @@
+package proxy
+
+import "maps"
+
+// mergeExtraBody merges extra into payload. Objects present in both are
+// merged recursively, null removes a field and any other value replaces
+// it. payload's nested objects are copied before they are changed.
+func mergeExtraBody(payload, extra map[string]interface{}) {
+	for k, v := range extra {
+		if v == nil {
+			delete(payload, k)
+			continue
+		}
+		src, ok := v.(map[string]interface{})
+		dst, isObj := payload[k].(map[string]interface{})
+		if ok && isObj {
+			dst = maps.Clone(dst)
+			mergeExtraBody(dst, src)
+			payload[k] = dst
+			continue
+		}
+		payload[k] = v
+	}
+}
@@ -0,0 +1,109 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"gopenbridge/providers"
+)
+
+// target is one upstream in the failover chain.
+type target struct {
+	prov  providers.Provider
+	up    providers.Upstream
+	model string   // Replaces the request model when set
+	keys  []string // Pooled API keys, up.APIKey first
+
+	maxConcurrency int                    // Overrides the configured upstream concurrency when set
+	extraBody      map[string]interface{} // Merged into every payload
+	noStream       bool                   // Upstream cannot stream, see simulateStream
+	alwaysStream   bool                   // Upstream must stream, see aggregateWith
+}
+
+// targets returns the primary upstream followed by the configured failovers.
+// A routed request's primary is its provider profile instead of the default
+// upstream.
+func (p *ChatProxy) targets(ctx context.Context) []target {
+	cfg := p.cfg()
+	primary := providers.Upstream{
+		BaseURL:     cfg.BaseURL,
+		APIKey:      cfg.APIKey,
+		APIVersion:  cfg.AzureAPIVersion,
+		Deployments: cfg.AzureDeployments,
+		Region:      cfg.AWSRegion,
+		AWSProfile:  cfg.AWSProfile,
+	}
+	res := []target{{prov: emulated(providers.Resolve(cfg.Provider, cfg.BaseURL), cfg.EmulateTools), up: primary, keys: cfg.UpstreamKeys(), extraBody: cfg.ExtraBody, noStream: cfg.NoStream, alwaysStream: cfg.AlwaysStream}}
+	if r := requestFrom(ctx).route; r != nil {
+		if prof, ok := cfg.Providers[r.Provider]; ok {
+			adapter := prof.Provider
+			if adapter == "" {
+				adapter = r.Provider
+			}
+			up := primary
+			up.BaseURL = prof.BaseURL
+			keys := prof.Keys()
+			up.APIKey = firstKey(keys)
+			model := r.Model
+			if model == "" {
+				model = prof.Model
+			}
+			res[0] = target{prov: emulated(providers.Resolve(adapter, prof.BaseURL), prof.EmulateTools), up: up, model: model, keys: keys, maxConcurrency: prof.MaxConcurrency, extraBody: prof.ExtraBody, noStream: prof.NoStream, alwaysStream: prof.AlwaysStream}
+		}
+	}
+	for _, f := range cfg.Failover {
+		up := primary
+		up.BaseURL = f.BaseURL
+		keys := f.Keys()
+		up.APIKey = firstKey(keys)
+		res = append(res, target{prov: emulated(providers.Resolve(f.Provider, f.BaseURL), f.EmulateTools), up: up, model: f.Model, keys: keys, maxConcurrency: f.MaxConcurrency, extraBody: f.ExtraBody, noStream: f.NoStream, alwaysStream: f.AlwaysStream})
+	}
+	return res
+}
+
+// emulated returns prov with prompt-based tool calling when emulate is set.
+func emulated(prov providers.Provider, emulate bool) providers.Provider {
+	if emulate {
+		return providers.EmulateTools(prov)
+	}
+	return prov
+}
+
+// firstKey returns the first of keys, or "" if there are none.
+func firstKey(keys []string) string {
+	if len(keys) == 0 {
+		return ""
+	}
+	return keys[0]
+}
+
+// withFailover calls attempt for each upstream in order until one succeeds
+// or fails in a way another upstream would not fix.
+func (p *ChatProxy) withFailover(ctx context.Context, attempt func(t target) error) error {
+	targets := p.targets(ctx)
+	var err error
+	for i, t := range targets {
+		if err = attempt(t); err == nil || !shouldFailover(ctx, err) {
+			return err
+		}
+		if i < len(targets)-1 {
+			requestFrom(ctx).logger.Warn("Upstream failed, failing over",
+				"upstream", t.up.BaseURL, "next", targets[i+1].up.BaseURL, "error", err)
+		}
+	}
+	return err
+}
+
+// shouldFailover reports whether err is an upstream 5xx, rate limit or
+// network failure. Client errors and cancellations are returned as is.
+func shouldFailover(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	return apiErr.Status >= 500 || apiErr.Status == http.StatusTooManyRequests
+}
@@ -0,0 +1,69 @@
+package proxy
+
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"gopenbridge/logstore"
+)
+
+// janitorStats counts the log janitor's activity for the metrics endpoint.
+type janitorStats struct {
+	runs     atomic.Uint64
+	pruned   atomic.Uint64
+	lastRun  atomic.Int64 // Unix seconds of the last finished run
+	dbBytes  atomic.Int64 // Log store size after the last run
+	failures atomic.Uint64
+}
+
+// StartJanitor prunes api_logs every log_prune_interval until ctx is done,
+// deleting rows older than log_retention and the oldest rows while the
+// database is larger than log_max_db_bytes. Both are re-read on each run,
+// so pruning can be enabled by a config reload.
+func (p *ChatProxy) StartJanitor(ctx context.Context) {
+	go func() {
+		for {
+			p.pruneLogs(ctx)
+			interval := p.cfg().LogPruneInterval
+			if interval <= 0 {
+				interval = time.Hour
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(interval):
+			}
+		}
+	}()
+}
+
+// pruneLogs runs one janitor pass, if retention or a size limit is set.
+func (p *ChatProxy) pruneLogs(ctx context.Context) {
+	cfg := p.cfg()
+	if cfg.LogRetention <= 0 && cfg.LogMaxDBBytes <= 0 {
+		return
+	}
+	var policy logstore.PrunePolicy
+	if cfg.LogRetention > 0 {
+		policy.Before = time.Now().Add(-cfg.LogRetention)
+	}
+	policy.MaxBytes = int64(cfg.LogMaxDBBytes)
+	start := time.Now()
+	res, err := p.logStore.Prune(ctx, policy)
+	p.janitor.runs.Add(1)
+	p.janitor.pruned.Add(uint64(res.Deleted))
+	p.janitor.lastRun.Store(time.Now().Unix())
+	if err != nil {
+		if ctx.Err() == nil {
+			p.janitor.failures.Add(1)
+			slog.Error("Failed to prune API logs", "deleted", res.Deleted, "error", err)
+		}
+		return
+	}
+	p.janitor.dbBytes.Store(res.SizeBytes)
+	if res.Deleted > 0 {
+		slog.Info("Pruned API logs", "deleted", res.Deleted, "db_bytes", res.SizeBytes, "duration_ms", time.Since(start).Milliseconds())
+	}
+}
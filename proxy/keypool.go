@@ -0,0 +1,89 @@
+package proxy
+
+import (
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"gopenbridge/secrets"
+)
+
+// keyPool hands out an upstream's API keys round-robin, skipping keys that
+// are benched after the upstream rate limited or rejected them.
+type keyPool struct {
+	mu      sync.Mutex
+	keys    []string
+	next    int
+	benched map[string]time.Time // key -> benched until
+	now     func() time.Time
+}
+
+// newKeyPool returns a pool over keys.
+func newKeyPool(keys []string) *keyPool {
+	return &keyPool{keys: keys, benched: make(map[string]time.Time), now: time.Now}
+}
+
+// pick returns the next key that is not benched. When every key is benched
+// it returns the one that comes back soonest and false.
+func (kp *keyPool) pick() (string, bool) {
+	kp.mu.Lock()
+	defer kp.mu.Unlock()
+	now := kp.now()
+	soonest := ""
+	for range kp.keys {
+		key := kp.keys[kp.next]
+		kp.next = (kp.next + 1) % len(kp.keys)
+		until, ok := kp.benched[key]
+		if !ok || !now.Before(until) {
+			delete(kp.benched, key)
+			return key, true
+		}
+		if soonest == "" || until.Before(kp.benched[soonest]) {
+			soonest = key
+		}
+	}
+	return soonest, false
+}
+
+// bench takes key out of rotation for d.
+func (kp *keyPool) bench(key string, d time.Duration) {
+	kp.mu.Lock()
+	kp.benched[key] = kp.now().Add(d)
+	kp.mu.Unlock()
+}
+
+// keyPoolFor returns the pool for an upstream, or nil when it has a single
+// key. A pool is rebuilt when a reload changes the upstream's keys.
+func (p *ChatProxy) keyPoolFor(baseURL string, keys []string) *keyPool {
+	if len(keys) < 2 {
+		return nil
+	}
+	p.keyPoolsMu.Lock()
+	defer p.keyPoolsMu.Unlock()
+	kp, ok := p.keyPools[baseURL]
+	if !ok || !slices.Equal(kp.keys, keys) {
+		kp = newKeyPool(keys)
+		p.keyPools[baseURL] = kp
+	}
+	return kp
+}
+
+// keyLabel identifies an API key in logs without revealing it: secret
+// references are shown as is, literal keys by their first and last four
+// characters.
+func keyLabel(key string) string {
+	if secrets.IsRef(key) {
+		return key
+	}
+	if len(key) <= 8 {
+		return "…"
+	}
+	return key[:4] + "…" + key[len(key)-4:]
+}
+
+// isKeyFailure reports whether status blames the API key rather than the
+// request: the key is rate limited or not accepted.
+func isKeyFailure(status int) bool {
+	return status == http.StatusTooManyRequests || status == http.StatusUnauthorized
+}
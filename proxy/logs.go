@@ -0,0 +1,155 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopenbridge/logbody"
+	"gopenbridge/logstore"
+	"gopenbridge/tracing"
+)
+
+// stopReasonCancelled marks log rows for requests abandoned by the client.
+const stopReasonCancelled = "cancelled"
+
+// logEntry is a finished request, handed to the log store by persistLog.
+type logEntry struct {
+	ID               string
+	Provider         string // Base URL of the upstream that served the request
+	Endpoint         string
+	Model            string
+	Request          string
+	Response         string
+	StatusCode       int
+	ErrorMessage     string
+	StopReason       string
+	PromptTokens     int
+	CompletionTokens int
+	Retries          int      // Upstream retries before the final attempt
+	CostUSD          *float64 // Estimated cost, nil when the model has no price
+}
+
+// costHeader reports a request's estimated cost to the client. Streams send
+// it as a trailer since usage is only known at the end.
+const costHeader = "X-Gopenbridge-Cost-Usd"
+
+// cost estimates the USD cost of a request to the upstream model, or
+// returns nil when the model has no configured price.
+func (p *ChatProxy) cost(model string, inputTokens, outputTokens int) *float64 {
+	price, ok := p.cfg().PriceFor(model)
+	if !ok {
+		return nil
+	}
+	c := price.Cost(inputTokens, outputTokens)
+	return &c
+}
+
+// formatCost renders a cost for costHeader.
+func formatCost(c float64) string {
+	return strconv.FormatFloat(c, 'f', -1, 64)
+}
+
+// persistLog counts e's usage and, as log_persist selects, stores its log
+// row, through the background writer when log_queue_size is set.
+// Failures are logged, never returned, so persistence problems do not fail
+// the request. The write carries ctx's values but not its cancellation, so
+// abandoned requests are still recorded.
+func (p *ChatProxy) persistLog(ctx context.Context, e logEntry) {
+	ctx, span := p.tracer.Start(context.WithoutCancel(ctx), "persist_log", tracing.KindInternal)
+	defer span.End()
+	info := requestFrom(ctx)
+	rec := logstore.Record{
+		Log: logstore.Log{
+			ID:               e.ID,
+			Timestamp:        time.Now().UTC(),
+			Provider:         e.Provider,
+			Endpoint:         e.Endpoint,
+			Model:            e.Model,
+			StatusCode:       e.StatusCode,
+			ErrorMessage:     e.ErrorMessage,
+			StopReason:       e.StopReason,
+			PromptTokens:     e.PromptTokens,
+			CompletionTokens: e.CompletionTokens,
+			Retries:          e.Retries,
+			LatencyMs:        time.Since(info.start).Milliseconds(),
+			CostUSD:          e.CostUSD,
+			UpstreamKey:      info.upstreamKey,
+			UserID:           info.userID,
+			AnthropicVersion: info.anthropicVersion,
+			AnthropicBeta:    strings.Join(info.betas, ","),
+			Request:          e.Request,
+			Response:         e.Response,
+			ClientRequest:    string(info.clientRequest),
+		},
+		Persist: p.shouldPersist(e),
+	}
+	if info.key != nil {
+		rec.KeyName = info.key.Name
+	}
+	if err := p.logs.write(ctx, rec); errors.Is(err, errLogQueueFull) {
+		span.SetError(err)
+		if n := p.logs.dropped.Load(); n == 1 || n%100 == 0 {
+			slog.Warn("API log queue is full, dropping rows", "id", e.ID, "dropped_total", n)
+		}
+	} else if err != nil {
+		span.SetError(err)
+		slog.Error("Failed to persist API log", "id", e.ID, "error", err)
+	}
+	level := slog.LevelInfo
+	if e.ErrorMessage != "" {
+		level = slog.LevelWarn
+	}
+	attrs := []interface{}{
+		"provider", e.Provider,
+		"upstream_model", e.Model,
+		"status", e.StatusCode,
+		"stop_reason", e.StopReason,
+		"input_tokens", e.PromptTokens,
+		"output_tokens", e.CompletionTokens,
+		"retries", e.Retries,
+		"latency_ms", time.Since(info.start).Milliseconds(),
+	}
+	if e.CostUSD != nil {
+		attrs = append(attrs, "cost_usd", *e.CostUSD)
+	}
+	if info.queueWait > 0 {
+		attrs = append(attrs, "queue_ms", info.queueWait.Milliseconds())
+	}
+	info.logger.Log(ctx, level, "Request completed", attrs...)
+}
+
+// persistFailure stores the last upstream error response of a request that
+// has failed for good, with err as its error. Attempts a later upstream
+// recovered from are not stored, since they share the row ID.
+func (p *ChatProxy) persistFailure(ctx context.Context, err error) {
+	info := requestFrom(ctx)
+	if info.failed == nil {
+		return
+	}
+	e := *info.failed
+	info.failed = nil
+	e.ErrorMessage = err.Error()
+	p.persistLog(ctx, e)
+}
+
+// bodyOptions returns how the log store keeps request and response bodies,
+// from log_body_max_bytes, log_body_storage and log_body_dir.
+func (p *ChatProxy) bodyOptions() logbody.Options {
+	cfg := p.cfg()
+	opts := logbody.Options{MaxBytes: cfg.LogBodyMaxBytes, Storage: cfg.LogBodyStorage, Dir: cfg.LogBodyDir}
+	if opts.Dir == "" {
+		opts.Dir = cfg.DBPath + ".bodies"
+	}
+	if !slices.Contains([]string{logbody.Inline, logbody.Gzip, logbody.File}, opts.Storage) {
+		if _, seen := p.warned.LoadOrStore("log_body_storage:"+opts.Storage, true); !seen {
+			slog.Warn("Unknown log_body_storage, storing bodies inline", "log_body_storage", opts.Storage)
+		}
+		opts.Storage = logbody.Inline
+	}
+	return opts
+}
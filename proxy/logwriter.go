@@ -0,0 +1,73 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync/atomic"
+
+	"gopenbridge/logstore"
+)
+
+// errLogQueueFull is returned for rows dropped because the queue is full.
+var errLogQueueFull = errors.New("log queue is full, dropping row")
+
+// logWriter hands finished requests to the log store. With a queue, they
+// are written by a background goroutine that passes whatever has queued
+// up, up to batch records, to the store at once, so database latency and
+// lock contention never delay responses.
+type logWriter struct {
+	store   logstore.Store
+	queue   chan logstore.Record // nil writes synchronously
+	batch   int
+	dropped atomic.Uint64
+}
+
+// newLogWriter returns a writer queueing up to size records, or writing
+// synchronously when size is zero.
+func newLogWriter(store logstore.Store, size, batch int) *logWriter {
+	w := &logWriter{store: store, batch: max(batch, 1)}
+	if size > 0 {
+		w.queue = make(chan logstore.Record, size)
+		go w.run()
+	}
+	return w
+}
+
+// write stores rec, or queues it for the background writer.
+func (w *logWriter) write(ctx context.Context, rec logstore.Record) error {
+	if w.queue == nil {
+		return w.store.LogRequests(ctx, []logstore.Record{rec})
+	}
+	select {
+	case w.queue <- rec:
+		return nil
+	default:
+		w.dropped.Add(1)
+		return errLogQueueFull
+	}
+}
+
+// queued returns the number of records waiting to be written.
+func (w *logWriter) queued() int {
+	return len(w.queue)
+}
+
+func (w *logWriter) run() {
+	recs := make([]logstore.Record, 0, w.batch)
+	for rec := range w.queue {
+		recs = append(recs[:0], rec)
+	drain:
+		for len(recs) < w.batch {
+			select {
+			case rec := <-w.queue:
+				recs = append(recs, rec)
+			default:
+				break drain
+			}
+		}
+		if err := w.store.LogRequests(context.Background(), recs); err != nil {
+			slog.Error("Failed to persist API logs", "rows", len(recs), "error", err)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package proxy
+
+import (
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+)
+
+// ServeMetrics writes upstream scheduling and log queue metrics in the
+// Prometheus text format. Only upstreams with a concurrency limit are
+// scheduled, so others do not appear.
+func (p *ChatProxy) ServeMetrics(w http.ResponseWriter, r *http.Request) {
+	stats := p.UpstreamStats()
+	urls := slices.Sorted(maps.Keys(stats))
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	metrics := []struct {
+		name, kind, help string
+		value            func(url string) string
+	}{
+		{"gopenbridge_upstream_max_concurrency", "gauge", "Concurrent request limit per upstream.",
+			func(u string) string { return strconv.Itoa(stats[u].MaxActive) }},
+		{"gopenbridge_upstream_active_requests", "gauge", "Requests currently running against the upstream.",
+			func(u string) string { return strconv.Itoa(stats[u].Active) }},
+		{"gopenbridge_upstream_queue_depth", "gauge", "Requests waiting for a free upstream slot.",
+			func(u string) string { return strconv.Itoa(stats[u].Queued) }},
+		{"gopenbridge_upstream_admitted_total", "counter", "Requests given an upstream slot.",
+			func(u string) string { return strconv.FormatUint(stats[u].Admitted, 10) }},
+		{"gopenbridge_upstream_rejected_total", "counter", "Requests rejected because the upstream queue was full.",
+			func(u string) string { return strconv.FormatUint(stats[u].Rejected, 10) }},
+		{"gopenbridge_upstream_queue_wait_seconds_count", "counter", "Admitted requests that had to wait for a slot.",
+			func(u string) string { return strconv.FormatUint(stats[u].Waited, 10) }},
+		{"gopenbridge_upstream_queue_wait_seconds_sum", "counter", "Total time admitted requests spent queued.",
+			func(u string) string { return strconv.FormatFloat(stats[u].WaitTime.Seconds(), 'f', -1, 64) }},
+	}
+	for _, m := range metrics {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind)
+		for _, u := range urls {
+			fmt.Fprintf(w, "%s{upstream=%q} %s\n", m.name, u, m.value(u))
+		}
+	}
+	logMetrics := []struct {
+		name, kind, help string
+		value            uint64
+	}{
+		{"gopenbridge_log_queue_depth", "gauge", "api_logs rows waiting to be written.", uint64(p.logs.queued())},
+		{"gopenbridge_log_dropped_total", "counter", "api_logs rows dropped because the log queue was full.", p.logs.dropped.Load()},
+		{"gopenbridge_log_prune_runs_total", "counter", "Log janitor runs.", p.janitor.runs.Load()},
+		{"gopenbridge_log_prune_failures_total", "counter", "Log janitor runs that failed.", p.janitor.failures.Load()},
+		{"gopenbridge_log_pruned_rows_total", "counter", "api_logs rows deleted by the log janitor.", p.janitor.pruned.Load()},
+		{"gopenbridge_log_last_prune_timestamp_seconds", "gauge", "Unix time of the last log janitor run.", uint64(p.janitor.lastRun.Load())},
+		{"gopenbridge_db_size_bytes", "gauge", "Size of the log database after the last janitor run.", uint64(p.janitor.dbBytes.Load())},
+	}
+	for _, m := range logMetrics {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %d\n", m.name, m.help, m.name, m.kind, m.name, m.value)
+	}
+}
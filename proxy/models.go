@@ -0,0 +1,128 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// modelInfo is an entry of the Anthropic models list.
+type modelInfo struct {
+	Type        string `json:"type"`
+	ID          string `json:"id"`
+	DisplayName string `json:"display_name"`
+	CreatedAt   string `json:"created_at"`
+}
+
+// claudeModels are the Claude models clients commonly request, newest
+// first. Requests for them are served through the model map, the routes or
+// the default model, so they are always listed.
+var claudeModels = []modelInfo{
+	{ID: "claude-opus-4-5-20251101", DisplayName: "Claude Opus 4.5", CreatedAt: "2025-11-24T00:00:00Z"},
+	{ID: "claude-haiku-4-5-20251001", DisplayName: "Claude Haiku 4.5", CreatedAt: "2025-10-15T00:00:00Z"},
+	{ID: "claude-sonnet-4-5-20250929", DisplayName: "Claude Sonnet 4.5", CreatedAt: "2025-09-29T00:00:00Z"},
+	{ID: "claude-opus-4-1-20250805", DisplayName: "Claude Opus 4.1", CreatedAt: "2025-08-05T00:00:00Z"},
+	{ID: "claude-opus-4-20250514", DisplayName: "Claude Opus 4", CreatedAt: "2025-05-22T00:00:00Z"},
+	{ID: "claude-sonnet-4-20250514", DisplayName: "Claude Sonnet 4", CreatedAt: "2025-05-22T00:00:00Z"},
+	{ID: "claude-3-7-sonnet-20250219", DisplayName: "Claude Sonnet 3.7", CreatedAt: "2025-02-24T00:00:00Z"},
+	{ID: "claude-3-5-haiku-20241022", DisplayName: "Claude Haiku 3.5", CreatedAt: "2024-10-22T00:00:00Z"},
+}
+
+// listModels returns the models the bridge serves: exact names from the
+// model map and routes, which are aliases the operator defined, followed by
+// the Claude models. Glob patterns cannot be listed and are skipped.
+func (p *ChatProxy) listModels() []modelInfo {
+	cfg := p.cfg()
+	created := p.started.UTC().Format(time.RFC3339)
+	var res []modelInfo
+	seen := make(map[string]bool)
+	add := func(m modelInfo) {
+		if m.ID == "" || seen[m.ID] || strings.ContainsAny(m.ID, "*?[") {
+			return
+		}
+		seen[m.ID] = true
+		m.Type = "model"
+		res = append(res, m)
+	}
+	for _, m := range cfg.ModelMap {
+		add(modelInfo{ID: m.Pattern, DisplayName: m.Pattern + " (" + m.Model + ")", CreatedAt: created})
+	}
+	for _, r := range cfg.Routes {
+		name := r.Provider
+		if r.Model != "" {
+			name = r.Model
+		}
+		add(modelInfo{ID: r.Pattern, DisplayName: r.Pattern + " (" + name + ")", CreatedAt: created})
+	}
+	for _, m := range claudeModels {
+		add(m)
+	}
+	return res
+}
+
+// ServeModels answers GET /v1/models and GET /v1/models/{id} in Anthropic's
+// format, so model pickers work against the bridge. The list supports the
+// limit, after_id and before_id parameters.
+func (p *ChatProxy) ServeModels(w http.ResponseWriter, r *http.Request) {
+	info := newRequestInfo()
+	ctx := withRequestInfo(r.Context(), info)
+	writeRequestID(w, info)
+	if r.Method != http.MethodGet {
+		writeError(w, &APIError{Status: http.StatusMethodNotAllowed, Type: "invalid_request_error", Message: "method not allowed"})
+		return
+	}
+	if err := p.authenticate(ctx, r); err != nil {
+		p.fail(ctx, w, err)
+		return
+	}
+	list := p.listModels()
+	w.Header().Set("Content-Type", "application/json")
+	if id := strings.TrimPrefix(r.URL.Path, "/v1/models/"); id != r.URL.Path && id != "" {
+		i := slices.IndexFunc(list, func(m modelInfo) bool { return m.ID == id })
+		if i == -1 {
+			writeError(w, &APIError{Status: http.StatusNotFound, Type: "not_found_error", Message: "model: " + id})
+			return
+		}
+		json.NewEncoder(w).Encode(list[i])
+		return
+	}
+	q := r.URL.Query()
+	limit := 20
+	if v, err := strconv.Atoi(q.Get("limit")); err == nil {
+		if v < 1 || v > 1000 {
+			writeError(w, invalidRequest("limit must be between 1 and 1000"))
+			return
+		}
+		limit = v
+	}
+	start, end := 0, len(list)
+	if id := q.Get("after_id"); id != "" {
+		start = slices.IndexFunc(list, func(m modelInfo) bool { return m.ID == id }) + 1
+	}
+	if id := q.Get("before_id"); id != "" {
+		if i := slices.IndexFunc(list, func(m modelInfo) bool { return m.ID == id }); i != -1 {
+			end = i
+		}
+	}
+	if start > end {
+		start = end
+	}
+	page := list[start:end]
+	hasMore := false
+	if len(page) > limit {
+		hasMore = true
+		if q.Get("before_id") != "" {
+			page = page[len(page)-limit:]
+		} else {
+			page = page[:limit]
+		}
+	}
+	res := map[string]interface{}{"data": page, "has_more": hasMore, "first_id": nil, "last_id": nil}
+	if len(page) > 0 {
+		res["first_id"], res["last_id"] = page[0].ID, page[len(page)-1].ID
+	}
+	json.NewEncoder(w).Encode(res)
+}
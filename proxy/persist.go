@@ -0,0 +1,33 @@
+package proxy
+
+import (
+	"log/slog"
+	"math/rand/v2"
+)
+
+// Values of log_persist.
+const (
+	persistAll     = "all"
+	persistErrors  = "errors"
+	persistSampled = "sampled"
+	persistNone    = "none"
+)
+
+// shouldPersist reports whether e is stored in api_logs under log_persist.
+func (p *ChatProxy) shouldPersist(e logEntry) bool {
+	cfg := p.cfg()
+	switch cfg.LogPersist {
+	case persistAll:
+		return true
+	case persistErrors:
+		return e.ErrorMessage != "" || e.StatusCode >= 400
+	case persistSampled:
+		return rand.Float64() < cfg.LogSampleRate
+	case persistNone:
+		return false
+	}
+	if _, seen := p.warned.LoadOrStore("log_persist:"+cfg.LogPersist, true); !seen {
+		slog.Warn("Unknown log_persist, storing every request", "log_persist", cfg.LogPersist)
+	}
+	return true
+}
@@ -0,0 +1,147 @@
+package proxy
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"gopenbridge/keys"
+)
+
+// tokenBucket allows bursts of up to perMinute requests, refilling
+// continuously at perMinute per minute.
+type tokenBucket struct {
+	mu        sync.Mutex
+	perMinute float64
+	tokens    float64
+	last      time.Time
+}
+
+// newTokenBucket returns a full bucket.
+func newTokenBucket(perMinute int) *tokenBucket {
+	return &tokenBucket{perMinute: float64(perMinute), tokens: float64(perMinute), last: time.Now()}
+}
+
+// allow takes a token if one is available. Otherwise it returns false and
+// how long until the next token.
+func (b *tokenBucket) allow() (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill()
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / b.perMinute * float64(time.Minute))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// full reports whether the bucket has refilled completely, i.e. it has not
+// been used for a while.
+func (b *tokenBucket) full() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill()
+	return b.tokens >= b.perMinute
+}
+
+func (b *tokenBucket) refill() {
+	now := time.Now()
+	b.tokens = min(b.perMinute, b.tokens+now.Sub(b.last).Minutes()*b.perMinute)
+	b.last = now
+}
+
+// maxLimiters bounds the bucket map; past it, idle buckets are dropped.
+const maxLimiters = 10000
+
+// limiterFor returns the named bucket, replacing it when the limit has
+// changed.
+func (p *ChatProxy) limiterFor(name string, perMinute int) *tokenBucket {
+	p.limitersMu.Lock()
+	defer p.limitersMu.Unlock()
+	b, ok := p.limiters[name]
+	if !ok || b.perMinute != float64(perMinute) {
+		if len(p.limiters) >= maxLimiters {
+			for n, l := range p.limiters {
+				if l.full() {
+					delete(p.limiters, n)
+				}
+			}
+		}
+		b = newTokenBucket(perMinute)
+		p.limiters[name] = b
+	}
+	return b
+}
+
+// limitInbound applies the configured per-IP, per-key and global request
+// rates, in that order so that one noisy client is rejected before it eats
+// into the global budget. Run after authenticate so virtual keys are known.
+func (p *ChatProxy) limitInbound(ctx context.Context, r *http.Request) error {
+	cfg := p.cfg()
+	if cfg.RateLimitPerIP > 0 {
+		if ip := clientIP(r); ip != "" {
+			if err := p.takeToken("ip:"+ip, cfg.RateLimitPerIP, "client IP "+ip); err != nil {
+				return err
+			}
+		}
+	}
+	if cfg.RateLimitPerKey > 0 {
+		if id, label := clientKey(ctx, r); id != "" {
+			if err := p.takeToken("key:"+id, cfg.RateLimitPerKey, label); err != nil {
+				return err
+			}
+		}
+	}
+	if cfg.RateLimitGlobal > 0 {
+		return p.takeToken("global", cfg.RateLimitGlobal, "the proxy")
+	}
+	return nil
+}
+
+// takeToken takes a token from the named bucket or returns a 429 telling
+// the client when to retry.
+func (p *ChatProxy) takeToken(name string, perMinute int, who string) error {
+	ok, wait := p.limiterFor(name, perMinute).allow()
+	if ok {
+		return nil
+	}
+	err := rateLimited(fmt.Sprintf("rate limit of %d requests per minute exceeded for %s", perMinute, who))
+	err.RetryAfter = wait
+	return err
+}
+
+// clientIP returns the host part of the client's address, or "" for unix
+// socket clients.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return ""
+	}
+	return host
+}
+
+// clientKey identifies the API key a request was made with: the virtual
+// key's name, or a hash of any other key so it is not kept in memory.
+func clientKey(ctx context.Context, r *http.Request) (id, label string) {
+	if k := requestFrom(ctx).key; k != nil {
+		return "virtual:" + k.Name, fmt.Sprintf("key %q", k.Name)
+	}
+	secret := keys.FromRequest(r)
+	if secret == "" {
+		return "", ""
+	}
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:8]), "this API key"
+}
+
+// retryAfterSeconds renders d for a retry-after header, rounded up to a
+// whole second.
+func retryAfterSeconds(d time.Duration) string {
+	return fmt.Sprint(int(math.Ceil(d.Seconds())))
+}
@@ -0,0 +1,91 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"gopenbridge/config"
+	"gopenbridge/logbody"
+	"gopenbridge/logstore"
+	"gopenbridge/models"
+)
+
+// ReplayOptions changes how Replay sends a logged request.
+type ReplayOptions struct {
+	Model    string // Model to request instead of the logged one
+	Provider string // Provider profile to send to, instead of the routes
+}
+
+// ReplayResult is what a replayed request sent and got back.
+type ReplayResult struct {
+	ID       string                 // Request ID of the replay, also its log row
+	Request  string                 // Body sent upstream
+	Response string                 // Body the upstream answered with
+	Message  map[string]interface{} // The translated message, nil on failure
+	Err      error                  // Why the replay failed, if it did
+}
+
+// Replay sends the client request logged in l through the current
+// pipeline again, as a buffered request, and returns the outcome. The replay
+// is logged like any request, without a virtual key. An error is returned
+// only when l cannot be replayed; upstream failures are in the result.
+func (p *ChatProxy) Replay(ctx context.Context, l *logstore.Log, opts ReplayOptions) (*ReplayResult, error) {
+	if l.ClientRequest == "" {
+		return nil, fmt.Errorf("log %s has no client request; it was logged before replay support", l.ID)
+	}
+	var req models.MessagesRequest
+	if err := json.Unmarshal([]byte(l.ClientRequest), &req); err != nil {
+		if logbody.Truncated(l.ClientRequest) {
+			return nil, fmt.Errorf("log %s has a truncated client request, see log_body_max_bytes", l.ID)
+		}
+		return nil, fmt.Errorf("log %s has an invalid client request: %w", l.ID, err)
+	}
+	req.Stream = nil
+	info := newRequestInfo()
+	info.logger = info.logger.With("replay_of", l.ID)
+	info.clientRequest = []byte(l.ClientRequest)
+	info.anthropicVersion = l.AnthropicVersion
+	if l.AnthropicBeta != "" {
+		info.betas = strings.Split(l.AnthropicBeta, ",")
+	}
+	if req.Metadata != nil {
+		info.userID = req.Metadata.UserID
+	}
+	if opts.Provider != "" {
+		if _, ok := p.cfg().Providers[opts.Provider]; !ok {
+			names := slices.Sorted(maps.Keys(p.cfg().Providers))
+			if len(names) == 0 {
+				return nil, fmt.Errorf("unknown provider profile %q, none are configured", opts.Provider)
+			}
+			return nil, fmt.Errorf("unknown provider profile %q, configured: %s", opts.Provider, strings.Join(names, ", "))
+		}
+		info.route = &config.Route{Provider: opts.Provider, Model: opts.Model}
+	} else if opts.Model != "" {
+		req.Model = opts.Model
+	}
+	ctx = withRequestInfo(ctx, info)
+	res := &ReplayResult{ID: info.id}
+	msg, err := p.processRequest(ctx, &req, true)
+	res.Request = string(info.sent)
+	if err != nil {
+		if info.failed != nil {
+			res.Response = info.failed.Response
+		}
+		p.logFailure(ctx, err)
+		res.Err = err
+		return res, nil
+	}
+	switch raw := msg["upstream_response"].(type) {
+	case json.RawMessage:
+		res.Response = string(raw)
+	case string:
+		res.Response = raw
+	}
+	delete(msg, "upstream_response")
+	res.Message = msg
+	return res, nil
+}
@@ -0,0 +1,100 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+
+	"gopenbridge/config"
+	"gopenbridge/keys"
+	"gopenbridge/sched"
+)
+
+// requestInfo carries per-request state through the context: the ID shared
+// by the log row and the message, the start time and a logger tagged with
+// both.
+type requestInfo struct {
+	id      string
+	start   time.Time
+	logger  *slog.Logger
+	costUSD *float64      // Set once the upstream response is priced
+	key     *keys.Key     // Virtual key the client authenticated with, if any
+	route   *config.Route // Provider profile route for the model, if any
+
+	upstreamKey      string      // Label of the upstream API key used, see keyLabel
+	userID           string      // End user from the request's metadata.user_id
+	acceptsGzip      bool        // Client accepts gzip encoded responses
+	betas            []string    // Features from the client's anthropic-beta headers
+	anthropicVersion string      // Client's anthropic-version header
+	toolNames        *toolNames  // Tool renames for the upstream, nil if none
+	rateLimits       http.Header // anthropic-ratelimit-* headers from the last upstream response
+
+	toolArgProblems map[string]string      // Tool calls with invalid arguments, by tool_use id
+	extraBody       map[string]interface{} // Payload fields from the model's model_map entry
+
+	priority  sched.Priority // Upstream queue priority
+	queueWait time.Duration  // Time spent waiting for upstream slots
+	cacheKey  string         // Response cache key, empty when not cacheable
+	flight    *flight        // Shared with identical requests, if any
+	failed    *logEntry      // Last upstream error response, see persistFailure
+
+	clientRequest []byte // Messages request as the client sent it, logged for replay
+	sent          []byte // Last request body sent upstream
+}
+
+type requestInfoKey struct{}
+
+// newRequestInfo starts tracking a new inbound request.
+func newRequestInfo() *requestInfo {
+	id := uuid.New().String()[:12]
+	return &requestInfo{id: id, start: time.Now(), logger: slog.Default().With("request_id", id), priority: sched.Normal}
+}
+
+// writeRequestID returns the request ID to the client as request-id, like
+// Anthropic, and as x-request-id. It is also the api_logs row ID and is
+// sent upstream as X-Request-Id.
+func writeRequestID(w http.ResponseWriter, info *requestInfo) {
+	w.Header().Set("Request-Id", info.id)
+	w.Header().Set("X-Request-Id", info.id)
+}
+
+// withRequestInfo returns ctx carrying info.
+func withRequestInfo(ctx context.Context, info *requestInfo) context.Context {
+	return context.WithValue(ctx, requestInfoKey{}, info)
+}
+
+// requestFrom returns the request info in ctx, starting a new one if absent.
+func requestFrom(ctx context.Context) *requestInfo {
+	if info, ok := ctx.Value(requestInfoKey{}).(*requestInfo); ok {
+		return info
+	}
+	return newRequestInfo()
+}
+
+// decodeBody decodes r's JSON body into v and returns it, reading at most
+// max_request_bytes so a client cannot exhaust memory with a huge request.
+// Bodies over the limit fail with a 413, other decoding errors with a 400.
+func (p *ChatProxy) decodeBody(w http.ResponseWriter, r *http.Request, v interface{}) ([]byte, error) {
+	if n := p.cfg().MaxRequestBytes; n > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, int64(n))
+	}
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return nil, requestTooLarge(fmt.Sprintf("request body exceeds the maximum size of %d bytes", tooLarge.Limit))
+		}
+		return nil, invalidRequest("failed to read request body: " + err.Error())
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return nil, invalidRequest("invalid JSON: " + err.Error())
+	}
+	return data, nil
+}
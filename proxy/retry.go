@@ -0,0 +1,113 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// maxRetryAfter caps how long an upstream's Retry-After is honored; longer
+// waits return the response to the client instead.
+const maxRetryAfter = time.Minute
+
+// retryPolicy retries transient upstream failures with exponential backoff.
+type retryPolicy struct {
+	maxAttempts int
+	backoff     time.Duration
+	retryOn     []int
+	now         func() time.Time
+}
+
+// retryPolicy returns the configured policy.
+func (p *ChatProxy) retryPolicy() retryPolicy {
+	return retryPolicy{
+		maxAttempts: p.cfg().RetryMaxAttempts,
+		backoff:     p.cfg().RetryBackoff,
+		retryOn:     p.cfg().RetryOn,
+		now:         time.Now,
+	}
+}
+
+// do sends req with client, retrying network errors and retryable statuses.
+// req must have GetBody set so the body can be replayed. It returns the
+// final response or error and the number of retries performed.
+func (rp retryPolicy) do(client *http.Client, req *http.Request) (*http.Response, int, error) {
+	ctx := req.Context()
+	for attempt := 1; ; attempt++ {
+		r := req
+		if attempt > 1 {
+			r = req.Clone(ctx)
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, attempt - 1, err
+			}
+			r.Body = body
+		}
+		res, err := client.Do(r)
+		if attempt >= rp.maxAttempts || ctx.Err() != nil {
+			return res, attempt - 1, err
+		}
+		wait := rp.delay(attempt)
+		if err == nil {
+			if !slices.Contains(rp.retryOn, res.StatusCode) {
+				return res, attempt - 1, nil
+			}
+			if d, ok := rp.retryAfter(res.Header.Get("Retry-After")); ok {
+				if d > maxRetryAfter {
+					return res, attempt - 1, nil
+				}
+				wait = d
+			}
+			io.Copy(io.Discard, res.Body)
+			res.Body.Close()
+			requestFrom(ctx).logger.Warn("Upstream returned retryable status",
+				"host", req.URL.Host, "status", res.StatusCode, "wait", wait, "attempt", attempt+1, "max_attempts", rp.maxAttempts)
+		} else {
+			requestFrom(ctx).logger.Warn("Upstream request failed, retrying",
+				"host", req.URL.Host, "error", err, "wait", wait, "attempt", attempt+1, "max_attempts", rp.maxAttempts)
+		}
+		if err := sleepContext(ctx, wait); err != nil {
+			return nil, attempt - 1, err
+		}
+	}
+}
+
+// delay returns the backoff before retry number attempt: the base doubled
+// per attempt, with the upper half randomized to spread out retries.
+func (rp retryPolicy) delay(attempt int) time.Duration {
+	d := rp.backoff << (attempt - 1)
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+// retryAfter parses a Retry-After header given in seconds or as an HTTP date.
+func (rp retryPolicy) retryAfter(v string) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(t.Sub(rp.now()), 0), true
+	}
+	return 0, false
+}
+
+// sleepContext waits for d or until ctx is done.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
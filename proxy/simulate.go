@@ -0,0 +1,131 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// simulateStream replays a complete message as the Anthropic SSE events a
+// streaming upstream would have produced, for upstreams marked no_stream.
+// With simulated_stream_delay set, text and thinking are sent word by word
+// with that delay between words. The message is already logged, so only
+// the response cache and request followers see the events.
+func (p *ChatProxy) simulateStream(ctx context.Context, s *sseStream, msg map[string]interface{}) {
+	info := requestFrom(ctx)
+	s.begin(func(h http.Header) {
+		if info.costUSD != nil {
+			h.Set(costHeader, formatCost(*info.costUSD))
+		}
+		writeRateLimitHeaders(s.w, info)
+	})
+
+	var events []cachedEvent
+	emit := func(event string, data interface{}) error {
+		b, _ := json.Marshal(data)
+		if info.cacheKey != "" {
+			events = append(events, cachedEvent{Event: event, Data: b})
+		}
+		if info.flight != nil {
+			info.flight.emit(cachedEvent{Event: event, Data: b})
+		}
+		return s.write(event, b)
+	}
+	delay := p.cfg().SimulatedStreamDelay
+	if err := replayMessage(ctx, msg, delay, emit); err != nil {
+		info.logger.Debug("Simulated stream aborted", "error", err)
+		return
+	}
+	if info.cacheKey != "" {
+		value, _ := json.Marshal(events)
+		p.cache.Put(ctx, info.cacheKey, value)
+	}
+}
+
+// replayMessage emits msg as message_start, a start, deltas and stop per
+// content block, message_delta and message_stop. A positive delay splits
+// text into words and waits between them.
+func replayMessage(ctx context.Context, msg map[string]interface{}, delay time.Duration, emit func(event string, data interface{}) error) error {
+	// Content holds provider-specific block types, so it is normalized
+	// through JSON before being taken apart
+	var blocks []map[string]interface{}
+	data, _ := json.Marshal(msg["content"])
+	json.Unmarshal(data, &blocks)
+	usage, _ := msg["usage"].(map[string]interface{})
+
+	startUsage := maps.Clone(usage)
+	if startUsage == nil {
+		startUsage = map[string]interface{}{}
+	}
+	startUsage["output_tokens"] = 0
+	start := maps.Clone(msg)
+	start["content"] = []interface{}{}
+	start["stop_reason"] = nil
+	start["stop_sequence"] = nil
+	start["usage"] = startUsage
+	if err := emit("message_start", map[string]interface{}{"type": "message_start", "message": start}); err != nil {
+		return err
+	}
+
+	pieces := func(s string) []string {
+		if delay <= 0 || s == "" {
+			return []string{s}
+		}
+		return strings.SplitAfter(s, " ")
+	}
+	for i, blk := range blocks {
+		var deltas []map[string]interface{}
+		empty := blk
+		switch blk["type"] {
+		case "text":
+			text, _ := blk["text"].(string)
+			empty = map[string]interface{}{"type": "text", "text": ""}
+			for _, s := range pieces(text) {
+				deltas = append(deltas, map[string]interface{}{"type": "text_delta", "text": s})
+			}
+		case "thinking":
+			thinking, _ := blk["thinking"].(string)
+			empty = map[string]interface{}{"type": "thinking", "thinking": ""}
+			for _, s := range pieces(thinking) {
+				deltas = append(deltas, map[string]interface{}{"type": "thinking_delta", "thinking": s})
+			}
+			if sig, _ := blk["signature"].(string); sig != "" {
+				deltas = append(deltas, map[string]interface{}{"type": "signature_delta", "signature": sig})
+			}
+		case "tool_use":
+			input, _ := json.Marshal(blk["input"])
+			empty = map[string]interface{}{"type": "tool_use", "id": blk["id"], "name": blk["name"], "input": map[string]interface{}{}}
+			deltas = append(deltas, map[string]interface{}{"type": "input_json_delta", "partial_json": string(input)})
+		}
+		if err := emit("content_block_start", map[string]interface{}{"type": "content_block_start", "index": i, "content_block": empty}); err != nil {
+			return err
+		}
+		for j, d := range deltas {
+			if j > 0 && delay > 0 {
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-time.After(delay):
+				}
+			}
+			if err := emit("content_block_delta", map[string]interface{}{"type": "content_block_delta", "index": i, "delta": d}); err != nil {
+				return err
+			}
+		}
+		if err := emit("content_block_stop", map[string]interface{}{"type": "content_block_stop", "index": i}); err != nil {
+			return err
+		}
+	}
+
+	if err := emit("message_delta", map[string]interface{}{
+		"type":  "message_delta",
+		"delta": map[string]interface{}{"stop_reason": msg["stop_reason"], "stop_sequence": msg["stop_sequence"]},
+		"usage": usage,
+	}); err != nil {
+		return err
+	}
+	return emit("message_stop", map[string]interface{}{"type": "message_stop"})
+}
@@ -0,0 +1,124 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// sseStream writes Anthropic SSE events to a client. Writes are serialized
+// so keep-alive pings can be sent from another goroutine.
+type sseStream struct {
+	mu      sync.Mutex
+	w       http.ResponseWriter
+	flusher http.Flusher
+	started bool      // response headers have been written
+	last    time.Time // last write, or creation
+}
+
+// newSSEStream returns a stream on w. Nothing is written until the first
+// event or ping.
+func newSSEStream(w http.ResponseWriter) *sseStream {
+	flusher, _ := w.(http.Flusher)
+	return &sseStream{w: w, flusher: flusher, last: time.Now()}
+}
+
+// begin writes the event stream headers, first calling header to add its
+// own unless a ping already started the stream.
+func (s *sseStream) begin(header func(h http.Header)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.started && header != nil {
+		header(s.w.Header())
+	}
+	s.startLocked()
+}
+
+func (s *sseStream) startLocked() {
+	if s.started {
+		return
+	}
+	s.started = true
+	s.w.Header().Set("Content-Type", "text/event-stream")
+	s.w.Header().Set("Cache-Control", "no-cache")
+	s.w.Header().Set("Connection", "keep-alive")
+	s.w.WriteHeader(http.StatusOK)
+}
+
+// isStarted reports whether the response headers have been written.
+func (s *sseStream) isStarted() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.started
+}
+
+// write sends one event with already encoded data.
+func (s *sseStream) write(event string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.startLocked()
+	s.last = time.Now()
+	if _, err := fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", event, data); err != nil {
+		return err
+	}
+	if s.flusher != nil {
+		s.flusher.Flush()
+	}
+	return nil
+}
+
+// keepAlive sends a ping event whenever the stream has been quiet for
+// interval, until ctx is done or the returned stop is called. Pings start
+// the stream when the upstream is slow to answer, so proxies between the
+// client and the bridge do not drop the idle connection.
+func (s *sseStream) keepAlive(ctx context.Context, interval time.Duration) (stop func()) {
+	if interval <= 0 {
+		return func() {}
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			s.mu.Lock()
+			quiet := time.Since(s.last) >= interval
+			s.mu.Unlock()
+			if quiet && s.write("ping", []byte(`{"type":"ping"}`)) != nil {
+				return
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// fail reports err as an error event, the way Anthropic reports failures
+// after a stream has started. Errors that are not an APIError are sent as
+// an api_error.
+func (s *sseStream) fail(err error) {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		apiErr = upstreamAPIError(err.Error())
+	}
+	data, _ := json.Marshal(map[string]interface{}{
+		"type":  "error",
+		"error": map[string]interface{}{"type": apiErr.Type, "message": apiErr.Message},
+	})
+	if werr := s.write("error", data); werr != nil {
+		slog.Debug("Failed to send stream error event", "error", werr)
+	}
+}
@@ -0,0 +1,211 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"gopenbridge/models"
+	"gopenbridge/providers"
+)
+
+// streamRequest forwards req upstream with stream=true and relays the
+// translated events to w as they arrive. Upstreams that fail before the
+// stream starts are failed over like buffered requests. If the client goes
+// away the upstream stream is aborted and a partial log row is persisted.
+// Upstreams marked no_stream are sent a buffered request instead, and the
+// message is replayed by simulateStream. While the upstream is quiet the
+// client gets ping events, and failures after the stream has started are
+// reported as error events.
+func (p *ChatProxy) streamRequest(ctx context.Context, w http.ResponseWriter, req *models.MessagesRequest) {
+	logID := requestFrom(ctx).id
+	opts, err := p.resolveOptions(ctx, req)
+	if err != nil {
+		p.fail(ctx, w, err)
+		return
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	s := newSSEStream(w)
+	stopPings := s.keepAlive(ctx, p.cfg().StreamPingInterval)
+	defer stopPings()
+
+	var (
+		t        target
+		r        *models.MessagesRequest
+		body     []byte
+		httpRes  *http.Response
+		endpoint string
+		retries  int
+		msg      map[string]interface{}
+	)
+	err = p.withFailover(ctx, func(next target) error {
+		t = next
+		if t.noStream {
+			var err error
+			msg, err = p.processWith(ctx, t, req, opts, false)
+			return err
+		}
+		var payload map[string]interface{}
+		var err error
+		r, payload, err = p.buildPayload(ctx, t, req, opts)
+		if err != nil {
+			return err
+		}
+		providers.MarkStream(t.prov, payload)
+		body, _ = json.Marshal(payload)
+		httpRes, endpoint, retries, err = p.sendUpstream(ctx, t, logID, r, body, true)
+		if err != nil {
+			return err
+		}
+		if httpRes.StatusCode != http.StatusOK {
+			data, _ := io.ReadAll(httpRes.Body)
+			httpRes.Body.Close()
+			requestFrom(ctx).failed = &logEntry{
+				ID:         logID,
+				Provider:   t.up.BaseURL,
+				Endpoint:   endpoint,
+				Model:      r.Model,
+				Request:    string(body),
+				Response:   string(data),
+				StatusCode: httpRes.StatusCode,
+				Retries:    retries,
+			}
+			if _, err := p.decodeUpstream(ctx, httpRes, data); err != nil {
+				return err
+			}
+			return upstreamResponseError(httpRes, fmt.Sprintf("upstream returned status %d", httpRes.StatusCode))
+		}
+		return nil
+	})
+	if err != nil && s.isStarted() {
+		p.failStream(ctx, s, err)
+		return
+	}
+	if err != nil {
+		p.fail(ctx, w, err)
+		return
+	}
+	if msg != nil {
+		p.simulateStream(ctx, s, msg)
+		return
+	}
+	defer httpRes.Body.Close()
+
+	s.begin(func(h http.Header) {
+		if _, ok := p.cfg().PriceFor(r.Model); ok {
+			h.Set("Trailer", costHeader)
+		}
+		writeRateLimitHeaders(w, requestFrom(ctx))
+	})
+
+	writeFailed := false
+	cacheKey := requestFrom(ctx).cacheKey
+	var events []cachedEvent
+	names := requestFrom(ctx).toolNames
+	emit := func(event string, data interface{}) error {
+		names.restoreEvent(event, data)
+		b, _ := json.Marshal(data)
+		if cacheKey != "" {
+			events = append(events, cachedEvent{Event: event, Data: b})
+		}
+		if f := requestFrom(ctx).flight; f != nil {
+			f.emit(cachedEvent{Event: event, Data: b})
+		}
+		if err := s.write(event, b); err != nil {
+			writeFailed = true
+			return err
+		}
+		return nil
+	}
+	tr := t.prov.StreamTranslator("msg_"+logID, r.Model, opts, emit)
+	// An upstream that stalls mid-stream is aborted by cancelling ctx, which
+	// unblocks the pending body read
+	var idleExpired atomic.Bool
+	var idle *time.Timer
+	if p.cfg().StreamIdleTimeout > 0 {
+		idle = time.AfterFunc(p.cfg().StreamIdleTimeout, func() {
+			idleExpired.Store(true)
+			cancel()
+		})
+		defer idle.Stop()
+	}
+	var raw strings.Builder
+	streamErr := func() error {
+		if err := tr.Start(); err != nil {
+			return err
+		}
+		reader := providers.NewChunkReader(t.prov, httpRes.Body)
+		for {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			default:
+			}
+			chunk, data, readErr := reader.Next()
+			if readErr == io.EOF {
+				break
+			}
+			if readErr != nil {
+				return readErr
+			}
+			if idle != nil {
+				idle.Reset(p.cfg().StreamIdleTimeout)
+			}
+			raw.Write(data)
+			raw.WriteString("\n")
+			if chunk == nil {
+				requestFrom(ctx).logger.Debug("Skipping undecodable stream chunk", "data", string(data))
+			} else if errRaw, exists := chunk["error"]; exists {
+				return fmt.Errorf("upstream stream error: %v", errRaw)
+			} else if err := tr.Chunk(chunk); err != nil {
+				return err
+			}
+		}
+		return tr.Finish()
+	}()
+	if idleExpired.Load() {
+		streamErr = fmt.Errorf("upstream stream idle for %s", p.cfg().StreamIdleTimeout)
+	}
+
+	usage := tr.Usage()
+	inputTokens, outputTokens := usage.InputTokens, usage.OutputTokens
+	entry := logEntry{
+		ID:               logID,
+		Provider:         t.up.BaseURL,
+		Endpoint:         endpoint,
+		Model:            r.Model,
+		Request:          string(body),
+		Response:         raw.String(),
+		StatusCode:       httpRes.StatusCode,
+		StopReason:       tr.StopReason(),
+		PromptTokens:     inputTokens,
+		CompletionTokens: outputTokens,
+		Retries:          retries,
+		CostUSD:          p.cost(r.Model, inputTokens, outputTokens),
+	}
+	if entry.CostUSD != nil {
+		w.Header().Set(costHeader, formatCost(*entry.CostUSD))
+	}
+	if streamErr != nil {
+		entry.ErrorMessage = streamErr.Error()
+		if writeFailed || (ctx.Err() != nil && !idleExpired.Load()) {
+			// Client disconnected: stop reading from the upstream
+			cancel()
+			entry.StopReason = stopReasonCancelled
+		} else {
+			requestFrom(ctx).logger.Error("Stream failed", "endpoint", endpoint, "error", streamErr)
+			s.fail(streamErr)
+		}
+	}
+	if streamErr == nil && cacheKey != "" {
+		value, _ := json.Marshal(events)
+		p.cache.Put(ctx, cacheKey, value)
+	}
+	p.persistLog(ctx, entry)
+}
@@ -0,0 +1,77 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"gopenbridge/models"
+)
+
+// cancellingWriter records a response and cancels the client's context
+// once the first text delta is written, as a client hanging up mid-stream.
+type cancellingWriter struct {
+	*httptest.ResponseRecorder
+	cancel context.CancelFunc
+}
+
+func (w *cancellingWriter) Write(b []byte) (int, error) {
+	n, err := w.ResponseRecorder.Write(b)
+	if strings.Contains(string(b), "text_delta") {
+		w.cancel()
+	}
+	return n, err
+}
+
+func TestStreamRequestClientDisconnect(t *testing.T) {
+	aborted := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte(`data: {"id":"c1","choices":[{"index":0,"delta":{"role":"assistant","content":"Hel"}}],"usage":{"prompt_tokens":12,"completion_tokens":1}}` + "\n\n"))
+		w.(http.Flusher).Flush()
+		// Hold the stream open until the bridge gives up on it
+		select {
+		case <-r.Context().Done():
+			close(aborted)
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer upstream.Close()
+	p := newTestProxy(t, upstream.URL, nil)
+
+	ctx, cancel := context.WithCancel(testContext())
+	defer cancel()
+	id := requestFrom(ctx).id
+	maxTokens := 100
+	req := &models.MessagesRequest{
+		Model:     "test-model",
+		MaxTokens: &maxTokens,
+		Messages:  []models.Message{{Role: "user", Content: "Hello"}},
+	}
+	w := &cancellingWriter{ResponseRecorder: httptest.NewRecorder(), cancel: cancel}
+	p.streamRequest(ctx, w, req)
+
+	select {
+	case <-aborted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("upstream request was not aborted after the client disconnected")
+	}
+	row, err := p.logStore.GetLog(context.Background(), id)
+	if err != nil {
+		t.Fatalf("no log row for the cancelled stream: %v", err)
+	}
+	if row.StopReason != stopReasonCancelled {
+		t.Errorf("stop_reason = %q, want %q", row.StopReason, stopReasonCancelled)
+	}
+	if row.PromptTokens != 12 || row.CompletionTokens != 1 {
+		t.Errorf("usage = %d in, %d out, want the partial 12 in, 1 out", row.PromptTokens, row.CompletionTokens)
+	}
+	if !strings.Contains(row.Response, "Hel") {
+		t.Errorf("response %q lacks the partial stream", row.Response)
+	}
+}
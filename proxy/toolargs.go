@@ -0,0 +1,275 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopenbridge/models"
+	"gopenbridge/providers"
+)
+
+// Tool argument repair modes, see config.Config.ToolArgRepair.
+const (
+	toolArgRepairFix   = "fix"
+	toolArgRepairReask = "reask"
+)
+
+// repairToolArgs reports whether tool call arguments should be repaired.
+func (p *ChatProxy) repairToolArgs() bool {
+	mode := p.cfg().ToolArgRepair
+	return mode == toolArgRepairFix || mode == toolArgRepairReask
+}
+
+// checkToolArgs validates the tool_use inputs in parsed against the input
+// schemas of tools, coercing values that are plainly meant as the expected
+// type: numbers and booleans sent as strings, objects and arrays sent as
+// JSON strings, and single values where an array is expected. It returns
+// the problems left, by tool_use id, including arguments the provider could
+// not decode.
+func checkToolArgs(tools []models.Tool, parsed *providers.Response, logger *slog.Logger) map[string]string {
+	problems := map[string]string{}
+	maps.Copy(problems, parsed.ToolArgErrors)
+	schemas := make(map[string]map[string]interface{}, len(tools))
+	for _, t := range tools {
+		schemas[t.Name] = t.InputSchema
+	}
+	for _, blk := range parsed.Content {
+		b, ok := blk.(map[string]interface{})
+		if !ok || b["type"] != "tool_use" {
+			continue
+		}
+		id, _ := b["id"].(string)
+		name, _ := b["name"].(string)
+		if _, failed := problems[id]; failed {
+			continue
+		}
+		schema, ok := schemas[name]
+		if !ok {
+			problems[id] = fmt.Sprintf("there is no tool named %q", name)
+			continue
+		}
+		c := argChecker{}
+		input, _ := b["input"].(map[string]interface{})
+		b["input"] = c.check("input", input, schema)
+		for _, fix := range c.fixes {
+			logger.Info("Repaired tool call argument", "tool", name, "tool_use_id", id, "repair", fix)
+		}
+		if len(c.errs) > 0 {
+			problems[id] = strings.Join(c.errs, "; ")
+			logger.Warn("Tool call arguments do not match the input schema", "tool", name, "tool_use_id", id, "problems", problems[id])
+		}
+	}
+	return problems
+}
+
+// argChecker collects what checking one tool call's arguments fixed and
+// what it could not.
+type argChecker struct {
+	fixes []string
+	errs  []string
+}
+
+// check validates v at path against schema and returns it, coerced where
+// possible. Keywords it does not know are ignored.
+func (c *argChecker) check(path string, v interface{}, schema map[string]interface{}) interface{} {
+	if schema == nil {
+		return v
+	}
+	if types := schemaTypes(schema); len(types) > 0 && !slices.ContainsFunc(types, func(t string) bool { return hasType(v, t) }) {
+		coerced, ok := coerce(v, types)
+		if !ok {
+			c.errs = append(c.errs, fmt.Sprintf("%s: expected %s, got %s", path, strings.Join(types, " or "), jsonType(v)))
+			return v
+		}
+		c.fixes = append(c.fixes, fmt.Sprintf("%s: %s to %s", path, jsonType(v), jsonType(coerced)))
+		v = coerced
+	}
+	if enum, ok := schema["enum"].([]interface{}); ok && !slices.ContainsFunc(enum, func(e interface{}) bool { return equalJSON(e, v) }) {
+		c.errs = append(c.errs, fmt.Sprintf("%s: must be one of %s", path, compactJSON(enum)))
+	}
+	switch val := v.(type) {
+	case map[string]interface{}:
+		props, _ := schema["properties"].(map[string]interface{})
+		required, _ := schema["required"].([]interface{})
+		for _, r := range required {
+			if name, _ := r.(string); name != "" {
+				if _, ok := val[name]; !ok {
+					c.errs = append(c.errs, fmt.Sprintf("%s: missing required property %q", path, name))
+				}
+			}
+		}
+		for name, prop := range val {
+			if sub, ok := props[name].(map[string]interface{}); ok {
+				val[name] = c.check(path+"."+name, prop, sub)
+			}
+		}
+	case []interface{}:
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range val {
+				val[i] = c.check(fmt.Sprintf("%s[%d]", path, i), item, items)
+			}
+		}
+	}
+	return v
+}
+
+// schemaTypes returns the types a schema allows, none meaning any.
+func schemaTypes(schema map[string]interface{}) []string {
+	switch t := schema["type"].(type) {
+	case string:
+		return []string{t}
+	case []interface{}:
+		var types []string
+		for _, s := range t {
+			if s, ok := s.(string); ok {
+				types = append(types, s)
+			}
+		}
+		return types
+	}
+	return nil
+}
+
+// hasType reports whether v is a JSON value of type t.
+func hasType(v interface{}, t string) bool {
+	switch t {
+	case "integer":
+		f, ok := v.(float64)
+		return ok && f == float64(int64(f))
+	case "number":
+		_, ok := v.(float64)
+		return ok
+	}
+	return jsonType(v) == t
+}
+
+// jsonType names the JSON type of a decoded value.
+func jsonType(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// coerce converts v to the first of types it can plainly stand for.
+func coerce(v interface{}, types []string) (interface{}, bool) {
+	for _, t := range types {
+		switch s := v.(type) {
+		case string:
+			s = strings.TrimSpace(s)
+			switch t {
+			case "integer", "number":
+				if f, err := strconv.ParseFloat(s, 64); err == nil && hasType(f, t) {
+					return f, true
+				}
+			case "boolean":
+				if b, err := strconv.ParseBool(s); err == nil {
+					return b, true
+				}
+			case "object", "array":
+				var decoded interface{}
+				if json.Unmarshal([]byte(s), &decoded) == nil && jsonType(decoded) == t {
+					return decoded, true
+				}
+			}
+		case float64, bool:
+			if t == "string" {
+				return compactJSON(s), true
+			}
+		}
+		if t == "array" && v != nil {
+			return []interface{}{v}, true
+		}
+	}
+	return nil, false
+}
+
+// equalJSON compares two decoded JSON values.
+func equalJSON(a, b interface{}) bool {
+	return compactJSON(a) == compactJSON(b)
+}
+
+// compactJSON renders a decoded value as JSON.
+func compactJSON(v interface{}) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+// reaskToolArgs asks the model once more for the tool calls in res whose
+// arguments are still invalid, telling it what was wrong with each. It
+// returns the new response, or res unchanged if the retry fails.
+func (p *ChatProxy) reaskToolArgs(ctx context.Context, req *models.MessagesRequest, opts providers.Options, includeRaw bool, res map[string]interface{}, problems map[string]string) map[string]interface{} {
+	info := requestFrom(ctx)
+	content, _ := res["content"].([]interface{})
+	var results []interface{}
+	for _, blk := range content {
+		b, ok := blk.(map[string]interface{})
+		if !ok || b["type"] != "tool_use" {
+			continue
+		}
+		id, _ := b["id"].(string)
+		result := map[string]interface{}{"type": "tool_result", "tool_use_id": id}
+		if problem, ok := problems[id]; ok {
+			result["is_error"] = true
+			result["content"] = "Invalid arguments, the tool was not called: " + problem + ". Call it again with arguments matching its input_schema."
+		} else {
+			result["content"] = "Not executed because another tool call in this turn had invalid arguments. Repeat this call if it is still needed."
+		}
+		results = append(results, result)
+	}
+	retry := *req
+	retry.Messages = append(slices.Clip(req.Messages),
+		models.Message{Role: "assistant", Content: content},
+		models.Message{Role: "user", Content: results},
+	)
+
+	// The retry is logged as its own row, under a derived ID
+	child := *info
+	child.id = info.id + "-reask"
+	child.logger = info.logger.With("reask", true)
+	child.costUSD = nil
+	child.toolArgProblems = nil
+	child.toolNames = newToolNames(&retry)
+	cctx := withRequestInfo(ctx, &child)
+	child.logger.Info("Asking the model again for invalid tool call arguments", "tool_calls", len(problems))
+
+	var retried map[string]interface{}
+	err := p.withFailover(cctx, func(t target) error {
+		var err error
+		retried, err = p.processWith(cctx, t, &retry, opts, includeRaw)
+		return err
+	})
+	if err != nil {
+		info.logger.Warn("Tool argument re-ask failed, returning the original response", "error", err)
+		return res
+	}
+	if child.costUSD != nil {
+		total := *child.costUSD
+		if info.costUSD != nil {
+			total += *info.costUSD
+		}
+		info.costUSD = &total
+	}
+	if len(child.toolArgProblems) > 0 {
+		info.logger.Warn("Tool call arguments still invalid after re-ask", "tool_calls", len(child.toolArgProblems))
+	}
+	retried["id"] = res["id"]
+	return retried
+}
@@ -0,0 +1,185 @@
+package proxy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"maps"
+	"slices"
+	"strings"
+
+	"gopenbridge/models"
+)
+
+// maxToolNameLen is the longest function name OpenAI, Bedrock and Gemini
+// accept.
+const maxToolNameLen = 64
+
+// toolNames maps tool names the upstream would reject to sanitized ones
+// for a single request, and back again for the tool_use blocks returned to
+// the client.
+type toolNames struct {
+	out  map[string]string // original → sanitized
+	back map[string]string // sanitized → original
+}
+
+// newToolNames returns the renames needed by req's tools, tool_use blocks
+// and tool_choice, or nil when every name is acceptable as is.
+func newToolNames(req *models.MessagesRequest) *toolNames {
+	names := map[string]bool{}
+	for _, t := range req.Tools {
+		names[t.Name] = true
+	}
+	eachToolUse(req.Messages, func(b map[string]interface{}) {
+		if name, _ := b["name"].(string); name != "" {
+			names[name] = true
+		}
+	})
+	if c, ok := req.ToolChoice.(map[string]interface{}); ok {
+		if name, _ := c["name"].(string); name != "" {
+			names[name] = true
+		}
+	}
+	taken := map[string]bool{}
+	for name := range names {
+		if validToolName(name) {
+			taken[name] = true
+		}
+	}
+	var n *toolNames
+	for _, name := range slices.Sorted(maps.Keys(names)) {
+		if taken[name] {
+			continue
+		}
+		s := sanitizeToolName(name, taken)
+		taken[s] = true
+		if n == nil {
+			n = &toolNames{out: map[string]string{}, back: map[string]string{}}
+		}
+		n.out[name], n.back[s] = s, name
+	}
+	return n
+}
+
+// validToolName reports whether name is at most maxToolNameLen characters
+// of [a-zA-Z0-9_-].
+func validToolName(name string) bool {
+	if name == "" || len(name) > maxToolNameLen {
+		return false
+	}
+	return strings.IndexFunc(name, func(r rune) bool { return !toolNameRune(r) }) == -1
+}
+
+func toolNameRune(r rune) bool {
+	return r == '_' || r == '-' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9'
+}
+
+// sanitizeToolName replaces disallowed characters with underscores. Names
+// that are still too long or collide with another name are truncated and
+// suffixed with a hash of the original, keeping them unique.
+func sanitizeToolName(name string, taken map[string]bool) string {
+	s := strings.Map(func(r rune) rune {
+		if toolNameRune(r) {
+			return r
+		}
+		return '_'
+	}, name)
+	if s != "" && len(s) <= maxToolNameLen && !taken[s] {
+		return s
+	}
+	sum := sha256.Sum256([]byte(name))
+	suffix := "_" + hex.EncodeToString(sum[:4])
+	if len(s) > maxToolNameLen-len(suffix) {
+		s = s[:maxToolNameLen-len(suffix)]
+	}
+	return s + suffix
+}
+
+// apply returns a copy of req using sanitized names. req is not modified.
+func (n *toolNames) apply(req *models.MessagesRequest) *models.MessagesRequest {
+	if n == nil {
+		return req
+	}
+	r := *req
+	r.Tools = make([]models.Tool, len(req.Tools))
+	for i, t := range req.Tools {
+		t.Name = n.rename(t.Name)
+		r.Tools[i] = t
+	}
+	r.Messages = make([]models.Message, len(req.Messages))
+	for i, msg := range req.Messages {
+		if blocks, ok := msg.Content.([]interface{}); ok {
+			renamed := make([]interface{}, len(blocks))
+			for j, blk := range blocks {
+				renamed[j] = blk
+				if b, ok := blk.(map[string]interface{}); ok && b["type"] == "tool_use" {
+					name, _ := b["name"].(string)
+					b = maps.Clone(b)
+					b["name"] = n.rename(name)
+					renamed[j] = b
+				}
+			}
+			msg.Content = renamed
+		}
+		r.Messages[i] = msg
+	}
+	if c, ok := req.ToolChoice.(map[string]interface{}); ok {
+		if name, _ := c["name"].(string); name != "" {
+			c = maps.Clone(c)
+			c["name"] = n.rename(name)
+			r.ToolChoice = c
+		}
+	}
+	return &r
+}
+
+// rename returns the sanitized form of name.
+func (n *toolNames) rename(name string) string {
+	if s, ok := n.out[name]; ok {
+		return s
+	}
+	return name
+}
+
+// restore puts original names back on tool_use blocks in content.
+func (n *toolNames) restore(content []interface{}) {
+	if n == nil {
+		return
+	}
+	for _, blk := range content {
+		n.restoreBlock(blk)
+	}
+}
+
+// restoreEvent puts the original name back on a tool_use block opened by a
+// content_block_start stream event.
+func (n *toolNames) restoreEvent(event string, data interface{}) {
+	if n == nil || event != "content_block_start" {
+		return
+	}
+	if ev, ok := data.(map[string]interface{}); ok {
+		n.restoreBlock(ev["content_block"])
+	}
+}
+
+// restoreBlock renames a tool_use block in place.
+func (n *toolNames) restoreBlock(blk interface{}) {
+	b, ok := blk.(map[string]interface{})
+	if !ok || b["type"] != "tool_use" {
+		return
+	}
+	if name, _ := b["name"].(string); n.back[name] != "" {
+		b["name"] = n.back[name]
+	}
+}
+
+// eachToolUse calls fn for every tool_use block in msgs.
+func eachToolUse(msgs []models.Message, fn func(b map[string]interface{})) {
+	for _, msg := range msgs {
+		blocks, _ := msg.Content.([]interface{})
+		for _, blk := range blocks {
+			if b, ok := blk.(map[string]interface{}); ok && b["type"] == "tool_use" {
+				fn(b)
+			}
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// translatingWriter wraps a ResponseWriter for endpoints that speak another
+// API on top of /v1/messages. Anthropic SSE events written to it are parsed
+// and passed to event one at a time; other bodies are buffered and passed
+// to body by Close, with the status they were written with.
+type translatingWriter struct {
+	http.ResponseWriter
+	event func(w io.Writer, name string, data []byte) error
+	body  func(w http.ResponseWriter, status int, data []byte)
+
+	status int
+	stream bool
+	buf    bytes.Buffer
+}
+
+// WriteHeader satisfies http.ResponseWriter. Only event streams are
+// started right away, since translating a body may change its headers.
+func (w *translatingWriter) WriteHeader(status int) {
+	if w.status != 0 {
+		return
+	}
+	w.status = status
+	if status == http.StatusOK && strings.HasPrefix(w.Header().Get("Content-Type"), "text/event-stream") {
+		w.stream = true
+		w.ResponseWriter.WriteHeader(status)
+	}
+}
+
+// Write satisfies http.ResponseWriter.
+func (w *translatingWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	w.buf.Write(b)
+	if !w.stream {
+		return len(b), nil
+	}
+	for {
+		raw, rest, ok := bytes.Cut(w.buf.Bytes(), []byte("\n\n"))
+		if !ok {
+			return len(b), nil
+		}
+		var name string
+		var data []byte
+		for _, line := range strings.Split(string(raw), "\n") {
+			if v, ok := strings.CutPrefix(line, "event: "); ok {
+				name = v
+			} else if v, ok := strings.CutPrefix(line, "data: "); ok {
+				data = []byte(v)
+			}
+		}
+		w.buf = *bytes.NewBuffer(append([]byte(nil), rest...))
+		if err := w.event(w.ResponseWriter, name, data); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// Flush satisfies http.Flusher.
+func (w *translatingWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok && w.stream {
+		f.Flush()
+	}
+}
+
+// Close hands a buffered body to w.body. It must be called once the
+// wrapped handler returns.
+func (w *translatingWriter) Close() {
+	if w.stream {
+		return
+	}
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.body(w.ResponseWriter, w.status, w.buf.Bytes())
+}
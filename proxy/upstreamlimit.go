@@ -0,0 +1,94 @@
+package proxy
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// upstreamLimits maps the x-ratelimit-* headers sent by OpenAI-compatible
+// upstreams to Anthropic's anthropic-ratelimit-* headers, so that clients
+// pacing themselves by the latter see the upstream's real budget.
+var upstreamLimits = []struct{ from, to string }{
+	{"x-ratelimit-limit-requests", "anthropic-ratelimit-requests-limit"},
+	{"x-ratelimit-remaining-requests", "anthropic-ratelimit-requests-remaining"},
+	{"x-ratelimit-limit-tokens", "anthropic-ratelimit-tokens-limit"},
+	{"x-ratelimit-remaining-tokens", "anthropic-ratelimit-tokens-remaining"},
+}
+
+// upstreamResets maps reset headers, given upstream as a duration, to
+// Anthropic's, which are RFC 3339 times.
+var upstreamResets = []struct{ from, to string }{
+	{"x-ratelimit-reset-requests", "anthropic-ratelimit-requests-reset"},
+	{"x-ratelimit-reset-tokens", "anthropic-ratelimit-tokens-reset"},
+}
+
+// rateLimitHeaders synthesizes anthropic-ratelimit-* headers from an
+// upstream response's rate limit headers. It returns nil if there are none.
+func rateLimitHeaders(h http.Header, now time.Time) http.Header {
+	res := http.Header{}
+	for _, m := range upstreamLimits {
+		if v := h.Get(m.from); v != "" {
+			res.Set(m.to, v)
+		}
+	}
+	for _, m := range upstreamResets {
+		if d, ok := parseReset(h.Get(m.from), now); ok {
+			res.Set(m.to, now.Add(d).UTC().Format(time.RFC3339))
+		}
+	}
+	if len(res) == 0 {
+		return nil
+	}
+	return res
+}
+
+// upstreamRetryAfter returns how long the upstream asked us to wait: its
+// Retry-After (or retry-after-ms) header, or else the longest rate limit
+// reset.
+func upstreamRetryAfter(h http.Header, now time.Time) (time.Duration, bool) {
+	if ms, err := strconv.ParseFloat(h.Get("retry-after-ms"), 64); err == nil && ms > 0 {
+		return time.Duration(ms * float64(time.Millisecond)), true
+	}
+	rp := retryPolicy{now: func() time.Time { return now }}
+	if d, ok := rp.retryAfter(h.Get("Retry-After")); ok {
+		return d, true
+	}
+	var longest time.Duration
+	for _, m := range upstreamResets {
+		if d, ok := parseReset(h.Get(m.from), now); ok {
+			longest = max(longest, d)
+		}
+	}
+	return longest, longest > 0
+}
+
+// parseReset reads a rate limit reset as a Go-style duration ("1m30s",
+// "250ms", as OpenAI and Groq send), seconds ("0.5"), or a Unix time.
+func parseReset(v string, now time.Time) (time.Duration, bool) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0, false
+	}
+	if d, err := time.ParseDuration(v); err == nil {
+		return max(d, 0), true
+	}
+	secs, err := strconv.ParseFloat(v, 64)
+	if err != nil || secs < 0 {
+		return 0, false
+	}
+	// Values this large are timestamps rather than waits
+	if secs > 1e9 {
+		return max(time.Unix(int64(secs), 0).Sub(now), 0), true
+	}
+	return time.Duration(secs * float64(time.Second)), true
+}
+
+// writeRateLimitHeaders copies the synthesized upstream rate limit headers
+// of the request to w.
+func writeRateLimitHeaders(w http.ResponseWriter, info *requestInfo) {
+	for k, v := range info.rateLimits {
+		w.Header()[k] = v
+	}
+}
@@ -0,0 +1,46 @@
+package proxy
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+
+	"gopenbridge/config"
+	"gopenbridge/providers"
+)
+
+// ValidateUpstreams checks the default upstream, the provider profiles and
+// the failover entries in cfg against what their provider adapters need,
+// and that the upstream client can be set up. It opens nothing and sends
+// no requests.
+func ValidateUpstreams(cfg *config.Config) []config.Problem {
+	var problems []config.Problem
+	if _, err := newUpstreamClient(cfg); err != nil {
+		problems = append(problems, config.Problem{Key: "upstream", Message: "cannot set up the upstream client: " + err.Error()})
+	}
+	check := func(key, adapter, baseURL string, keys []string) {
+		if _, ok := providers.Get(adapter); adapter != "" && !ok {
+			problems = append(problems, config.Problem{Key: key, Message: fmt.Sprintf("unknown provider %q, using %s detected from base_url", adapter, providers.Detect(baseURL).Name())})
+		}
+		up := providers.Upstream{BaseURL: baseURL, APIKey: firstKey(keys), Region: cfg.AWSRegion, AWSProfile: cfg.AWSProfile}
+		for _, msg := range providers.Validate(providers.Resolve(adapter, baseURL), up) {
+			problems = append(problems, config.Problem{Key: key, Message: msg})
+		}
+	}
+	check("upstream", cfg.Provider, cfg.BaseURL, cfg.UpstreamKeys())
+	for _, name := range slices.Sorted(maps.Keys(cfg.Providers)) {
+		prof := cfg.Providers[name]
+		adapter := prof.Provider
+		if adapter == "" {
+			// A profile named after an adapter uses it, others detect one
+			if _, ok := providers.Get(name); ok {
+				adapter = name
+			}
+		}
+		check("providers."+name, adapter, prof.BaseURL, prof.Keys())
+	}
+	for i, f := range cfg.Failover {
+		check(fmt.Sprintf("failover[%d]", i), f.Provider, f.BaseURL, f.Keys())
+	}
+	return problems
+}
@@ -0,0 +1,68 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"gopenbridge/config"
+)
+
+// loadTestConfig loads the config for upstream the way newTestProxy does,
+// without creating a proxy or its database.
+func loadTestConfig(t *testing.T, upstream string) *config.Config {
+	t.Helper()
+	dir := t.TempDir()
+	t.Chdir(dir)
+	t.Setenv("HOME", dir)
+	t.Setenv("OPENAI_BASE_URL", upstream)
+	t.Setenv("OPENAI_API_KEY", "test-key")
+	t.Setenv("OPENAI_MODEL", "test-model")
+	t.Setenv("DB_PATH", filepath.Join(dir, "test.db"))
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Provider = "openai"
+	return cfg
+}
+
+func TestValidationLeavesTheDatabaseAlone(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/models" || r.Header.Get("Authorization") != "Bearer test-key" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"data":[{"id":"test-model"},{"id":"other-model"}]}`))
+	}))
+	defer upstream.Close()
+	cfg := loadTestConfig(t, upstream.URL)
+
+	if problems := ValidateUpstreams(cfg); len(problems) > 0 {
+		t.Errorf("problems = %v", problems)
+	}
+	list, err := ListModels(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || !reflect.DeepEqual(list[0].Models, []string{"other-model", "test-model"}) {
+		t.Errorf("models = %+v", list)
+	}
+	if _, err := os.Stat(cfg.DBPath); !os.IsNotExist(err) {
+		t.Errorf("validation created or touched the database: %v", err)
+	}
+}
+
+func TestValidateUpstreamsReportsClientSetup(t *testing.T) {
+	cfg := loadTestConfig(t, "https://api.openai.com/v1")
+	cfg.UpstreamCAFile = filepath.Join(t.TempDir(), "missing.pem")
+	problems := ValidateUpstreams(cfg)
+	if len(problems) != 1 || problems[0].Key != "upstream" {
+		t.Errorf("problems = %v, want the client setup error", problems)
+	}
+}
@@ -0,0 +1,220 @@
+// Package sched schedules requests to an upstream: it caps how many run at
+// once and queues the rest by priority, so interactive traffic is served
+// ahead of background work when the upstream is saturated.
+package sched
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Priority orders queued requests; higher runs first.
+type Priority int
+
+const (
+	Background Priority = iota // e.g. title generation and other haiku traffic
+	Normal
+	Interactive
+)
+
+// String returns the priority's name as accepted by ParsePriority.
+func (p Priority) String() string {
+	switch p {
+	case Background:
+		return "background"
+	case Interactive:
+		return "interactive"
+	}
+	return "normal"
+}
+
+// ParsePriority reads "background" (or "low"), "normal" and "interactive"
+// (or "high").
+func ParsePriority(s string) (Priority, bool) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "background", "low":
+		return Background, true
+	case "normal":
+		return Normal, true
+	case "interactive", "high":
+		return Interactive, true
+	}
+	return Normal, false
+}
+
+// ErrQueueFull is returned when a request cannot be queued, or is pushed
+// out of the queue by one with a higher priority.
+var ErrQueueFull = errors.New("upstream queue is full")
+
+// waiter is a queued request.
+type waiter struct {
+	prio    Priority
+	seq     uint64 // arrival order, FIFO within a priority
+	ready   chan error
+	index   int // position in the heap, -1 once removed
+	granted bool
+}
+
+// waitQueue is a max-heap of waiters by priority, then arrival.
+type waitQueue []*waiter
+
+func (q waitQueue) Len() int { return len(q) }
+func (q waitQueue) Less(i, j int) bool {
+	if q[i].prio != q[j].prio {
+		return q[i].prio > q[j].prio
+	}
+	return q[i].seq < q[j].seq
+}
+func (q waitQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index, q[j].index = i, j
+}
+func (q *waitQueue) Push(x interface{}) {
+	w := x.(*waiter)
+	w.index = len(*q)
+	*q = append(*q, w)
+}
+func (q *waitQueue) Pop() interface{} {
+	old := *q
+	w := old[len(old)-1]
+	old[len(old)-1] = nil
+	w.index = -1
+	*q = old[:len(old)-1]
+	return w
+}
+
+// Stats is a snapshot of a Scheduler's state and counters.
+type Stats struct {
+	MaxActive int           // Concurrency cap
+	Active    int           // Requests running
+	Queued    int           // Requests waiting for a slot
+	Admitted  uint64        // Requests given a slot, immediately or after waiting
+	Rejected  uint64        // Requests refused or pushed out of a full queue
+	Waited    uint64        // Admitted requests that had to wait
+	WaitTime  time.Duration // Total time admitted requests spent queued
+}
+
+// Scheduler admits at most max concurrent requests. Others wait in a queue
+// of up to maxQueue, highest priority first. When the queue is full a new
+// request displaces the newest waiter of a lower priority, if any.
+type Scheduler struct {
+	max      int
+	maxQueue int
+
+	mu     sync.Mutex
+	active int
+	queue  waitQueue
+	seq    uint64
+	stats  Stats
+}
+
+// New returns a Scheduler running at most max requests at once and queuing
+// up to maxQueue more.
+func New(max, maxQueue int) *Scheduler {
+	return &Scheduler{max: max, maxQueue: maxQueue, stats: Stats{MaxActive: max}}
+}
+
+// Limits returns the limits s was created with.
+func (s *Scheduler) Limits() (max, maxQueue int) {
+	return s.max, s.maxQueue
+}
+
+// Acquire waits for a slot and returns a function that frees it, safe to
+// call more than once, and how long the request was queued. It fails with
+// ErrQueueFull or ctx's error.
+func (s *Scheduler) Acquire(ctx context.Context, prio Priority) (func(), time.Duration, error) {
+	s.mu.Lock()
+	if s.active < s.max && len(s.queue) == 0 {
+		s.active++
+		s.stats.Admitted++
+		s.mu.Unlock()
+		return s.releaser(), 0, nil
+	}
+	if len(s.queue) >= s.maxQueue && !s.displace(prio) {
+		s.stats.Rejected++
+		s.mu.Unlock()
+		return nil, 0, ErrQueueFull
+	}
+	s.seq++
+	w := &waiter{prio: prio, seq: s.seq, ready: make(chan error, 1)}
+	heap.Push(&s.queue, w)
+	s.mu.Unlock()
+
+	start := time.Now()
+	select {
+	case err := <-w.ready:
+		if err != nil {
+			return nil, time.Since(start), err
+		}
+		wait := time.Since(start)
+		s.mu.Lock()
+		s.stats.Waited++
+		s.stats.WaitTime += wait
+		s.mu.Unlock()
+		return s.releaser(), wait, nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		if w.granted {
+			// The slot was handed over as ctx ended; pass it on
+			s.mu.Unlock()
+			s.release()
+		} else if w.index >= 0 {
+			heap.Remove(&s.queue, w.index)
+			s.mu.Unlock()
+		} else {
+			s.mu.Unlock()
+		}
+		return nil, time.Since(start), ctx.Err()
+	}
+}
+
+// displace drops the newest lowest-priority waiter if it ranks below prio,
+// making room for a new request. s.mu must be held.
+func (s *Scheduler) displace(prio Priority) bool {
+	var victim *waiter
+	for _, w := range s.queue {
+		if w.prio < prio && (victim == nil || w.prio < victim.prio || (w.prio == victim.prio && w.seq > victim.seq)) {
+			victim = w
+		}
+	}
+	if victim == nil {
+		return false
+	}
+	heap.Remove(&s.queue, victim.index)
+	s.stats.Rejected++
+	victim.ready <- ErrQueueFull
+	return true
+}
+
+func (s *Scheduler) releaser() func() {
+	var once sync.Once
+	return func() { once.Do(s.release) }
+}
+
+// release frees a slot, handing it straight to the next waiter.
+func (s *Scheduler) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.queue) == 0 {
+		s.active--
+		return
+	}
+	w := heap.Pop(&s.queue).(*waiter)
+	w.granted = true
+	s.stats.Admitted++
+	w.ready <- nil
+}
+
+// Stats returns a snapshot of s.
+func (s *Scheduler) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := s.stats
+	st.Active = s.active
+	st.Queued = len(s.queue)
+	return st
+}
@@ -0,0 +1,72 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"gopenbridge/awsauth"
+)
+
+// awsSecretsManager reads secrets from AWS Secrets Manager with the
+// standard AWS credentials. The path is a secret name or ARN; the region
+// comes from the ARN or the AWS defaults. Without a field the whole secret
+// string is used, otherwise it is parsed as JSON.
+type awsSecretsManager struct{}
+
+// Fetch satisfies Backend.
+func (awsSecretsManager) Fetch(ctx context.Context, client *http.Client, ref Ref) (string, error) {
+	creds, err := awsauth.LoadCredentials("")
+	if err != nil {
+		return "", err
+	}
+	region := awsauth.DefaultRegion("")
+	// arn:aws:secretsmanager:REGION:ACCOUNT:secret:NAME
+	if parts := strings.Split(ref.Path, ":"); len(parts) > 3 && parts[0] == "arn" {
+		region = parts[3]
+	}
+	if region == "" {
+		region = "us-east-1"
+	}
+	body, _ := json.Marshal(map[string]string{"SecretId": ref.Path})
+	req, err := http.NewRequestWithContext(ctx, "POST", "https://secretsmanager."+region+".amazonaws.com/", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	if err := awsauth.Sign(req, body, creds, region, "secretsmanager", time.Now()); err != nil {
+		return "", err
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return "", err
+	}
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("secrets manager returned status %d: %s", res.StatusCode, data)
+	}
+	var out struct {
+		SecretString string `json:"SecretString"`
+	}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return "", err
+	}
+	if ref.Field == "" {
+		return out.SecretString, nil
+	}
+	var kv map[string]interface{}
+	if err := json.Unmarshal([]byte(out.SecretString), &kv); err != nil {
+		return "", fmt.Errorf("secret is not JSON, remove #%s from the reference", ref.Field)
+	}
+	return field(kv, ref)
+}
@@ -0,0 +1,41 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// keychainService is the service name entries are stored under in the OS
+// keyring; the account is the entry name.
+const keychainService = "gopenbridge"
+
+// ErrNoKeychainEntry is returned when the keyring has no entry by that name.
+var ErrNoKeychainEntry = errors.New("no such keychain entry")
+
+// keychain reads secrets from the OS keyring: the macOS Keychain, the
+// Secret Service on Linux and the BSDs (through secret-tool) or the Windows
+// Credential Manager. A reference is "keychain://name", as stored by
+// `gopenbridge key set name`.
+type keychain struct{}
+
+// Fetch satisfies Backend.
+func (keychain) Fetch(_ context.Context, _ *http.Client, ref Ref) (string, error) {
+	return KeychainGet(ref.Path)
+}
+
+// KeychainGet returns the secret stored as name in the OS keyring.
+func KeychainGet(name string) (string, error) {
+	return keychainGet(name)
+}
+
+// KeychainSet stores secret as name in the OS keyring, replacing any
+// previous value.
+func KeychainSet(name, secret string) error {
+	return keychainSet(name, secret)
+}
+
+// KeychainDelete removes name from the OS keyring.
+func KeychainDelete(name string) error {
+	return keychainDelete(name)
+}
@@ -0,0 +1,41 @@
+package secrets
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// The macOS Keychain is driven through the security CLI, which ships with
+// the OS. Exit status 44 means the item was not found.
+
+func keychainGet(name string) (string, error) {
+	out, err := exec.Command("security", "find-generic-password", "-s", keychainService, "-a", name, "-w").Output()
+	if err != nil {
+		return "", securityError(err)
+	}
+	return strings.TrimRight(string(out), "\n"), nil
+}
+
+func keychainSet(name, secret string) error {
+	// -U updates an existing item instead of failing.
+	cmd := exec.Command("security", "add-generic-password", "-U", "-s", keychainService, "-a", name, "-w", secret)
+	return securityError(cmd.Run())
+}
+
+func keychainDelete(name string) error {
+	return securityError(exec.Command("security", "delete-generic-password", "-s", keychainService, "-a", name).Run())
+}
+
+func securityError(err error) error {
+	var exit *exec.ExitError
+	if !errors.As(err, &exit) {
+		return err
+	}
+	if exit.ExitCode() == 44 {
+		return ErrNoKeychainEntry
+	}
+	return fmt.Errorf("security: %s", bytes.TrimSpace(exit.Stderr))
+}
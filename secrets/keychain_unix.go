@@ -0,0 +1,50 @@
+//go:build !darwin && !windows
+
+package secrets
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// The Secret Service (GNOME Keyring, KWallet) is driven through secret-tool
+// from libsecret. lookup exits 1 with no output when nothing matches.
+
+func keychainGet(name string) (string, error) {
+	out, err := exec.Command("secret-tool", "lookup", "service", keychainService, "account", name).Output()
+	if err != nil {
+		var exit *exec.ExitError
+		if errors.As(err, &exit) && len(bytes.TrimSpace(exit.Stderr)) == 0 {
+			return "", ErrNoKeychainEntry
+		}
+		return "", secretToolError(err)
+	}
+	return strings.TrimRight(string(out), "\n"), nil
+}
+
+func keychainSet(name, secret string) error {
+	cmd := exec.Command("secret-tool", "store", "--label", keychainService+" "+name, "service", keychainService, "account", name)
+	cmd.Stdin = strings.NewReader(secret)
+	return secretToolError(cmd.Run())
+}
+
+func keychainDelete(name string) error {
+	if _, err := keychainGet(name); err != nil {
+		return err
+	}
+	return secretToolError(exec.Command("secret-tool", "clear", "service", keychainService, "account", name).Run())
+}
+
+func secretToolError(err error) error {
+	var exit *exec.ExitError
+	if errors.As(err, &exit) {
+		return fmt.Errorf("secret-tool: %s", bytes.TrimSpace(exit.Stderr))
+	}
+	if errors.Is(err, exec.ErrNotFound) {
+		return errors.New("secret-tool not found, install libsecret-tools")
+	}
+	return err
+}
@@ -0,0 +1,135 @@
+// Package secrets resolves API keys kept in an external secret manager.
+// A config value such as "vault://secret/data/llm#groq",
+// "aws-sm://prod/llm-keys#groq" or "keychain://groq" is a reference to a
+// secret; any other value is used as is.
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Ref identifies one secret value.
+type Ref struct {
+	Scheme string // Backend name, e.g. "vault"
+	Path   string // Backend-specific secret location
+	Field  string // Key within the secret; empty if the secret is a single value
+}
+
+// Backend fetches secrets from one secret manager.
+type Backend interface {
+	Fetch(ctx context.Context, client *http.Client, ref Ref) (string, error)
+}
+
+// backends are keyed by reference scheme.
+var backends = map[string]Backend{
+	"vault":    vault{},
+	"aws-sm":   awsSecretsManager{},
+	"keychain": keychain{},
+}
+
+// Parse splits a secret reference, reporting false for plain values.
+func Parse(s string) (Ref, bool) {
+	scheme, rest, ok := strings.Cut(s, "://")
+	if !ok {
+		return Ref{}, false
+	}
+	if _, known := backends[scheme]; !known {
+		return Ref{}, false
+	}
+	ref := Ref{Scheme: scheme, Path: rest}
+	if i := strings.LastIndex(rest, "#"); i >= 0 {
+		ref.Path, ref.Field = rest[:i], rest[i+1:]
+	}
+	return ref, true
+}
+
+// IsRef reports whether s refers to a secret.
+func IsRef(s string) bool {
+	_, ok := Parse(s)
+	return ok
+}
+
+// entry is a cached secret value.
+type entry struct {
+	value   string
+	fetched time.Time
+}
+
+// Cache resolves references through their backend, caching values for a
+// refresh interval. When a refresh fails the previous value keeps being
+// served, so a secret manager outage does not take the proxy down.
+type Cache struct {
+	refresh time.Duration
+	client  *http.Client
+
+	mu      sync.Mutex
+	entries map[string]entry
+}
+
+// fetchTimeout bounds a single call to a secret manager.
+const fetchTimeout = 30 * time.Second
+
+// NewCache returns a cache that re-fetches secrets older than refresh; zero
+// fetches each secret once.
+func NewCache(refresh time.Duration) *Cache {
+	return &Cache{refresh: refresh, client: &http.Client{Timeout: fetchTimeout}, entries: make(map[string]entry)}
+}
+
+// Resolve returns s itself, or the secret it refers to.
+func (c *Cache) Resolve(ctx context.Context, s string) (string, error) {
+	ref, ok := Parse(s)
+	if !ok {
+		return s, nil
+	}
+	c.mu.Lock()
+	e, cached := c.entries[s]
+	c.mu.Unlock()
+	if cached && (c.refresh <= 0 || time.Since(e.fetched) < c.refresh) {
+		return e.value, nil
+	}
+	value, err := backends[ref.Scheme].Fetch(ctx, c.client, ref)
+	if err != nil {
+		if cached {
+			slog.Warn("Failed to refresh secret, using cached value", "secret", ref.Scheme+"://"+ref.Path, "error", err)
+			return e.value, nil
+		}
+		return "", fmt.Errorf("fetch %s://%s: %w", ref.Scheme, ref.Path, err)
+	}
+	c.mu.Lock()
+	c.entries[s] = entry{value: value, fetched: time.Now()}
+	c.mu.Unlock()
+	return value, nil
+}
+
+// Invalidate drops the cached value of s so the next Resolve fetches it
+// again, e.g. after the upstream rejected it.
+func (c *Cache) Invalidate(s string) {
+	c.mu.Lock()
+	delete(c.entries, s)
+	c.mu.Unlock()
+}
+
+// field picks ref.Field from a secret's key/value data. A secret with a
+// single key may omit the field.
+func field(data map[string]interface{}, ref Ref) (string, error) {
+	name := ref.Field
+	if name == "" {
+		if len(data) != 1 {
+			return "", fmt.Errorf("secret has %d keys, add #field to the reference", len(data))
+		}
+		for k := range data {
+			name = k
+		}
+	}
+	v, ok := data[name].(string)
+	if !ok {
+		return "", fmt.Errorf("secret has no string field %q", name)
+	}
+	return v, nil
+}
@@ -0,0 +1,70 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// vault reads secrets from HashiCorp Vault's HTTP API using VAULT_ADDR and
+// VAULT_TOKEN (or ~/.vault-token), like the vault CLI. Both KV version 1
+// and 2 paths work; for version 2 the path includes "data/".
+type vault struct{}
+
+// Fetch satisfies Backend.
+func (vault) Fetch(ctx context.Context, client *http.Client, ref Ref) (string, error) {
+	addr := os.Getenv("VAULT_ADDR")
+	if addr == "" {
+		return "", errors.New("VAULT_ADDR is not set")
+	}
+	token := os.Getenv("VAULT_TOKEN")
+	if token == "" {
+		home, _ := os.UserHomeDir()
+		if b, err := os.ReadFile(filepath.Join(home, ".vault-token")); err == nil {
+			token = strings.TrimSpace(string(b))
+		}
+	}
+	if token == "" {
+		return "", errors.New("VAULT_TOKEN is not set")
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", strings.TrimRight(addr, "/")+"/v1/"+strings.TrimLeft(ref.Path, "/"), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if ns := os.Getenv("VAULT_NAMESPACE"); ns != "" {
+		req.Header.Set("X-Vault-Namespace", ns)
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return "", err
+	}
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vault returned status %d", res.StatusCode)
+	}
+	var out struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &out); err != nil {
+		return "", err
+	}
+	data := out.Data
+	// KV version 2 nests the secret under data.data
+	if inner, ok := data["data"].(map[string]interface{}); ok {
+		if _, hasMeta := data["metadata"]; hasMeta {
+			data = inner
+		}
+	}
+	return field(data, ref)
+}
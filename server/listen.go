@@ -0,0 +1,39 @@
+package server
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"gopenbridge/config"
+)
+
+// listen opens the server listener: a unix domain socket when cfg.Listen is
+// "unix:///path", otherwise TCP on cfg.Listen or host:port.
+func listen(cfg *config.Config) (net.Listener, error) {
+	path, ok := strings.CutPrefix(cfg.Listen, "unix://")
+	if !ok {
+		addr := cfg.Listen
+		if addr == "" {
+			addr = cfg.Host + ":" + strconv.Itoa(cfg.Port)
+		}
+		return net.Listen("tcp", addr)
+	}
+	// A socket left behind by an unclean exit would make Listen fail; only
+	// sockets are removed so a misconfigured path cannot delete a file
+	if fi, err := os.Lstat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, cfg.ListenMode); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
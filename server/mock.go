@@ -0,0 +1,44 @@
+package server
+
+import (
+	"log/slog"
+
+	"gopenbridge/config"
+	"gopenbridge/providers/mock"
+)
+
+// startMock starts the built-in mock upstream for cfg.MockUpstream and
+// points cfg at it.
+func startMock(cfg *config.Config) error {
+	var models []string
+	for _, m := range []string{cfg.Model, cfg.DefaultModel, cfg.SmallModel} {
+		if m != "" {
+			models = append(models, m)
+		}
+	}
+	baseURL, _, err := mock.Start(mock.Options{
+		Reply:      cfg.MockReply,
+		Latency:    cfg.MockLatency,
+		ChunkDelay: cfg.MockChunkDelay,
+		ErrorRate:  cfg.MockErrorRate,
+		Models:     models,
+	})
+	if err != nil {
+		return err
+	}
+	useMock(cfg, baseURL)
+	slog.Info("Serving requests from the mock upstream", "base_url", baseURL)
+	return nil
+}
+
+// useMock sends every request of cfg to the mock upstream at baseURL,
+// dropping the configured provider profiles, routes and failover.
+func useMock(cfg *config.Config, baseURL string) {
+	cfg.BaseURL = baseURL
+	cfg.Provider = "openai"
+	cfg.APIKey = "mock"
+	cfg.APIKeys = nil
+	cfg.Providers = nil
+	cfg.Routes = nil
+	cfg.Failover = nil
+}
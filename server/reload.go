@@ -0,0 +1,82 @@
+package server
+
+import (
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"gopenbridge/config"
+)
+
+// reloadPollInterval is how often the config file is checked for changes.
+const reloadPollInterval = 2 * time.Second
+
+// reloader is a component that can switch to a new configuration.
+type reloader interface {
+	Reload(cfg *config.Config) error
+}
+
+// watchConfig reloads the configuration on SIGHUP and, when cfg.Reload is
+// set, whenever the config file changes. Model mappings, keys and provider
+// settings take effect for new requests; the listener, TLS, server
+// timeouts, database and logging settings need a restart.
+func watchConfig(cfg *config.Config, targets ...reloader) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	var tick <-chan time.Time
+	path := config.FilePath()
+	if cfg.Reload && path != "" {
+		tick = time.NewTicker(reloadPollInterval).C
+		slog.Info("Watching config file for changes", "path", path)
+	}
+	modTime := fileModTime(path)
+	for {
+		select {
+		case <-hup:
+			slog.Info("Received SIGHUP, reloading config")
+		case <-tick:
+			mt := fileModTime(path)
+			if mt.Equal(modTime) {
+				continue
+			}
+			modTime = mt
+			slog.Info("Config file changed, reloading", "path", path)
+		}
+		if err := reloadConfig(cfg, targets...); err != nil {
+			slog.Error("Failed to reload config, keeping the current one", "error", err)
+		}
+	}
+}
+
+// reloadConfig loads the configuration again and hands it to targets. A
+// config that fails to load is returned as an error and not applied, so a
+// half-saved file does not replace the running settings with defaults.
+func reloadConfig(cfg *config.Config, targets ...reloader) error {
+	next, err := config.LoadConfig()
+	if err != nil {
+		return err
+	}
+	// Command line overrides still apply
+	next.Host, next.Port = cfg.Host, cfg.Port
+	if cfg.MockUpstream {
+		useMock(next, cfg.BaseURL)
+	}
+	for _, t := range targets {
+		if err := t.Reload(next); err != nil {
+			slog.Error("Failed to apply reloaded config", "error", err)
+		}
+	}
+	slog.Info("Config reloaded")
+	return nil
+}
+
+// fileModTime returns the modification time of path, or the zero time.
+func fileModTime(path string) time.Time {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return fi.ModTime()
+}
@@ -0,0 +1,51 @@
+package server
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"gopenbridge/config"
+)
+
+// recordingReloader keeps the configs it is asked to switch to.
+type recordingReloader struct {
+	got []*config.Config
+}
+
+func (r *recordingReloader) Reload(cfg *config.Config) error {
+	r.got = append(r.got, cfg)
+	return nil
+}
+
+func TestReloadKeepsConfigWhenFileIsInvalid(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	t.Setenv("HOME", dir)
+	valid := "auth_keys: secret1\nbase_url: https://api.openai.com/v1\n"
+	if err := os.WriteFile("gopenbridge.yaml", []byte(valid), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &recordingReloader{}
+	if err := reloadConfig(cfg, r); err != nil {
+		t.Fatalf("reload of a valid file: %v", err)
+	}
+	if len(r.got) != 1 || !reflect.DeepEqual(r.got[0].AuthKeys, []string{"secret1"}) {
+		t.Fatalf("reloaded configs = %v, want one with the file's auth keys", r.got)
+	}
+
+	// A half-saved edit must not drop the auth keys and upstream
+	if err := os.WriteFile("gopenbridge.yaml", []byte(valid+"retry:\n  on: [429\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := reloadConfig(cfg, r); err == nil {
+		t.Fatal("reload of an invalid file succeeded")
+	}
+	if len(r.got) != 1 {
+		t.Errorf("invalid config applied: auth_keys %v, base_url %q", r.got[1].AuthKeys, r.got[1].BaseURL)
+	}
+}
@@ -1,10 +1,13 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
+	"gopenbridge/admin"
 	"gopenbridge/config"
 	"gopenbridge/proxy"
-	"log"
+	"gopenbridge/version"
+	"log/slog"
 	"net/http"
 	"strconv"
 )
@@ -12,8 +15,12 @@ import (
 // StartServer starts HTTP server on given address.
 // StartServer starts HTTP server using configuration.
 func StartServer(cfg *config.Config) error {
-	addr := cfg.Host + ":" + strconv.Itoa(cfg.Port)
-
+	if cfg.MockUpstream {
+		if err := startMock(cfg); err != nil {
+			return err
+		}
+	}
+	build := version.Get()
 	mux := http.NewServeMux()
 
 	// Root endpoint serves rendered homepage template
@@ -41,6 +48,7 @@ body { font-family: Arial; max-width: 800px; margin: 40px auto; padding: 20px; }
     <h2>Status: Running</h2>
     <p>Proxy listening on ` + cfg.Host + `:` + strconv.Itoa(cfg.Port) + `</p>
     <p>Model: ` + cfg.Model + `</p>
+    <p>Version: ` + build.String() + `</p>
 </div>
 </body>
 </html>`
@@ -50,14 +58,72 @@ body { font-family: Arial; max-width: 800px; margin: 40px auto; padding: 20px; }
 	// Health endpoint
 	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{"status": "healthy", "model": cfg.Model})
+		json.NewEncoder(w).Encode(map[string]interface{}{"status": "healthy", "model": cfg.Model, "version": build.Version, "commit": build.Commit, "build_date": build.Date})
 	})
 
 	// Chat proxy for messages endpoint (Anthropic -> OpenAI)
 	chatProxy := proxy.NewChatProxy(cfg)
 	mux.Handle("/v1/messages", chatProxy)
+	mux.HandleFunc("/v1/complete", chatProxy.ServeComplete)
+	mux.HandleFunc("/v1/chat/completions", chatProxy.ServeChatCompletions)
+	mux.HandleFunc("/metrics", chatProxy.ServeMetrics)
+	mux.HandleFunc("/v1/models", chatProxy.ServeModels)
+	mux.HandleFunc("/v1/models/", chatProxy.ServeModels)
+	mux.HandleFunc("/v1/messages/batches", chatProxy.ServeBatches)
+	mux.HandleFunc("/v1/messages/batches/", chatProxy.ServeBatches)
+	reloaders := []reloader{chatProxy}
+	chatProxy.StartBatchWorkers(context.Background())
+	chatProxy.StartJanitor(context.Background())
+	if cfg.ValidateModels {
+		go chatProxy.ValidateModels(context.Background())
+	}
+
+	// Request log dashboard
+	if cfg.AdminEnabled {
+		if len(cfg.AuthKeys) == 0 {
+			slog.Warn("The admin dashboard shows stored prompts to anyone who can reach the server; set auth_keys to require a key")
+		}
+		adminHandler, err := admin.New(cfg, chatProxy.Logs(), chatProxy)
+		if err != nil {
+			return err
+		}
+		mux.Handle("/admin", adminHandler)
+		mux.Handle("/admin/", adminHandler)
+		reloaders = append(reloaders, adminHandler)
+	}
+	go watchConfig(cfg, reloaders...)
+
+	tlsCfg, err := tlsConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	ln, err := listen(cfg)
+	if err != nil {
+		return err
+	}
 
 	// Start HTTP server
-	log.Printf("Starting server on %s", addr)
-	return http.ListenAndServe(addr, mux)
+	slog.Info("Starting server", "addr", ln.Addr().String(), "tls", tlsCfg != nil, "version", build.Header())
+	srv := &http.Server{
+		Handler:      versionHeader(build, proxy.DecompressRequests(mux)),
+		ReadTimeout:  cfg.ServerReadTimeout,
+		WriteTimeout: cfg.ServerWriteTimeout,
+		IdleTimeout:  cfg.ServerIdleTimeout,
+		TLSConfig:    tlsCfg,
+	}
+	if tlsCfg != nil {
+		return srv.ServeTLS(ln, "", "")
+	}
+	return srv.Serve(ln)
+}
+
+// versionHeader reports the running build on every response as
+// X-Gopenbridge-Version, so bug reports can name it.
+func versionHeader(build version.Info, next http.Handler) http.Handler {
+	value := build.Header()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Gopenbridge-Version", value)
+		next.ServeHTTP(w, r)
+	})
 }
@@ -0,0 +1,183 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxBatch flushes early once this many spans are queued.
+	maxBatch = 512
+	// maxQueue drops spans beyond this many when the collector falls behind.
+	maxQueue = 4096
+	// flushInterval is how often queued spans are exported.
+	flushInterval = 5 * time.Second
+)
+
+// Tracer samples spans and exports them in batches to an OTLP/HTTP
+// collector using the JSON encoding.
+type Tracer struct {
+	endpoint   string
+	service    string
+	sampleRate float64
+	client     *http.Client
+
+	mu    sync.Mutex
+	queue []*Span
+	kick  chan struct{}
+}
+
+// New returns a Tracer exporting to endpoint, an OTLP/HTTP base URL such as
+// http://localhost:4318, or nil when endpoint is empty. sampleRate is the
+// fraction of new traces recorded; remote parents' decisions are honored.
+func New(endpoint, service string, sampleRate float64) *Tracer {
+	if endpoint == "" {
+		return nil
+	}
+	endpoint = strings.TrimRight(endpoint, "/")
+	if !strings.HasSuffix(endpoint, "/v1/traces") {
+		endpoint += "/v1/traces"
+	}
+	t := &Tracer{
+		endpoint:   endpoint,
+		service:    service,
+		sampleRate: sampleRate,
+		client:     &http.Client{Timeout: 10 * time.Second},
+		kick:       make(chan struct{}, 1),
+	}
+	go t.loop()
+	return t
+}
+
+// enqueue queues s for the next export.
+func (t *Tracer) enqueue(s *Span) {
+	t.mu.Lock()
+	if len(t.queue) < maxQueue {
+		t.queue = append(t.queue, s)
+	}
+	full := len(t.queue) >= maxBatch
+	t.mu.Unlock()
+	if full {
+		select {
+		case t.kick <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// loop exports queued spans periodically or when a batch fills up.
+func (t *Tracer) loop() {
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-t.kick:
+		}
+		t.Flush()
+	}
+}
+
+// Flush exports all queued spans now.
+func (t *Tracer) Flush() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	batch := t.queue
+	t.queue = nil
+	t.mu.Unlock()
+	if len(batch) == 0 {
+		return
+	}
+	body, err := json.Marshal(t.encode(batch))
+	if err != nil {
+		slog.Error("Failed to encode trace spans", "error", err)
+		return
+	}
+	res, err := t.client.Post(t.endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		slog.Warn("Failed to export trace spans", "spans", len(batch), "error", err)
+		return
+	}
+	res.Body.Close()
+	if res.StatusCode >= 300 {
+		slog.Warn("Failed to export trace spans", "spans", len(batch), "status", res.Status)
+	}
+}
+
+// encode builds an OTLP ExportTraceServiceRequest in its JSON mapping.
+func (t *Tracer) encode(batch []*Span) map[string]interface{} {
+	spans := make([]interface{}, 0, len(batch))
+	for _, s := range batch {
+		s.mu.Lock()
+		span := map[string]interface{}{
+			"traceId":           hex.EncodeToString(s.sc.traceID[:]),
+			"spanId":            hex.EncodeToString(s.sc.spanID[:]),
+			"name":              s.name,
+			"kind":              int(s.kind),
+			"startTimeUnixNano": strconv.FormatInt(s.start.UnixNano(), 10),
+			"endTimeUnixNano":   strconv.FormatInt(s.end.UnixNano(), 10),
+			"attributes":        encodeAttrs(s.attrs),
+		}
+		if s.parentID != [8]byte{} {
+			span["parentSpanId"] = hex.EncodeToString(s.parentID[:])
+		}
+		if s.errMsg != "" {
+			span["status"] = map[string]interface{}{"code": 2, "message": s.errMsg}
+		}
+		s.mu.Unlock()
+		spans = append(spans, span)
+	}
+	return map[string]interface{}{
+		"resourceSpans": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{
+				"attributes": encodeAttrs(map[string]interface{}{"service.name": t.service}),
+			},
+			"scopeSpans": []interface{}{map[string]interface{}{
+				"scope": map[string]interface{}{"name": t.service},
+				"spans": spans,
+			}},
+		}},
+	}
+}
+
+// encodeAttrs converts attributes to OTLP KeyValue objects.
+func encodeAttrs(attrs map[string]interface{}) []interface{} {
+	out := make([]interface{}, 0, len(attrs))
+	for k, v := range attrs {
+		var val map[string]interface{}
+		switch x := v.(type) {
+		case string:
+			val = map[string]interface{}{"stringValue": x}
+		case bool:
+			val = map[string]interface{}{"boolValue": x}
+		case int:
+			val = map[string]interface{}{"intValue": strconv.Itoa(x)}
+		case int64:
+			val = map[string]interface{}{"intValue": strconv.FormatInt(x, 10)}
+		case float64:
+			val = map[string]interface{}{"doubleValue": x}
+		default:
+			val = map[string]interface{}{"stringValue": fmtValue(v)}
+		}
+		out = append(out, map[string]interface{}{"key": k, "value": val})
+	}
+	return out
+}
+
+// fmtValue renders an arbitrary attribute value as a string.
+func fmtValue(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
@@ -0,0 +1,142 @@
+// Package tracing records request spans and exports them to an OpenTelemetry
+// collector over OTLP/HTTP, without pulling in the OpenTelemetry SDK.
+//
+// A nil *Tracer is valid and records nothing, so callers need no checks when
+// tracing is disabled.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	mrand "math/rand/v2"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SpanKind mirrors the OTLP span kinds used by the proxy.
+type SpanKind int
+
+// Span kinds, numbered as in the OTLP protocol.
+const (
+	KindInternal SpanKind = 1
+	KindServer   SpanKind = 2
+	KindClient   SpanKind = 3
+)
+
+// spanContext identifies a span and carries the sampling decision.
+type spanContext struct {
+	traceID [16]byte
+	spanID  [8]byte
+	sampled bool
+}
+
+// Span is one timed operation. Methods on a nil or unsampled Span are no-ops.
+type Span struct {
+	tracer   *Tracer
+	sc       spanContext
+	parentID [8]byte
+	name     string
+	kind     SpanKind
+	start    time.Time
+	end      time.Time
+	attrs    map[string]interface{}
+	errMsg   string
+	mu       sync.Mutex
+}
+
+type ctxKey struct{}
+
+// Start begins a span named name as a child of the span or remote parent in
+// ctx, returning a context carrying the new span.
+func (t *Tracer) Start(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+	s := &Span{tracer: t, name: name, kind: kind, start: time.Now()}
+	if parent, ok := ctx.Value(ctxKey{}).(spanContext); ok {
+		s.sc.traceID = parent.traceID
+		s.sc.sampled = parent.sampled
+		s.parentID = parent.spanID
+	} else {
+		rand.Read(s.sc.traceID[:])
+		s.sc.sampled = mrand.Float64() < t.sampleRate
+	}
+	rand.Read(s.sc.spanID[:])
+	return context.WithValue(ctx, ctxKey{}, s.sc), s
+}
+
+// SetAttr records an attribute on the span.
+func (s *Span) SetAttr(key string, value interface{}) {
+	if s == nil || !s.sc.sampled {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.attrs == nil {
+		s.attrs = make(map[string]interface{})
+	}
+	s.attrs[key] = value
+}
+
+// SetError marks the span as failed with err. A nil err is ignored.
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil || !s.sc.sampled {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.errMsg = err.Error()
+}
+
+// End finishes the span and queues it for export.
+func (s *Span) End() {
+	if s == nil || !s.sc.sampled {
+		return
+	}
+	s.mu.Lock()
+	s.end = time.Now()
+	s.mu.Unlock()
+	s.tracer.enqueue(s)
+}
+
+// Inject adds a W3C traceparent header for the span in ctx to h.
+func Inject(ctx context.Context, h http.Header) {
+	sc, ok := ctx.Value(ctxKey{}).(spanContext)
+	if !ok {
+		return
+	}
+	flags := "00"
+	if sc.sampled {
+		flags = "01"
+	}
+	h.Set("traceparent", fmt.Sprintf("00-%s-%s-%s", hex.EncodeToString(sc.traceID[:]), hex.EncodeToString(sc.spanID[:]), flags))
+}
+
+// Extract returns ctx with the remote parent from an incoming traceparent
+// header in h, if present and valid.
+func Extract(ctx context.Context, h http.Header) context.Context {
+	parts := strings.Split(strings.TrimSpace(h.Get("traceparent")), "-")
+	if len(parts) != 4 || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return ctx
+	}
+	var sc spanContext
+	if _, err := hex.Decode(sc.traceID[:], []byte(parts[1])); err != nil {
+		return ctx
+	}
+	if _, err := hex.Decode(sc.spanID[:], []byte(parts[2])); err != nil {
+		return ctx
+	}
+	if sc.traceID == [16]byte{} || sc.spanID == [8]byte{} {
+		return ctx
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return ctx
+	}
+	sc.sampled = flags[0]&1 == 1
+	return context.WithValue(ctx, ctxKey{}, sc)
+}
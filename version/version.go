@@ -0,0 +1,97 @@
+// Package version reports which build of gopenbridge is running. Release
+// builds set Version, Commit and Date with -ldflags "-X"; other builds fall
+// back to what the Go toolchain records in the binary.
+package version
+
+import (
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
+// Set at build time, e.g.
+//
+//	go build -ldflags "-X gopenbridge/version.Version=v1.2.0 -X gopenbridge/version.Commit=$(git rev-parse HEAD)"
+var (
+	Version = ""
+	Commit  = ""
+	Date    = ""
+)
+
+// Info describes a build.
+type Info struct {
+	Version   string `json:"version"`          // Release version, "dev" when unknown
+	Commit    string `json:"commit,omitempty"` // VCS revision, with "-dirty" for uncommitted changes
+	Date      string `json:"date,omitempty"`   // Build or commit time, RFC 3339
+	GoVersion string `json:"go_version"`
+}
+
+// Get returns the running build, from the -ldflags variables where set and
+// the binary's build info otherwise.
+func Get() Info {
+	info := Info{Version: Version, Commit: Commit, Date: Date, GoVersion: runtime.Version()}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		if info.Version == "" && bi.Main.Version != "" && bi.Main.Version != "(devel)" {
+			info.Version = bi.Main.Version
+		}
+		var modified bool
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = s.Value
+				}
+			case "vcs.time":
+				if info.Date == "" {
+					info.Date = s.Value
+				}
+			case "vcs.modified":
+				modified = s.Value == "true"
+			}
+		}
+		if modified && Commit == "" && info.Commit != "" {
+			info.Commit += "-dirty"
+		}
+	}
+	if info.Version == "" {
+		info.Version = "dev"
+	}
+	return info
+}
+
+// String formats i on one line, e.g. "v1.2.0 (commit 1a2b3c4d5e6f, built
+// 2025-01-02T03:04:05Z, go1.24.1)".
+func (i Info) String() string {
+	var details []string
+	if i.Commit != "" {
+		details = append(details, "commit "+short(i.Commit))
+	}
+	if i.Date != "" {
+		details = append(details, "built "+i.Date)
+	}
+	details = append(details, i.GoVersion)
+	return i.Version + " (" + strings.Join(details, ", ") + ")"
+}
+
+// Header is the value of the X-Gopenbridge-Version response header: the
+// version and, when known and not already part of it, the short commit.
+func (i Info) Header() string {
+	hash, _ := strings.CutSuffix(i.Commit, "-dirty")
+	if hash == "" || strings.Contains(i.Version, short(hash)) {
+		return i.Version
+	}
+	return i.Version + "+" + short(i.Commit)
+}
+
+// short abbreviates a commit hash to 12 characters, keeping a "-dirty"
+// suffix.
+func short(commit string) string {
+	hash, dirty := strings.CutSuffix(commit, "-dirty")
+	if len(hash) > 12 {
+		hash = hash[:12]
+	}
+	if dirty {
+		hash += "-dirty"
+	}
+	return hash
+}